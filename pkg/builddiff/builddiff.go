@@ -0,0 +1,289 @@
+package builddiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/pmezard/go-difflib/difflib"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+var timestampRegex = regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?\s*|\b\d{2}:\d{2}:\d{2}(\.\d+)?\b\s*`)
+
+// Build a build to compare
+type Build struct {
+	Activity *v1.PipelineActivity
+
+	// TaskRuns the TaskRuns of the build indexed by stage name
+	TaskRuns map[string]*pipelinev1.TaskRun
+
+	// Unavailable the stages whose TaskRun has been deleted so their spec and steps cannot be compared
+	Unavailable map[string]bool
+}
+
+// Change a value which differs between the builds
+type Change struct {
+	Name string
+	From string
+	To   string
+}
+
+// StageChange the status and duration of a stage in each build
+type StageChange struct {
+	Name         string
+	FromStatus   v1.ActivityStatusType
+	ToStatus     v1.ActivityStatusType
+	FromDuration time.Duration
+	ToDuration   time.Duration
+}
+
+// SpecChange the unified diff of the rendered TaskRun of a stage
+type SpecChange struct {
+	Stage string
+	Diff  string
+}
+
+// Diff the differences between two builds
+type Diff struct {
+	Commit []Change
+	Stages []StageChange
+	Specs  []SpecChange
+
+	// Unavailable the stages whose spec could not be compared as the TaskRun of either build has been deleted
+	Unavailable []string
+}
+
+// StepRef refers to a step of a build and the container which ran it
+type StepRef struct {
+	Stage     string
+	Step      string
+	PodName   string
+	Container string
+}
+
+// Compare compares the commit, stages and rendered TaskRuns of the builds
+func Compare(from, to *Build) (*Diff, error) {
+	answer := &Diff{}
+	fs := &from.Activity.Spec
+	ts := &to.Activity.Spec
+	for _, c := range []Change{
+		{Name: "SHA", From: fs.LastCommitSHA, To: ts.LastCommitSHA},
+		{Name: "Base SHA", From: fs.BaseSHA, To: ts.BaseSHA},
+		{Name: "Author", From: fs.Author, To: ts.Author},
+		{Name: "Message", From: firstLine(fs.LastCommitMessage), To: firstLine(ts.LastCommitMessage)},
+	} {
+		if c.From != c.To {
+			answer.Commit = append(answer.Commit, c)
+		}
+	}
+
+	fromStages := stages(from.Activity)
+	toStages := stages(to.Activity)
+	for _, name := range StageNames(from, to) {
+		c := StageChange{Name: name}
+		if s := fromStages[name]; s != nil {
+			c.FromStatus = s.Status
+			c.FromDuration = duration(&s.CoreActivityStep)
+		}
+		if s := toStages[name]; s != nil {
+			c.ToStatus = s.Status
+			c.ToDuration = duration(&s.CoreActivityStep)
+		}
+		answer.Stages = append(answer.Stages, c)
+
+		if from.Unavailable[name] || to.Unavailable[name] {
+			answer.Unavailable = append(answer.Unavailable, name)
+			continue
+		}
+		fromText := RenderTaskRun(from.TaskRuns[name])
+		toText := RenderTaskRun(to.TaskRuns[name])
+		if fromText == toText {
+			continue
+		}
+		text, err := UnifiedDiff("a/"+name, "b/"+name, fromText, toText)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff stage %s: %w", name, err)
+		}
+		answer.Specs = append(answer.Specs, SpecChange{Stage: name, Diff: text})
+	}
+	return answer, nil
+}
+
+// StageNames returns the names of the stages of both builds in the order they ran
+func StageNames(builds ...*Build) []string {
+	var answer []string
+	found := map[string]bool{}
+	add := func(name string) {
+		if name != "" && !found[name] {
+			found[name] = true
+			answer = append(answer, name)
+		}
+	}
+	for _, b := range builds {
+		for i := range b.Activity.Spec.Steps {
+			if s := b.Activity.Spec.Steps[i].Stage; s != nil {
+				add(s.Name)
+			}
+		}
+	}
+	for _, b := range builds {
+		var names []string
+		for name := range b.TaskRuns {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name)
+		}
+	}
+	return answer
+}
+
+// FirstFailedStep returns the first step of the build which terminated with a non zero exit code or nil
+func (b *Build) FirstFailedStep() *StepRef {
+	for _, stage := range StageNames(b) {
+		tr := b.TaskRuns[stage]
+		if tr == nil {
+			continue
+		}
+		for i := range tr.Status.Steps {
+			step := &tr.Status.Steps[i]
+			if step.Terminated != nil && step.Terminated.ExitCode != 0 {
+				return &StepRef{Stage: stage, Step: step.Name, PodName: tr.Status.PodName, Container: step.Container}
+			}
+		}
+	}
+	return nil
+}
+
+// FindStep returns the given step of the stage of the build or nil if it did not run
+func (b *Build) FindStep(stage, step string) *StepRef {
+	tr := b.TaskRuns[stage]
+	if tr == nil {
+		return nil
+	}
+	for i := range tr.Status.Steps {
+		s := &tr.Status.Steps[i]
+		if s.Name == step {
+			return &StepRef{Stage: stage, Step: step, PodName: tr.Status.PodName, Container: s.Container}
+		}
+	}
+	return nil
+}
+
+// RenderTaskRun renders the params of the TaskRun and the images, env and scripts of the steps from its resolved
+// Status.TaskSpec as stable text which can be diffed
+func RenderTaskRun(tr *pipelinev1.TaskRun) string {
+	if tr == nil {
+		return ""
+	}
+	buf := &strings.Builder{}
+	if len(tr.Spec.Params) > 0 {
+		buf.WriteString("params:\n")
+		params := append(pipelinev1.Params{}, tr.Spec.Params...)
+		sort.SliceStable(params, func(i, j int) bool {
+			return params[i].Name < params[j].Name
+		})
+		for i := range params {
+			value, _ := json.Marshal(params[i].Value)
+			fmt.Fprintf(buf, "  %s: %s\n", params[i].Name, string(value))
+		}
+	}
+
+	imageIDs := map[string]string{}
+	for i := range tr.Status.Steps {
+		imageIDs[tr.Status.Steps[i].Name] = tr.Status.Steps[i].ImageID
+	}
+	spec := tr.Status.TaskSpec
+	if spec == nil || len(spec.Steps) == 0 {
+		return buf.String()
+	}
+	buf.WriteString("steps:\n")
+	for i := range spec.Steps {
+		step := &spec.Steps[i]
+		fmt.Fprintf(buf, "- name: %s\n", step.Name)
+		fmt.Fprintf(buf, "  image: %s\n", step.Image)
+		if imageID := imageIDs[step.Name]; imageID != "" {
+			fmt.Fprintf(buf, "  imageID: %s\n", imageID)
+		}
+		if len(step.Command) > 0 {
+			fmt.Fprintf(buf, "  command: %s\n", strings.Join(step.Command, " "))
+		}
+		if len(step.Args) > 0 {
+			fmt.Fprintf(buf, "  args: %s\n", strings.Join(step.Args, " "))
+		}
+		if step.WorkingDir != "" {
+			fmt.Fprintf(buf, "  workingDir: %s\n", step.WorkingDir)
+		}
+		if len(step.Env) > 0 {
+			buf.WriteString("  env:\n")
+			env := append(step.Env[:0:0], step.Env...)
+			sort.SliceStable(env, func(i, j int) bool {
+				return env[i].Name < env[j].Name
+			})
+			for j := range env {
+				value := env[j].Value
+				if env[j].ValueFrom != nil {
+					value = "<valueFrom>"
+				}
+				fmt.Fprintf(buf, "    %s: %s\n", env[j].Name, value)
+			}
+		}
+		if step.Script != "" {
+			buf.WriteString("  script: |\n")
+			for _, line := range strings.Split(strings.TrimRight(step.Script, "\n"), "\n") {
+				fmt.Fprintf(buf, "    %s\n", line)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// StripTimestamps removes the timestamps from the log so that logs of different builds can be compared
+func StripTimestamps(text string) string {
+	return timestampRegex.ReplaceAllString(text, "")
+}
+
+// UnifiedDiff returns the unified diff of the text or an empty string if they are equal
+func UnifiedDiff(fromFile, toFile, from, to string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return difflib.SplitLines(strings.TrimSuffix(text, "\n"))
+}
+
+func stages(pa *v1.PipelineActivity) map[string]*v1.StageActivityStep {
+	answer := map[string]*v1.StageActivityStep{}
+	for i := range pa.Spec.Steps {
+		if s := pa.Spec.Steps[i].Stage; s != nil {
+			answer[s.Name] = s
+		}
+	}
+	return answer
+}
+
+func duration(s *v1.CoreActivityStep) time.Duration {
+	if s.StartedTimestamp == nil || s.CompletedTimestamp == nil {
+		return 0
+	}
+	return s.CompletedTimestamp.Sub(s.StartedTimestamp.Time)
+}
+
+func firstLine(text string) string {
+	return strings.TrimSpace(strings.SplitN(text, "\n", 2)[0])
+}
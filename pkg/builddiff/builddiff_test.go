@@ -0,0 +1,126 @@
+//go:build unit
+// +build unit
+
+package builddiff_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/builddiff"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCompare(t *testing.T) {
+	from := newBuild("abc123", "jstrachan", "golang:1.21", "make build", 60, v1.ActivityStatusTypeSucceeded, 0)
+	to := newBuild("def456", "jstrachan", "golang:1.22", "make build\nmake test", 90, v1.ActivityStatusTypeFailed, 2)
+
+	diff, err := builddiff.Compare(from, to)
+	require.NoError(t, err)
+
+	assert.Equal(t, []builddiff.Change{{Name: "SHA", From: "abc123", To: "def456"}}, diff.Commit)
+
+	require.Len(t, diff.Stages, 1)
+	stage := diff.Stages[0]
+	assert.Equal(t, "build", stage.Name)
+	assert.Equal(t, v1.ActivityStatusTypeSucceeded, stage.FromStatus)
+	assert.Equal(t, v1.ActivityStatusTypeFailed, stage.ToStatus)
+	assert.Equal(t, time.Minute, stage.FromDuration)
+	assert.Equal(t, 90*time.Second, stage.ToDuration)
+
+	require.Len(t, diff.Specs, 1)
+	text := diff.Specs[0].Diff
+	t.Logf("got spec diff:\n%s\n", text)
+	assert.Contains(t, text, "--- a/build")
+	assert.Contains(t, text, "-  image: golang:1.21")
+	assert.Contains(t, text, "+  image: golang:1.22")
+	assert.Contains(t, text, "+    make test")
+	assert.Contains(t, text, "\n     GOOS: linux\n", "unchanged env should only be context")
+
+	assert.Nil(t, from.FirstFailedStep())
+	failed := to.FirstFailedStep()
+	require.NotNil(t, failed)
+	assert.Equal(t, builddiff.StepRef{Stage: "build", Step: "compile", PodName: "build-pod", Container: "step-compile"}, *failed)
+	assert.Equal(t, failed, to.FindStep("build", "compile"))
+	assert.Nil(t, from.FindStep("build", "missing"))
+
+	delete(from.TaskRuns, "build")
+	from.Unavailable = map[string]bool{"build": true}
+	diff, err = builddiff.Compare(from, to)
+	require.NoError(t, err)
+	require.Len(t, diff.Stages, 1)
+	assert.Empty(t, diff.Specs, "should not compare the spec of a stage whose TaskRun has been deleted")
+	assert.Equal(t, []string{"build"}, diff.Unavailable)
+}
+
+func TestStripTimestamps(t *testing.T) {
+	text := builddiff.StripTimestamps("2024-01-02T10:00:00.123Z building\n[10:00:01] done at 2024-01-02 10:00:02+01:00 ok\n")
+	assert.Equal(t, "building\n[] done at ok\n", text)
+}
+
+func newBuild(sha, author, image, script string, seconds int, status v1.ActivityStatusType, exitCode int32) *builddiff.Build {
+	start := metav1.NewTime(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(start.Add(time.Duration(seconds) * time.Second))
+	return &builddiff.Build{
+		Activity: &v1.PipelineActivity{
+			Spec: v1.PipelineActivitySpec{
+				LastCommitSHA: sha,
+				Author:        author,
+				Status:        status,
+				Steps: []v1.PipelineActivityStep{
+					{
+						Kind: v1.ActivityStepKindTypeStage,
+						Stage: &v1.StageActivityStep{
+							CoreActivityStep: v1.CoreActivityStep{
+								Name:               "build",
+								Status:             status,
+								StartedTimestamp:   &start,
+								CompletedTimestamp: &end,
+							},
+						},
+					},
+				},
+			},
+		},
+		TaskRuns: map[string]*pipelinev1.TaskRun{
+			"build": {
+				Spec: pipelinev1.TaskRunSpec{
+					Params: pipelinev1.Params{
+						{Name: "version", Value: *pipelinev1.NewStructuredValues("1.0.0")},
+					},
+				},
+				Status: pipelinev1.TaskRunStatus{
+					TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+						PodName: "build-pod",
+						Steps: []pipelinev1.StepState{
+							{
+								Name:      "compile",
+								Container: "step-compile",
+								ContainerState: corev1.ContainerState{
+									Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+								},
+							},
+						},
+						TaskSpec: &pipelinev1.TaskSpec{
+							Steps: []pipelinev1.Step{
+								{
+									Name:   "compile",
+									Image:  image,
+									Script: script,
+									Env: []corev1.EnvVar{
+										{Name: "GOOS", Value: "linux"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
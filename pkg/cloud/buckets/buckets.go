@@ -1,9 +1,11 @@
 package buckets
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
-
 	"io"
 	"net/http"
 	"net/url"
@@ -41,12 +43,77 @@ func CreateBucketURL(name, kind, cloudProvider string) (string, error) {
 	return kind + "://" + name, nil
 }
 
+// S3Options the options used to access S3 compatible storage such as MinIO, OCI Object Storage or Alibaba OSS
+type S3Options struct {
+	// Endpoint the host (and optional port) of the S3 compatible service
+	Endpoint string
+	// Region the region of the bucket; S3 compatible services often ignore it but the AWS SDK requires one
+	Region string
+	// PathStyle uses path style addressing (http://host/bucket/key) rather than virtual hosted buckets
+	PathStyle bool
+	// DisableHTTPS uses plain HTTP to talk to the endpoint, e.g. for an in cluster MinIO service
+	DisableHTTPS bool
+}
+
+// S3CompatibleDefaultRegion the region used for S3 compatible endpoints if none is specified
+const S3CompatibleDefaultRegion = "us-east-1"
+
+// CreateS3CompatibleBucketURL creates a go-cloud URL to a bucket on an S3 compatible service
+func CreateS3CompatibleBucketURL(name string, o *S3Options) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("no bucket name provided")
+	}
+	return ApplyS3Options("s3://"+name, o)
+}
+
+// ApplyS3Options adds the endpoint, region and path style query arguments to the given s3 bucket URL
+// so that S3 compatible services can be used
+func ApplyS3Options(bucketURL string, o *S3Options) (string, error) {
+	if o == nil {
+		return bucketURL, nil
+	}
+	u, err := url.Parse(bucketURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse bucket URL %s: %w", bucketURL, err)
+	}
+	if u.Scheme != "s3" {
+		return "", fmt.Errorf("cannot apply S3 options to bucket URL %s as it does not use the s3 scheme", bucketURL)
+	}
+	q := u.Query()
+	region := o.Region
+	if o.Endpoint != "" {
+		endpoint := o.Endpoint
+		if !strings.Contains(endpoint, "://") {
+			if o.DisableHTTPS {
+				endpoint = "http://" + endpoint
+			} else {
+				endpoint = "https://" + endpoint
+			}
+		}
+		q.Set("endpoint", endpoint)
+		if region == "" {
+			region = S3CompatibleDefaultRegion
+		}
+	}
+	if region != "" {
+		q.Set("region", region)
+	}
+	if o.PathStyle {
+		q.Set("use_path_style", "true")
+	}
+	if o.DisableHTTPS {
+		q.Set("disable_https", "true")
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
 // KubeProviderToBucketScheme returns the bucket scheme for the cloud provider
 func KubeProviderToBucketScheme(provider string) string {
 	switch provider {
 	case cloud.AKS:
 		return "azblob"
-	case cloud.AWS, cloud.EKS:
+	case cloud.AWS, cloud.EKS, cloud.OKE, cloud.ALIBABA:
 		return "s3"
 	case cloud.GKE:
 		return "gs"
@@ -101,7 +168,9 @@ func ReadHTTPURL(u string, headerFunc func(*http.Request), timeout time.Duration
 
 // ReadBucketURL reads the content of a bucket URL of the for 's3://bucketName/foo/bar/whatnot.txt?param=123'
 // where any of the query arguments are applied to the underlying Bucket URL and the path is extracted and resolved
-// within the bucket
+// within the bucket.
+//
+// Objects with a .gz suffix or a gzip Content-Encoding are decompressed transparently
 func ReadBucketURL(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
 	bucketURL, key := SplitBucketURL(u)
 
@@ -109,11 +178,32 @@ func ReadBucketURL(ctx context.Context, u *url.URL) (io.ReadCloser, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open bucket %s: %w", bucketURL, err)
 	}
+	reader, err := ReadBlob(ctx, bucket, key)
+	if err != nil {
+		_ = bucket.Close()
+		return nil, fmt.Errorf("failed to read key %s in bucket %s: %w", key, bucketURL, err)
+	}
+	return &bucketReadCloser{ReadCloser: reader, bucket: bucket}, nil
+}
+
+// ReadBlob reads the given key from the bucket decompressing it if it is gzipped
+func ReadBlob(ctx context.Context, bucket *blob.Bucket, key string) (io.ReadCloser, error) {
+	compressed := strings.HasSuffix(key, ".gz")
+	if !compressed {
+		attrs, err := bucket.Attributes(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		compressed = strings.EqualFold(attrs.ContentEncoding, "gzip")
+	}
 	data, err := bucket.NewReader(ctx, key, nil)
 	if err != nil {
-		return data, fmt.Errorf("failed to read key %s in bucket %s: %w", key, bucketURL, err)
+		return nil, err
 	}
-	return data, nil
+	if !compressed {
+		return data, nil
+	}
+	return newGzipReadCloser(data)
 }
 
 // WriteBucketURL writes the data to a bucket URL of the for 's3://bucketName/foo/bar/whatnot.txt?param=123'
@@ -130,17 +220,57 @@ func WriteBucket(ctx context.Context, bucketURL, key string, reader io.Reader) (
 	if err != nil {
 		return fmt.Errorf("failed to open bucket %s: %w", bucketURL, err)
 	}
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read data for key %s in bucket %s: %w", key, bucketURL, err)
-	}
-	err = bucket.WriteAll(ctx, key, data, nil)
+	defer bucket.Close()
+
+	err = WriteBlob(ctx, bucket, key, reader)
 	if err != nil {
 		return fmt.Errorf("failed to write key %s in bucket %s: %w", key, bucketURL, err)
 	}
 	return nil
 }
 
+// WriteBlob streams the data to the given key in the bucket without buffering it all in memory
+func WriteBlob(ctx context.Context, bucket *blob.Bucket, key string, reader io.Reader) error {
+	// cancelling the context aborts the write so a failed copy doesn't leave a partial blob behind
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w, err := bucket.NewWriter(ctx, key, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create writer: %w", err)
+	}
+	_, err = io.Copy(w, reader)
+	if err != nil {
+		cancel()
+		_ = w.Close()
+		return fmt.Errorf("failed to copy data: %w", err)
+	}
+	return w.Close()
+}
+
+// ListBucket lists the objects in the bucket URL of the form 's3://bucketName?param=123' whose keys start with the prefix
+func ListBucket(ctx context.Context, bucketURL, prefix string) ([]*blob.ListObject, error) {
+	bucket, err := blob.OpenBucket(ctx, bucketURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bucket %s: %w", bucketURL, err)
+	}
+	defer bucket.Close()
+
+	var answer []*blob.ListObject
+	it := bucket.List(&blob.ListOptions{Prefix: prefix})
+	for {
+		obj, err := it.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return answer, fmt.Errorf("failed to list bucket %s with prefix %s: %w", bucketURL, prefix, err)
+		}
+		answer = append(answer, obj)
+	}
+	return answer, nil
+}
+
 // SplitBucketURL splits the full bucket URL into the URL to open the bucket and the file name to refer to
 // within the bucket
 func SplitBucketURL(u *url.URL) (string, string) {
@@ -148,3 +278,53 @@ func SplitBucketURL(u *url.URL) (string, string) {
 	u2.Path = ""
 	return u2.String(), strings.TrimPrefix(u.Path, "/")
 }
+
+// bucketReadCloser closes the bucket once the reader is closed
+type bucketReadCloser struct {
+	io.ReadCloser
+	bucket *blob.Bucket
+}
+
+func (r *bucketReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	err2 := r.bucket.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
+
+// gzipReadCloser decompresses the underlying reader closing it when done
+type gzipReadCloser struct {
+	*gzip.Reader
+	underlying io.Closer
+}
+
+// newGzipReadCloser returns a decompressing reader if the data has the gzip magic header, otherwise the data as is.
+// Some storage services transparently decompress objects stored with a gzip Content-Encoding so we can't assume
+// the payload is still compressed
+func newGzipReadCloser(data io.ReadCloser) (io.ReadCloser, error) {
+	br := bufio.NewReader(data)
+	header, err := br.Peek(2)
+	if err != nil || header[0] != 0x1f || header[1] != 0x8b {
+		return struct {
+			io.Reader
+			io.Closer
+		}{br, data}, nil
+	}
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		_ = data.Close()
+		return nil, fmt.Errorf("failed to create gzip reader: %w", err)
+	}
+	return &gzipReadCloser{Reader: gz, underlying: data}, nil
+}
+
+func (r *gzipReadCloser) Close() error {
+	err := r.Reader.Close()
+	err2 := r.underlying.Close()
+	if err == nil {
+		err = err2
+	}
+	return err
+}
@@ -1,12 +1,22 @@
 package buckets_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
 	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cloud"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cloud/buckets"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/fileblob"
+	"gocloud.dev/blob/memblob"
 )
 
 func TestSplitBucketURL(t *testing.T) {
@@ -27,3 +37,123 @@ func assertSplitBucketURL(t *testing.T, inputURL, expectedBucketURL, expectedKey
 	assert.Equal(t, expectedBucketURL, bucketURL, "for URL %s", inputURL)
 	assert.Equal(t, expectedKey, key, "for URL %s", inputURL)
 }
+
+func TestWriteAndReadBucketURL(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucketURL := "file://" + filepath.ToSlash(dir)
+
+	err := buckets.WriteBucket(ctx, bucketURL, "logs/org/repo/1.log", strings.NewReader("hello world"))
+	require.NoError(t, err, "failed to write bucket")
+
+	assertReadBlob(t, dir, "logs/org/repo/1.log", "hello world")
+
+	objects, err := buckets.ListBucket(ctx, bucketURL, "logs/org/")
+	require.NoError(t, err, "failed to list bucket")
+	require.Len(t, objects, 1)
+	assert.Equal(t, "logs/org/repo/1.log", objects[0].Key)
+}
+
+func TestReadBucketURLGzip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	bucketURL := "file://" + filepath.ToSlash(dir)
+
+	err := buckets.WriteBucket(ctx, bucketURL, "build.log.gz", bytes.NewReader(gzipData(t, "compressed by suffix")))
+	require.NoError(t, err, "failed to write bucket")
+	assertReadBlob(t, dir, "build.log.gz", "compressed by suffix")
+
+	bucket, err := fileblob.OpenBucket(dir, nil)
+	require.NoError(t, err, "failed to open bucket")
+	defer bucket.Close()
+	err = bucket.WriteAll(ctx, "build.log", gzipData(t, "compressed by encoding"), &blob.WriterOptions{ContentEncoding: "gzip"})
+	require.NoError(t, err, "failed to write gzip encoded blob")
+	assertReadBlob(t, dir, "build.log", "compressed by encoding")
+
+	// some services transparently decompress so we should not fail if the data is already decompressed
+	err = buckets.WriteBucket(ctx, bucketURL, "plain.log.gz", strings.NewReader("not really compressed"))
+	require.NoError(t, err, "failed to write bucket")
+	assertReadBlob(t, dir, "plain.log.gz", "not really compressed")
+}
+
+func TestWriteAndReadBlobMemory(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	err := buckets.WriteBlob(ctx, bucket, "foo.txt.gz", bytes.NewReader(gzipData(t, "in memory")))
+	require.NoError(t, err, "failed to write blob")
+
+	reader, err := buckets.ReadBlob(ctx, bucket, "foo.txt.gz")
+	require.NoError(t, err, "failed to read blob")
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err, "failed to read data")
+	assert.Equal(t, "in memory", string(data))
+}
+
+func TestCreateS3CompatibleBucketURL(t *testing.T) {
+	testCases := []struct {
+		name     string
+		options  *buckets.S3Options
+		expected string
+	}{
+		{
+			name:     "aws",
+			options:  &buckets.S3Options{Region: "eu-west-1"},
+			expected: "s3://mybucket?region=eu-west-1",
+		},
+		{
+			name:     "minio",
+			options:  &buckets.S3Options{Endpoint: "minio.minio.svc.cluster.local:9000", PathStyle: true, DisableHTTPS: true},
+			expected: "s3://mybucket?disable_https=true&endpoint=http%3A%2F%2Fminio.minio.svc.cluster.local%3A9000&region=us-east-1&use_path_style=true",
+		},
+		{
+			name:     "alibaba",
+			options:  &buckets.S3Options{Endpoint: "https://oss-cn-hangzhou.aliyuncs.com", Region: "oss-cn-hangzhou"},
+			expected: "s3://mybucket?endpoint=https%3A%2F%2Foss-cn-hangzhou.aliyuncs.com&region=oss-cn-hangzhou",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := buckets.CreateS3CompatibleBucketURL("mybucket", tc.options)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+
+	_, err := buckets.ApplyS3Options("gs://mybucket", &buckets.S3Options{Endpoint: "minio:9000"})
+	assert.Error(t, err, "should not apply S3 options to a GCS bucket")
+}
+
+func TestKubeProviderToBucketScheme(t *testing.T) {
+	assert.Equal(t, "gs", buckets.KubeProviderToBucketScheme(cloud.GKE))
+	assert.Equal(t, "azblob", buckets.KubeProviderToBucketScheme(cloud.AKS))
+	assert.Equal(t, "s3", buckets.KubeProviderToBucketScheme(cloud.EKS))
+	assert.Equal(t, "s3", buckets.KubeProviderToBucketScheme(cloud.OKE))
+	assert.Equal(t, "s3", buckets.KubeProviderToBucketScheme(cloud.ALIBABA))
+	assert.Equal(t, "", buckets.KubeProviderToBucketScheme(cloud.KUBERNETES))
+}
+
+func assertReadBlob(t *testing.T, dir, key, expected string) {
+	bucket, err := fileblob.OpenBucket(dir, nil)
+	require.NoError(t, err, "failed to open bucket %s", dir)
+	defer bucket.Close()
+
+	reader, err := buckets.ReadBlob(context.Background(), bucket, key)
+	require.NoError(t, err, "failed to read key %s", key)
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err, "failed to read data from %s", key)
+	assert.Equal(t, expected, string(data), "for key %s", key)
+}
+
+func gzipData(t *testing.T, text string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write([]byte(text))
+	require.NoError(t, err, "failed to gzip data")
+	require.NoError(t, w.Close(), "failed to close gzip writer")
+	return buf.Bytes()
+}
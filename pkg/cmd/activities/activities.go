@@ -4,16 +4,22 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
-	"github.com/ghodss/yaml"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/activities/repair"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scminfo"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
 	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
-	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/activities"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
@@ -27,10 +33,7 @@ import (
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/tools/cache"
-	"knative.dev/pkg/signals"
 )
 
 const (
@@ -41,17 +44,38 @@ const (
 type Options struct {
 	options.BaseOptions
 
-	Format       string
-	Namespace    string
-	Filter       string
-	BuildNumber  string
-	Watch        bool
-	Sort         bool
-	KubeClient   kubernetes.Interface
-	JXClient     versioned.Interface
-	TektonClient tektonclient.Interface
-	Out          io.Writer
-	Results      []v1.PipelineActivity
+	Format        string
+	Columns       []string
+	Template      string
+	Namespace     string
+	Filter        string
+	BuildNumber   string
+	Context       string
+	Author        string
+	Statuses      []string
+	Since         string
+	Until         string
+	LongerThan    string
+	Limit         int
+	Watch         bool
+	UntilComplete bool
+	Timeout       time.Duration
+	Exec          string
+	ExitCode      int
+	Sort          string
+	Reverse       bool
+	SCM           bool
+	ScmEnricher   scminfo.Enricher
+	CommandRunner cmdrunner.CommandRunner
+	KubeClient    kubernetes.Interface
+	JXClient      versioned.Interface
+	TektonClient  tektonclient.Interface
+	Out           io.Writer
+	Results       []v1.PipelineActivity
+	template      *template.Template
+	since         *time.Time
+	until         *time.Time
+	longerThan    time.Duration
 }
 
 var (
@@ -68,6 +92,33 @@ var (
 
 		# Watch the activities for application 'foo'
 		jx pipeline act -f foo -w
+
+		# Wait for build 3 of application 'foo' to complete and exit with its status
+		jx pipeline act -f foo --build 3 --until-complete --timeout 30m
+
+		# Run a command whenever an activity changes status
+		jx pipeline act -w --exec 'echo $JX_ACTIVITY_NAME is now $JX_ACTIVITY_STATUS'
+
+		# List the activities as JSON
+		jx pipeline act -o json
+
+		# List the status and duration of the activities for application 'foo' as CSV
+		jx pipeline act -f foo -o csv --columns name,status,duration
+
+		# List the failed or aborted activities of the last day which took longer than 10 minutes
+		jx pipeline act --status Failed --status Aborted --since 24h --longer-than 10m
+
+		# List the 10 longest activities
+		jx pipeline act --sort duration --reverse --limit 10
+
+		# List the activities with the commit message, author and pull request title from the git provider
+		jx pipeline act --scm -o wide
+
+		# List the activities using a template
+		jx pipeline act --template '{{.Name}} {{.Status}}'
+
+		# Repair the activities so they match the Tekton PipelineRuns
+		jx pipeline act repair --dry-run
 	`)
 )
 
@@ -84,20 +135,58 @@ func NewCmdActivities() (*cobra.Command, *Options) {
 		Run: func(_ *cobra.Command, _ []string) {
 			err := o.Run()
 			helper.CheckErr(err)
+			if o.ExitCode != 0 {
+				os.Exit(o.ExitCode)
+			}
 		},
 	}
 	cmd.Flags().StringVarP(&o.Filter, "filter", "f", "", "Text to filter the pipeline names")
 	cmd.Flags().StringVarP(&o.BuildNumber, "build", "", "", "The build number to filter on")
 	cmd.Flags().BoolVarP(&o.Watch, "watch", "w", false, "Whether to watch the activities for changes")
-	cmd.Flags().BoolVarP(&o.Sort, "sort", "s", false, "Sort activities by timestamp")
+	cmd.Flags().BoolVarP(&o.UntilComplete, "until-complete", "", false, "Watches the activities until they have all completed then exits with 0 if they succeeded, 1 if any failed or 2 if any were aborted")
+	cmd.Flags().DurationVarP(&o.Timeout, "timeout", "", 0, "The maximum time to wait for the activities to complete when using --until-complete")
+	cmd.Flags().StringVarP(&o.Exec, "exec", "", "", "A shell command to run whenever a watched activity changes status. The fields of the activity are passed as environment variables such as "+envPrefix+"NAME and "+envPrefix+"STATUS")
+	cmd.Flags().StringVarP(&o.Context, "context", "", "", "The context of the builds to filter on")
+	cmd.Flags().StringVarP(&o.Author, "author", "", "", "The author of the builds to filter on")
+	cmd.Flags().StringSliceVarP(&o.Statuses, "status", "", nil, "The statuses of the builds to filter on such as Running, Succeeded, Failed or Aborted. Can be specified multiple times")
+	cmd.Flags().StringVarP(&o.Since, "since", "", "", "Only include builds started after this duration ago such as 24h or this date such as 2006-01-02")
+	cmd.Flags().StringVarP(&o.Until, "until", "", "", "Only include builds started before this duration ago such as 1h or this date such as 2006-01-02")
+	cmd.Flags().StringVarP(&o.LongerThan, "longer-than", "", "", "Only include builds which took or have been running for longer than this duration such as 10m")
+	cmd.Flags().IntVarP(&o.Limit, "limit", "", 0, "The maximum number of activities to display")
+	cmd.Flags().StringVarP(&o.Sort, "sort", "s", "", "Sort the activities by: "+strings.Join(sortFields, ", ")+". Defaults to start if specified without a value")
+	cmd.Flags().Lookup("sort").NoOptDefVal = SortStart
+	cmd.Flags().BoolVarP(&o.Reverse, "reverse", "", false, "Reverses the order of the activities")
+	cmd.Flags().StringVarP(&o.Format, "output", "o", FormatTable, "The output format. Valid values are: "+strings.Join(formats, ", "))
+	cmd.Flags().StringSliceVarP(&o.Columns, "columns", "", nil, "The columns to include in the wide, json, yaml, jsonl and csv output formats. Valid values are: "+strings.Join(Columns, ", ")+" and with --scm: "+strings.Join(ScmColumns, ", "))
+	cmd.Flags().StringVarP(&o.Template, "template", "", "", "A Go text/template to render each activity with using the fields of the json output format such as {{.Name}} and {{.Status}}")
+	cmd.Flags().BoolVarP(&o.SCM, "scm", "", false, "Fetches the commit message, author and pull request title of the SHA of each activity from the git provider")
+	o.ScmEnricher.AddFlags(cmd)
 
 	o.AddBaseFlags(cmd)
+
+	cmd.AddCommand(cobras.SplitCommand(repair.NewCmdActivitiesRepair()))
 	return cmd, o
 }
 
 // Validate verifies things are setup correctly
 func (o *Options) Validate() error {
-	var err error
+	err := o.validateOutput()
+	if err != nil {
+		return err
+	}
+	err = o.validateFilters()
+	if err != nil {
+		return err
+	}
+	if o.SCM {
+		err = o.ScmEnricher.Validate()
+		if err != nil {
+			return err
+		}
+	}
+	if o.CommandRunner == nil {
+		o.CommandRunner = cmdrunner.QuietCommandRunner
+	}
 	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
 	if err != nil {
 		return fmt.Errorf("failed to create kube client: %w", err)
@@ -149,13 +238,15 @@ func (o *Options) Run() error {
 	}
 
 	ctx := o.GetContext()
-	list, err := jxClient.JenkinsV1().PipelineActivities(ns).List(ctx, metav1.ListOptions{})
+	list, err := tektonlog.ListPipelineActivities(ctx, jxClient, ns, o.labelValues(), 0)
 	if err != nil {
 		return err
 	}
-	items := list.Items
-	if o.Sort {
-		activities.SortActivities(items)
+	items := o.filterActivities(list)
+	o.Results = items
+
+	if o.Format != FormatTable || o.template != nil {
+		return o.renderActivities(items)
 	}
 
 	for i := range items {
@@ -163,8 +254,6 @@ func (o *Options) Run() error {
 		o.addTableRow(&t, a)
 	}
 	t.Render()
-
-	o.Results = items
 	return nil
 }
 
@@ -187,65 +276,61 @@ func (o *Options) addTableRow(t *table.Table, activity *v1.PipelineActivity) boo
 			DurationString(spec.StartedTimestamp, spec.CompletedTimestamp),
 			statusText)
 		indent := indentation
+		if o.SCM {
+			o.addScmRows(t, activity, indent)
+		}
+		graph, err := pipelines.GetStageGraph(activity)
+		if err != nil {
+			log.Logger().Warnf("%s", err.Error())
+		}
+		tree := newStageTree(activity, graph)
 		for _, step := range spec.Steps {
 			s := step
+			if tree.contains(&s) {
+				if !tree.rendered {
+					tree.render(t, indent)
+				}
+				continue
+			}
 			o.addStepRow(t, &s, indent)
 		}
+		if !tree.rendered {
+			// none of the stages have started yet
+			tree.render(t, indent)
+		}
 		return true
 	}
 	return false
 }
 
-func (o *Options) WatchActivities(t *table.Table, jxClient versioned.Interface, ns string) error {
-	yamlSpecMap := map[string]string{}
-	activity := &v1.PipelineActivity{}
-
-	listWatch := cache.NewListWatchFromClient(jxClient.JenkinsV1().RESTClient(), "pipelineactivities", ns, fields.Everything())
-	kube.SortListWatchByName(listWatch)
-	_, controller := cache.NewInformerWithOptions(cache.InformerOptions{
-		ListerWatcher: listWatch,
-		ObjectType:    activity,
-		Handler: cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				o.onActivity(t, obj, yamlSpecMap)
-			},
-			UpdateFunc: func(_, newObj interface{}) {
-				o.onActivity(t, newObj, yamlSpecMap)
-			},
-			DeleteFunc: func(_ interface{}) {
-			},
-		},
-		ResyncPeriod: time.Minute * 10,
-	})
-
-	stop := signals.SetupSignalHandler()
-	go controller.Run(stop)
-
-	// Wait forever
-	select {}
-}
-
-func (o *Options) onActivity(t *table.Table, obj interface{}, yamlSpecMap map[string]string) {
-	activity, ok := obj.(*v1.PipelineActivity)
-	if !ok {
-		log.Logger().Infof("Object is not a PipelineActivity %#v", obj)
+// addScmRows adds the commit and pull request of the activity from the git provider
+func (o *Options) addScmRows(t *table.Table, activity *v1.PipelineActivity, indent string) {
+	d := o.scmDetails(activity)
+	if d == nil {
 		return
 	}
-	data, err := yaml.Marshal(&activity.Spec)
+	sha := d.SHA
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	description := d.Subject()
+	if d.Author != "" {
+		description += " by " + termcolor.ColorInfo(d.Author)
+	}
+	t.AddRow(indent+"Commit: "+sha, "", "", description)
+	if d.PullRequest > 0 {
+		t.AddRow(indent+"PullRequest: #"+strconv.Itoa(d.PullRequest), "", "", d.PullRequestTitle)
+	}
+}
+
+// scmDetails returns the commit and pull request details of the activity logging any failure to find them
+func (o *Options) scmDetails(activity *v1.PipelineActivity) *scminfo.Details {
+	d, err := o.ScmEnricher.Details(o.GetContext(), activity)
 	if err != nil {
-		log.Logger().Infof("Failed to marshal Activity.Spec to YAML: %s", err)
-	} else {
-		text := string(data)
-		name := activity.Name
-		old := yamlSpecMap[name]
-		if old == "" || old != text {
-			yamlSpecMap[name] = text
-			if o.addTableRow(t, activity) {
-				t.Render()
-				t.Clear()
-			}
-		}
+		log.Logger().Warnf("failed to find the commit of PipelineActivity %s: %s", activity.Name, err.Error())
+		return nil
 	}
+	return d
 }
 
 func (o *Options) addStepRow(t *table.Table, parent *v1.PipelineActivityStep, indent string) {
@@ -253,7 +338,7 @@ func (o *Options) addStepRow(t *table.Table, parent *v1.PipelineActivityStep, in
 	preview := parent.Preview
 	promote := parent.Promote
 	if stage != nil {
-		addStageRow(t, stage, indent)
+		addStageRow(t, stage, indent, "", "")
 	} else if preview != nil {
 		addPreviewRow(t, preview, indent)
 	} else if promote != nil {
@@ -263,12 +348,11 @@ func (o *Options) addStepRow(t *table.Table, parent *v1.PipelineActivityStep, in
 	}
 }
 
-func addStageRow(t *table.Table, stage *v1.StageActivityStep, indent string) {
-	name := "Stage"
-	if stage.Name != "" {
-		name = ""
+func addStageRow(t *table.Table, stage *v1.StageActivityStep, indent, name, description string) {
+	if name == "" && stage.Name == "" {
+		name = "Stage"
 	}
-	addStepRowItem(t, &stage.CoreActivityStep, indent, name, "")
+	addStepRowItem(t, &stage.CoreActivityStep, indent, name, description)
 
 	indent += indentation
 	for _, step := range stage.Steps {
@@ -389,19 +473,6 @@ func timeToString(t *metav1.Time) string {
 	return DurationString(t, now)
 }
 
-func (o *Options) matches(activity *v1.PipelineActivity) bool {
-	answer := true
-	filter := o.Filter
-	if filter != "" {
-		answer = strings.Contains(activity.Name, filter) || strings.Contains(activity.Spec.Pipeline, filter)
-	}
-	build := o.BuildNumber
-	if answer && build != "" {
-		answer = activity.Spec.Build == build
-	}
-	return answer
-}
-
 // DurationString returns the duration between start and end time as string
 func DurationString(start, end *metav1.Time) string {
 	if start == nil || end == nil {
@@ -10,8 +10,13 @@ import (
 	"time"
 
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/activities"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/testpipelines"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	jxv1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/stretchr/testify/require"
 	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
 	corev1 "k8s.io/api/core/v1"
@@ -66,3 +71,529 @@ func TestGetActivity(t *testing.T) {
 		text = text[idx+len(expected):]
 	}
 }
+
+func TestGetActivityStageTree(t *testing.T) {
+	ns := "jx"
+	stdout := &strings.Builder{}
+
+	stage := func(name string, status jxv1.ActivityStatusType) jxv1.PipelineActivityStep {
+		return jxv1.PipelineActivityStep{
+			Kind: jxv1.ActivityStepKindTypeStage,
+			Stage: &jxv1.StageActivityStep{
+				CoreActivityStep: jxv1.CoreActivityStep{
+					Name:   name,
+					Status: status,
+				},
+			},
+		}
+	}
+	pa := &jxv1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-main-1",
+			Namespace: ns,
+		},
+		Spec: jxv1.PipelineActivitySpec{
+			Pipeline: "myorg/myrepo/main",
+			Build:    "1",
+			Status:   jxv1.ActivityStatusTypeSucceeded,
+			Steps: []jxv1.PipelineActivityStep{
+				stage("clone", jxv1.ActivityStatusTypeSucceeded),
+				stage("build", jxv1.ActivityStatusTypeSucceeded),
+				stage("test", jxv1.ActivityStatusTypeSucceeded),
+				stage("package", jxv1.ActivityStatusTypeSucceeded),
+				stage("notify", jxv1.ActivityStatusTypeSucceeded),
+			},
+		},
+	}
+	err := pipelines.SetStageGraph(pa, []pipelines.StageNode{
+		{Name: "clone", Task: "clone"},
+		{Name: "build", Task: "build", RunAfter: []string{"clone"}},
+		{Name: "lint", Task: "lint", RunAfter: []string{"clone"}, Skipped: true, SkipReason: "When Expressions evaluated to false"},
+		{Name: "test", Task: "test", RunAfter: []string{"clone"}},
+		{Name: "package", Task: "package", RunAfter: []string{"build", "test"}},
+		{Name: "notify", Task: "notify", Finally: true},
+	})
+	require.NoError(t, err, "failed to set stage graph")
+
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+
+	_, options := activities.NewCmdActivities()
+	options.JXClient = fakejx.NewSimpleClientset(pa)
+	options.KubeClient = kubeClient
+	options.TektonClient = faketekton.NewSimpleClientset()
+	options.Namespace = ns
+	options.Out = stdout
+	options.Ctx = context.Background()
+
+	err = options.Run()
+	require.NoError(t, err, "failed to run command")
+
+	text := stdout.String()
+	t.Logf("got: %s\n", text)
+
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	orderedExpectedPrefixes := []string{
+		"myorg/myrepo/main #1",
+		"  clone",
+		"    build",
+		"      package",
+		"    lint",
+		"    test",
+		"  Finally:notify",
+	}
+	require.Len(t, lines, len(orderedExpectedPrefixes)+2)
+	for i, expected := range orderedExpectedPrefixes {
+		require.True(t, strings.HasPrefix(lines[i+1], expected+" "), "line %d should start with %q but was %q", i+1, expected, lines[i+1])
+	}
+	require.Contains(t, lines[4], "after build, test")
+	require.Contains(t, lines[5], "NotExecuted skipped: When Expressions evaluated to false")
+}
+
+func TestGetActivityOutputFormats(t *testing.T) {
+	ns := "jx"
+	started := metav1.Date(2026, time.March, 1, 10, 0, 0, 0, time.UTC)
+	completed := metav1.Date(2026, time.March, 1, 10, 2, 30, 0, time.UTC)
+	pa := &jxv1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-main-1",
+			Namespace: ns,
+		},
+		Spec: jxv1.PipelineActivitySpec{
+			Pipeline:           "myorg/myrepo/main",
+			Build:              "1",
+			GitOwner:           "myorg",
+			GitRepository:      "myrepo",
+			GitBranch:          "main",
+			Context:            "release",
+			Status:             jxv1.ActivityStatusTypeSucceeded,
+			StartedTimestamp:   &started,
+			CompletedTimestamp: &completed,
+			BuildURL:           "https://dashboard/myorg/myrepo/main/1",
+			Steps: []jxv1.PipelineActivityStep{
+				{
+					Kind: jxv1.ActivityStepKindTypeStage,
+					Stage: &jxv1.StageActivityStep{
+						CoreActivityStep: jxv1.CoreActivityStep{
+							Name:               "build",
+							Status:             jxv1.ActivityStatusTypeSucceeded,
+							StartedTimestamp:   &started,
+							CompletedTimestamp: &completed,
+						},
+					},
+				},
+			},
+		},
+	}
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+
+	testCases := []struct {
+		format   string
+		columns  []string
+		template string
+		expected string
+	}{
+		{
+			format:   "name",
+			expected: "myorg-myrepo-main-1\n",
+		},
+		{
+			format:   "jsonl",
+			expected: `{"name":"myorg-myrepo-main-1","owner":"myorg","repo":"myrepo","branch":"main","build":"1","context":"release","status":"Succeeded","start":"2026-03-01T10:00:00Z","end":"2026-03-01T10:02:30Z","duration":"2m30s","stages":[{"name":"build","status":"Succeeded","start":"2026-03-01T10:00:00Z","end":"2026-03-01T10:02:30Z","duration":"2m30s"}],"url":"https://dashboard/myorg/myrepo/main/1"}` + "\n",
+		},
+		{
+			format:   "jsonl",
+			columns:  []string{"name", "status"},
+			expected: `{"name":"myorg-myrepo-main-1","status":"Succeeded"}` + "\n",
+		},
+		{
+			format:   "csv",
+			columns:  []string{"name", "status", "duration", "stages"},
+			expected: "name,status,duration,stages\nmyorg-myrepo-main-1,Succeeded,2m30s,build=Succeeded\n",
+		},
+		{
+			format:   "yaml",
+			columns:  []string{"build", "url"},
+			expected: "- build: \"1\"\n  url: https://dashboard/myorg/myrepo/main/1\n",
+		},
+		{
+			format:   "table",
+			template: "{{.Owner}}/{{.Repo}} {{.Status}} {{len .Stages}}",
+			expected: "myorg/myrepo Succeeded 1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		stdout := &strings.Builder{}
+		_, options := activities.NewCmdActivities()
+		options.JXClient = fakejx.NewSimpleClientset(pa)
+		options.KubeClient = kubeClient
+		options.TektonClient = faketekton.NewSimpleClientset()
+		options.Namespace = ns
+		options.Out = stdout
+		options.Ctx = context.Background()
+		options.Format = tc.format
+		options.Columns = tc.columns
+		options.Template = tc.template
+
+		err := options.Run()
+		require.NoError(t, err, "failed to run command for format %s", tc.format)
+		require.Equal(t, tc.expected, stdout.String(), "for format %s with columns %v", tc.format, tc.columns)
+	}
+
+	_, options := activities.NewCmdActivities()
+	options.Format = "xml"
+	require.Error(t, options.Validate(), "should fail for an unknown format")
+
+	_, options = activities.NewCmdActivities()
+	options.Format = "csv"
+	options.Columns = []string{"cheese"}
+	require.Error(t, options.Validate(), "should fail for an unknown column")
+}
+
+func TestGetActivityScm(t *testing.T) {
+	ns := "jx"
+	pa := &jxv1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-pr-5-1",
+			Namespace: ns,
+		},
+		Spec: jxv1.PipelineActivitySpec{
+			Pipeline:      "myorg/myrepo/PR-5",
+			Build:         "1",
+			GitOwner:      "myorg",
+			GitRepository: "myrepo",
+			GitBranch:     "PR-5",
+			GitURL:        "https://github.com/myorg/myrepo.git",
+			LastCommitSHA: "abc1234567",
+			Status:        jxv1.ActivityStatusTypeSucceeded,
+		},
+	}
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+	scmClient, fakeData := fakescm.NewDefault()
+	fakeData.Commits["abc1234567"] = &scm.Commit{
+		Sha:     "abc1234567",
+		Message: "fix: the cheese",
+		Author:  scm.Signature{Login: "jstrachan"},
+	}
+	fakeData.PullRequests[5] = &scm.PullRequest{Number: 5, Title: "Fix the cheese"}
+	cacheDir := t.TempDir()
+
+	for _, format := range []string{"table", "jsonl"} {
+		stdout := &strings.Builder{}
+		_, options := activities.NewCmdActivities()
+		options.JXClient = fakejx.NewSimpleClientset(pa)
+		options.KubeClient = kubeClient
+		options.TektonClient = faketekton.NewSimpleClientset()
+		options.Namespace = ns
+		options.Out = stdout
+		options.Ctx = context.Background()
+		options.Format = format
+		options.SCM = true
+		options.ScmEnricher.CacheDir = cacheDir
+		options.ScmEnricher.ScmClients = map[string]*scm.Client{"https://github.com": scmClient}
+
+		err := options.Run()
+		require.NoError(t, err, "failed to run command for format %s", format)
+
+		text := stdout.String()
+		t.Logf("got: %s\n", text)
+		if format == "jsonl" {
+			require.Contains(t, text, `"scm":{"sha":"abc1234567","message":"fix: the cheese","author":"jstrachan","pr":5,"prTitle":"Fix the cheese"}`)
+			continue
+		}
+		require.Contains(t, text, "Commit: abc1234")
+		require.Contains(t, text, "fix: the cheese by jstrachan")
+		require.Contains(t, text, "PullRequest: #5")
+		require.Contains(t, text, "Fix the cheese")
+	}
+}
+
+func TestGetActivityFilterAndSort(t *testing.T) {
+	ns := "jx"
+	now := time.Now()
+	newActivity := func(build, author string, status jxv1.ActivityStatusType, startedAgo, duration time.Duration) *jxv1.PipelineActivity {
+		started := metav1.NewTime(now.Add(-startedAgo))
+		pa := &jxv1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myorg-myrepo-main-" + build,
+				Namespace: ns,
+				Labels: map[string]string{
+					"lighthouse.jenkins-x.io/context": "release",
+				},
+			},
+			Spec: jxv1.PipelineActivitySpec{
+				Pipeline:         "myorg/myrepo/main",
+				Build:            build,
+				Context:          "release",
+				Author:           author,
+				Status:           status,
+				StartedTimestamp: &started,
+			},
+		}
+		if status.IsTerminated() {
+			completed := metav1.NewTime(started.Add(duration))
+			pa.Spec.CompletedTimestamp = &completed
+		}
+		return pa
+	}
+	jxClient := fakejx.NewSimpleClientset(
+		newActivity("1", "alice", jxv1.ActivityStatusTypeSucceeded, 72*time.Hour, 5*time.Minute),
+		newActivity("2", "bob", jxv1.ActivityStatusTypeFailed, 10*time.Hour, 20*time.Minute),
+		newActivity("3", "alice", jxv1.ActivityStatusTypeAborted, 5*time.Hour, 2*time.Minute),
+		newActivity("4", "Alice", jxv1.ActivityStatusTypeSucceeded, 2*time.Hour, 15*time.Minute),
+		newActivity("5", "bob", jxv1.ActivityStatusTypeRunning, 30*time.Minute, 0),
+	)
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+
+	testCases := []struct {
+		name     string
+		setup    func(o *activities.Options)
+		expected []string
+	}{
+		{
+			name:     "all",
+			setup:    func(_ *activities.Options) {},
+			expected: []string{"1", "2", "3", "4", "5"},
+		},
+		{
+			name: "statuses",
+			setup: func(o *activities.Options) {
+				o.Statuses = []string{"failed", "Aborted"}
+			},
+			expected: []string{"2", "3"},
+		},
+		{
+			name: "author since",
+			setup: func(o *activities.Options) {
+				o.Author = "alice"
+				o.Since = "24h"
+			},
+			expected: []string{"3", "4"},
+		},
+		{
+			name: "until",
+			setup: func(o *activities.Options) {
+				o.Until = "6h"
+			},
+			expected: []string{"1", "2"},
+		},
+		{
+			name: "longer than",
+			setup: func(o *activities.Options) {
+				o.LongerThan = "10m"
+			},
+			expected: []string{"2", "4", "5"},
+		},
+		{
+			name: "sort duration reverse limit",
+			setup: func(o *activities.Options) {
+				o.Sort = "duration"
+				o.Reverse = true
+				o.Limit = 2
+			},
+			expected: []string{"5", "2"},
+		},
+		{
+			name: "sort status",
+			setup: func(o *activities.Options) {
+				o.Sort = "status"
+			},
+			expected: []string{"3", "2", "5", "1", "4"},
+		},
+		{
+			name: "context",
+			setup: func(o *activities.Options) {
+				o.Context = "pr"
+			},
+		},
+		{
+			name: "build without a build label",
+			setup: func(o *activities.Options) {
+				o.BuildNumber = "3"
+				o.Context = "release"
+			},
+			expected: []string{"3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		stdout := &strings.Builder{}
+		_, options := activities.NewCmdActivities()
+		options.JXClient = jxClient
+		options.KubeClient = kubeClient
+		options.TektonClient = faketekton.NewSimpleClientset()
+		options.Namespace = ns
+		options.Out = stdout
+		options.Ctx = context.Background()
+		options.Sort = "start"
+		tc.setup(options)
+
+		err := options.Run()
+		require.NoError(t, err, "failed to run command for %s", tc.name)
+
+		var builds []string
+		for i := range options.Results {
+			builds = append(builds, options.Results[i].Spec.Build)
+		}
+		require.Equal(t, tc.expected, builds, "for %s", tc.name)
+	}
+
+	_, options := activities.NewCmdActivities()
+	options.Sort = "cheese"
+	require.Error(t, options.Validate(), "should fail for an unknown sort")
+
+	_, options = activities.NewCmdActivities()
+	options.Since = "yesterday"
+	require.Error(t, options.Validate(), "should fail for an invalid since")
+}
+
+func TestWatchActivitiesUntilComplete(t *testing.T) {
+	ns := "jx"
+	newActivity := func(name string, status jxv1.ActivityStatusType) *jxv1.PipelineActivity {
+		return &jxv1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+			},
+			Spec: jxv1.PipelineActivitySpec{
+				Pipeline: "myorg/myrepo/main",
+				Build:    "1",
+				Status:   status,
+			},
+		}
+	}
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+	newOptions := func(jxClient *fakejx.Clientset) *activities.Options {
+		_, o := activities.NewCmdActivities()
+		o.JXClient = noWatchListClient{jxClient}
+		o.KubeClient = kubeClient
+		o.TektonClient = faketekton.NewSimpleClientset()
+		o.Namespace = ns
+		o.Out = &strings.Builder{}
+		o.Ctx = context.Background()
+		o.UntilComplete = true
+		o.Timeout = 10 * time.Second
+		return o
+	}
+
+	testCases := []struct {
+		name     string
+		statuses []jxv1.ActivityStatusType
+		expected int
+	}{
+		{
+			name:     "succeeded",
+			statuses: []jxv1.ActivityStatusType{jxv1.ActivityStatusTypeSucceeded, jxv1.ActivityStatusTypeSucceeded},
+		},
+		{
+			name:     "failed",
+			statuses: []jxv1.ActivityStatusType{jxv1.ActivityStatusTypeSucceeded, jxv1.ActivityStatusTypeFailed, jxv1.ActivityStatusTypeAborted},
+			expected: activities.ExitCodeFailed,
+		},
+		{
+			name:     "aborted",
+			statuses: []jxv1.ActivityStatusType{jxv1.ActivityStatusTypeAborted, jxv1.ActivityStatusTypeSucceeded},
+			expected: activities.ExitCodeAborted,
+		},
+	}
+	for _, tc := range testCases {
+		jxClient := fakejx.NewSimpleClientset()
+		for i, s := range tc.statuses {
+			_, err := jxClient.JenkinsV1().PipelineActivities(ns).Create(context.Background(), newActivity("myorg-myrepo-main-"+string(rune('a'+i)), s), metav1.CreateOptions{})
+			require.NoError(t, err)
+		}
+		o := newOptions(jxClient)
+		err := o.Run()
+		require.NoError(t, err, "failed to run for %s", tc.name)
+		require.Equal(t, tc.expected, o.ExitCode, "exit code for %s", tc.name)
+	}
+
+	// now lets check the exec hook is invoked when a running activity completes
+	jxClient := fakejx.NewSimpleClientset(newActivity("myorg-myrepo-main-1", jxv1.ActivityStatusTypeRunning))
+	o := newOptions(jxClient)
+	o.Exec = "echo done"
+	var commands []*cmdrunner.Command
+	o.CommandRunner = func(c *cmdrunner.Command) (string, error) {
+		commands = append(commands, c)
+		return "", nil
+	}
+	go func() {
+		// lets wait for the watch to start before completing the activity
+		for !hasWatched(jxClient) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		pa, err := jxClient.JenkinsV1().PipelineActivities(ns).Get(context.Background(), "myorg-myrepo-main-1", metav1.GetOptions{})
+		if err == nil {
+			pa.Spec.Status = jxv1.ActivityStatusTypeSucceeded
+			_, err = jxClient.JenkinsV1().PipelineActivities(ns).Update(context.Background(), pa, metav1.UpdateOptions{})
+		}
+		if err != nil {
+			t.Errorf("failed to update activity: %s", err.Error())
+		}
+	}()
+	err := o.Run()
+	require.NoError(t, err, "failed to run with exec hook")
+	require.Equal(t, 0, o.ExitCode)
+	require.Len(t, commands, 1, "should have run the exec hook")
+	c := commands[0]
+	require.Equal(t, []string{"-c", "echo done"}, c.Args)
+	require.Equal(t, "myorg-myrepo-main-1", c.Env["JX_ACTIVITY_NAME"])
+	require.Equal(t, "Succeeded", c.Env["JX_ACTIVITY_STATUS"])
+	require.Equal(t, "Running", c.Env["JX_ACTIVITY_PREVIOUS_STATUS"])
+
+	_, options := activities.NewCmdActivities()
+	options.Timeout = time.Minute
+	require.Error(t, options.Validate(), "should fail for a timeout without until-complete")
+}
+
+// noWatchListClient is a fake clientset which does not support streaming the initial list from a watch, like the
+// fakes generated for newer versions of client-go, so that informers list and then watch
+type noWatchListClient struct {
+	*fakejx.Clientset
+}
+
+func (c noWatchListClient) IsWatchListSemanticsUnSupported() bool {
+	return true
+}
+
+func hasWatched(jxClient *fakejx.Clientset) bool {
+	for _, a := range jxClient.Actions() {
+		if a.GetVerb() == "watch" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,202 @@
+package activities
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/activities"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+)
+
+const (
+	// SortStart sorts the activities by their start time
+	SortStart = "start"
+
+	// SortDuration sorts the activities by how long they took or have been running
+	SortDuration = "duration"
+
+	// SortStatus sorts the activities by their status
+	SortStatus = "status"
+)
+
+var (
+	sortFields = []string{SortStart, SortDuration, SortStatus}
+
+	timeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"}
+)
+
+// validateFilters parses the time based filters and verifies the sort field and watch options
+func (o *Options) validateFilters() error {
+	if o.Sort != "" && stringhelpers.StringArrayIndex(sortFields, o.Sort) < 0 {
+		return options.InvalidOptionf("sort", o.Sort, "valid values are: %s", strings.Join(sortFields, ", "))
+	}
+	if o.UntilComplete {
+		o.Watch = true
+	}
+	if o.Timeout > 0 && !o.UntilComplete {
+		return options.MissingOption("until-complete")
+	}
+	if o.Exec != "" && !o.Watch {
+		return options.MissingOption("watch")
+	}
+	if o.Limit < 0 {
+		return options.InvalidOptionf("limit", o.Limit, "must not be negative")
+	}
+	now := time.Now()
+	var err error
+	o.since, err = parseTime(now, "since", o.Since)
+	if err != nil {
+		return err
+	}
+	o.until, err = parseTime(now, "until", o.Until)
+	if err != nil {
+		return err
+	}
+	if o.LongerThan != "" {
+		o.longerThan, err = time.ParseDuration(o.LongerThan)
+		if err != nil {
+			return options.InvalidOptionf("longer-than", o.LongerThan, "must be a duration such as 10m: %s", err.Error())
+		}
+	}
+	return nil
+}
+
+// parseTime parses the value as either a duration before now or a date
+func parseTime(now time.Time, name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil {
+		t := now.Add(-d)
+		return &t, nil
+	}
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err == nil {
+			return &t, nil
+		}
+	}
+	return nil, options.InvalidOptionf(name, value, "must be a duration such as 24h or a date such as 2006-01-02 or %s", time.RFC3339)
+}
+
+// labelValues returns the label values used to select the activities on the server, activities missing the labels
+// are also listed and filtered on their spec by matches
+func (o *Options) labelValues() map[string]string {
+	return map[string]string{
+		tektonlog.LabelLighthouseContext: o.Context,
+		"build":                          o.BuildNumber,
+	}
+}
+
+// filterActivities returns the activities which match the filters sorted and limited by the options
+func (o *Options) filterActivities(items []v1.PipelineActivity) []v1.PipelineActivity {
+	var answer []v1.PipelineActivity
+	for i := range items {
+		if o.matches(&items[i]) {
+			answer = append(answer, items[i])
+		}
+	}
+
+	now := time.Now()
+	switch o.Sort {
+	case SortStart:
+		activities.SortActivities(answer)
+	case SortDuration:
+		sort.SliceStable(answer, func(i, j int) bool {
+			return activityDuration(&answer[i], now) < activityDuration(&answer[j], now)
+		})
+	case SortStatus:
+		sort.SliceStable(answer, func(i, j int) bool {
+			s1 := answer[i].Spec.Status
+			s2 := answer[j].Spec.Status
+			if s1 != s2 {
+				return s1 < s2
+			}
+			return startedBefore(&answer[i], &answer[j])
+		})
+	}
+	if o.Reverse {
+		for i, j := 0, len(answer)-1; i < j; i, j = i+1, j-1 {
+			answer[i], answer[j] = answer[j], answer[i]
+		}
+	}
+	if o.Limit > 0 && len(answer) > o.Limit {
+		answer = answer[:o.Limit]
+	}
+	return answer
+}
+
+func (o *Options) matches(activity *v1.PipelineActivity) bool {
+	ps := &activity.Spec
+	filter := o.Filter
+	if filter != "" && !strings.Contains(activity.Name, filter) && !strings.Contains(ps.Pipeline, filter) {
+		return false
+	}
+	if o.BuildNumber != "" && ps.Build != o.BuildNumber {
+		return false
+	}
+	if o.Context != "" && ps.Context != o.Context {
+		return false
+	}
+	if o.Author != "" && !strings.EqualFold(ps.Author, o.Author) {
+		return false
+	}
+	if len(o.Statuses) > 0 {
+		found := false
+		for _, s := range o.Statuses {
+			if strings.EqualFold(s, ps.Status.String()) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if o.since != nil || o.until != nil {
+		if ps.StartedTimestamp == nil {
+			return false
+		}
+		started := ps.StartedTimestamp.Time
+		if o.since != nil && started.Before(*o.since) {
+			return false
+		}
+		if o.until != nil && started.After(*o.until) {
+			return false
+		}
+	}
+	if o.longerThan > 0 && activityDuration(activity, time.Now()) <= o.longerThan {
+		return false
+	}
+	return true
+}
+
+// activityDuration returns how long the activity took or how long it has been running if it has not completed
+func activityDuration(activity *v1.PipelineActivity, now time.Time) time.Duration {
+	ps := &activity.Spec
+	if ps.StartedTimestamp == nil {
+		return 0
+	}
+	end := now
+	if ps.CompletedTimestamp != nil {
+		end = ps.CompletedTimestamp.Time
+	}
+	return end.Sub(ps.StartedTimestamp.Time)
+}
+
+func startedBefore(a1, a2 *v1.PipelineActivity) bool {
+	t1 := a1.Spec.StartedTimestamp
+	t2 := a2.Spec.StartedTimestamp
+	if t1 == nil {
+		return false
+	}
+	if t2 == nil {
+		return true
+	}
+	return t1.Before(t2)
+}
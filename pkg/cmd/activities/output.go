@@ -0,0 +1,342 @@
+package activities
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scminfo"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// FormatTable the default tree view of the activities and their stages
+	FormatTable = "table"
+
+	// FormatWide a table with a row for each activity
+	FormatWide = "wide"
+
+	// FormatJSON a JSON array of activities
+	FormatJSON = "json"
+
+	// FormatYAML a YAML list of activities
+	FormatYAML = "yaml"
+
+	// FormatJSONL a JSON object per line for each activity
+	FormatJSONL = "jsonl"
+
+	// FormatCSV comma separated values with a header row
+	FormatCSV = "csv"
+
+	// FormatName the name of each activity on its own line
+	FormatName = "name"
+)
+
+var (
+	formats = []string{FormatTable, FormatWide, FormatJSON, FormatYAML, FormatJSONL, FormatCSV, FormatName}
+
+	// Columns the stable names of the fields of an activity used by the machine readable output formats
+	Columns = []string{"name", "owner", "repo", "branch", "build", "context", "status", "start", "end", "duration", "stages", "url"}
+
+	// ScmColumns the columns populated from the git provider when using --scm
+	ScmColumns = []string{"sha", "author", "message", "pr", "title"}
+
+	// wideColumns the default columns of the wide format as the stages do not fit well on a single line
+	wideColumns = []string{"name", "owner", "repo", "branch", "build", "context", "status", "start", "end", "duration", "url"}
+)
+
+// ActivityRow the fields of a PipelineActivity in the machine readable output formats
+type ActivityRow struct {
+	Name     string     `json:"name"`
+	Owner    string     `json:"owner"`
+	Repo     string     `json:"repo"`
+	Branch   string     `json:"branch"`
+	Build    string     `json:"build"`
+	Context  string     `json:"context"`
+	Status   string     `json:"status"`
+	Start    string     `json:"start"`
+	End      string     `json:"end"`
+	Duration string     `json:"duration"`
+	Stages   []StageRow `json:"stages"`
+	URL      string     `json:"url"`
+
+	// SCM the commit and pull request details from the git provider when using --scm
+	SCM *scminfo.Details `json:"scm,omitempty"`
+}
+
+// StageRow the fields of a stage of a PipelineActivity
+type StageRow struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Duration string `json:"duration"`
+}
+
+// ToActivityRow converts the activity into its machine readable fields
+func ToActivityRow(pa *v1.PipelineActivity) *ActivityRow {
+	ps := &pa.Spec
+	row := &ActivityRow{
+		Name:     pa.Name,
+		Owner:    ps.GitOwner,
+		Repo:     ps.GitRepository,
+		Branch:   ps.GitBranch,
+		Build:    ps.Build,
+		Context:  ps.Context,
+		Status:   ps.Status.String(),
+		Start:    formatTime(ps.StartedTimestamp),
+		End:      formatTime(ps.CompletedTimestamp),
+		Duration: DurationString(ps.StartedTimestamp, ps.CompletedTimestamp),
+		Stages:   []StageRow{},
+		URL:      ps.BuildURL,
+	}
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil {
+			continue
+		}
+		row.Stages = append(row.Stages, StageRow{
+			Name:     stage.Name,
+			Status:   stage.Status.String(),
+			Start:    formatTime(stage.StartedTimestamp),
+			End:      formatTime(stage.CompletedTimestamp),
+			Duration: DurationString(stage.StartedTimestamp, stage.CompletedTimestamp),
+		})
+	}
+	return row
+}
+
+// Value returns the value of the given column as text
+func (r *ActivityRow) Value(column string) string {
+	switch column {
+	case "name":
+		return r.Name
+	case "owner":
+		return r.Owner
+	case "repo":
+		return r.Repo
+	case "branch":
+		return r.Branch
+	case "build":
+		return r.Build
+	case "context":
+		return r.Context
+	case "status":
+		return r.Status
+	case "start":
+		return r.Start
+	case "end":
+		return r.End
+	case "duration":
+		return r.Duration
+	case "stages":
+		var stages []string
+		for _, s := range r.Stages {
+			stages = append(stages, s.Name+"="+s.Status)
+		}
+		return strings.Join(stages, ";")
+	case "url":
+		return r.URL
+	}
+	if r.SCM == nil {
+		return ""
+	}
+	switch column {
+	case "sha":
+		return r.SCM.SHA
+	case "author":
+		return r.SCM.Author
+	case "message":
+		return r.SCM.Subject()
+	case "pr":
+		if r.SCM.PullRequest > 0 {
+			return strconv.Itoa(r.SCM.PullRequest)
+		}
+	case "title":
+		return r.SCM.Title()
+	}
+	return ""
+}
+
+// fields returns the row as a map of the given columns so that JSON and YAML only include the selected columns
+func (r *ActivityRow) fields(columns []string) map[string]interface{} {
+	m := map[string]interface{}{}
+	for _, c := range columns {
+		if c == "stages" {
+			m[c] = r.Stages
+		} else {
+			m[c] = r.Value(c)
+		}
+	}
+	return m
+}
+
+// validateOutput verifies the output format, columns and template
+func (o *Options) validateOutput() error {
+	if o.Format == "" {
+		o.Format = FormatTable
+	}
+	if o.Template != "" {
+		if o.Format != FormatTable {
+			return options.InvalidOptionf("template", o.Template, "cannot be used with the output format %s", o.Format)
+		}
+		var err error
+		o.template, err = template.New("activity").Option("missingkey=error").Parse(o.Template)
+		if err != nil {
+			return options.InvalidOptionf("template", o.Template, "failed to parse template: %s", err.Error())
+		}
+	}
+	if stringhelpers.StringArrayIndex(formats, o.Format) < 0 {
+		return options.InvalidOptionf("output", o.Format, "valid values are: %s", strings.Join(formats, ", "))
+	}
+	if o.Watch && (o.Format != FormatTable || o.Template != "") {
+		return options.InvalidOptionf("output", o.Format, "only the %s output format can be used when watching", FormatTable)
+	}
+	if len(o.Columns) > 0 {
+		if o.Format == FormatTable || o.Format == FormatName {
+			return options.InvalidOptionf("columns", strings.Join(o.Columns, ","), "cannot be used with the output format %s", o.Format)
+		}
+		validColumns := append(append([]string{}, Columns...), ScmColumns...)
+		for _, c := range o.Columns {
+			if stringhelpers.StringArrayIndex(validColumns, c) < 0 {
+				return options.InvalidOptionf("columns", c, "valid values are: %s", strings.Join(validColumns, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// renderActivities renders the activities using the machine readable output format or template
+func (o *Options) renderActivities(items []v1.PipelineActivity) error {
+	var rows []*ActivityRow
+	for i := range items {
+		a := &items[i]
+		if o.matches(a) {
+			row := ToActivityRow(a)
+			if o.SCM {
+				row.SCM = o.scmDetails(a)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	columns := o.Columns
+	if len(columns) == 0 {
+		columns = Columns
+		if o.Format == FormatWide {
+			columns = wideColumns
+		}
+		if o.SCM {
+			columns = append(append([]string{}, columns...), ScmColumns...)
+		}
+	}
+	selected := len(o.Columns) > 0
+
+	if o.template != nil {
+		for _, r := range rows {
+			err := o.template.Execute(o.Out, r)
+			if err != nil {
+				return fmt.Errorf("failed to execute template for %s: %w", r.Name, err)
+			}
+			_, err = fmt.Fprintln(o.Out)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(rows))
+	for _, r := range rows {
+		if selected {
+			values = append(values, r.fields(columns))
+		} else {
+			values = append(values, r)
+		}
+	}
+
+	switch o.Format {
+	case FormatName:
+		for _, r := range rows {
+			_, err := fmt.Fprintln(o.Out, r.Name)
+			if err != nil {
+				return err
+			}
+		}
+	case FormatJSON:
+		data, err := json.MarshalIndent(values, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal activities to JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(o.Out, string(data))
+		return err
+	case FormatJSONL:
+		for _, v := range values {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("failed to marshal activity to JSON: %w", err)
+			}
+			_, err = fmt.Fprintln(o.Out, string(data))
+			if err != nil {
+				return err
+			}
+		}
+	case FormatYAML:
+		data, err := yaml.Marshal(values)
+		if err != nil {
+			return fmt.Errorf("failed to marshal activities to YAML: %w", err)
+		}
+		_, err = o.Out.Write(data)
+		return err
+	case FormatCSV:
+		w := csv.NewWriter(o.Out)
+		err := w.Write(columns)
+		if err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+		for _, r := range rows {
+			err = w.Write(rowValues(r, columns))
+			if err != nil {
+				return fmt.Errorf("failed to write CSV: %w", err)
+			}
+		}
+		w.Flush()
+		return w.Error()
+	case FormatWide:
+		t := table.CreateTable(o.Out)
+		var headers []string
+		for _, c := range columns {
+			headers = append(headers, strings.ToUpper(c))
+		}
+		t.AddRow(headers...)
+		for _, r := range rows {
+			t.AddRow(rowValues(r, columns)...)
+		}
+		t.Render()
+	}
+	return nil
+}
+
+func rowValues(r *ActivityRow, columns []string) []string {
+	var answer []string
+	for _, c := range columns {
+		answer = append(answer, r.Value(c))
+	}
+	return answer
+}
+
+func formatTime(t *metav1.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
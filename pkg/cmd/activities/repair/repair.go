@@ -0,0 +1,402 @@
+package repair
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/spf13/cobra"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options contains the command line options
+type Options struct {
+	options.BaseOptions
+
+	Namespace    string
+	DryRun       bool
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	Out          io.Writer
+	Changes      []*Change
+}
+
+// ChangeType the kind of change made to a PipelineActivity
+type ChangeType string
+
+const (
+	// ChangeTypeCreate a missing PipelineActivity is created for a PipelineRun
+	ChangeTypeCreate ChangeType = "create"
+
+	// ChangeTypeUpdate a PipelineActivity is updated with the latest status of its PipelineRun
+	ChangeTypeUpdate ChangeType = "update"
+
+	// ChangeTypeAbort a running PipelineActivity without a PipelineRun is marked as aborted
+	ChangeTypeAbort ChangeType = "abort"
+)
+
+// Change describes a change made to a PipelineActivity
+type Change struct {
+	Type   ChangeType
+	Name   string
+	Before *v1.PipelineActivity
+	After  *v1.PipelineActivity
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Repairs the PipelineActivity resources so they match the Tekton PipelineRuns.
+
+		Missing activities are created for PipelineRuns, activities with a stale status are updated and any running activities whose PipelineRun no longer exists are marked as Aborted.
+`)
+
+	cmdExample = templates.Examples(`
+		# view the changes that would be made to the activities
+		jx pipeline activities repair --dry-run
+
+		# repair the activities
+		jx pipeline activities repair
+	`)
+)
+
+// NewCmdActivitiesRepair creates the command
+func NewCmdActivitiesRepair() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "repair",
+		Short:   "Rebuilds the PipelineActivity resources from the Tekton PipelineRuns",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Run: func(_ *cobra.Command, _ []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to repair the activities in. Defaults to the dev namespace")
+	cmd.Flags().BoolVarP(&o.DryRun, "dry-run", "", false, "Prints the changes as a diff without modifying any PipelineActivity")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.TektonClient != nil {
+		return nil
+	}
+
+	f := kubeclient.NewFactory()
+	cfg, err := f.CreateKubeConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get kubernetes config: %w", err)
+	}
+	o.TektonClient, err = tektonclient.NewForConfig(cfg)
+	if err != nil {
+		return fmt.Errorf("error building tekton client: %w", err)
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ns, _, err := jxenv.GetDevNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to find dev namespace: %w", err)
+	}
+
+	o.Changes, err = o.findChanges(ns)
+	if err != nil {
+		return err
+	}
+	if len(o.Changes) == 0 {
+		log.Logger().Infof("all PipelineActivity resources in namespace %s match their PipelineRuns", termcolor.ColorInfo(ns))
+		return nil
+	}
+
+	for _, c := range o.Changes {
+		if o.DryRun {
+			err = o.printDiff(c)
+		} else {
+			err = o.applyChange(ns, c)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findChanges compares the PipelineActivity resources with the PipelineRuns to find the changes needed
+func (o *Options) findChanges(ns string) ([]*Change, error) {
+	ctx := o.GetContext()
+	paList, err := o.JXClient.JenkinsV1().PipelineActivities(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineActivity resources in namespace %s: %w", ns, err)
+	}
+	prList, err := pipelines.ListPipelineRuns(ctx, o.TektonClient, ns, pipelines.ServedAPIVersion(o.TektonClient), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", ns, err)
+	}
+
+	prs := prList.Items
+	sort.Slice(prs, func(i, j int) bool {
+		return prs[i].CreationTimestamp.Before(&prs[j].CreationTimestamp)
+	})
+
+	activities := paList.Items
+	index := map[string]*v1.PipelineActivity{}
+	for i := range activities {
+		pa := &activities[i]
+		index[pa.Name] = pa
+	}
+
+	// a dry run reads the build numbers from the SourceRepository without allocating them
+	allocator := pipelines.NewSourceRepositoryBuildNumbers(o.JXClient, ns)
+	allocator.DryRun = o.DryRun
+
+	var changes []*Change
+	changed := map[string]*Change{}
+	matched := map[string]bool{}
+	for i := range prs {
+		pr := &prs[i]
+		name, err := pipelines.ToPipelineActivityNameWithAllocator(ctx, pr, activities, allocator)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find the PipelineActivity name for PipelineRun %s: %w", pr.Name, err)
+		}
+		if name == "" {
+			log.Logger().Debugf("ignoring PipelineRun %s as it has no repository labels", pr.Name)
+			continue
+		}
+		matched[name] = true
+
+		c := changed[name]
+		if c == nil {
+			c = &Change{
+				Type: ChangeTypeUpdate,
+				Name: name,
+			}
+			before := index[name]
+			if before == nil {
+				c.Type = ChangeTypeCreate
+				c.After = &v1.PipelineActivity{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      name,
+						Namespace: ns,
+					},
+				}
+
+				// lets make sure a subsequent PipelineRun for the same branch gets the next build number
+				activities = append(activities, *c.After)
+			} else {
+				c.Before = before
+				c.After = before.DeepCopy()
+				if c.After.Namespace == "" {
+					c.After.Namespace = ns
+				}
+			}
+			changed[name] = c
+			changes = append(changes, c)
+		}
+		err = toPipelineActivity(o.TektonClient, pr, c.After)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert PipelineRun %s to PipelineActivity %s: %w", pr.Name, name, err)
+		}
+	}
+
+	for i := range paList.Items {
+		pa := &paList.Items[i]
+		if matched[pa.Name] || pa.Spec.Status != v1.ActivityStatusTypeRunning {
+			continue
+		}
+		changes = append(changes, &Change{
+			Type:   ChangeTypeAbort,
+			Name:   pa.Name,
+			Before: pa,
+			After:  AbortActivity(pa),
+		})
+	}
+
+	// lets filter out any updates which do not change anything
+	var answer []*Change
+	for _, c := range changes {
+		if c.Type == ChangeTypeUpdate {
+			before, after, err := toYAML(c)
+			if err != nil {
+				return nil, err
+			}
+			if before == after {
+				continue
+			}
+		}
+		answer = append(answer, c)
+	}
+	return answer, nil
+}
+
+// toPipelineActivity updates the activity from the PipelineRun making sure the activity is completed if the
+// PipelineRun has completed, even if its stages could not be resolved from the TaskRuns
+func toPipelineActivity(client tektonclient.Interface, pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity) error {
+	if pa.CreationTimestamp.IsZero() {
+		pa.CreationTimestamp = pr.CreationTimestamp
+	}
+	err := pipelines.ToPipelineActivity(client, pr, pa, false)
+	if err != nil {
+		return err
+	}
+	status := pipelines.ToPipelineRunStatus(pr)
+	ps := &pa.Spec
+	if !status.IsTerminated() || ps.Status == status {
+		return nil
+	}
+	ps.Status = status
+	if ps.CompletedTimestamp == nil {
+		ps.CompletedTimestamp = pr.Status.CompletionTime
+	}
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage != nil && !stage.Status.IsTerminated() {
+			stage.Status = status
+			if stage.CompletedTimestamp == nil {
+				stage.CompletedTimestamp = ps.CompletedTimestamp
+			}
+		}
+	}
+	return nil
+}
+
+// AbortActivity returns a copy of the activity marked as aborted along with any of its stages which have not completed
+func AbortActivity(pa *v1.PipelineActivity) *v1.PipelineActivity {
+	answer := pa.DeepCopy()
+	now := metav1.NewTime(time.Now())
+	ps := &answer.Spec
+	ps.Status = v1.ActivityStatusTypeAborted
+	if ps.CompletedTimestamp == nil {
+		ps.CompletedTimestamp = &now
+	}
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil || stage.Status.IsTerminated() {
+			continue
+		}
+		stage.Status = v1.ActivityStatusTypeAborted
+		if stage.CompletedTimestamp == nil && stage.StartedTimestamp != nil {
+			stage.CompletedTimestamp = &now
+		}
+		for j := range stage.Steps {
+			step := &stage.Steps[j]
+			if step.Status.IsTerminated() {
+				continue
+			}
+			step.Status = v1.ActivityStatusTypeAborted
+			if step.CompletedTimestamp == nil && step.StartedTimestamp != nil {
+				step.CompletedTimestamp = &now
+			}
+		}
+	}
+	return answer
+}
+
+func (o *Options) applyChange(ns string, c *Change) error {
+	ctx := o.GetContext()
+	activityInterface := o.JXClient.JenkinsV1().PipelineActivities(ns)
+	var err error
+	switch c.Type {
+	case ChangeTypeCreate:
+		_, err = activityInterface.Create(ctx, c.After, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create PipelineActivity %s: %w", c.Name, err)
+		}
+		log.Logger().Infof("created PipelineActivity %s", termcolor.ColorInfo(c.Name))
+	default:
+		_, err = activityInterface.Update(ctx, c.After, metav1.UpdateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to update PipelineActivity %s: %w", c.Name, err)
+		}
+		if c.Type == ChangeTypeAbort {
+			log.Logger().Infof("marked PipelineActivity %s as %s as it has no PipelineRun", termcolor.ColorInfo(c.Name), termcolor.ColorWarning(string(v1.ActivityStatusTypeAborted)))
+		} else {
+			log.Logger().Infof("updated PipelineActivity %s", termcolor.ColorInfo(c.Name))
+		}
+	}
+	return nil
+}
+
+func (o *Options) printDiff(c *Change) error {
+	before, after, err := toYAML(c)
+	if err != nil {
+		return err
+	}
+	fromFile := "a/" + c.Name
+	if c.Before == nil {
+		fromFile = "/dev/null"
+	}
+	text, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(before),
+		B:        difflib.SplitLines(after),
+		FromFile: fromFile,
+		ToFile:   "b/" + c.Name,
+		Context:  3,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to diff PipelineActivity %s: %w", c.Name, err)
+	}
+	_, err = fmt.Fprintf(o.Out, "# %s PipelineActivity %s\n%s", c.Type, c.Name, text)
+	if err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+	return nil
+}
+
+func toYAML(c *Change) (string, string, error) {
+	before := ""
+	if c.Before != nil {
+		data, err := yaml.Marshal(c.Before)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to marshal PipelineActivity %s: %w", c.Name, err)
+		}
+		before = string(data)
+	}
+	data, err := yaml.Marshal(c.After)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal PipelineActivity %s: %w", c.Name, err)
+	}
+	return before, string(data), nil
+}
@@ -0,0 +1,224 @@
+//go:build unit
+// +build unit
+
+package repair_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/activities/repair"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+)
+
+const ns = "jx"
+
+func TestRepairActivities(t *testing.T) {
+	ctx := context.Background()
+	jxClient := fakejx.NewSimpleClientset(
+		newActivity("myorg-repo-b-master-1", "repo-b", v1.ActivityStatusTypeRunning),
+		newActivity("myorg-repo-c-master-3", "repo-c", v1.ActivityStatusTypeRunning),
+		newActivity("myorg-repo-d-master-1", "repo-d", v1.ActivityStatusTypeSucceeded),
+	)
+	tektonClient := faketekton.NewSimpleClientset(
+		newPipelineRun("repo-a-1", "repo-a", corev1.ConditionTrue),
+		newPipelineRun("repo-b-1", "repo-b", corev1.ConditionFalse),
+	)
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+
+	newOptions := func(dryRun bool) (*repair.Options, *strings.Builder) {
+		out := &strings.Builder{}
+		_, o := repair.NewCmdActivitiesRepair()
+		o.Ctx = ctx
+		o.JXClient = jxClient
+		o.KubeClient = kubeClient
+		o.TektonClient = tektonClient
+		o.Namespace = ns
+		o.DryRun = dryRun
+		o.Out = out
+		return o, out
+	}
+
+	o, out := newOptions(true)
+	err := o.Run()
+	require.NoError(t, err, "failed to run dry run")
+
+	text := out.String()
+	t.Logf("dry run:\n%s\n", text)
+
+	var changes []string
+	for _, c := range o.Changes {
+		changes = append(changes, string(c.Type)+" "+c.Name)
+	}
+	assert.Equal(t, []string{
+		"create myorg-repo-a-master-1",
+		"update myorg-repo-b-master-1",
+		"abort myorg-repo-c-master-3",
+	}, changes)
+
+	assert.Contains(t, text, "# create PipelineActivity myorg-repo-a-master-1\n--- /dev/null\n+++ b/myorg-repo-a-master-1\n")
+	assert.Contains(t, text, "# update PipelineActivity myorg-repo-b-master-1\n--- a/myorg-repo-b-master-1\n+++ b/myorg-repo-b-master-1\n")
+	assert.Contains(t, text, "-  status: Running\n+  status: Failed\n")
+	assert.Contains(t, text, "-  status: Running\n+  status: Aborted\n")
+	assert.NotContains(t, text, "myorg-repo-d-master-1")
+
+	for _, action := range jxClient.Actions() {
+		assert.Equal(t, "list", action.GetVerb(), "dry run should not modify any activities")
+	}
+	_, err = jxClient.JenkinsV1().PipelineActivities(ns).Get(ctx, "myorg-repo-a-master-1", metav1.GetOptions{})
+	require.Error(t, err, "dry run should not create the activity")
+
+	o, out = newOptions(false)
+	err = o.Run()
+	require.NoError(t, err, "failed to repair activities")
+	assert.Empty(t, out.String())
+
+	expectedStatuses := map[string]v1.ActivityStatusType{
+		"myorg-repo-a-master-1": v1.ActivityStatusTypeSucceeded,
+		"myorg-repo-b-master-1": v1.ActivityStatusTypeFailed,
+		"myorg-repo-c-master-3": v1.ActivityStatusTypeAborted,
+		"myorg-repo-d-master-1": v1.ActivityStatusTypeSucceeded,
+	}
+	for name, expected := range expectedStatuses {
+		pa, err := jxClient.JenkinsV1().PipelineActivities(ns).Get(ctx, name, metav1.GetOptions{})
+		require.NoError(t, err, "failed to find PipelineActivity %s", name)
+		assert.Equal(t, expected, pa.Spec.Status, "status of PipelineActivity %s", name)
+	}
+
+	pa, err := jxClient.JenkinsV1().PipelineActivities(ns).Get(ctx, "myorg-repo-c-master-3", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.NotNil(t, pa.Spec.CompletedTimestamp)
+	require.Len(t, pa.Spec.Steps, 1)
+	assert.Equal(t, v1.ActivityStatusTypeAborted, pa.Spec.Steps[0].Stage.Status)
+
+	o, _ = newOptions(true)
+	err = o.Run()
+	require.NoError(t, err)
+	assert.Empty(t, o.Changes, "should have nothing left to repair")
+}
+
+func TestRepairActivitiesDryRunBuildNumbers(t *testing.T) {
+	ctx := context.Background()
+	jxClient := fakejx.NewSimpleClientset(
+		&v1.SourceRepository{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myorg-repo-e",
+				Namespace: ns,
+				Annotations: map[string]string{
+					"jenkins.io/last-build-number-for-master": "4",
+				},
+			},
+			Spec: v1.SourceRepositorySpec{
+				Org:  "myorg",
+				Repo: "repo-e",
+			},
+		},
+	)
+	pr := newPipelineRun("repo-e-1", "repo-e", corev1.ConditionTrue)
+	delete(pr.Labels, "build")
+	pr.Labels["lighthouse.jenkins-x.io/buildNum"] = "1234"
+	tektonClient := faketekton.NewSimpleClientset(pr)
+
+	for _, dryRun := range []bool{true, false} {
+		_, o := repair.NewCmdActivitiesRepair()
+		o.Ctx = ctx
+		o.JXClient = jxClient
+		o.KubeClient = fake.NewSimpleClientset(
+			&corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: ns,
+				},
+			},
+		)
+		o.TektonClient = tektonClient
+		o.Namespace = ns
+		o.DryRun = dryRun
+		o.Out = &strings.Builder{}
+		err := o.Run()
+		require.NoError(t, err, "failed to repair activities with dry run %v", dryRun)
+
+		require.Len(t, o.Changes, 1, "changes with dry run %v", dryRun)
+		assert.Equal(t, "myorg-repo-e-master-5", o.Changes[0].Name, "should name the activity from the SourceRepository with dry run %v", dryRun)
+
+		sr, err := jxClient.JenkinsV1().SourceRepositories(ns).Get(ctx, "myorg-repo-e", metav1.GetOptions{})
+		require.NoError(t, err)
+		expected := "4"
+		if !dryRun {
+			expected = "5"
+		}
+		assert.Equal(t, expected, sr.Annotations["jenkins.io/last-build-number-for-master"], "build number annotation with dry run %v", dryRun)
+	}
+}
+
+func newActivity(name, repo string, status v1.ActivityStatusType) *v1.PipelineActivity {
+	started := metav1.Now()
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:         "myorg/" + repo + "/master",
+			GitOwner:         "myorg",
+			GitRepository:    repo,
+			GitBranch:        "master",
+			Status:           status,
+			StartedTimestamp: &started,
+			Steps: []v1.PipelineActivityStep{
+				{
+					Kind: v1.ActivityStepKindTypeStage,
+					Stage: &v1.StageActivityStep{
+						CoreActivityStep: v1.CoreActivityStep{
+							Name:             "build",
+							Status:           status,
+							StartedTimestamp: &started,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func newPipelineRun(name, repo string, succeeded corev1.ConditionStatus) *pipelinev1.PipelineRun {
+	started := metav1.Now()
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				"lighthouse.jenkins-x.io/refs.org":  "myorg",
+				"lighthouse.jenkins-x.io/refs.repo": repo,
+				"lighthouse.jenkins-x.io/branch":    "master",
+				"build":                             "1",
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &started,
+				CompletionTime: &started,
+			},
+		},
+	}
+	pr.Status.SetCondition(&apis.Condition{
+		Type:   apis.ConditionSucceeded,
+		Status: succeeded,
+	})
+	return pr
+}
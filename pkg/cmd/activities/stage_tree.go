@@ -0,0 +1,182 @@
+package activities
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+)
+
+// stageTree renders the stages of an activity as a tree using the stage graph of the pipeline
+type stageTree struct {
+	nodes    []pipelines.StageNode
+	tasks    map[string]int
+	stages   map[string]*v1.StageActivityStep
+	children map[int][]int
+	roots    []int
+	finally  []int
+	status   v1.ActivityStatusType
+	rendered bool
+}
+
+func newStageTree(activity *v1.PipelineActivity, nodes []pipelines.StageNode) *stageTree {
+	tree := &stageTree{
+		nodes:    nodes,
+		tasks:    map[string]int{},
+		stages:   map[string]*v1.StageActivityStep{},
+		children: map[int][]int{},
+		status:   activity.Spec.Status,
+	}
+	for i := range nodes {
+		tree.tasks[nodes[i].Task] = i
+	}
+	for i := range activity.Spec.Steps {
+		stage := activity.Spec.Steps[i].Stage
+		if stage != nil {
+			tree.stages[stage.Name] = stage
+		}
+	}
+
+	depths := map[int]int{}
+	for i := range nodes {
+		if nodes[i].Finally {
+			tree.finally = append(tree.finally, i)
+			continue
+		}
+		parent := -1
+		parentDepth := -1
+		for _, dep := range nodes[i].RunAfter {
+			j, ok := tree.tasks[dep]
+			if !ok || nodes[j].Finally {
+				continue
+			}
+			d := tree.depth(j, depths, map[int]bool{})
+			if d > parentDepth {
+				parent = j
+				parentDepth = d
+			}
+		}
+		if parent < 0 {
+			tree.roots = append(tree.roots, i)
+		} else {
+			tree.children[parent] = append(tree.children[parent], i)
+		}
+	}
+	return tree
+}
+
+// depth returns the length of the longest chain of dependencies of the given node
+func (s *stageTree) depth(i int, depths map[int]int, visiting map[int]bool) int {
+	if d, ok := depths[i]; ok {
+		return d
+	}
+	if visiting[i] {
+		return 0
+	}
+	visiting[i] = true
+	answer := 0
+	for _, dep := range s.nodes[i].RunAfter {
+		j, ok := s.tasks[dep]
+		if !ok || s.nodes[j].Finally {
+			continue
+		}
+		d := s.depth(j, depths, visiting) + 1
+		if d > answer {
+			answer = d
+		}
+	}
+	depths[i] = answer
+	return answer
+}
+
+// contains returns true if the step is a stage rendered by the tree
+func (s *stageTree) contains(step *v1.PipelineActivityStep) bool {
+	if step.Stage == nil {
+		return false
+	}
+	for i := range s.nodes {
+		for _, name := range s.stageNames(&s.nodes[i]) {
+			if name == step.Stage.Name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *stageTree) render(t *table.Table, indent string) {
+	s.rendered = true
+	for _, i := range s.roots {
+		s.renderNode(t, i, indent)
+	}
+	for _, i := range s.finally {
+		s.renderNode(t, i, indent)
+	}
+}
+
+func (s *stageTree) renderNode(t *table.Table, i int, indent string) {
+	node := &s.nodes[i]
+	name := ""
+	if node.Finally {
+		name = "Finally"
+	}
+	description := s.describe(node)
+	for _, stageName := range s.stageNames(node) {
+		stage := s.stages[stageName]
+		if stage != nil {
+			addStageRow(t, stage, indent, name, description)
+		} else {
+			step := &v1.CoreActivityStep{
+				Name:   stageName,
+				Status: s.notRunStatus(node),
+			}
+			addStepRowItem(t, step, indent, name, description)
+		}
+	}
+	for _, child := range s.children[i] {
+		s.renderNode(t, child, indent+indentation)
+	}
+}
+
+// stageNames returns the names of the stages of the node which has one stage per matrix instance
+func (s *stageTree) stageNames(node *pipelines.StageNode) []string {
+	if len(node.Instances) > 0 {
+		return node.Instances
+	}
+	return []string{node.Name}
+}
+
+// describe returns the dependencies when there is more than one, or why the stage was skipped
+func (s *stageTree) describe(node *pipelines.StageNode) string {
+	var parts []string
+	if len(node.RunAfter) > 1 {
+		var deps []string
+		for _, dep := range node.RunAfter {
+			if j, ok := s.tasks[dep]; ok {
+				dep = s.nodes[j].Name
+			}
+			deps = append(deps, dep)
+		}
+		parts = append(parts, "after "+strings.Join(deps, ", "))
+	}
+	if node.Skipped {
+		text := "skipped"
+		if node.SkipReason != "" {
+			text += ": " + node.SkipReason
+		}
+		if len(node.When) > 0 {
+			text += fmt.Sprintf(" (%s)", strings.Join(node.When, ", "))
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s *stageTree) notRunStatus(node *pipelines.StageNode) v1.ActivityStatusType {
+	if !node.Skipped && (s.status == v1.ActivityStatusTypePending || s.status == v1.ActivityStatusTypeRunning) {
+		return v1.ActivityStatusTypePending
+	}
+	return v1.ActivityStatusTypeNotExecuted
+}
@@ -0,0 +1,227 @@
+package activities
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghodss/yaml"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	// ExitCodeFailed the exit code when watching until complete and an activity failed
+	ExitCodeFailed = 1
+
+	// ExitCodeAborted the exit code when watching until complete and an activity was aborted
+	ExitCodeAborted = 2
+
+	// envPrefix the prefix of the environment variables passed to the exec hook
+	envPrefix = "JX_ACTIVITY_"
+)
+
+// activityWatcher keeps track of the status of the activities being watched
+type activityWatcher struct {
+	lock        sync.Mutex
+	t           *table.Table
+	yamlSpecMap map[string]string
+	statuses    map[string]v1.ActivityStatusType
+	synced      func() bool
+	complete    chan v1.ActivityStatusType
+}
+
+// WatchActivities watches the activities rendering any changes. If UntilComplete is enabled this returns once all
+// the matching activities have completed with ExitCode set from their statuses
+func (o *Options) WatchActivities(t *table.Table, jxClient versioned.Interface, ns string) error {
+	ctx, cancel := context.WithCancel(o.GetContext())
+	defer cancel()
+	if o.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, o.Timeout)
+		defer cancel()
+	}
+
+	w := &activityWatcher{
+		t:           t,
+		yamlSpecMap: map[string]string{},
+		statuses:    map[string]v1.ActivityStatusType{},
+		complete:    make(chan v1.ActivityStatusType, 1),
+	}
+	activityInterface := jxClient.JenkinsV1().PipelineActivities(ns)
+	// activities are not selected by label on the server as those without the build or context labels would never
+	// be seen, onActivity filters them using matches instead
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return activityInterface.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return activityInterface.Watch(ctx, options)
+		},
+	}
+	kube.SortListWatchByName(listWatch)
+	_, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: cache.ToListWatcherWithWatchListSemantics(listWatch, jxClient),
+		ObjectType:    &v1.PipelineActivity{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				o.onActivity(w, obj)
+			},
+			UpdateFunc: func(_, newObj interface{}) {
+				o.onActivity(w, newObj)
+			},
+			DeleteFunc: func(_ interface{}) {
+			},
+		},
+		ResyncPeriod: time.Minute * 10,
+	})
+	w.synced = controller.HasSynced
+
+	go controller.Run(ctx.Done())
+
+	if !o.UntilComplete {
+		<-ctx.Done()
+		return nil
+	}
+
+	// lets check if the activities had already completed once we have loaded them all
+	if cache.WaitForCacheSync(ctx.Done(), controller.HasSynced) {
+		w.checkComplete()
+	}
+	select {
+	case status := <-w.complete:
+		o.ExitCode = ToExitCode(status)
+		return nil
+	case <-ctx.Done():
+		if o.Timeout > 0 && ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s waiting for the activities to complete", o.Timeout.String())
+		}
+		return ctx.Err()
+	}
+}
+
+func (o *Options) onActivity(w *activityWatcher, obj interface{}) {
+	activity, ok := obj.(*v1.PipelineActivity)
+	if !ok {
+		log.Logger().Infof("Object is not a PipelineActivity %#v", obj)
+		return
+	}
+	if !o.matches(activity) {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	data, err := yaml.Marshal(&activity.Spec)
+	if err != nil {
+		log.Logger().Infof("Failed to marshal Activity.Spec to YAML: %s", err)
+	} else {
+		text := string(data)
+		name := activity.Name
+		old := w.yamlSpecMap[name]
+		if old == "" || old != text {
+			w.yamlSpecMap[name] = text
+			if o.addTableRow(w.t, activity) {
+				w.t.Render()
+				w.t.Clear()
+			}
+		}
+	}
+
+	status := activity.Spec.Status
+	previous, exists := w.statuses[activity.Name]
+	w.statuses[activity.Name] = status
+	if o.Exec != "" && exists && previous != status {
+		o.runExecHook(activity, previous)
+	}
+	if o.UntilComplete && w.synced != nil && w.synced() {
+		w.checkCompleteLocked()
+	}
+}
+
+// checkComplete notifies the watcher if all the matching activities have completed
+func (w *activityWatcher) checkComplete() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.checkCompleteLocked()
+}
+
+func (w *activityWatcher) checkCompleteLocked() {
+	if len(w.statuses) == 0 {
+		return
+	}
+	var statuses []v1.ActivityStatusType
+	for _, s := range w.statuses {
+		if !s.IsTerminated() {
+			return
+		}
+		statuses = append(statuses, s)
+	}
+	select {
+	case w.complete <- CombinedStatus(statuses):
+	default:
+	}
+}
+
+// runExecHook runs the exec command passing the fields of the activity as environment variables
+func (o *Options) runExecHook(activity *v1.PipelineActivity, previous v1.ActivityStatusType) {
+	row := ToActivityRow(activity)
+	env := map[string]string{
+		envPrefix + "PREVIOUS_STATUS": string(previous),
+	}
+	for _, c := range Columns {
+		env[envPrefix+strings.ToUpper(c)] = row.Value(c)
+	}
+	c := &cmdrunner.Command{
+		Name: "sh",
+		Args: []string{"-c", o.Exec},
+		Env:  env,
+		Out:  o.Out,
+		Err:  os.Stderr,
+	}
+	_, err := o.CommandRunner(c)
+	if err != nil {
+		log.Logger().Warnf("failed to run %s for activity %s: %s", termcolor.ColorInfo(o.Exec), activity.Name, err.Error())
+	}
+}
+
+// CombinedStatus returns Failed if any of the statuses failed, Aborted if any were aborted otherwise Succeeded
+func CombinedStatus(statuses []v1.ActivityStatusType) v1.ActivityStatusType {
+	answer := v1.ActivityStatusTypeSucceeded
+	for _, s := range statuses {
+		switch s {
+		case v1.ActivityStatusTypeSucceeded, v1.ActivityStatusTypeNotExecuted:
+		case v1.ActivityStatusTypeAborted, v1.ActivityStatusTypeCancelled:
+			if answer == v1.ActivityStatusTypeSucceeded {
+				answer = v1.ActivityStatusTypeAborted
+			}
+		default:
+			return v1.ActivityStatusTypeFailed
+		}
+	}
+	return answer
+}
+
+// ToExitCode returns the process exit code for the status of a completed activity
+func ToExitCode(status v1.ActivityStatusType) int {
+	switch status {
+	case v1.ActivityStatusTypeSucceeded:
+		return 0
+	case v1.ActivityStatusTypeAborted, v1.ActivityStatusTypeCancelled:
+		return ExitCodeAborted
+	default:
+		return ExitCodeFailed
+	}
+}
@@ -187,22 +187,7 @@ func (o *Options) Run() error {
 	}
 
 	// lets create a new Breakpoint for this filter
-	bp := &v1alpha1.LighthouseBreakpoint{
-		TypeMeta: metav1.TypeMeta{
-			Kind:       "LighthouseBreakpoint",
-			APIVersion: lighthouse.GroupAndVersion,
-		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pa.Name,
-			Namespace: ns,
-		},
-		Spec: v1alpha1.LighthouseBreakpointSpec{
-			Filter: *f,
-			Debug: pipelinev1.TaskRunDebug{
-				Breakpoints: &pipelinev1.TaskBreakpoints{BeforeSteps: o.BreakpointNames},
-			},
-		},
-	}
+	bp := NewBreakpoint(pa, ns, o.BreakpointNames)
 	_, err = o.LHClient.LighthouseV1alpha1().LighthouseBreakpoints(ns).Create(ctx, bp, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create the LighthouseBreakpoint %#v: %w", bp, err)
@@ -225,6 +210,26 @@ func (o *Options) ToLabel(a *v1.PipelineActivity) string {
 	return label
 }
 
+// NewBreakpoint creates a LighthouseBreakpoint for the pipeline of the PipelineActivity
+func NewBreakpoint(pa *v1.PipelineActivity, ns string, breakpointNames []string) *v1alpha1.LighthouseBreakpoint {
+	return &v1alpha1.LighthouseBreakpoint{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "LighthouseBreakpoint",
+			APIVersion: lighthouse.GroupAndVersion,
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pa.Name,
+			Namespace: ns,
+		},
+		Spec: v1alpha1.LighthouseBreakpointSpec{
+			Filter: *ToBreakpointFilter(pa),
+			Debug: pipelinev1.TaskRunDebug{
+				Breakpoints: &pipelinev1.TaskBreakpoints{BeforeSteps: breakpointNames},
+			},
+		},
+	}
+}
+
 // ToBreakpointFilter converts the PipelineActivity to a filter for breakpoints
 func ToBreakpointFilter(a *v1.PipelineActivity) *v1alpha1.LighthousePipelineFilter {
 	as := &a.Spec
@@ -0,0 +1,334 @@
+package diff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/builddiff"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/spf13/cobra"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Args         []string
+	Namespace    string
+	Logs         bool
+	BuildFilter  tektonlog.BuildPodInfoFilter
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	Out          io.Writer
+	Diff         *builddiff.Diff
+	LogDiff      string
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Displays the differences between two builds.
+
+		The builds can be specified by their PipelineActivity names or by their build numbers with the --repo and --branch flags.
+
+		The differences include the commit, the status and duration of each stage and the params, images, env and scripts of the steps of each stage from the TaskRuns. The logs of the first failed step can also be compared with their timestamps removed.
+`)
+
+	cmdExample = templates.Examples(`
+		# Compare two builds of a branch
+		jx pipeline diff --repo cheese --branch main 12 13
+
+		# Compare two builds including the logs of the first failed step
+		jx pipeline diff myorg-cheese-main-12 myorg-cheese-pr-5-1 --logs
+	`)
+)
+
+// NewCmdPipelineDiff creates the command
+func NewCmdPipelineDiff() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "diff <build-a> <build-b>",
+		Short:   "Displays the differences between two builds",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"compare"},
+		Run: func(_ *cobra.Command, args []string) {
+			o.Args = args
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().BoolVarP(&o.Logs, "logs", "", false, "Compares the logs of the first failed step with their timestamps removed")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if len(o.Args) != 2 {
+		return fmt.Errorf("please specify the two builds to compare. e.g. jx pipeline diff --repo cheese --branch main 12 13")
+	}
+
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	if o.TektonClient == nil {
+		f := kubeclient.NewFactory()
+		cfg, err := f.CreateKubeConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes config: %w", err)
+		}
+		o.TektonClient, err = tektonclient.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building tekton client: %w", err)
+		}
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	ns := o.Namespace
+	paList, err := o.JXClient.JenkinsV1().PipelineActivities(ns).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list PipelineActivity resources in namespace %s: %w", ns, err)
+	}
+	prs, err := pipelines.ListPipelineRuns(ctx, o.TektonClient, ns, pipelines.ServedAPIVersion(o.TektonClient), metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", ns, err)
+	}
+
+	var builds []*builddiff.Build
+	for _, arg := range o.Args {
+		pa, err := o.findActivity(arg, paList.Items)
+		if err != nil {
+			return err
+		}
+		build, err := o.loadBuild(ctx, pa, paList.Items, prs)
+		if err != nil {
+			return err
+		}
+		builds = append(builds, build)
+	}
+	from, to := builds[0], builds[1]
+
+	o.Diff, err = builddiff.Compare(from, to)
+	if err != nil {
+		return fmt.Errorf("failed to compare %s and %s: %w", from.Activity.Name, to.Activity.Name, err)
+	}
+	if o.Logs {
+		err = o.diffLogs(ctx, from, to)
+		if err != nil {
+			return err
+		}
+	}
+	return o.render(from, to)
+}
+
+// findActivity finds the activity by name or by the build number of the repository and branch of the filter
+func (o *Options) findActivity(arg string, paList []v1.PipelineActivity) (*v1.PipelineActivity, error) {
+	var matches []*v1.PipelineActivity
+	for i := range paList {
+		pa := &paList[i]
+		if pa.Name == arg {
+			return pa, nil
+		}
+		if pa.Spec.Build == arg && o.BuildFilter.Matches(pa) {
+			matches = append(matches, pa)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("could not find a PipelineActivity for build %s in namespace %s", arg, o.Namespace)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("there are %d builds %s in namespace %s. Please use the --repo and --branch flags", len(matches), arg, o.Namespace)
+	}
+}
+
+// loadBuild loads the TaskRuns of the PipelineRuns of the activity
+func (o *Options) loadBuild(ctx context.Context, pa *v1.PipelineActivity, paList []v1.PipelineActivity, prs *pipelinev1.PipelineRunList) (*builddiff.Build, error) {
+	build := &builddiff.Build{
+		Activity:    pa,
+		TaskRuns:    map[string]*pipelinev1.TaskRun{},
+		Unavailable: map[string]bool{},
+	}
+	if prs == nil {
+		return build, nil
+	}
+	for i := range prs.Items {
+		pr := &prs.Items[i]
+		if pipelines.ToPipelineActivityName(pr, paList) != pa.Name {
+			continue
+		}
+		taskRuns, missing, err := pipelines.StageTaskRuns(ctx, o.TektonClient, o.Namespace, pr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the TaskRuns of PipelineRun %s: %w", pr.Name, err)
+		}
+		for stageName, tr := range taskRuns {
+			build.TaskRuns[stageName] = tr
+		}
+		for _, stageName := range missing {
+			build.Unavailable[stageName] = true
+		}
+	}
+	return build, nil
+}
+
+// diffLogs compares the logs of the first failed step of the builds with the same step of the other build
+func (o *Options) diffLogs(ctx context.Context, from, to *builddiff.Build) error {
+	toStep := to.FirstFailedStep()
+	fromStep := from.FirstFailedStep()
+	switch {
+	case toStep != nil:
+		fromStep = from.FindStep(toStep.Stage, toStep.Step)
+	case fromStep != nil:
+		toStep = to.FindStep(fromStep.Stage, fromStep.Step)
+	default:
+		log.Logger().Infof("no failed steps to compare the logs of")
+		return nil
+	}
+	for _, b := range []*builddiff.Build{from, to} {
+		for _, step := range []*builddiff.StepRef{fromStep, toStep} {
+			if step != nil && b.Unavailable[step.Stage] {
+				log.Logger().Warnf("the TaskRun of stage %s of %s has been deleted so its steps cannot be compared", step.Stage, b.Activity.Name)
+				return nil
+			}
+		}
+	}
+
+	fromLog, err := o.stepLog(ctx, fromStep)
+	if err != nil {
+		return err
+	}
+	toLog, err := o.stepLog(ctx, toStep)
+	if err != nil {
+		return err
+	}
+	step := fromStep
+	if step == nil {
+		step = toStep
+	}
+	name := step.Stage + "/" + step.Step
+	o.LogDiff, err = builddiff.UnifiedDiff("a/"+name, "b/"+name, builddiff.StripTimestamps(fromLog), builddiff.StripTimestamps(toLog))
+	if err != nil {
+		return fmt.Errorf("failed to diff the logs of step %s: %w", name, err)
+	}
+	return nil
+}
+
+// stepLog returns the log of the step or an empty string if the step did not run
+func (o *Options) stepLog(ctx context.Context, step *builddiff.StepRef) (string, error) {
+	if step == nil || step.PodName == "" {
+		return "", nil
+	}
+	data, err := o.KubeClient.CoreV1().Pods(o.Namespace).GetLogs(step.PodName, &corev1.PodLogOptions{
+		Container: step.Container,
+	}).DoRaw(ctx)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Logger().Warnf("the pod %s of stage %s has been garbage collected so its log cannot be compared", step.PodName, step.Stage)
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get the log of container %s of pod %s: %w", step.Container, step.PodName, err)
+	}
+	return string(data), nil
+}
+
+func (o *Options) render(from, to *builddiff.Build) error {
+	d := o.Diff
+	info := termcolor.ColorInfo
+	fmt.Fprintf(o.Out, "Comparing %s with %s\n\n", info(from.Activity.Name), info(to.Activity.Name))
+
+	if len(d.Commit) == 0 {
+		fmt.Fprintf(o.Out, "The builds are of the same commit\n\n")
+	} else {
+		t := table.CreateTable(o.Out)
+		t.AddRow("COMMIT", "FROM", "TO")
+		for _, c := range d.Commit {
+			t.AddRow(c.Name, c.From, c.To)
+		}
+		t.Render()
+		fmt.Fprintln(o.Out)
+	}
+
+	if len(d.Stages) > 0 {
+		t := table.CreateTable(o.Out)
+		t.AddRow("STAGE", "FROM", "TO", "FROM DURATION", "TO DURATION", "CHANGE")
+		for _, s := range d.Stages {
+			change := ""
+			if s.FromDuration > 0 && s.ToDuration > 0 {
+				delta := s.ToDuration - s.FromDuration
+				change = delta.String()
+				if delta >= 0 {
+					change = "+" + change
+				}
+			}
+			t.AddRow(s.Name, string(s.FromStatus), string(s.ToStatus), formatDuration(s.FromDuration), formatDuration(s.ToDuration), change)
+		}
+		t.Render()
+		fmt.Fprintln(o.Out)
+	}
+
+	for _, s := range d.Specs {
+		fmt.Fprintf(o.Out, "Spec of stage %s:\n%s\n", info(s.Stage), s.Diff)
+	}
+	for _, name := range d.Unavailable {
+		fmt.Fprintf(o.Out, "Spec of stage %s: unavailable as its TaskRun has been deleted\n\n", info(name))
+	}
+	if o.LogDiff != "" {
+		fmt.Fprintf(o.Out, "Log of the first failed step:\n%s\n", o.LogDiff)
+	}
+	return nil
+}
+
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
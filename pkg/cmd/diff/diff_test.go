@@ -0,0 +1,187 @@
+//go:build unit
+// +build unit
+
+package diff_test
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/diff"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const ns = "jx"
+
+func TestDiff(t *testing.T) {
+	var objects []runtime.Object
+	var tektonObjects []runtime.Object
+	for _, b := range []struct {
+		build    int
+		sha      string
+		image    string
+		status   v1.ActivityStatusType
+		exitCode int32
+	}{
+		{build: 1, sha: "abc123", image: "golang:1.21", status: v1.ActivityStatusTypeSucceeded},
+		{build: 2, sha: "def456", image: "golang:1.22", status: v1.ActivityStatusTypeFailed, exitCode: 1},
+	} {
+		pa, pr, tr := newBuild(b.build, b.sha, b.image, b.status, b.exitCode)
+		objects = append(objects, pa)
+		tektonObjects = append(tektonObjects, pr, tr)
+	}
+
+	out := &bytes.Buffer{}
+	_, o := diff.NewCmdPipelineDiff()
+	o.KubeClient = fake.NewSimpleClientset()
+	o.JXClient = fakejx.NewSimpleClientset(objects...)
+	o.TektonClient = faketekton.NewSimpleClientset(tektonObjects...)
+	o.Namespace = ns
+	o.Out = out
+	o.Ctx = context.Background()
+	o.BuildFilter.Repository = "cheese"
+	o.BuildFilter.Branch = "main"
+	o.Args = []string{"1", "myorg-cheese-main-2"}
+
+	err := o.Run()
+	require.NoError(t, err, "failed to run")
+	t.Logf("got output:\n%s\n", out.String())
+
+	require.NotNil(t, o.Diff)
+	require.Len(t, o.Diff.Commit, 1)
+	assert.Equal(t, "abc123", o.Diff.Commit[0].From)
+	assert.Equal(t, "def456", o.Diff.Commit[0].To)
+
+	require.Len(t, o.Diff.Stages, 1)
+	assert.Equal(t, v1.ActivityStatusTypeSucceeded, o.Diff.Stages[0].FromStatus)
+	assert.Equal(t, v1.ActivityStatusTypeFailed, o.Diff.Stages[0].ToStatus)
+
+	require.Len(t, o.Diff.Specs, 1)
+	assert.Contains(t, o.Diff.Specs[0].Diff, "+  image: golang:1.22")
+	assert.Contains(t, out.String(), "Spec of stage")
+
+	o.Args = []string{"1", "3"}
+	err = o.Run()
+	require.Error(t, err, "should fail for a missing build")
+}
+
+func TestDiffMissingTaskRun(t *testing.T) {
+	pa1, pr1, _ := newBuild(1, "abc123", "golang:1.21", v1.ActivityStatusTypeSucceeded, 0)
+	pa2, pr2, tr2 := newBuild(2, "def456", "golang:1.22", v1.ActivityStatusTypeFailed, 1)
+
+	out := &bytes.Buffer{}
+	_, o := diff.NewCmdPipelineDiff()
+	o.KubeClient = fake.NewSimpleClientset()
+	o.JXClient = fakejx.NewSimpleClientset(pa1, pa2)
+	o.TektonClient = faketekton.NewSimpleClientset(pr1, pr2, tr2)
+	o.Namespace = ns
+	o.Out = out
+	o.Ctx = context.Background()
+	o.Logs = true
+	o.Args = []string{"myorg-cheese-main-1", "myorg-cheese-main-2"}
+
+	err := o.Run()
+	require.NoError(t, err, "should not fail when the TaskRun of a stage has been deleted")
+	t.Logf("got output:\n%s\n", out.String())
+
+	require.Len(t, o.Diff.Stages, 1)
+	assert.Equal(t, v1.ActivityStatusTypeFailed, o.Diff.Stages[0].ToStatus)
+	assert.Empty(t, o.Diff.Specs, "should not compare the spec of a stage without a TaskRun")
+	assert.Equal(t, []string{"build"}, o.Diff.Unavailable)
+	assert.Empty(t, o.LogDiff, "should not compare the steps of a stage without a TaskRun")
+	assert.Contains(t, out.String(), "unavailable as its TaskRun has been deleted")
+}
+
+func newBuild(build int, sha, image string, status v1.ActivityStatusType, exitCode int32) (*v1.PipelineActivity, *pipelinev1.PipelineRun, *pipelinev1.TaskRun) {
+	started := metav1.NewTime(time.Date(2024, 1, 2, 10, build, 0, 0, time.UTC))
+	completed := metav1.NewTime(started.Add(time.Minute))
+	buildNumber := strconv.Itoa(build)
+	pa := &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-cheese-main-" + buildNumber,
+			Namespace: ns,
+		},
+		Spec: v1.PipelineActivitySpec{
+			Build:         buildNumber,
+			GitOwner:      "myorg",
+			GitRepository: "cheese",
+			GitBranch:     "main",
+			LastCommitSHA: sha,
+			Status:        status,
+			Steps: []v1.PipelineActivityStep{
+				{
+					Kind: v1.ActivityStepKindTypeStage,
+					Stage: &v1.StageActivityStep{
+						CoreActivityStep: v1.CoreActivityStep{
+							Name:               "build",
+							Status:             status,
+							StartedTimestamp:   &started,
+							CompletedTimestamp: &completed,
+						},
+					},
+				},
+			},
+		},
+	}
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-" + buildNumber,
+			Namespace: ns,
+			Labels: map[string]string{
+				"lighthouse.jenkins-x.io/refs.org":  "myorg",
+				"lighthouse.jenkins-x.io/refs.repo": "cheese",
+				"lighthouse.jenkins-x.io/branch":    "main",
+				"build":                             buildNumber,
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{Name: "cheese-main-" + buildNumber + "-build", PipelineTaskName: "build"},
+				},
+			},
+		},
+	}
+	tr := &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-" + buildNumber + "-build",
+			Namespace: ns,
+			Labels: map[string]string{
+				pipelines.PipelineRunLabel: pr.Name,
+			},
+		},
+		Status: pipelinev1.TaskRunStatus{
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				PodName: "cheese-main-" + buildNumber + "-build-pod",
+				Steps: []pipelinev1.StepState{
+					{
+						Name:      "compile",
+						Container: "step-compile",
+						ContainerState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode},
+						},
+					},
+				},
+				TaskSpec: &pipelinev1.TaskSpec{
+					Steps: []pipelinev1.Step{
+						{Name: "compile", Image: image, Script: "make build"},
+					},
+				},
+			},
+		},
+	}
+	return pa, pr, tr
+}
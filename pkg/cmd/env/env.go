@@ -175,6 +175,7 @@ func (o *Options) Run() error {
 
 	var pipelineNames []string
 	m := map[string]*PipelinePod{}
+	paNames := map[string]*v1.PipelineActivity{}
 	for _, name := range filteredNames {
 		pa := paMap[name]
 		if pa == nil {
@@ -192,6 +193,7 @@ func (o *Options) Run() error {
 			ActivitySpec: &pa.Spec,
 			PipelineRuns: pr,
 		}
+		paNames[name] = pa
 	}
 
 	sort.Strings(pipelineNames)
@@ -205,6 +207,13 @@ func (o *Options) Run() error {
 		return fmt.Errorf("could not find Pipeline Pod for name: %s", name)
 	}
 
+	// lets only load the TaskRuns of the pipeline we picked
+	pa := paNames[name]
+	o.TektonLogger.ResolvePipelineActivity(pa, pp.PipelineRuns)
+	if podName := pa.Labels["podName"]; podName != "" {
+		pp.PodName = podName
+	}
+
 	return o.viewEnvironment(name, pp)
 }
 
@@ -277,6 +286,31 @@ func (o *Options) viewVariables(pp *PipelinePod, stepName string) error {
 	return o.renderEnv(envVars)
 }
 
+// ViewPodEnvironment displays the environment variables of each step of the pod
+func (o *Options) ViewPodEnvironment(podName string) error {
+	ctx := o.GetContext()
+	pod, err := o.KubeClient.CoreV1().Pods(o.Namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to load pod %s in namespace %s: %w", podName, o.Namespace, err)
+	}
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if !strings.HasPrefix(c.Name, "step-") {
+			continue
+		}
+		envVars, err := o.PodEnvVars(pod, c.Name)
+		if err != nil {
+			return fmt.Errorf("failed to get environment variables: %w", err)
+		}
+		log.Logger().Infof("step %s:", termcolor.ColorInfo(strings.TrimPrefix(c.Name, "step-")))
+		err = o.renderEnv(envVars)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // PodEnvVars returns the pod environment variables for the given container name
 func (o *Options) PodEnvVars(pod *corev1.Pod, containerName string) (map[string]string, error) {
 	for i := range pod.Spec.Containers {
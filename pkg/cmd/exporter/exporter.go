@@ -0,0 +1,213 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/metrics"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Namespace       string
+	Listen          string
+	Labels          []string
+	Branches        string
+	MaxRepositories int
+	BuildFilter     tektonlog.BuildPodInfoFilter
+	KubeClient      kubernetes.Interface
+	JXClient        versioned.Interface
+	Metrics         *metrics.Metrics
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Serves Prometheus metrics of the pipelines on /metrics by watching the PipelineActivity resources.
+
+		The metrics include counters and histograms of the pipeline and stage durations, a gauge of the running and pending pipelines and the time of the last successful pipeline of each repository and branch.
+
+		The cardinality of the labels can be bounded by choosing which labels to include, which branches to keep and the maximum number of repositories.
+`)
+
+	cmdExample = templates.Examples(`
+		# Serve the metrics on port 9090
+		jx pipeline exporter --listen :9090
+
+		# Only include the repository label with the main branch metrics
+		jx pipeline exporter --labels repo,branch --branches '^main$'
+	`)
+)
+
+// NewCmdPipelineExporter creates the command
+func NewCmdPipelineExporter() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "exporter",
+		Short:   "Serves Prometheus metrics of the pipelines",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Run: func(_ *cobra.Command, _ []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to watch the pipelines. Defaults to the current namespace")
+	cmd.Flags().StringVarP(&o.Listen, "listen", "l", ":9090", "The address to serve the metrics on")
+	cmd.Flags().StringSliceVarP(&o.Labels, "labels", "", metrics.Labels, "The labels to include on the metrics. Valid values are: "+strings.Join(metrics.Labels, ", "))
+	cmd.Flags().StringVarP(&o.Branches, "branches", "", "", "A regular expression of the branches to keep as label values. Other branches use the value '"+metrics.OtherValue+"'. Defaults to all branches")
+	cmd.Flags().IntVarP(&o.MaxRepositories, "max-repos", "", 500, "The maximum number of repositories to keep as label values. Any more repositories use the value '"+metrics.OtherValue+"'. Use 0 for no limit")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if o.MaxRepositories < 0 {
+		return options.InvalidOptionf("max-repos", o.MaxRepositories, "must not be negative")
+	}
+	if o.Metrics == nil {
+		config := metrics.Config{
+			Labels:          o.Labels,
+			MaxRepositories: o.MaxRepositories,
+		}
+		if o.Branches != "" {
+			re, err := regexp.Compile(o.Branches)
+			if err != nil {
+				return options.InvalidOptionf("branches", o.Branches, "invalid regular expression: %s", err.Error())
+			}
+			config.Branches = re
+		}
+		m, err := metrics.NewMetrics(config)
+		if err != nil {
+			return options.InvalidOptionf("labels", strings.Join(o.Labels, ","), "%s", err.Error())
+		}
+		o.Metrics = m
+	}
+
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	o.WatchActivities(ctx)
+
+	registry := prometheus.NewRegistry()
+	err = registry.Register(o.Metrics)
+	if err != nil {
+		return fmt.Errorf("failed to register metrics: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{
+		Addr:              o.Listen,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	log.Logger().Infof("serving metrics of the pipelines in namespace %s on %s", termcolor.ColorInfo(o.Namespace), termcolor.ColorInfo(o.Listen+"/metrics"))
+	err = server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve metrics on %s: %w", o.Listen, err)
+	}
+	return nil
+}
+
+// WatchActivities starts an informer updating the metrics until the context is done
+func (o *Options) WatchActivities(ctx context.Context) {
+	activityInterface := o.JXClient.JenkinsV1().PipelineActivities(o.Namespace)
+	// activities are not selected by label on the server as those without the lighthouse labels would never be
+	// seen, onActivity filters them using the BuildFilter instead
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			return activityInterface.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return activityInterface.Watch(ctx, options)
+		},
+	}
+	_, controller := cache.NewInformerWithOptions(cache.InformerOptions{
+		ListerWatcher: listWatch,
+		ObjectType:    &v1.PipelineActivity{},
+		Handler: cache.ResourceEventHandlerFuncs{
+			AddFunc: func(obj interface{}) {
+				o.onActivity(obj)
+			},
+			UpdateFunc: func(_, newObj interface{}) {
+				o.onActivity(newObj)
+			},
+			DeleteFunc: func(obj interface{}) {
+				if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+					obj = tombstone.Obj
+				}
+				if pa, ok := obj.(*v1.PipelineActivity); ok {
+					o.Metrics.OnDelete(pa)
+				}
+			},
+		},
+		ResyncPeriod: time.Minute * 10,
+	})
+	go controller.Run(ctx.Done())
+}
+
+func (o *Options) onActivity(obj interface{}) {
+	pa, ok := obj.(*v1.PipelineActivity)
+	if !ok {
+		log.Logger().Infof("Object is not a PipelineActivity %#v", obj)
+		return
+	}
+	if o.BuildFilter.Matches(pa) {
+		o.Metrics.OnActivity(pa)
+	}
+}
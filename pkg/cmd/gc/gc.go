@@ -0,0 +1,513 @@
+package gc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cloud/buckets"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/retention"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/spf13/cobra"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Namespace     string
+	Policy        retention.Policy
+	DryRun        bool
+	DeleteOrphans bool
+	ArchiveBucket string
+	ArchivePrefix string
+	GitUsername   string
+	GitToken      string
+	BuildFilter   tektonlog.BuildPodInfoFilter
+	KubeClient    kubernetes.Interface
+	JXClient      versioned.Interface
+	TektonClient  tektonclient.Interface
+	TektonLogger  *tektonlog.TektonLogger
+	Out           io.Writer
+	Now           time.Time
+
+	// ScmClients cache of Scm Clients for each git server URL mostly used for testing
+	ScmClients map[string]*scm.Client
+
+	// WriteBucket writes the archived files to the bucket which defaults to buckets.WriteBucket
+	WriteBucket func(ctx context.Context, bucketURL, key string, reader io.Reader) error
+
+	// Deleted the names of the deleted PipelineActivity resources
+	Deleted []string
+}
+
+// Summary the number of resources deleted
+type Summary struct {
+	Activities   int
+	PipelineRuns int
+	TaskRuns     int
+	Kept         int
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Garbage collects old PipelineActivity, PipelineRun and TaskRun resources using retention policies.
+
+		The policies are applied to the builds of each repository and branch. Running builds are never deleted. A build is kept if it is one of the latest builds, if it started within the keep duration or if it is the last successful build.
+
+		Builds of pull requests which are closed can use a different keep duration which replaces the latest builds and keep duration policies. The last successful build of a closed pull request is still kept if --keep-last-success is enabled.
+
+		With --delete-orphans the PipelineRuns and TaskRuns created by lighthouse which have no PipelineActivity are also deleted once they have completed and are older than the keep duration.
+
+		Before a build is deleted its PipelineActivity YAML and logs can be archived to a bucket.
+`)
+
+	cmdExample = templates.Examples(`
+		# View which builds would be deleted
+		jx pipeline gc --dry-run
+
+		# Keep the last 5 builds of each branch for at least 3 days
+		jx pipeline gc --keep-last 5 --keep-for 72h
+
+		# Delete the builds of closed pull requests after a day archiving them to a bucket
+		jx pipeline gc --closed-pr-keep-for 24h --archive-bucket s3://my-bucket
+
+		# Also delete the old PipelineRuns and TaskRuns of lighthouse which have no PipelineActivity
+		jx pipeline gc --delete-orphans
+	`)
+)
+
+// NewCmdPipelineGC creates the command
+func NewCmdPipelineGC() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "gc",
+		Short:   "Garbage collects old PipelineActivity, PipelineRun and TaskRun resources",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Run: func(_ *cobra.Command, _ []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().IntVarP(&o.Policy.KeepLast, "keep-last", "", 10, "The number of the latest builds of each repository and branch to keep")
+	cmd.Flags().DurationVarP(&o.Policy.KeepFor, "keep-for", "", 7*24*time.Hour, "The minimum duration to keep builds since they started")
+	cmd.Flags().BoolVarP(&o.Policy.KeepLastSuccess, "keep-last-success", "", true, "Always keep the last successful build of each repository and branch")
+	cmd.Flags().DurationVarP(&o.Policy.ClosedPRKeepFor, "closed-pr-keep-for", "", 0, "The duration to keep builds of closed pull requests. Use 0 to apply the other policies to pull requests")
+	cmd.Flags().BoolVarP(&o.DryRun, "dry-run", "", false, "Only display the builds which would be deleted")
+	cmd.Flags().BoolVarP(&o.DeleteOrphans, "delete-orphans", "", false, "Also delete the completed PipelineRuns and TaskRuns created by lighthouse which have no PipelineActivity once they are older than the keep duration")
+	cmd.Flags().StringVarP(&o.ArchiveBucket, "archive-bucket", "", "", "The bucket URL to archive the PipelineActivity YAML and logs to before deleting. e.g. 's3://my-bucket' or 'gs://my-bucket'")
+	cmd.Flags().StringVarP(&o.ArchivePrefix, "archive-prefix", "", "archive", "The key prefix of the archived files in the bucket")
+	cmd.Flags().StringVarP(&o.GitUsername, "git-username", "", "", "The git username used to find the pull requests. If not specified it's loaded from the git credentials file")
+	cmd.Flags().StringVarP(&o.GitToken, "git-token", "", "", "The git token used to find the pull requests. If not specified it's loaded from the git credentials file")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if o.Policy.KeepLast < 0 {
+		return options.InvalidOptionf("keep-last", o.Policy.KeepLast, "must not be negative")
+	}
+	if o.Policy.KeepFor < 0 {
+		return options.InvalidOptionf("keep-for", o.Policy.KeepFor, "must not be negative")
+	}
+	if o.Policy.ClosedPRKeepFor < 0 {
+		return options.InvalidOptionf("closed-pr-keep-for", o.Policy.ClosedPRKeepFor, "must not be negative")
+	}
+	if o.Policy.IsClosedPullRequest == nil {
+		o.Policy.IsClosedPullRequest = o.isClosedPullRequest
+	}
+
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	if o.TektonClient == nil {
+		f := kubeclient.NewFactory()
+		cfg, err := f.CreateKubeConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes config: %w", err)
+		}
+		o.TektonClient, err = tektonclient.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building tekton client: %w", err)
+		}
+	}
+	if o.TektonLogger == nil {
+		o.TektonLogger = &tektonlog.TektonLogger{
+			KubeClient:   o.KubeClient,
+			TektonClient: o.TektonClient,
+			JXClient:     o.JXClient,
+			Namespace:    o.Namespace,
+		}
+	}
+	if o.WriteBucket == nil {
+		o.WriteBucket = buckets.WriteBucket
+	}
+	if o.ScmClients == nil {
+		o.ScmClients = map[string]*scm.Client{}
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	ns := o.Namespace
+	list, err := tektonlog.ListFilteredPipelineActivities(ctx, o.JXClient, ns, &o.BuildFilter)
+	if err != nil {
+		return fmt.Errorf("failed to list PipelineActivity resources in namespace %s: %w", ns, err)
+	}
+	var items []v1.PipelineActivity
+	for i := range list {
+		pa := &list[i]
+		if o.BuildFilter.Matches(pa) {
+			items = append(items, *pa)
+		}
+	}
+
+	decisions, err := retention.Select(items, &o.Policy, o.Now)
+	if err != nil {
+		return fmt.Errorf("failed to apply the retention policies: %w", err)
+	}
+
+	apiVersion := pipelines.ServedAPIVersion(o.TektonClient)
+	prs, err := tektonlog.ListFilteredPipelineRuns(ctx, o.TektonClient, ns, apiVersion, &o.BuildFilter)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", ns, err)
+	}
+	prMap := map[string][]*pipelinev1.PipelineRun{}
+	for i := range prs {
+		pr := &prs[i]
+		paName := pipelines.ToPipelineActivityName(pr, list)
+		if paName != "" {
+			prMap[paName] = append(prMap[paName], pr)
+		}
+	}
+
+	summary := &Summary{}
+	t := table.CreateTable(o.Out)
+	t.AddRow("ACTIVITY", "STATUS", "AGE", "REASON", "PIPELINERUNS", "TASKRUNS")
+	for i := range decisions {
+		d := &decisions[i]
+		if !d.Delete {
+			summary.Kept++
+			continue
+		}
+		pa := d.Activity
+		prList := prMap[pa.Name]
+		taskRuns, err := o.deleteActivity(ctx, apiVersion, pa, prList)
+		if err != nil {
+			return err
+		}
+		summary.Activities++
+		summary.PipelineRuns += len(prList)
+		summary.TaskRuns += taskRuns
+		o.Deleted = append(o.Deleted, pa.Name)
+
+		age := ""
+		if pa.Spec.StartedTimestamp != nil {
+			age = o.Now.Sub(pa.Spec.StartedTimestamp.Time).Round(time.Minute).String()
+		}
+		t.AddRow(pa.Name, string(pa.Spec.Status), age, d.Reason, strconv.Itoa(len(prList)), strconv.Itoa(taskRuns))
+	}
+
+	if o.DeleteOrphans {
+		err = o.deleteOrphans(ctx, apiVersion, list, prs, summary, &t)
+		if err != nil {
+			return err
+		}
+	}
+
+	if summary.Activities == 0 && summary.PipelineRuns == 0 && summary.TaskRuns == 0 {
+		log.Logger().Infof("no pipelines to delete in namespace %s, keeping %d", ns, summary.Kept)
+		return nil
+	}
+	t.Render()
+
+	verb := "deleted"
+	if o.DryRun {
+		verb = "would delete"
+	}
+	log.Logger().Infof("%s %s PipelineActivities, %s PipelineRuns and %s TaskRuns in namespace %s, keeping %d PipelineActivities",
+		verb, termcolor.ColorInfo(summary.Activities), termcolor.ColorInfo(summary.PipelineRuns), termcolor.ColorInfo(summary.TaskRuns), ns, summary.Kept)
+	return nil
+}
+
+// deleteActivity archives and deletes the activity and its PipelineRuns and TaskRuns returning the number of TaskRuns
+func (o *Options) deleteActivity(ctx context.Context, apiVersion string, pa *v1.PipelineActivity, prList []*pipelinev1.PipelineRun) (int, error) {
+	ns := o.Namespace
+	taskRunNames, err := o.listTaskRunNames(ctx, apiVersion, prList)
+	if err != nil {
+		return 0, err
+	}
+	if o.DryRun {
+		return len(taskRunNames), nil
+	}
+
+	if o.ArchiveBucket != "" {
+		err := o.archive(ctx, pa, prList)
+		if err != nil {
+			return 0, fmt.Errorf("failed to archive PipelineActivity %s: %w", pa.Name, err)
+		}
+	}
+	err = o.deleteRuns(ctx, apiVersion, prList, taskRunNames)
+	if err != nil {
+		return 0, err
+	}
+	err = o.JXClient.JenkinsV1().PipelineActivities(ns).Delete(ctx, pa.Name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return 0, fmt.Errorf("failed to delete PipelineActivity %s in namespace %s: %w", pa.Name, ns, err)
+	}
+	return len(taskRunNames), nil
+}
+
+// deleteOrphans deletes the completed PipelineRuns created by lighthouse which have no PipelineActivity and the
+// completed TaskRuns created by lighthouse which have no PipelineRun once they are older than the keep duration
+func (o *Options) deleteOrphans(ctx context.Context, apiVersion string, activities []v1.PipelineActivity, prs []pipelinev1.PipelineRun, summary *Summary, t *table.Table) error {
+	ns := o.Namespace
+	activityNames := map[string]bool{}
+	for i := range activities {
+		activityNames[activities[i].Name] = true
+	}
+
+	prNames := map[string]bool{}
+	for i := range prs {
+		pr := &prs[i]
+		prNames[pr.Name] = true
+		if !o.isLighthouseRun(pr.Labels) {
+			continue
+		}
+		paName := pipelines.ToPipelineActivityName(pr, activities)
+		if paName != "" && activityNames[paName] {
+			continue
+		}
+		status := pipelines.ToPipelineRunStatus(pr)
+		age := o.Now.Sub(pipelineRunStartTime(pr))
+		if !status.IsTerminated() || age < o.Policy.KeepFor {
+			continue
+		}
+		prList := []*pipelinev1.PipelineRun{pr}
+		taskRunNames, err := o.listTaskRunNames(ctx, apiVersion, prList)
+		if err != nil {
+			return err
+		}
+		if !o.DryRun {
+			err = o.deleteRuns(ctx, apiVersion, prList, taskRunNames)
+			if err != nil {
+				return err
+			}
+		}
+		summary.PipelineRuns++
+		summary.TaskRuns += len(taskRunNames)
+		t.AddRow("pipelinerun/"+pr.Name, string(status), age.Round(time.Minute).String(), retention.ReasonOrphaned, "1", strconv.Itoa(len(taskRunNames)))
+	}
+
+	trs, err := pipelines.ListTaskRuns(ctx, o.TektonClient, ns, apiVersion, metav1.ListOptions{
+		LabelSelector: o.BuildFilter.PipelineRunLabelSelector(),
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to list TaskRuns in namespace %s: %w", ns, err)
+	}
+	if trs == nil {
+		return nil
+	}
+	for i := range trs.Items {
+		tr := &trs.Items[i]
+		if prNames[tr.Labels[pipelines.PipelineRunLabel]] || tr.Status.CompletionTime == nil || !o.isLighthouseRun(tr.Labels) {
+			continue
+		}
+		age := o.Now.Sub(tr.CreationTimestamp.Time)
+		if tr.Status.StartTime != nil {
+			age = o.Now.Sub(tr.Status.StartTime.Time)
+		}
+		if age < o.Policy.KeepFor {
+			continue
+		}
+		if !o.DryRun {
+			err = o.deleteRuns(ctx, apiVersion, nil, []string{tr.Name})
+			if err != nil {
+				return err
+			}
+		}
+		summary.TaskRuns++
+		t.AddRow("taskrun/"+tr.Name, "", age.Round(time.Minute).String(), retention.ReasonOrphaned, "0", "1")
+	}
+	return nil
+}
+
+// isLighthouseRun returns true if the labels of a PipelineRun or TaskRun show lighthouse created it for the owner,
+// repository and branch of the filter so that runs created by other tools are never treated as orphans
+func (o *Options) isLighthouseRun(labels map[string]string) bool {
+	f := &o.BuildFilter
+	values := map[string]string{
+		tektonlog.LabelLighthouseOwner:  f.Owner,
+		tektonlog.LabelLighthouseRepo:   f.Repository,
+		tektonlog.LabelLighthouseBranch: f.Branch,
+	}
+	for k, v := range values {
+		if labels[k] == "" || (v != "" && labels[k] != v) {
+			return false
+		}
+	}
+	return f.Context == "" || labels[tektonlog.LabelLighthouseContext] == f.Context
+}
+
+// listTaskRunNames returns the names of the TaskRuns of the PipelineRuns
+func (o *Options) listTaskRunNames(ctx context.Context, apiVersion string, prList []*pipelinev1.PipelineRun) ([]string, error) {
+	ns := o.Namespace
+	var taskRunNames []string
+	for _, pr := range prList {
+		trs, err := pipelines.ListTaskRuns(ctx, o.TektonClient, ns, apiVersion, metav1.ListOptions{
+			LabelSelector: pipelines.PipelineRunLabel + "=" + pr.Name,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("failed to list TaskRuns of PipelineRun %s in namespace %s: %w", pr.Name, ns, err)
+		}
+		if trs != nil {
+			for i := range trs.Items {
+				taskRunNames = append(taskRunNames, trs.Items[i].Name)
+			}
+		}
+	}
+	return taskRunNames, nil
+}
+
+// deleteRuns deletes the TaskRuns and PipelineRuns
+func (o *Options) deleteRuns(ctx context.Context, apiVersion string, prList []*pipelinev1.PipelineRun, taskRunNames []string) error {
+	ns := o.Namespace
+	for _, name := range taskRunNames {
+		err := pipelines.DeleteTaskRun(ctx, o.TektonClient, ns, apiVersion, name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete TaskRun %s in namespace %s: %w", name, ns, err)
+		}
+	}
+	for _, pr := range prList {
+		err := pipelines.DeletePipelineRun(ctx, o.TektonClient, ns, apiVersion, pr.Name)
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete PipelineRun %s in namespace %s: %w", pr.Name, ns, err)
+		}
+	}
+	return nil
+}
+
+func pipelineRunStartTime(pr *pipelinev1.PipelineRun) time.Time {
+	if pr.Status.StartTime != nil {
+		return pr.Status.StartTime.Time
+	}
+	return pr.CreationTimestamp.Time
+}
+
+// archive writes the activity YAML and its logs to the archive bucket
+func (o *Options) archive(ctx context.Context, pa *v1.PipelineActivity, prList []*pipelinev1.PipelineRun) error {
+	dir := ArchiveDir(o.ArchivePrefix, pa)
+
+	resource := pa.DeepCopy()
+	resource.APIVersion = "jenkins.io/v1"
+	resource.Kind = "PipelineActivity"
+	resource.ManagedFields = nil
+	data, err := yaml.Marshal(resource)
+	if err != nil {
+		return fmt.Errorf("failed to marshal PipelineActivity to YAML: %w", err)
+	}
+	err = o.WriteBucket(ctx, o.ArchiveBucket, path.Join(dir, "activity.yaml"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	// the logs are best effort as the pods may have already been removed
+	buf := &bytes.Buffer{}
+	err = o.TektonLogger.GetLogsForActivity(ctx, buf, pa.DeepCopy(), pa.Name, prList)
+	if err != nil {
+		log.Logger().Warnf("failed to get the logs of PipelineActivity %s: %s", pa.Name, err.Error())
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+	return o.WriteBucket(ctx, o.ArchiveBucket, path.Join(dir, "logs.txt"), buf)
+}
+
+// ArchiveDir returns the directory in the bucket to archive the activity to
+func ArchiveDir(prefix string, pa *v1.PipelineActivity) string {
+	ps := &pa.Spec
+	if ps.GitRepository == "" || ps.Build == "" {
+		return path.Join(prefix, pa.Name)
+	}
+	return path.Join(prefix, ps.GitOwner, ps.GitRepository, ps.GitBranch, ps.Build)
+}
+
+// isClosedPullRequest returns true if the pull request of the activity is closed. If the pull request cannot be found
+// it is treated as open so that its builds are kept
+func (o *Options) isClosedPullRequest(pa *v1.PipelineActivity) (bool, error) {
+	number := scmclients.PullRequestNumber(pa)
+	if number <= 0 || pa.Spec.GitOwner == "" || pa.Spec.GitRepository == "" {
+		return false, nil
+	}
+	_, err := scmclients.GitServerURL(pa)
+	if err != nil {
+		log.Logger().Warnf("%s so keeping its builds", err.Error())
+		return false, nil
+	}
+	scmClient, err := scmclients.ScmClient(o.ScmClients, o.GitUsername, o.GitToken, pa)
+	if err != nil {
+		return false, err
+	}
+
+	fullName := scm.Join(pa.Spec.GitOwner, pa.Spec.GitRepository)
+	pr, _, err := scmClient.PullRequests.Find(o.GetContext(), fullName, number)
+	if err != nil {
+		log.Logger().Warnf("failed to find pull request %d of repository %s so keeping its builds: %s", number, fullName, err.Error())
+		return false, nil
+	}
+	return pr.Closed || pr.Merged || strings.EqualFold(pr.State, "closed"), nil
+}
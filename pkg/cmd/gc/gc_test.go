@@ -0,0 +1,266 @@
+//go:build unit
+// +build unit
+
+package gc_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cloud/buckets"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/gc"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	"gocloud.dev/blob/memblob"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const ns = "jx"
+
+var now = time.Date(2024, 1, 20, 10, 0, 0, 0, time.UTC)
+
+func TestGC(t *testing.T) {
+	var objects []runtime.Object
+	var tektonObjects []runtime.Object
+	for i, status := range []v1.ActivityStatusType{v1.ActivityStatusTypeSucceeded, v1.ActivityStatusTypeFailed, v1.ActivityStatusTypeFailed} {
+		pa, pr, tr := newBuild("main", i+1, status, 10-i)
+		objects = append(objects, pa)
+		tektonObjects = append(tektonObjects, pr, tr)
+	}
+	pa, pr, tr := newBuild("PR-7", 1, v1.ActivityStatusTypeFailed, 3)
+	objects = append(objects, pa)
+	tektonObjects = append(tektonObjects, pr, tr)
+
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	defer bucket.Close()
+
+	scmClient, fakeData := fakescm.NewDefault()
+	fakeData.PullRequests[7] = &scm.PullRequest{Number: 7, Closed: true}
+
+	newOptions := func() *gc.Options {
+		_, o := gc.NewCmdPipelineGC()
+		o.KubeClient = fake.NewSimpleClientset()
+		o.JXClient = fakejx.NewSimpleClientset(objects...)
+		o.TektonClient = faketekton.NewSimpleClientset(tektonObjects...)
+		o.Namespace = ns
+		o.Now = now
+		o.Out = &bytes.Buffer{}
+		o.Ctx = ctx
+		o.Policy.KeepLast = 1
+		o.Policy.KeepFor = 2 * 24 * time.Hour
+		o.Policy.ClosedPRKeepFor = 24 * time.Hour
+		o.ScmClients = map[string]*scm.Client{"https://github.com": scmClient}
+		o.WriteBucket = func(ctx context.Context, _, key string, reader io.Reader) error {
+			return buckets.WriteBlob(ctx, bucket, key, reader)
+		}
+		return o
+	}
+
+	o := newOptions()
+	o.DryRun = true
+	err := o.Run()
+	require.NoError(t, err, "failed to run dry run")
+	expected := []string{"myorg-cheese-pr-7-1", "myorg-cheese-main-2"}
+	assert.ElementsMatch(t, expected, o.Deleted)
+	assert.Contains(t, o.Out.(*bytes.Buffer).String(), "closed pull request")
+
+	list, err := o.JXClient.JenkinsV1().PipelineActivities(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, list.Items, 4, "should not delete on a dry run")
+
+	o = newOptions()
+	o.ArchiveBucket = "mem://"
+	err = o.Run()
+	require.NoError(t, err, "failed to run")
+	assert.ElementsMatch(t, expected, o.Deleted)
+
+	list, err = o.JXClient.JenkinsV1().PipelineActivities(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for i := range list.Items {
+		names = append(names, list.Items[i].Name)
+	}
+	assert.ElementsMatch(t, []string{"myorg-cheese-main-1", "myorg-cheese-main-3"}, names)
+
+	prs, err := o.TektonClient.TektonV1().PipelineRuns(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, prs.Items, 2)
+	trs, err := o.TektonClient.TektonV1().TaskRuns(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, trs.Items, 2)
+
+	reader, err := buckets.ReadBlob(ctx, bucket, "archive/myorg/cheese/main/2/activity.yaml")
+	require.NoError(t, err, "should have archived the activity")
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	archived := &v1.PipelineActivity{}
+	require.NoError(t, yaml.Unmarshal(data, archived))
+	assert.Equal(t, "myorg-cheese-main-2", archived.Name)
+	assert.Equal(t, v1.ActivityStatusTypeFailed, archived.Spec.Status)
+}
+
+func TestGCOrphans(t *testing.T) {
+	_, oldPR, oldTR := newBuild("main", 1, v1.ActivityStatusTypeSucceeded, 5)
+	_, recentPR, recentTR := newBuild("main", 2, v1.ActivityStatusTypeSucceeded, 1)
+	started := metav1.NewTime(now.Add(-5 * 24 * time.Hour))
+	newTaskRun := func(name string, labels map[string]string) *pipelinev1.TaskRun {
+		return &pipelinev1.TaskRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    labels,
+			},
+			Status: pipelinev1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+					StartTime:      &started,
+					CompletionTime: &started,
+				},
+			},
+		}
+	}
+	orphanTR := newTaskRun("cheese-main-0-build", map[string]string{
+		pipelines.PipelineRunLabel:          "cheese-main-0",
+		"lighthouse.jenkins-x.io/refs.org":  "myorg",
+		"lighthouse.jenkins-x.io/refs.repo": "cheese",
+		"lighthouse.jenkins-x.io/branch":    "main",
+	})
+
+	// runs which were not created by lighthouse should never be treated as orphans
+	manualPR := oldPR.DeepCopy()
+	manualPR.Name = "manual-1"
+	manualPR.Labels = nil
+	manualTR := newTaskRun("manual-task-1", nil)
+
+	ctx := context.Background()
+	newOptions := func() *gc.Options {
+		_, o := gc.NewCmdPipelineGC()
+		o.KubeClient = fake.NewSimpleClientset()
+		o.JXClient = fakejx.NewSimpleClientset()
+		o.TektonClient = faketekton.NewSimpleClientset(oldPR, oldTR, recentPR, recentTR, orphanTR, manualPR, manualTR)
+		o.Namespace = ns
+		o.Now = now
+		o.Out = &bytes.Buffer{}
+		o.Ctx = ctx
+		o.Policy.KeepFor = 2 * 24 * time.Hour
+		return o
+	}
+
+	o := newOptions()
+	err := o.Run()
+	require.NoError(t, err, "failed to run")
+	prs, err := o.TektonClient.TektonV1().PipelineRuns(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, prs.Items, 3, "should not delete orphans without --delete-orphans")
+
+	o = newOptions()
+	o.DeleteOrphans = true
+	err = o.Run()
+	require.NoError(t, err, "failed to run")
+	assert.Empty(t, o.Deleted, "there are no activities")
+	assert.Contains(t, o.Out.(*bytes.Buffer).String(), "orphaned")
+
+	prs, err = o.TektonClient.TektonV1().PipelineRuns(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	var names []string
+	for i := range prs.Items {
+		names = append(names, prs.Items[i].Name)
+	}
+	assert.ElementsMatch(t, []string{recentPR.Name, manualPR.Name}, names, "should keep the PipelineRun within the keep duration and the one not created by lighthouse")
+
+	trs, err := o.TektonClient.TektonV1().TaskRuns(ns).List(ctx, metav1.ListOptions{})
+	require.NoError(t, err)
+	names = nil
+	for i := range trs.Items {
+		names = append(names, trs.Items[i].Name)
+	}
+	assert.ElementsMatch(t, []string{recentTR.Name, manualTR.Name}, names, "should delete the TaskRuns of the orphaned PipelineRun and the lighthouse TaskRun without a PipelineRun")
+}
+
+func newBuild(branch string, build int, status v1.ActivityStatusType, daysAgo int) (*v1.PipelineActivity, *pipelinev1.PipelineRun, *pipelinev1.TaskRun) {
+	started := metav1.NewTime(now.Add(-time.Duration(daysAgo) * 24 * time.Hour))
+	completed := metav1.NewTime(started.Add(time.Minute))
+	buildNumber := strconv.Itoa(build)
+	name := "myorg-cheese-" + strings.ToLower(branch) + "-" + buildNumber
+	labels := map[string]string{
+		"lighthouse.jenkins-x.io/refs.org":  "myorg",
+		"lighthouse.jenkins-x.io/refs.repo": "cheese",
+		"lighthouse.jenkins-x.io/branch":    branch,
+		"lighthouse.jenkins-x.io/buildNum":  buildNumber,
+	}
+	pa := &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels:    labels,
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:           "myorg/cheese/" + branch,
+			Build:              buildNumber,
+			GitOwner:           "myorg",
+			GitRepository:      "cheese",
+			GitBranch:          branch,
+			GitURL:             "https://github.com/myorg/cheese.git",
+			Status:             status,
+			StartedTimestamp:   &started,
+			CompletedTimestamp: &completed,
+		},
+	}
+	condition := corev1.ConditionTrue
+	if status != v1.ActivityStatusTypeSucceeded {
+		condition = corev1.ConditionFalse
+	}
+	prLabels := map[string]string{
+		"build": buildNumber,
+	}
+	for k, v := range labels {
+		prLabels[k] = v
+	}
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-" + strings.ToLower(branch) + "-" + buildNumber,
+			Namespace: ns,
+			Labels:    prLabels,
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			Status: duckv1.Status{
+				Conditions: duckv1.Conditions{
+					{Type: apis.ConditionSucceeded, Status: condition},
+				},
+			},
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &started,
+				CompletionTime: &completed,
+			},
+		},
+	}
+	tr := &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pr.Name + "-build",
+			Namespace: ns,
+			Labels: map[string]string{
+				pipelines.PipelineRunLabel: pr.Name,
+			},
+		},
+	}
+	return pa, pr, tr
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/activities"
 
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/constants"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/triggers"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
@@ -169,8 +170,7 @@ func (o *Options) renderPipelineRuns(ctx context.Context) error {
 	ns := o.Namespace
 	tektonClient := o.TektonClient
 
-	pipelineRuns := tektonClient.TektonV1().PipelineRuns(ns)
-	prList, err := pipelineRuns.List(ctx, metav1.ListOptions{})
+	prList, err := pipelines.ListPipelineRuns(ctx, tektonClient, ns, pipelines.ServedAPIVersion(tektonClient), metav1.ListOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", ns, err)
 	}
@@ -0,0 +1,186 @@
+package grid
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/breakpoint"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/env"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/start"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/pkg/browser"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// defaultBreakpoints the breakpoints created from the grid
+var defaultBreakpoints = []string{"onFailure"}
+
+// rowActions returns the actions on the selected activity indexed by their key
+func (o *Options) rowActions() map[string]*rowAction {
+	return map[string]*rowAction{
+		"x": {name: "stop", confirm: true, fn: o.stopBuild},
+		"R": {name: "rerun", confirm: true, fn: o.rerunBuild},
+		"b": {name: "breakpoint", fn: o.createBreakpoint},
+		"o": {name: "open", fn: o.openBuildURL},
+		"e": {name: "env", leave: true, fn: o.viewEnv},
+		"c": {name: "copy", fn: o.copyName, print: clipboardSequence},
+	}
+}
+
+// stopBuild cancels the running PipelineRuns of the activity like jx pipeline stop
+func (o *Options) stopBuild(t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) (string, error) {
+	ctx := o.GetContext()
+	prs, err := o.activityPipelineRuns(t, act, paList)
+	if err != nil {
+		return "", err
+	}
+	var cancelled []string
+	for _, pr := range prs {
+		if tektonlog.PipelineRunIsComplete(pr) {
+			continue
+		}
+		err = tektonlog.CancelPipelineRun(ctx, t.TektonClient, pr.Namespace, pr)
+		if err != nil {
+			return "", fmt.Errorf("failed to cancel PipelineRun %s: %w", pr.Name, err)
+		}
+		cancelled = append(cancelled, pr.Name)
+	}
+	if len(cancelled) == 0 {
+		return "", fmt.Errorf("pipeline %s has no running PipelineRuns to stop", act.Name)
+	}
+	return fmt.Sprintf("cancelled PipelineRun %s", info(cancelled[0])), nil
+}
+
+// rerunBuild creates a LighthouseJob for the branch and context of the activity like jx pipeline start
+func (o *Options) rerunBuild(t *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+	as := &act.Spec
+	if scmclients.IsPullRequest(act) {
+		return "", fmt.Errorf("cannot rerun pull request %s, please comment /retest on the pull request", as.GitBranch)
+	}
+	lhClient, err := t.lhClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create the lighthouse client: %w", err)
+	}
+	_, so := start.NewCmdPipelineStart()
+	so.BatchMode = true
+	so.Ctx = o.GetContext()
+	so.KubeClient = t.KubeClient
+	so.JXClient = t.JXClient
+	so.LHClient = lhClient
+	so.Input = o.Input
+	so.Namespace = t.namespace(act)
+	so.Context = as.Context
+	so.ScmClients = o.ScmEnricher.ScmClients
+	so.GitUsername = o.ScmEnricher.GitUsername
+	so.GitToken = o.ScmEnricher.GitToken
+	fullName := as.GitOwner + "/" + as.GitRepository + "/" + as.GitBranch
+	so.Args = []string{fullName}
+	err = so.Run()
+	if err != nil {
+		return "", fmt.Errorf("failed to rerun %s: %w", fullName, err)
+	}
+	return fmt.Sprintf("started a new build of %s", info(fullName)), nil
+}
+
+// createBreakpoint creates a LighthouseBreakpoint for the pipeline of the activity like jx pipeline debug
+func (o *Options) createBreakpoint(t *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+	ctx := o.GetContext()
+	lhClient, err := t.lhClient()
+	if err != nil {
+		return "", fmt.Errorf("failed to create the lighthouse client: %w", err)
+	}
+	ns := t.namespace(act)
+	bpInterface := lhClient.LighthouseV1alpha1().LighthouseBreakpoints(ns)
+	bpList, err := bpInterface.List(ctx, metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return "", fmt.Errorf("could not list LighthouseBreakpoint resources: %w", err)
+	}
+	f := breakpoint.ToBreakpointFilter(act)
+	if bpList != nil {
+		for i := range bpList.Items {
+			bp := &bpList.Items[i]
+			if bp.Spec.Filter.Matches(f) {
+				return fmt.Sprintf("the pipeline already has the LighthouseBreakpoint %s", info(bp.Name)), nil
+			}
+		}
+	}
+	bp := breakpoint.NewBreakpoint(act, ns, defaultBreakpoints)
+	_, err = bpInterface.Create(ctx, bp, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create the LighthouseBreakpoint %s: %w", bp.Name, err)
+	}
+	return fmt.Sprintf("created the LighthouseBreakpoint %s", info(bp.Name)), nil
+}
+
+// openBuildURL opens the build URL of the activity in a browser
+func (o *Options) openBuildURL(_ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+	u := act.Spec.BuildURL
+	if u == "" {
+		return "", fmt.Errorf("pipeline %s has no build URL", act.Name)
+	}
+	err := browser.OpenURL(u)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", u, err)
+	}
+	return fmt.Sprintf("opened %s", info(u)), nil
+}
+
+// viewEnv displays the environment variables of the steps of the pod of the activity like jx pipeline env
+func (o *Options) viewEnv(t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) (string, error) {
+	prs, err := o.activityPipelineRuns(t, act, paList)
+	if err != nil {
+		return "", err
+	}
+	ns := t.namespace(act)
+	pa := act.DeepCopy()
+	t.tektonLogger(ns, o.FailIfPodFails).ResolvePipelineActivity(pa, prs)
+	podName := pa.Labels["podName"]
+	if podName == "" {
+		return "", fmt.Errorf("could not find the pod of pipeline %s", act.Name)
+	}
+
+	_, eo := env.NewCmdPipelineEnv()
+	eo.Ctx = o.GetContext()
+	eo.KubeClient = t.KubeClient
+	eo.Namespace = ns
+	err = eo.ViewPodEnvironment(podName)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("viewed the environment of pod %s", info(podName)), nil
+}
+
+// copyName copies the name of the activity to the clipboard. The clipboardSequence is written through the program
+// output once the action completes
+func (o *Options) copyName(_ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+	return fmt.Sprintf("copied %s to the clipboard", info(act.Name)), nil
+}
+
+// clipboardSequence returns the OSC 52 terminal escape sequence which copies the name of the activity to the clipboard
+func clipboardSequence(act *v1.PipelineActivity) string {
+	return fmt.Sprintf("\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(act.Name)))
+}
+
+// activityPipelineRuns returns the PipelineRuns of the activity
+func (o *Options) activityPipelineRuns(t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) ([]*pipelinev1.PipelineRun, error) {
+	ns := t.namespace(act)
+	resources, err := pipelines.ListPipelineRuns(o.GetContext(), t.TektonClient, ns, pipelines.ServedAPIVersion(t.TektonClient), metav1.ListOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", ns, err)
+	}
+	var answer []*pipelinev1.PipelineRun
+	if resources != nil {
+		for i := range resources.Items {
+			pr := &resources.Items[i]
+			if pipelines.ToPipelineActivityName(pr, paList) == act.Name {
+				answer = append(answer, pr)
+			}
+		}
+	}
+	return answer, nil
+}
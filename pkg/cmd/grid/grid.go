@@ -3,11 +3,11 @@ package grid
 import (
 	"context"
 	"fmt"
-	"os"
-	"time"
+	"io"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scminfo"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
@@ -15,11 +15,11 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/input/inputfactory"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
-	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	lhclient "github.com/jenkins-x/lighthouse-client/pkg/client/clientset/versioned"
 	"github.com/spf13/cobra"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
@@ -29,10 +29,8 @@ import (
 
 	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
-	informers "github.com/jenkins-x/jx-api/v4/pkg/client/informers/externalversions"
 
 	"k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/tools/cache"
 )
 
 // Options containers the CLI options
@@ -40,11 +38,17 @@ type Options struct {
 	options.BaseOptions
 
 	Namespace      string
+	Namespaces     []string
+	Contexts       []string
+	AllNamespaces  bool
 	Filter         string
 	FailIfPodFails bool
+	SCM            bool
+	ScmEnricher    scminfo.Enricher
 	KubeClient     kubernetes.Interface
 	JXClient       versioned.Interface
 	TektonClient   tektonclient.Interface
+	LHClient       lhclient.Interface
 	TektonLogger   *tektonlog.TektonLogger
 	Input          input.Interface
 }
@@ -55,8 +59,22 @@ var (
 	cmdLong = templates.LongDesc(`
 		Watches pipeline activity in a table
 
-		You can use the up/down cursor keys to select a pipeline then hit enter on the selected pipeline to view its log. 
-		When the pipeline is completed you can then go back to the pipeline grid and view other pipelines.
+		You can use the up/down cursor keys to select a pipeline then hit enter or the right arrow to show the stages and steps of the selected pipeline 
+		with their status, duration and failure message which keep updating. Select a stage or step and hit enter to view its log or esc to go back to the grid.
+
+		Hit l on the selected pipeline to stream its log into a pane below the grid which keeps updating. In the log pane use the cursor keys to scroll, 
+		f to toggle following the end of the log, / to search the log, n and N to go to the next and previous match and esc to close the log.
+
+		The selected pipeline can be stopped with x, rerun with R, debugged with a breakpoint with b, opened in a browser with o, 
+		have the environment variables of its steps displayed with e or have its name copied to the clipboard with c. 
+		Stopping and rerunning a pipeline has to be confirmed with y.
+
+		Type / to fuzzy search the repository, branch and context of the pipelines, r to only show the running pipelines and f to only show the failed pipelines. 
+		The keys 1 to 5 sort by the repository, branch, build, context and status columns and pressing a key again reverses the order. 0 sorts by the start time. 
+		Use page up/down, home and end to page through the pipelines.
+
+		Use --namespaces, --contexts or --all-namespaces to watch the pipelines of several namespaces and clusters which adds the KUBE CONTEXT and NAMESPACE columns. 
+		A namespace or cluster which cannot be reached is shown as an Unreachable row.
 `)
 
 	cmdExample = templates.Examples(`
@@ -65,6 +83,12 @@ var (
 
 		# Watches the current pipeline activities which have a name containing 'foo'
 		jx pipeline grid -f foo
+
+		# Watches the pipeline activities of two namespaces in two clusters
+		jx pipeline grid --namespaces jx,jx-staging --contexts dev,staging
+
+		# Watches the current pipeline activities with the commit author and pull request title from the git provider
+		jx pipeline grid --scm
 	`)
 )
 
@@ -85,6 +109,11 @@ func NewCmdPipelineGrid() (*cobra.Command, *Options) {
 	}
 	cmd.Flags().StringVarP(&o.Filter, "filter", "f", "", "Text to filter the pipeline names")
 	cmd.Flags().BoolVarP(&o.FailIfPodFails, "fail-with-pod", "", false, "Return an error if the pod fails")
+	cmd.Flags().StringSliceVarP(&o.Namespaces, "namespaces", "", nil, "The namespaces to watch. Defaults to the dev namespace")
+	cmd.Flags().StringSliceVarP(&o.Contexts, "contexts", "", nil, "The kube contexts to watch. Defaults to the current context")
+	cmd.Flags().BoolVarP(&o.AllNamespaces, "all-namespaces", "A", false, "Watches all namespaces")
+	cmd.Flags().BoolVarP(&o.SCM, "scm", "", false, "Fetches the commit author and pull request title or commit message of the SHA of each activity from the git provider")
+	o.ScmEnricher.AddFlags(cmd)
 
 	o.AddBaseFlags(cmd)
 	return cmd, o
@@ -93,6 +122,12 @@ func NewCmdPipelineGrid() (*cobra.Command, *Options) {
 // Validate verifies things are setup correctly
 func (o *Options) Validate() error {
 	var err error
+	if o.SCM {
+		err = o.ScmEnricher.Validate()
+		if err != nil {
+			return err
+		}
+	}
 	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
 	if err != nil {
 		return fmt.Errorf("failed to create kube client: %w", err)
@@ -125,52 +160,27 @@ func (o *Options) Run() error {
 		return fmt.Errorf("failed to validate options: %w", err)
 	}
 
-	ns, _, err := jxenv.GetDevNamespace(o.KubeClient, o.Namespace)
+	targets, err := o.createTargets()
 	if err != nil {
-		return fmt.Errorf("failed to find dev namespace: %w", err)
+		return err
 	}
-	jxClient := o.JXClient
 
-	informerFactory := informers.NewSharedInformerFactoryWithOptions(
-		jxClient,
-		time.Minute*10,
-		informers.WithNamespace(ns),
-	)
 	stop := make(chan struct{})
 
 	defer close(stop)
 	defer runtime.HandleCrash()
 
-	m := newModel(o.Filter, o.viewLogsFor)
-
-	informer := informerFactory.Jenkins().V1().PipelineActivities().Informer()
-	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			e := obj.(*v1.PipelineActivity)
-			if e != nil {
-				m.onPipelineActivity(e)
-			}
-		},
-		UpdateFunc: func(_, obj interface{}) {
-			e := obj.(*v1.PipelineActivity)
-			if e != nil {
-				m.onPipelineActivity(e)
-			}
-		},
-		DeleteFunc: func(obj interface{}) {
-			e := obj.(*v1.PipelineActivity)
-			if e != nil {
-				m.deletePipelineActivity(e.Name)
-			}
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to add handler for updated pipeline activities: %w", err)
+	m := newModel(o.Filter, o.streamLogs)
+	m.actions = o.rowActions()
+	m.activityTable.targets = targets
+	m.showTargets = len(targets) > 1 || o.AllNamespaces
+	if o.SCM {
+		m.detailsFn = o.scmDetails
 	}
-	informerFactory.Start(stop)
-	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
-		msg := "timed out waiting for jx caches to sync"
-		return fmt.Errorf("%s", msg)
+
+	// each target is watched in the background so that an unreachable target does not stop the others
+	for _, t := range targets {
+		go o.watchTarget(m, t, stop)
 	}
 
 	p := tea.NewProgram(m)
@@ -180,25 +190,20 @@ func (o *Options) Run() error {
 	return nil
 }
 
-func (o *Options) viewLogsFor(act *v1.PipelineActivity, paList []v1.PipelineActivity) error {
-	if act == nil {
+// scmDetails returns the commit and pull request details of the activity logging any failure to find them
+func (o *Options) scmDetails(act *v1.PipelineActivity) *scminfo.Details {
+	d, err := o.ScmEnricher.Details(o.GetContext(), act)
+	if err != nil {
+		log.Logger().Warnf("failed to find the commit of PipelineActivity %s: %s", act.Name, err.Error())
 		return nil
 	}
-	log.Logger().Infof("\n\n")
-
-	ns := o.Namespace
-	if o.TektonLogger == nil {
-		o.TektonLogger = &tektonlog.TektonLogger{
-			KubeClient:     o.KubeClient,
-			TektonClient:   o.TektonClient,
-			JXClient:       o.JXClient,
-			Namespace:      ns,
-			FailIfPodFails: o.FailIfPodFails,
-		}
-	}
-	ctx := context.TODO()
+	return d
+}
 
-	resources, err := o.TektonClient.TektonV1().PipelineRuns(ns).List(ctx, metav1.ListOptions{})
+// streamLogs streams the logs of the activity to the log pane of the grid
+func (o *Options) streamLogs(ctx context.Context, t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity, out io.Writer) error {
+	ns := t.namespace(act)
+	resources, err := pipelines.ListPipelineRuns(ctx, t.TektonClient, ns, pipelines.ServedAPIVersion(t.TektonClient), metav1.ListOptions{})
 	if err != nil && apierrors.IsNotFound(err) {
 		err = nil
 	}
@@ -219,12 +224,11 @@ func (o *Options) viewLogsFor(act *v1.PipelineActivity, paList []v1.PipelineActi
 			break
 		}
 	}
-	out := os.Stdout
-	err = o.TektonLogger.GetLogsForActivity(ctx, out, act, act.Name, prList)
+
+	// each stream uses its own logger as the logger records the last error of its stream
+	err = t.newTektonLogger(ns, o.FailIfPodFails).GetLogsForActivity(ctx, out, act, act.Name, prList)
 	if err != nil {
 		return fmt.Errorf("failed to stream logs for pipeline %s: %w", act.Name, err)
 	}
-
-	fmt.Fprint(out, "\n\n")
 	return nil
 }
@@ -0,0 +1,368 @@
+package grid
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/x/ansi"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+)
+
+// logsFunc streams the logs of the activity to the writer until they complete or the context is cancelled
+type logsFunc func(ctx context.Context, t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity, out io.Writer) error
+
+// logPane shows the logs of the selected activity streaming into a viewport below the grid
+type logPane struct {
+	// id identifies the current stream so that messages from a previous stream are ignored
+	id        int
+	name      string
+	viewport  viewport.Model
+	lines     []string
+	dirty     bool
+	follow    bool
+	searching bool
+	search    string
+	matches   []int
+	match     int
+	jumping   bool
+	done      bool
+	err       error
+	cancel    context.CancelFunc
+	ch        chan tea.Msg
+
+	windowWidth  int
+	windowHeight int
+}
+
+// logLineMsg the lines written to the logs of the stream
+type logLineMsg struct {
+	id    int
+	lines []string
+}
+
+// logDoneMsg indicates the logs of the stream have completed
+type logDoneMsg struct {
+	id  int
+	err error
+}
+
+// A command that waits for the next log message on a channel
+func waitForLog(ch chan tea.Msg) tea.Cmd {
+	return func() tea.Msg {
+		return <-ch
+	}
+}
+
+func newLogPane() *logPane {
+	return &logPane{
+		viewport:     viewport.New(80, 5),
+		windowWidth:  80,
+		windowHeight: 14,
+	}
+}
+
+func (l *logPane) isOpen() bool {
+	return l.cancel != nil
+}
+
+// open starts streaming the logs of the activity in the background returning the command which waits for them.
+// If the jump text is not blank the viewport jumps to the first line containing it once it arrives
+func (l *logPane) open(fn logsFunc, t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity, jump string) tea.Cmd {
+	l.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.id++
+	l.name = act.Name
+	l.lines = nil
+	l.dirty = true
+	l.follow = true
+	l.searching = false
+	l.search = jump
+	l.matches = nil
+	l.match = 0
+	l.jumping = jump != ""
+	l.done = false
+	l.err = nil
+	l.cancel = cancel
+	l.ch = make(chan tea.Msg)
+
+	go streamLogs(ctx, l.id, l.ch, fn, t, act.DeepCopy(), paList)
+	return waitForLog(l.ch)
+}
+
+// close stops streaming the logs
+func (l *logPane) close() {
+	if l.cancel != nil {
+		l.cancel()
+		l.cancel = nil
+	}
+}
+
+// streamLogs writes the logs of the activity to the channel as messages closing it when the logs complete
+func streamLogs(ctx context.Context, id int, ch chan tea.Msg, fn logsFunc, t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) {
+	defer close(ch)
+
+	w := &logWriter{ctx: ctx, id: id, ch: ch}
+	err := fn(ctx, t, act, paList, w)
+	if err == nil {
+		err = w.flush()
+	}
+	select {
+	case ch <- logDoneMsg{id: id, err: err}:
+	case <-ctx.Done():
+	}
+}
+
+// logWriter sends each complete line written to it as a message on the channel
+type logWriter struct {
+	ctx     context.Context
+	id      int
+	ch      chan tea.Msg
+	partial string
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	text := w.partial + string(p)
+	idx := strings.LastIndex(text, "\n")
+	if idx < 0 {
+		w.partial = text
+		return len(p), nil
+	}
+	w.partial = text[idx+1:]
+	err := w.send(strings.Split(text[:idx], "\n"))
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// flush sends the last line if it did not end with a new line
+func (w *logWriter) flush() error {
+	if w.partial == "" {
+		return nil
+	}
+	lines := []string{w.partial}
+	w.partial = ""
+	return w.send(lines)
+}
+
+func (w *logWriter) send(lines []string) error {
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	select {
+	case w.ch <- logLineMsg{id: w.id, lines: lines}:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// refresh updates the content of the viewport with the new lines keeping it at the bottom when following the logs
+func (l *logPane) refresh() {
+	if !l.dirty {
+		return
+	}
+	l.dirty = false
+	l.viewport.SetContent(strings.Join(l.lines, "\n"))
+	l.findMatches()
+	if l.jumping && len(l.matches) > 0 {
+		l.jumping = false
+		l.match = 0
+		l.gotoMatch()
+	}
+	if l.follow {
+		l.viewport.GotoBottom()
+	}
+}
+
+// findMatches finds the lines containing the search text ignoring colours and case
+func (l *logPane) findMatches() {
+	l.matches = nil
+	if l.search == "" {
+		return
+	}
+	search := strings.ToLower(l.search)
+	for i, line := range l.lines {
+		if strings.Contains(strings.ToLower(ansi.Strip(line)), search) {
+			l.matches = append(l.matches, i)
+		}
+	}
+	if l.match >= len(l.matches) {
+		l.match = 0
+	}
+}
+
+// firstMatch moves to the first match from the top of the viewport
+func (l *logPane) firstMatch() {
+	l.findMatches()
+	for i, line := range l.matches {
+		if line >= l.viewport.YOffset {
+			l.match = i
+			break
+		}
+	}
+	l.gotoMatch()
+}
+
+// nextMatch moves the number of matches forwards or backwards wrapping around
+func (l *logPane) nextMatch(delta int) {
+	size := len(l.matches)
+	if size == 0 {
+		return
+	}
+	l.match = ((l.match+delta)%size + size) % size
+	l.gotoMatch()
+}
+
+func (l *logPane) gotoMatch() {
+	if l.match >= len(l.matches) {
+		return
+	}
+	l.follow = false
+	l.viewport.SetYOffset(l.matches[l.match])
+}
+
+// toggleFollow toggles keeping the viewport at the bottom as new lines arrive
+func (l *logPane) toggleFollow() {
+	l.follow = !l.follow
+	if l.follow {
+		l.viewport.GotoBottom()
+	}
+}
+
+// onLogKey handles the keys when the log pane is open
+func (m model) onLogKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	l := m.logs
+	l.refresh()
+	if l.searching {
+		switch msg.Type {
+		case tea.KeyCtrlC:
+			m.stop()
+			return m, tea.Quit
+		case tea.KeyEnter:
+			l.searching = false
+			l.firstMatch()
+		case tea.KeyEsc:
+			l.searching = false
+			l.search = ""
+			l.findMatches()
+		case tea.KeyBackspace:
+			runes := []rune(l.search)
+			if len(runes) > 0 {
+				l.search = string(runes[:len(runes)-1])
+			}
+		case tea.KeySpace:
+			l.search += " "
+		case tea.KeyRunes:
+			l.search += string(msg.Runes)
+		}
+		return m, nil
+	}
+
+	switch msg.String() {
+	case "ctrl+c", "q":
+		l.close()
+		m.stop()
+		return m, tea.Quit
+	case "esc":
+		if l.search != "" {
+			l.jumping = false
+			l.search = ""
+			l.findMatches()
+			return m, nil
+		}
+		l.close()
+		m.layout()
+		return m, nil
+	case "/":
+		l.searching = true
+		l.jumping = false
+		l.search = ""
+	case "n":
+		l.nextMatch(1)
+	case "N":
+		l.nextMatch(-1)
+	case "f":
+		l.toggleFollow()
+	case "home", "g":
+		l.follow = false
+		l.viewport.GotoTop()
+	case "end", "G":
+		l.follow = true
+		l.viewport.GotoBottom()
+	default:
+		var cmd tea.Cmd
+		l.viewport, cmd = l.viewport.Update(msg)
+		l.follow = l.viewport.AtBottom()
+		return m, cmd
+	}
+	return m, nil
+}
+
+// onLogMsg adds the streamed lines to the log pane ignoring messages from previous streams
+func (m model) onLogMsg(msg tea.Msg) (tea.Model, tea.Cmd) {
+	l := m.logs
+	switch msg := msg.(type) {
+	case logLineMsg:
+		if msg.id != l.id || !l.isOpen() {
+			return m, nil
+		}
+		l.lines = append(l.lines, msg.lines...)
+		l.dirty = true
+		return m, waitForLog(l.ch)
+
+	case logDoneMsg:
+		if msg.id == l.id {
+			l.done = true
+			l.err = msg.err
+		}
+	}
+	return m, nil
+}
+
+// view renders the title, the viewport and the search box of the log pane
+func (l *logPane) view() string {
+	l.refresh()
+
+	state := "streaming"
+	switch {
+	case l.err != nil:
+		state = termcolor.ColorError(l.err.Error())
+	case l.done:
+		state = info("complete")
+	}
+	follow := "off"
+	if l.follow {
+		follow = "on"
+	}
+	parts := []string{
+		"logs of " + info(l.name),
+		state,
+		fmt.Sprintf("%d lines", len(l.lines)),
+		"follow: " + follow,
+	}
+	if l.search != "" && !l.searching {
+		if len(l.matches) == 0 {
+			parts = append(parts, fmt.Sprintf("no matches for %s", l.search))
+		} else {
+			parts = append(parts, fmt.Sprintf("match %d of %d for %s", l.match+1, len(l.matches), l.search))
+		}
+	}
+	parts = append(parts, "/ search  n/N next/previous  f follow  esc back to the grid")
+
+	s := &strings.Builder{}
+	s.WriteString(strings.Join(parts, " | "))
+	s.WriteString("\n")
+	s.WriteString(l.viewport.View())
+	s.WriteString("\n")
+	if l.searching {
+		fmt.Fprintf(s, "/%s_\n", l.search)
+	}
+	return s.String()
+}
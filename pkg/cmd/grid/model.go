@@ -1,11 +1,14 @@
 package grid
 
 import (
+	"fmt"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scminfo"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/activities"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -17,27 +20,88 @@ type model struct {
 	activityTable *activityTable
 	ch            chan struct{}
 	filter        string
+
+	// detailsFn fetches the commit and pull request details of an activity when using --scm
+	detailsFn func(act *v1.PipelineActivity) *scminfo.Details
+
+	// actions the actions on the selected activity indexed by their key
+	actions map[string]*rowAction
+
+	// logs the pane showing the logs of the selected activity
+	logs   *logPane
+	logsFn logsFunc
+
+	// showTargets whether the kube context and namespace columns are shown when watching more than one target
+	showTargets bool
+}
+
+// rowAction an action on the selected activity which returns the message to show in the status bar
+type rowAction struct {
+	// name describes the action in the status bar
+	name string
+
+	// confirm whether the action has to be confirmed first
+	confirm bool
+
+	// leave whether the grid is left while the action writes to the terminal
+	leave bool
+
+	fn func(t *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) (string, error)
+
+	// print optionally returns text to write through the program output once the action succeeds such as terminal
+	// escape sequences which would race the renderer if written to stdout directly
+	print func(act *v1.PipelineActivity) string
+}
+
+// actionMsg the result of a row action
+type actionMsg struct {
+	message string
+	err     error
+	print   string
 }
 
 type activityTable struct {
 	lock       sync.Mutex
 	current    int
-	max        int
+	offset     int
 	height     int
 	stopped    bool
+	searching  bool
+	search     string
+	status     string
+	sortBy     sortColumn
+	reverse    bool
+	confirming string
+	pending    *rowAction
+	message    string
+	failed     bool
 	names      []string
 	index      map[string]*v1.PipelineActivity
-	viewLogsFn func(act *v1.PipelineActivity, paList []v1.PipelineActivity) error
+	details    map[string]*scminfo.Details
+
+	// owners the target of each activity and targets the watched targets which are shown as status rows on failure
+	owners  map[string]*target
+	targets []*target
+
+	// expanded the key of the activity whose stages and steps are shown
+	expanded   string
+	treeCursor int
+	now        func() time.Time
 }
 
 func (a *activityTable) selected() *v1.PipelineActivity {
+	return a.index[a.selectedKey()]
+}
+
+func (a *activityTable) selectedKey() string {
 	c := a.current
-	if c >= a.max || c >= len(a.names) {
-		return nil
+	if c < 0 || c >= len(a.names) {
+		return ""
 	}
-	return a.index[a.names[c]]
+	return a.names[c]
 }
 
+// reindex sorts the activities then filters them using the search text and status toggle
 func (a *activityTable) reindex() {
 	var names []string
 	for k := range a.index {
@@ -46,41 +110,153 @@ func (a *activityTable) reindex() {
 	sort.Slice(names, func(i, j int) bool {
 		a1 := a.index[names[i]]
 		a2 := a.index[names[j]]
-		s1 := a1.Spec.StartedTimestamp
-		s2 := a2.Spec.StartedTimestamp
-		if s1 != nil && s2 != nil {
-			if s1.Time != s2.Time {
-				return s1.After(s2.Time)
-			}
-			diff := strings.Compare(a2.Spec.GitOwner, a1.Spec.GitOwner)
-			if diff != 0 {
-				return diff < 0
-			}
-			diff = strings.Compare(a2.Spec.GitRepository, a1.Spec.GitRepository)
-			if diff != 0 {
-				return diff < 0
-			}
-			diff = strings.Compare(a2.Spec.GitBranch, a1.Spec.GitBranch)
-			if diff != 0 {
-				return diff < 0
-			}
-			diff = strings.Compare(a2.Spec.Context, a1.Spec.Context)
-			if diff != 0 {
-				return diff < 0
-			}
-			diff = buildNumber(a2) - buildNumber(a1)
-			if diff != 0 {
-				return diff < 0
+		if diff := a.sortBy.compare(a1, a2); diff != 0 {
+			if a.reverse {
+				return diff > 0
 			}
+			return diff < 0
+		}
+		if a.sortBy == sortStarted && a.reverse {
+			return startedBefore(a2, a1)
 		}
-		return a1.CreationTimestamp.After(a2.CreationTimestamp.Time)
+		return startedBefore(a1, a2)
 	})
-	a.names = names
 
-	a.max = len(names)
-	if a.max > a.height {
-		a.max = a.height
+	a.names = nil
+	for _, name := range names {
+		act := a.index[name]
+		if matchesStatus(act, a.status) && matchesSearch(act, a.search) {
+			a.names = append(a.names, name)
+		}
+	}
+	a.scroll()
+}
+
+// startedBefore returns true if a1 should be shown before a2 with the most recently started activities first
+func startedBefore(a1, a2 *v1.PipelineActivity) bool {
+	s1 := a1.Spec.StartedTimestamp
+	s2 := a2.Spec.StartedTimestamp
+	if s1 != nil && s2 != nil {
+		if s1.Time != s2.Time {
+			return s1.After(s2.Time)
+		}
+		diff := strings.Compare(a2.Spec.GitOwner, a1.Spec.GitOwner)
+		if diff != 0 {
+			return diff < 0
+		}
+		diff = strings.Compare(a2.Spec.GitRepository, a1.Spec.GitRepository)
+		if diff != 0 {
+			return diff < 0
+		}
+		diff = strings.Compare(a2.Spec.GitBranch, a1.Spec.GitBranch)
+		if diff != 0 {
+			return diff < 0
+		}
+		diff = strings.Compare(a2.Spec.Context, a1.Spec.Context)
+		if diff != 0 {
+			return diff < 0
+		}
+		diff = buildNumber(a2) - buildNumber(a1)
+		if diff != 0 {
+			return diff < 0
+		}
+	}
+	return a1.CreationTimestamp.After(a2.CreationTimestamp.Time)
+}
+
+// pageSize returns the number of rows which fit in the window below the status rows of the unreachable targets
+func (a *activityTable) pageSize() int {
+	size := a.height - len(a.failedTargets())
+	if size < 1 {
+		return 1
+	}
+	return size
+}
+
+// failedTargets returns the targets which cannot be watched
+func (a *activityTable) failedTargets() []*target {
+	var answer []*target
+	for _, t := range a.targets {
+		if t.err != nil {
+			answer = append(answer, t)
+		}
+	}
+	return answer
+}
+
+// scroll keeps the current row within the activities and the page showing it
+func (a *activityTable) scroll() {
+	if a.current >= len(a.names) {
+		a.current = len(a.names) - 1
+	}
+	if a.current < 0 {
+		a.current = 0
+	}
+	size := a.pageSize()
+	if a.current < a.offset {
+		a.offset = a.current
+	}
+	if a.current >= a.offset+size {
+		a.offset = a.current - size + 1
+	}
+	if a.offset > len(a.names)-size {
+		a.offset = len(a.names) - size
+	}
+	if a.offset < 0 {
+		a.offset = 0
+	}
+}
+
+// move moves the current row by the delta
+func (a *activityTable) move(delta int) {
+	a.current += delta
+	a.scroll()
+}
+
+// page moves the current row and the window by the number of pages
+func (a *activityTable) page(delta int) {
+	size := a.pageSize()
+	a.offset += delta * size
+	a.current += delta * size
+	a.scroll()
+}
+
+// toggleStatus toggles only showing the activities of the status
+func (a *activityTable) toggleStatus(status string) {
+	if a.status == status {
+		a.status = statusAll
+	} else {
+		a.status = status
+	}
+	a.current = 0
+	a.reindex()
+}
+
+// sortByColumn sorts by the column reversing the order if its already sorted by the column
+func (a *activityTable) sortByColumn(column sortColumn) {
+	if a.sortBy == column {
+		a.reverse = !a.reverse
+	} else {
+		a.sortBy = column
+		a.reverse = false
 	}
+	a.reindex()
+}
+
+// setResult shows the result of an action in the status bar
+func (a *activityTable) setResult(message string, err error) {
+	a.failed = err != nil
+	if err != nil {
+		message = err.Error()
+	}
+	a.message = message
+}
+
+// setSearch changes the search text
+func (a *activityTable) setSearch(search string) {
+	a.search = search
+	a.current = 0
+	a.reindex()
 }
 
 func buildNumber(a *v1.PipelineActivity) int {
@@ -92,35 +268,33 @@ func buildNumber(a *v1.PipelineActivity) int {
 	return answer
 }
 
-func (a *activityTable) activityList() []v1.PipelineActivity {
+// activityList returns the activities of the target
+func (a *activityTable) activityList(t *target) []v1.PipelineActivity {
 	a.lock.Lock()
 	defer a.lock.Unlock()
 
 	var answer []v1.PipelineActivity
-	for _, v := range a.index {
-		answer = append(answer, *v)
+	for k, v := range a.index {
+		if a.owners[k] == t {
+			answer = append(answer, *v)
+		}
 	}
 	return answer
 }
 
-func (a *activityTable) viewLogs() {
-	act := a.selected()
-	a.stopped = true
-	if act != nil {
-		//ToDo: Check error here
-		_ = a.viewLogsFn(act, a.activityList())
-	}
-}
-
-func newModel(filter string, viewLogsFn func(act *v1.PipelineActivity, paList []v1.PipelineActivity) error) model {
+func newModel(filter string, logsFn logsFunc) model {
 	return model{
 		activityTable: &activityTable{
-			index:      map[string]*v1.PipelineActivity{},
-			height:     10,
-			viewLogsFn: viewLogsFn,
+			index:   map[string]*v1.PipelineActivity{},
+			details: map[string]*scminfo.Details{},
+			owners:  map[string]*target{},
+			height:  10,
+			now:     time.Now,
 		},
 		filter: filter,
 		ch:     make(chan struct{}),
+		logs:   newLogPane(),
+		logsFn: logsFn,
 	}
 }
 
@@ -141,10 +315,24 @@ func (m model) Init() tea.Cmd {
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
-		m.activityTable.height = msg.Height - 2
+		m.logs.windowWidth = msg.Width
+		m.logs.windowHeight = msg.Height
+		m.layout()
 		return m, nil
 
 	case tea.KeyMsg:
+		if m.activityTable.searching {
+			return m.onSearchKey(msg)
+		}
+		if m.activityTable.confirming != "" {
+			return m.onConfirmKey(msg)
+		}
+		if m.logs.isOpen() {
+			return m.onLogKey(msg)
+		}
+		if m.activityTable.expanded != "" {
+			return m.onTreeKey(msg)
+		}
 		switch msg.String() {
 
 		case "space", " ", "s":
@@ -157,27 +345,35 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.stop()
 			return m, tea.Quit
 
-		case "enter":
-			m.activityTable.viewLogs()
-			return m, waitForActivity(m.ch)
-
-		case "down", "j":
-			if m.activityTable.current+1 < m.activityTable.max {
-				m.activityTable.current++
-			}
+		case "enter", "right":
+			m.activityTable.lock.Lock()
+			m.activityTable.expand()
+			m.activityTable.lock.Unlock()
 			return m, nil
 
-		case "up", "k":
-			if m.activityTable.current > 0 {
-				m.activityTable.current--
-			}
-			return m, nil
+		case "l":
+			return m, m.openLogs(m.activityTable.selectedKey(), "")
 
 		default:
-			log.Logger().Infof("unknown key %s", msg.String())
+			if action := m.actions[msg.String()]; action != nil {
+				return m.onAction(action)
+			}
+			m.onKey(msg.String())
 			return m, nil
 		}
 
+	case logLineMsg, logDoneMsg:
+		return m.onLogMsg(msg)
+
+	case actionMsg:
+		m.activityTable.lock.Lock()
+		m.activityTable.setResult(msg.message, msg.err)
+		m.activityTable.lock.Unlock()
+		if msg.print != "" {
+			return m, tea.Printf("%s", msg.print)
+		}
+		return m, nil
+
 	case responseMsg:
 		if m.activityTable.stopped {
 			return m, tea.Quit
@@ -189,7 +385,175 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
-func (m model) onPipelineActivity(a *v1.PipelineActivity) {
+// layout splits the window between the grid and the log pane when it is open
+func (m model) layout() {
+	a := m.activityTable
+	l := m.logs
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	// leave room for the header, search box and status bar
+	a.height = l.windowHeight - 4
+	if l.isOpen() {
+		// the log pane takes the bottom half of the window including its title and search box
+		paneHeight := l.windowHeight / 2
+		l.viewport.Width = l.windowWidth
+		l.viewport.Height = paneHeight - 2
+		if l.viewport.Height < 1 {
+			l.viewport.Height = 1
+		}
+		a.height -= paneHeight
+	}
+	a.scroll()
+}
+
+// openLogs opens the log pane streaming the logs of the activity jumping to the first line containing the text if its not blank
+func (m model) openLogs(key, jump string) tea.Cmd {
+	a := m.activityTable
+	a.lock.Lock()
+	act := a.index[key]
+	t := a.owners[key]
+	a.lock.Unlock()
+	if act == nil {
+		return nil
+	}
+	cmd := m.logs.open(m.logsFn, t, act, a.activityList(t), jump)
+	m.layout()
+	return cmd
+}
+
+// onKey handles the keys which search, filter, sort and move around the grid
+func (m model) onKey(key string) {
+	a := m.activityTable
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	switch key {
+	case "/":
+		a.searching = true
+	case "esc":
+		a.setSearch("")
+	case "r":
+		a.toggleStatus(statusRunning)
+	case "f":
+		a.toggleStatus(statusFailed)
+	case "down", "j":
+		a.move(1)
+	case "up", "k":
+		a.move(-1)
+	case "pgdown", "ctrl+d":
+		a.page(1)
+	case "pgup", "ctrl+u":
+		a.page(-1)
+	case "home", "g":
+		a.move(-len(a.names))
+	case "end", "G":
+		a.move(len(a.names))
+	default:
+		column, ok := sortKeys[key]
+		if !ok {
+			log.Logger().Infof("unknown key %s", key)
+			return
+		}
+		a.sortByColumn(column)
+	}
+}
+
+// onAction performs the action on the selected activity or asks for confirmation first
+func (m model) onAction(action *rowAction) (tea.Model, tea.Cmd) {
+	a := m.activityTable
+	a.lock.Lock()
+	act := a.selected()
+	if act == nil {
+		a.setResult("", fmt.Errorf("no pipeline selected to %s", action.name))
+		a.lock.Unlock()
+		return m, nil
+	}
+	if action.confirm {
+		a.confirming = a.selectedKey()
+		a.pending = action
+		a.failed = false
+		a.message = fmt.Sprintf("%s %s? (y/n)", action.name, act.Name)
+		a.lock.Unlock()
+		return m, nil
+	}
+	t := a.owners[a.selectedKey()]
+	a.lock.Unlock()
+	return m, m.runAction(action, t, act)
+}
+
+// onConfirmKey performs or cancels the action waiting for confirmation
+func (m model) onConfirmKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	a := m.activityTable
+	a.lock.Lock()
+	act := a.index[a.confirming]
+	t := a.owners[a.confirming]
+	action := a.pending
+	a.confirming = ""
+	a.pending = nil
+	if msg.String() != "y" || act == nil || action == nil {
+		a.setResult("cancelled", nil)
+		a.lock.Unlock()
+		return m, nil
+	}
+	a.lock.Unlock()
+	return m, m.runAction(action, t, act)
+}
+
+// runAction runs the action in the background reporting the result in the status bar. Actions which write to the
+// terminal are run while the grid is stopped like viewing the logs
+func (m model) runAction(action *rowAction, t *target, act *v1.PipelineActivity) tea.Cmd {
+	a := m.activityTable
+	paList := a.activityList(t)
+	if action.leave {
+		a.stopped = true
+		message, err := action.fn(t, act, paList)
+		a.lock.Lock()
+		a.setResult(message, err)
+		a.lock.Unlock()
+		return waitForActivity(m.ch)
+	}
+	return func() tea.Msg {
+		message, err := action.fn(t, act, paList)
+		msg := actionMsg{message: message, err: err}
+		if err == nil && action.print != nil {
+			msg.print = action.print(act)
+		}
+		return msg
+	}
+}
+
+// onSearchKey handles the keys typed into the search box
+func (m model) onSearchKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if msg.Type == tea.KeyCtrlC {
+		m.stop()
+		return m, tea.Quit
+	}
+
+	a := m.activityTable
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	switch msg.Type {
+	case tea.KeyEnter:
+		a.searching = false
+	case tea.KeyEsc:
+		a.searching = false
+		a.setSearch("")
+	case tea.KeyBackspace:
+		runes := []rune(a.search)
+		if len(runes) > 0 {
+			a.setSearch(string(runes[:len(runes)-1]))
+		}
+	case tea.KeySpace:
+		a.setSearch(a.search + " ")
+	case tea.KeyRunes:
+		a.setSearch(a.search + string(msg.Runes))
+	}
+	return m, nil
+}
+
+func (m model) onPipelineActivity(t *target, a *v1.PipelineActivity) {
 	if m.filter != "" && !strings.Contains(a.Name, m.filter) {
 		return
 	}
@@ -198,20 +562,52 @@ func (m model) onPipelineActivity(a *v1.PipelineActivity) {
 
 	m.activityTable.lock.Lock()
 
-	m.activityTable.index[a.Name] = a
+	key := t.key(a)
+	m.activityTable.index[key] = a
+	m.activityTable.owners[key] = t
+	if t != nil {
+		// the target is reachable again
+		t.err = nil
+	}
 	m.activityTable.reindex()
+	d := m.activityTable.details[key]
+	fetch := m.detailsFn != nil && a.Spec.LastCommitSHA != "" && (d == nil || d.SHA != a.Spec.LastCommitSHA)
 
 	m.activityTable.lock.Unlock()
 
+	if fetch {
+		// lets fetch the details in the background so we don't block the informer on the git provider
+		go m.onDetails(key, a)
+	}
 	if !m.activityTable.stopped {
 		m.ch <- struct{}{}
 	}
 }
 
-func (m model) deletePipelineActivity(name string) {
+func (m model) onDetails(key string, a *v1.PipelineActivity) {
+	d := m.detailsFn(a)
+	if d == nil {
+		return
+	}
+
 	m.activityTable.lock.Lock()
 
-	delete(m.activityTable.index, name)
+	m.activityTable.details[key] = d
+
+	m.activityTable.lock.Unlock()
+
+	if !m.activityTable.stopped {
+		m.ch <- struct{}{}
+	}
+}
+
+func (m model) deletePipelineActivity(t *target, a *v1.PipelineActivity) {
+	m.activityTable.lock.Lock()
+
+	key := t.key(a)
+	delete(m.activityTable.index, key)
+	delete(m.activityTable.details, key)
+	delete(m.activityTable.owners, key)
 	m.activityTable.reindex()
 
 	m.activityTable.lock.Unlock()
@@ -221,6 +617,20 @@ func (m model) deletePipelineActivity(name string) {
 	}
 }
 
+// onTargetError shows the target as unreachable
+func (m model) onTargetError(t *target, err error) {
+	m.activityTable.lock.Lock()
+
+	t.err = err
+	m.activityTable.scroll()
+
+	m.activityTable.lock.Unlock()
+
+	if !m.activityTable.stopped {
+		m.ch <- struct{}{}
+	}
+}
+
 func (m model) stop() {
 	m.activityTable.stopped = true
 	// avoid waiting forever
@@ -0,0 +1,448 @@
+//go:build unit
+// +build unit
+
+package grid
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGridSearchSortAndPaging(t *testing.T) {
+	m := newTestModel(t)
+	started := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	for i := 1; i <= 12; i++ {
+		status := v1.ActivityStatusTypeSucceeded
+		switch i % 4 {
+		case 0:
+			status = v1.ActivityStatusTypeFailed
+		case 1:
+			status = v1.ActivityStatusTypeRunning
+		}
+		repo := "cheese"
+		if i%2 == 0 {
+			repo = "wine"
+		}
+		m.onPipelineActivity(nil, newActivity(repo, "main", i, status, started.Add(time.Duration(i)*time.Minute)))
+	}
+
+	update(m, tea.WindowSizeMsg{Width: 120, Height: 9})
+	a := m.activityTable
+	require.Equal(t, 5, a.pageSize())
+	require.Len(t, a.names, 12)
+	assert.Equal(t, "myorg-wine-main-12", a.selected().Name, "should show the most recent build first")
+
+	view := m.View()
+	assert.Contains(t, view, "1-5 of 12")
+	assert.Contains(t, view, "3 running 3 failed 6 succeeded of 12")
+
+	update(m, tea.KeyMsg{Type: tea.KeyPgDown})
+	assert.Equal(t, 5, a.current)
+	assert.Equal(t, 5, a.offset)
+	assert.Contains(t, m.View(), "6-10 of 12")
+
+	update(m, keys("G"))
+	assert.Equal(t, 11, a.current)
+	assert.Equal(t, 7, a.offset)
+
+	update(m, keys("f"))
+	require.Len(t, a.names, 3, "should only show the failed builds")
+	assert.Equal(t, 0, a.current)
+	assert.Contains(t, m.View(), "showing: failed")
+
+	update(m, keys("r"))
+	require.Len(t, a.names, 3, "should only show the running builds")
+	for _, name := range a.names {
+		assert.Equal(t, v1.ActivityStatusTypeRunning, a.index[name].Spec.Status)
+	}
+	update(m, keys("r"))
+	require.Len(t, a.names, 12, "should toggle the running builds off")
+
+	update(m, keys("3"))
+	assert.Equal(t, "1", a.index[a.names[0]].Spec.Build, "should sort by build")
+	assert.Contains(t, m.View(), "BUILD ^")
+	update(m, keys("3"))
+	assert.Equal(t, "12", a.index[a.names[0]].Spec.Build, "should reverse the sort by build")
+	update(m, keys("0"))
+	assert.Equal(t, "myorg-wine-main-12", a.names[0])
+
+	update(m, keys("/"))
+	require.True(t, a.searching)
+	update(m, keys("chs"))
+	assert.Equal(t, "chs", a.search)
+	require.Len(t, a.names, 6, "should fuzzy match the cheese repository")
+	update(m, tea.KeyMsg{Type: tea.KeyBackspace})
+	update(m, keys("z"))
+	assert.Empty(t, a.names)
+	assert.Contains(t, m.View(), "/chz_")
+
+	update(m, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, a.searching)
+	assert.Empty(t, a.search)
+	assert.Len(t, a.names, 12)
+}
+
+func TestGridRowActions(t *testing.T) {
+	m := newTestModel(t)
+	var stopped, copied []string
+	m.actions = map[string]*rowAction{
+		"x": {name: "stop", confirm: true, fn: func(_ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+			stopped = append(stopped, act.Name)
+			return "cancelled " + act.Name, nil
+		}},
+		"c": {name: "copy", fn: func(_ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+			copied = append(copied, act.Name)
+			return "", fmt.Errorf("no clipboard")
+		}},
+	}
+	started := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	m.onPipelineActivity(nil, newActivity("cheese", "main", 1, v1.ActivityStatusTypeRunning, started))
+	a := m.activityTable
+
+	cmd := update(m, keys("x"))
+	assert.Nil(t, cmd, "should wait for confirmation")
+	assert.Contains(t, m.View(), "stop myorg-cheese-main-1? (y/n)")
+
+	cmd = update(m, keys("n"))
+	assert.Nil(t, cmd)
+	assert.Empty(t, stopped, "should not stop without confirmation")
+	assert.Equal(t, "cancelled", a.message)
+
+	update(m, keys("x"))
+	cmd = update(m, keys("y"))
+	require.NotNil(t, cmd, "should run the confirmed action")
+	update(m, cmd())
+	assert.Equal(t, []string{"myorg-cheese-main-1"}, stopped)
+	assert.Equal(t, "cancelled myorg-cheese-main-1", a.message)
+	assert.False(t, a.failed)
+
+	cmd = update(m, keys("c"))
+	require.NotNil(t, cmd, "should run the action without confirmation")
+	update(m, cmd())
+	assert.Equal(t, []string{"myorg-cheese-main-1"}, copied)
+	assert.True(t, a.failed)
+	assert.Contains(t, m.View(), "no clipboard")
+
+	m.actions["c"] = &rowAction{
+		name: "copy",
+		fn: func(_ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity) (string, error) {
+			return "copied " + act.Name, nil
+		},
+		print: clipboardSequence,
+	}
+	cmd = update(m, keys("c"))
+	require.NotNil(t, cmd)
+	msg := cmd()
+	require.IsType(t, actionMsg{}, msg)
+	assert.Equal(t, "\x1b]52;c;bXlvcmctY2hlZXNlLW1haW4tMQ==\a", msg.(actionMsg).print)
+	assert.NotNil(t, update(m, msg), "should write the clipboard sequence through the program output")
+	assert.Equal(t, "copied myorg-cheese-main-1", a.message)
+}
+
+func TestGridLogPane(t *testing.T) {
+	m := newTestModel(t)
+	m.logsFn = func(_ context.Context, _ *target, act *v1.PipelineActivity, _ []v1.PipelineActivity, out io.Writer) error {
+		fmt.Fprintf(out, "\x1b[32mlogs of %s\x1b[0m\n", act.Name)
+		for i := 1; i <= 20; i++ {
+			fmt.Fprintf(out, "step %d\n", i)
+		}
+		fmt.Fprint(out, "Done")
+		return nil
+	}
+	started := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	m.onPipelineActivity(nil, newActivity("cheese", "main", 1, v1.ActivityStatusTypeRunning, started))
+	update(m, tea.WindowSizeMsg{Width: 120, Height: 20})
+	a := m.activityTable
+	l := m.logs
+	require.Equal(t, 16, a.pageSize())
+
+	cmd := update(m, keys("l"))
+	require.NotNil(t, cmd, "should stream the logs")
+	assert.Equal(t, 6, a.pageSize(), "should leave room for the log pane")
+	for cmd != nil {
+		cmd = update(m, cmd())
+	}
+	require.Len(t, l.lines, 22)
+	assert.True(t, l.done)
+	assert.Equal(t, "\x1b[32mlogs of myorg-cheese-main-1\x1b[0m", l.lines[0], "should preserve the colours")
+	assert.Equal(t, "Done", l.lines[21])
+
+	view := m.View()
+	assert.Contains(t, view, "22 lines")
+	assert.Contains(t, view, "follow: on")
+	assert.Contains(t, view, "Done", "should follow the end of the logs")
+	assert.NotContains(t, view, "step 3 ")
+
+	update(m, keys("/"))
+	update(m, keys("STEP 1"))
+	assert.Contains(t, m.View(), "/STEP 1_")
+	update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.Equal(t, []int{1, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19}, l.matches)
+	assert.False(t, l.follow, "should stop following when searching")
+	assert.Contains(t, m.View(), "match 6 of 11 for STEP 1", "should go to the first match on the page")
+	update(m, keys("N"))
+	view = m.View()
+	assert.Contains(t, view, "match 5 of 11 for STEP 1")
+	assert.Contains(t, view, "step 13")
+	update(m, keys("g"))
+	update(m, keys("N"))
+	assert.Contains(t, m.View(), "match 4 of 11 for STEP 1")
+	for i := 0; i < 8; i++ {
+		update(m, keys("n"))
+	}
+	assert.Contains(t, m.View(), "match 1 of 11 for STEP 1", "should wrap around")
+
+	update(m, keys("f"))
+	assert.True(t, l.follow)
+
+	update(m, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.True(t, l.isOpen(), "should clear the search first")
+	update(m, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, l.isOpen())
+	assert.Equal(t, 16, a.pageSize())
+	assert.NotContains(t, m.View(), "logs of")
+}
+
+func TestGridStepTree(t *testing.T) {
+	m := newTestModel(t)
+	var logs strings.Builder
+	m.logsFn = func(_ context.Context, _ *target, _ *v1.PipelineActivity, _ []v1.PipelineActivity, out io.Writer) error {
+		for _, container := range []string{"step-git-clone", "step-build-make"} {
+			fmt.Fprintf(out, "\nShowing logs for build \x1b[32m#1\x1b[0m stage \x1b[32mfrom-build-pack\x1b[0m and container \x1b[32m%s\x1b[0m\n", container)
+			for i := 1; i <= 10; i++ {
+				fmt.Fprintf(out, "%s line %d\n", container, i)
+			}
+		}
+		logs.WriteString("done")
+		return nil
+	}
+	started := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	a := m.activityTable
+	a.now = func() time.Time {
+		return started.Add(2 * time.Minute)
+	}
+	act := newActivity("cheese", "main", 1, v1.ActivityStatusTypeRunning, started)
+	act.Spec.Steps = []v1.PipelineActivityStep{
+		newStage("from-build-pack", v1.ActivityStatusTypeRunning, started, nil,
+			newStep("Git Clone", v1.ActivityStatusTypeSucceeded, started, time.Second*5),
+			newStep("Build Make", v1.ActivityStatusTypeRunning, started.Add(5*time.Second), 0),
+		),
+	}
+	m.onPipelineActivity(nil, act)
+	update(m, tea.WindowSizeMsg{Width: 120, Height: 20})
+
+	update(m, tea.KeyMsg{Type: tea.KeyRight})
+	require.Equal(t, "myorg-cheese-main-1", a.expanded)
+	view := m.View()
+	assert.Contains(t, view, "> "+statusIcon(v1.ActivityStatusTypeRunning)+" from-build-pack  2m0s")
+	assert.Contains(t, view, statusIcon(v1.ActivityStatusTypeSucceeded)+" Git Clone  5s")
+	assert.Contains(t, view, statusIcon(v1.ActivityStatusTypeRunning)+" Build Make  1m55s")
+	assert.Contains(t, view, "1-3 of 3 stages and steps")
+
+	// the tree updates as the informer delivers changes
+	act = act.DeepCopy()
+	act.Spec.Status = v1.ActivityStatusTypeFailed
+	buildStep := &act.Spec.Steps[0].Stage.Steps[1]
+	buildStep.Status = v1.ActivityStatusTypeFailed
+	buildStep.Message = "make: *** [build] Error 2"
+	completed := metav1.NewTime(started.Add(time.Minute))
+	buildStep.CompletedTimestamp = &completed
+	m.onPipelineActivity(nil, act)
+	view = m.View()
+	assert.Contains(t, view, statusIcon(v1.ActivityStatusTypeFailed)+" Build Make  55s")
+	assert.Contains(t, view, "make: *** [build] Error 2", "should show the failure message")
+
+	update(m, keys("G"))
+	assert.Equal(t, 2, a.treeCursor)
+	cmd := update(m, tea.KeyMsg{Type: tea.KeyEnter})
+	require.NotNil(t, cmd, "should stream the logs of the step")
+	for cmd != nil {
+		cmd = update(m, cmd())
+	}
+	require.Equal(t, "done", logs.String())
+	l := m.logs
+	require.Equal(t, "stage from-build-pack and container step-build-make", l.search)
+	view = m.View()
+	assert.Equal(t, 13, l.viewport.YOffset, "should jump to the logs of the step")
+	assert.False(t, l.follow)
+	assert.Contains(t, view, "step-build-make line 1")
+
+	update(m, tea.KeyMsg{Type: tea.KeyEsc})
+	update(m, tea.KeyMsg{Type: tea.KeyEsc})
+	assert.False(t, l.isOpen())
+	assert.Equal(t, "myorg-cheese-main-1", a.expanded, "should go back to the steps")
+	update(m, tea.KeyMsg{Type: tea.KeyLeft})
+	assert.Empty(t, a.expanded)
+	assert.Contains(t, m.View(), "REPOSITORY")
+}
+
+func TestLogWriter(t *testing.T) {
+	ch := make(chan tea.Msg, 10)
+	w := &logWriter{ctx: context.Background(), id: 1, ch: ch}
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	assert.Empty(t, ch, "should wait for the end of the line")
+	_, err = w.Write([]byte(" world\r\nfoo\nbar"))
+	require.NoError(t, err)
+	require.NoError(t, w.flush())
+	assert.Equal(t, logLineMsg{id: 1, lines: []string{"hello world", "foo"}}, <-ch)
+	assert.Equal(t, logLineMsg{id: 1, lines: []string{"bar"}}, <-ch)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w = &logWriter{ctx: ctx, id: 2, ch: make(chan tea.Msg)}
+	_, err = w.Write([]byte("closed\n"))
+	assert.Error(t, err, "should not block once the log pane is closed")
+}
+
+func TestGridTargets(t *testing.T) {
+	m := newTestModel(t)
+	dev := &target{Context: "dev", Namespace: "jx", qualified: true}
+	staging := &target{Context: "staging", Namespace: "jx", qualified: true}
+	a := m.activityTable
+	a.targets = []*target{dev, staging}
+	m.showTargets = true
+
+	var paLists [][]v1.PipelineActivity
+	m.actions = map[string]*rowAction{
+		"c": {name: "copy", fn: func(tg *target, act *v1.PipelineActivity, paList []v1.PipelineActivity) (string, error) {
+			paLists = append(paLists, paList)
+			return tg.Context + " " + act.Name, nil
+		}},
+	}
+	started := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	m.onPipelineActivity(dev, newActivity("cheese", "main", 1, v1.ActivityStatusTypeRunning, started))
+	m.onPipelineActivity(staging, newActivity("cheese", "main", 1, v1.ActivityStatusTypeSucceeded, started.Add(-time.Minute)))
+	require.Len(t, a.names, 2, "should not merge activities of the same name from different targets")
+	assert.Equal(t, []string{"dev/jx/myorg-cheese-main-1", "staging/jx/myorg-cheese-main-1"}, a.names)
+
+	view := m.View()
+	assert.Contains(t, view, "KUBE CONTEXT")
+	assert.Contains(t, view, "NAMESPACE")
+	assert.Contains(t, view, "staging")
+
+	update(m, keys("j"))
+	cmd := update(m, keys("c"))
+	require.NotNil(t, cmd)
+	update(m, cmd())
+	assert.Equal(t, "staging myorg-cheese-main-1", a.message, "should run the action on the target of the activity")
+	require.Len(t, paLists, 1)
+	assert.Len(t, paLists[0], 1, "should only pass the activities of the target")
+
+	m.onTargetError(staging, fmt.Errorf("connection refused"))
+	view = m.View()
+	assert.Contains(t, view, "Unreachable")
+	assert.Contains(t, view, "connection refused")
+	assert.Len(t, a.names, 2, "should keep the activities of the unreachable target")
+
+	m.onPipelineActivity(staging, newActivity("cheese", "main", 2, v1.ActivityStatusTypeRunning, started))
+	assert.NotContains(t, m.View(), "Unreachable", "should show the target as reachable again")
+
+	m.deletePipelineActivity(dev, newActivity("cheese", "main", 1, v1.ActivityStatusTypeRunning, started))
+	assert.Equal(t, []string{"staging/jx/myorg-cheese-main-2", "staging/jx/myorg-cheese-main-1"}, a.names)
+
+	all := &target{Context: "prod", qualified: true}
+	a.targets = append(a.targets, all)
+	for _, ns := range []string{"jx", "jx-staging"} {
+		act := newActivity("wine", "main", 1, v1.ActivityStatusTypeRunning, started)
+		act.Namespace = ns
+		m.onPipelineActivity(all, act)
+	}
+	assert.Contains(t, a.names, "prod/jx/myorg-wine-main-1")
+	assert.Contains(t, a.names, "prod/jx-staging/myorg-wine-main-1", "should not merge activities of the same name from different namespaces")
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	assert.True(t, fuzzyMatch("chs", "myorg/cheese main"))
+	assert.True(t, fuzzyMatch("Cheese Main", "myorg/cheese main"))
+	assert.False(t, fuzzyMatch("wine", "myorg/cheese main"))
+}
+
+// newTestModel creates a model draining its notifications so that updates do not block
+func newTestModel(t *testing.T) model {
+	m := newModel("", func(_ context.Context, _ *target, _ *v1.PipelineActivity, _ []v1.PipelineActivity, _ io.Writer) error {
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-m.ch:
+			case <-done:
+				return
+			}
+		}
+	}()
+	t.Cleanup(func() {
+		close(done)
+	})
+	return m
+}
+
+func update(m model, msg tea.Msg) tea.Cmd {
+	_, cmd := m.Update(msg)
+	return cmd
+}
+
+func keys(text string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)}
+}
+
+func newStage(name string, status v1.ActivityStatusType, started time.Time, completed *metav1.Time, steps ...v1.CoreActivityStep) v1.PipelineActivityStep {
+	startedTime := metav1.NewTime(started)
+	return v1.PipelineActivityStep{
+		Kind: v1.ActivityStepKindTypeStage,
+		Stage: &v1.StageActivityStep{
+			CoreActivityStep: v1.CoreActivityStep{
+				Name:               name,
+				Status:             status,
+				StartedTimestamp:   &startedTime,
+				CompletedTimestamp: completed,
+			},
+			Steps: steps,
+		},
+	}
+}
+
+func newStep(name string, status v1.ActivityStatusType, started time.Time, duration time.Duration) v1.CoreActivityStep {
+	startedTime := metav1.NewTime(started)
+	step := v1.CoreActivityStep{
+		Name:             name,
+		Status:           status,
+		StartedTimestamp: &startedTime,
+	}
+	if duration > 0 {
+		completed := metav1.NewTime(started.Add(duration))
+		step.CompletedTimestamp = &completed
+	}
+	return step
+}
+
+func newActivity(repo, branch string, build int, status v1.ActivityStatusType, started time.Time) *v1.PipelineActivity {
+	startedTime := metav1.NewTime(started)
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("myorg-%s-%s-%d", repo, branch, build),
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:         "myorg/" + repo + "/" + branch,
+			Build:            strconv.Itoa(build),
+			GitOwner:         "myorg",
+			GitRepository:    repo,
+			GitBranch:        branch,
+			Status:           status,
+			StartedTimestamp: &startedTime,
+		},
+	}
+}
@@ -0,0 +1,114 @@
+package grid
+
+import (
+	"strings"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+)
+
+const (
+	// statusAll shows the activities of any status
+	statusAll = ""
+
+	// statusRunning only shows the activities which have not terminated yet
+	statusRunning = "running"
+
+	// statusFailed only shows the failed activities
+	statusFailed = "failed"
+)
+
+// sortColumn the column the grid is sorted by
+type sortColumn int
+
+const (
+	sortStarted sortColumn = iota
+	sortRepository
+	sortBranch
+	sortBuild
+	sortContext
+	sortStatus
+)
+
+// sortKeys the keys used to sort the grid by each column
+var sortKeys = map[string]sortColumn{
+	"0": sortStarted,
+	"1": sortRepository,
+	"2": sortBranch,
+	"3": sortBuild,
+	"4": sortContext,
+	"5": sortStatus,
+}
+
+func (c sortColumn) String() string {
+	switch c {
+	case sortRepository:
+		return "repository"
+	case sortBranch:
+		return "branch"
+	case sortBuild:
+		return "build"
+	case sortContext:
+		return "context"
+	case sortStatus:
+		return "status"
+	default:
+		return "started"
+	}
+}
+
+// compare compares the activities by the column returning 0 if they are equal
+func (c sortColumn) compare(a1, a2 *v1.PipelineActivity) int {
+	s1 := &a1.Spec
+	s2 := &a2.Spec
+	switch c {
+	case sortRepository:
+		return strings.Compare(s1.GitOwner+"/"+s1.GitRepository, s2.GitOwner+"/"+s2.GitRepository)
+	case sortBranch:
+		return strings.Compare(s1.GitBranch, s2.GitBranch)
+	case sortBuild:
+		return buildNumber(a1) - buildNumber(a2)
+	case sortContext:
+		return strings.Compare(s1.Context, s2.Context)
+	case sortStatus:
+		return strings.Compare(s1.Status.String(), s2.Status.String())
+	default:
+		return 0
+	}
+}
+
+// matchesStatus returns true if the activity matches the status toggle
+func matchesStatus(a *v1.PipelineActivity, status string) bool {
+	switch status {
+	case statusRunning:
+		return !a.Spec.Status.IsTerminated()
+	case statusFailed:
+		return a.Spec.Status == v1.ActivityStatusTypeFailed || a.Spec.Status == v1.ActivityStatusTypeError
+	default:
+		return true
+	}
+}
+
+// matchesSearch returns true if the search text fuzzy matches the repository, branch or context of the activity
+func matchesSearch(a *v1.PipelineActivity, search string) bool {
+	if search == "" {
+		return true
+	}
+	s := &a.Spec
+	return fuzzyMatch(search, s.GitOwner+"/"+s.GitRepository+" "+s.GitBranch+" "+s.Context)
+}
+
+// fuzzyMatch returns true if the characters of the pattern appear in order in the text ignoring case
+func fuzzyMatch(pattern, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		if r == ' ' {
+			continue
+		}
+		idx := strings.IndexRune(text, r)
+		if idx < 0 {
+			return false
+		}
+		text = text[idx+len(string(r)):]
+	}
+	return true
+}
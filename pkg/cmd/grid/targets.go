@@ -0,0 +1,248 @@
+package grid
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/lighthouses"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	informers "github.com/jenkins-x/jx-api/v4/pkg/client/informers/externalversions"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxenv"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	lhclient "github.com/jenkins-x/lighthouse-client/pkg/client/clientset/versioned"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// targetTimeout how long to wait for a kube context and namespace to respond before showing it as unreachable
+const targetTimeout = 30 * time.Second
+
+// target a kube context and namespace watched by the grid with its own informer
+type target struct {
+	Context      string
+	Namespace    string
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	LHClient     lhclient.Interface
+	TektonLogger *tektonlog.TektonLogger
+
+	// qualified is true if the activity names are qualified by their kube context and namespace when watching more
+	// than one target or all namespaces
+	qualified bool
+	config    *rest.Config
+	err       error
+}
+
+// key returns the key of the activity of the target in the grid using the namespace of the activity itself so that
+// activities of the same name in different namespaces do not collide when watching all namespaces
+func (t *target) key(act *v1.PipelineActivity) string {
+	if t == nil || !t.qualified {
+		return act.Name
+	}
+	return t.Context + "/" + t.namespace(act) + "/" + act.Name
+}
+
+// namespace returns the namespace of the activity which is only known from the activity when watching all namespaces
+func (t *target) namespace(act *v1.PipelineActivity) string {
+	if act.Namespace != "" {
+		return act.Namespace
+	}
+	return t.Namespace
+}
+
+// lhClient lazily creates the lighthouse client of the kube context of the target
+func (t *target) lhClient() (lhclient.Interface, error) {
+	if t.LHClient != nil || t.config == nil {
+		var err error
+		t.LHClient, err = lighthouses.LazyCreateLHClient(t.LHClient)
+		return t.LHClient, err
+	}
+	client, err := lhclient.NewForConfig(t.config)
+	if err != nil {
+		return nil, fmt.Errorf("error building lighthouse clientset for context %s: %w", t.Context, err)
+	}
+	t.LHClient = client
+	return client, nil
+}
+
+// tektonLogger returns the TektonLogger of the target creating one for the namespace if there is none
+func (t *target) tektonLogger(ns string, failIfPodFails bool) *tektonlog.TektonLogger {
+	if t.TektonLogger != nil {
+		return t.TektonLogger
+	}
+	return t.newTektonLogger(ns, failIfPodFails)
+}
+
+func (t *target) newTektonLogger(ns string, failIfPodFails bool) *tektonlog.TektonLogger {
+	return &tektonlog.TektonLogger{
+		KubeClient:     t.KubeClient,
+		TektonClient:   t.TektonClient,
+		JXClient:       t.JXClient,
+		Namespace:      ns,
+		FailIfPodFails: failIfPodFails,
+	}
+}
+
+// createTargets creates the targets for each kube context and namespace to watch. A target whose clients cannot be
+// created is returned with its error so that it is shown as unreachable
+func (o *Options) createTargets() ([]*target, error) {
+	contexts := o.Contexts
+	if len(contexts) == 0 {
+		contexts = []string{""}
+	}
+	var answer []*target
+	for _, kubeContext := range contexts {
+		base, err := o.createContextTarget(kubeContext)
+		if err != nil {
+			answer = append(answer, &target{Context: kubeContext, Namespace: o.Namespace, err: err})
+			continue
+		}
+
+		namespaces := o.Namespaces
+		switch {
+		case o.AllNamespaces:
+			namespaces = []string{metav1.NamespaceAll}
+		case len(namespaces) == 0:
+			ns, _, err := jxenv.GetDevNamespace(base.KubeClient, o.Namespace)
+			if err != nil {
+				if kubeContext == "" {
+					return nil, fmt.Errorf("failed to find dev namespace: %w", err)
+				}
+				base.Namespace = o.Namespace
+				base.err = fmt.Errorf("failed to find dev namespace: %w", err)
+				answer = append(answer, base)
+				continue
+			}
+			namespaces = []string{ns}
+		}
+		for _, ns := range namespaces {
+			t := *base
+			t.Namespace = ns
+			if len(namespaces) > 1 || ns == metav1.NamespaceAll {
+				// the logger is bound to a single namespace
+				t.TektonLogger = nil
+			}
+			answer = append(answer, &t)
+		}
+	}
+
+	if len(answer) > 1 || o.AllNamespaces {
+		for _, t := range answer {
+			t.qualified = true
+		}
+	}
+	return answer, nil
+}
+
+// createContextTarget creates the clients of the kube context using the current context if it is blank
+func (o *Options) createContextTarget(kubeContext string) (*target, error) {
+	if kubeContext == "" {
+		t := &target{
+			Context:      currentContext(),
+			KubeClient:   o.KubeClient,
+			JXClient:     o.JXClient,
+			TektonClient: o.TektonClient,
+			LHClient:     o.LHClient,
+			TektonLogger: o.TektonLogger,
+		}
+		return t, nil
+	}
+
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		clientcmd.NewDefaultClientConfigLoadingRules(),
+		&clientcmd.ConfigOverrides{CurrentContext: kubeContext}).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kubernetes config for context %s: %w", kubeContext, err)
+	}
+	t := &target{Context: kubeContext, config: cfg}
+	t.KubeClient, err = kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building kube client for context %s: %w", kubeContext, err)
+	}
+	t.JXClient, err = versioned.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building jx client for context %s: %w", kubeContext, err)
+	}
+	t.TektonClient, err = tektonclient.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error building tekton client for context %s: %w", kubeContext, err)
+	}
+	return t, nil
+}
+
+// currentContext returns the name of the current kube context if there is one
+func currentContext() string {
+	config, _, err := kubeclient.LoadConfig()
+	if err != nil || config == nil {
+		return ""
+	}
+	return config.CurrentContext
+}
+
+// watchTarget checks the target can be reached then merges the events of its PipelineActivities into the model.
+// Any failure is shown as a status row of the target rather than stopping the grid
+func (o *Options) watchTarget(m model, t *target, stop chan struct{}) {
+	if t.err != nil {
+		m.onTargetError(t, t.err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(o.GetContext(), targetTimeout)
+	defer cancel()
+
+	_, err := t.JXClient.JenkinsV1().PipelineActivities(t.Namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	if err != nil {
+		m.onTargetError(t, fmt.Errorf("failed to list PipelineActivities: %w", err))
+		return
+	}
+
+	informerFactory := informers.NewSharedInformerFactoryWithOptions(
+		t.JXClient,
+		time.Minute*10,
+		informers.WithNamespace(t.Namespace),
+	)
+	informer := informerFactory.Jenkins().V1().PipelineActivities().Informer()
+	err = informer.SetWatchErrorHandler(func(_ *cache.Reflector, err error) {
+		m.onTargetError(t, fmt.Errorf("failed to watch PipelineActivities: %w", err))
+	})
+	if err != nil {
+		m.onTargetError(t, err)
+		return
+	}
+	_, err = informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			e := obj.(*v1.PipelineActivity)
+			if e != nil {
+				m.onPipelineActivity(t, e)
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			e := obj.(*v1.PipelineActivity)
+			if e != nil {
+				m.onPipelineActivity(t, e)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			// the final state is unknown if the watch missed the delete
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			e, ok := obj.(*v1.PipelineActivity)
+			if ok && e != nil {
+				m.deletePipelineActivity(t, e)
+			}
+		},
+	})
+	if err != nil {
+		m.onTargetError(t, fmt.Errorf("failed to add handler for updated pipeline activities: %w", err))
+		return
+	}
+	informerFactory.Start(stop)
+}
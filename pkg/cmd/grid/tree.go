@@ -0,0 +1,218 @@
+package grid
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+)
+
+// treeNode a stage or step of the expanded activity
+type treeNode struct {
+	depth int
+	name  string
+	step  *v1.CoreActivityStep
+
+	// logSearch the text in the header of the logs of the stage or step which is blank if it has no logs
+	logSearch string
+}
+
+// activityTree returns the stages and steps of the activity in the order they are shown
+func activityTree(act *v1.PipelineActivity) []treeNode {
+	var answer []treeNode
+	for i := range act.Spec.Steps {
+		s := &act.Spec.Steps[i]
+		switch {
+		case s.Stage != nil:
+			stage := s.Stage
+			answer = append(answer, treeNode{name: stage.Name, step: &stage.CoreActivityStep, logSearch: "stage " + stage.Name + " and container"})
+			for j := range stage.Steps {
+				step := &stage.Steps[j]
+				answer = append(answer, treeNode{depth: 1, name: step.Name, step: step, logSearch: "stage " + stage.Name + " and container " + containerName(step.Name)})
+			}
+		case s.Promote != nil:
+			promote := s.Promote
+			name := promote.Name
+			if name == "" {
+				name = "Promote " + promote.Environment
+			}
+			answer = append(answer, treeNode{name: name, step: &promote.CoreActivityStep})
+			if promote.PullRequest != nil {
+				answer = append(answer, treeNode{depth: 1, name: "Pull Request", step: &promote.PullRequest.CoreActivityStep})
+			}
+			if promote.Update != nil {
+				answer = append(answer, treeNode{depth: 1, name: "Update", step: &promote.Update.CoreActivityStep})
+			}
+		case s.Preview != nil:
+			preview := s.Preview
+			name := preview.Name
+			if name == "" {
+				name = "Preview"
+			}
+			answer = append(answer, treeNode{name: name, step: &preview.CoreActivityStep})
+		}
+	}
+	return answer
+}
+
+// containerName returns the name of the container of a step from its humanized name
+func containerName(name string) string {
+	return "step-" + strings.ToLower(strings.ReplaceAll(name, " ", "-"))
+}
+
+// statusIcon returns the coloured icon of the status
+func statusIcon(status v1.ActivityStatusType) string {
+	switch status {
+	case v1.ActivityStatusTypeSucceeded:
+		return termcolor.ColorInfo("✓")
+	case v1.ActivityStatusTypeFailed, v1.ActivityStatusTypeError, v1.ActivityStatusTypeTimedOut:
+		return termcolor.ColorError("✗")
+	case v1.ActivityStatusTypeRunning:
+		return termcolor.ColorStatus("●")
+	case v1.ActivityStatusTypeAborted, v1.ActivityStatusTypeCancelled:
+		return termcolor.ColorWarning("■")
+	case v1.ActivityStatusTypeNotExecuted:
+		return "-"
+	default:
+		return "○"
+	}
+}
+
+// stepDuration returns the duration of the step so far if it is still running
+func stepDuration(step *v1.CoreActivityStep, now time.Time) string {
+	if step.StartedTimestamp == nil {
+		return ""
+	}
+	end := now
+	if step.CompletedTimestamp != nil {
+		end = step.CompletedTimestamp.Time
+	} else if step.Status.IsTerminated() {
+		return ""
+	}
+	return end.Sub(step.StartedTimestamp.Time).Round(time.Second).String()
+}
+
+// expandedTree returns the expanded activity and its stages and steps keeping the cursor within them
+func (a *activityTable) expandedTree() (*v1.PipelineActivity, []treeNode) {
+	act := a.index[a.expanded]
+	if act == nil {
+		return nil, nil
+	}
+	nodes := activityTree(act)
+	if a.treeCursor >= len(nodes) {
+		a.treeCursor = len(nodes) - 1
+	}
+	if a.treeCursor < 0 {
+		a.treeCursor = 0
+	}
+	return act, nodes
+}
+
+// expand shows the stages and steps of the selected activity
+func (a *activityTable) expand() {
+	a.expanded = a.selectedKey()
+	a.treeCursor = 0
+}
+
+// onTreeKey handles the keys when the stages and steps of an activity are shown
+func (m model) onTreeKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	a := m.activityTable
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.stop()
+		return m, tea.Quit
+
+	case "enter", "right", "l":
+		a.lock.Lock()
+		_, nodes := a.expandedTree()
+		if len(nodes) == 0 {
+			a.lock.Unlock()
+			return m, nil
+		}
+		node := nodes[a.treeCursor]
+		a.lock.Unlock()
+		if node.logSearch == "" {
+			a.lock.Lock()
+			a.setResult("", fmt.Errorf("%s has no logs", node.name))
+			a.lock.Unlock()
+			return m, nil
+		}
+		return m, m.openLogs(a.expanded, node.logSearch)
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	switch msg.String() {
+	case "esc", "left", "backspace":
+		a.expanded = ""
+	case "down", "j":
+		a.treeCursor++
+	case "up", "k":
+		a.treeCursor--
+	case "home", "g":
+		a.treeCursor = 0
+	case "end", "G":
+		_, nodes := a.expandedTree()
+		a.treeCursor = len(nodes) - 1
+	}
+	a.expandedTree()
+	return m, nil
+}
+
+// treeView renders the stages and steps of the expanded activity
+func (m model) treeView(s *strings.Builder) {
+	a := m.activityTable
+	act, nodes := a.expandedTree()
+	if act == nil {
+		fmt.Fprintf(s, "pipeline %s has been deleted\n", a.expanded)
+		s.WriteString("esc back to the grid\n")
+		return
+	}
+
+	as := &act.Spec
+	fmt.Fprintf(s, "%s %s #%s %s %s %s\n", info(as.GitOwner+"/"+as.GitRepository), as.GitBranch, as.Build, as.Context,
+		ToPipelineStatus(as.Status), stepDuration(&v1.CoreActivityStep{Status: as.Status, StartedTimestamp: as.StartedTimestamp, CompletedTimestamp: as.CompletedTimestamp}, a.now()))
+	if as.Message != "" && (as.Status == v1.ActivityStatusTypeFailed || as.Status == v1.ActivityStatusTypeError) {
+		s.WriteString(termcolor.ColorError(as.Message))
+		s.WriteString("\n")
+	}
+
+	// keep the cursor on the page
+	size := a.pageSize()
+	offset := 0
+	if a.treeCursor >= size {
+		offset = a.treeCursor - size + 1
+	}
+	last := offset + size
+	if last > len(nodes) {
+		last = len(nodes)
+	}
+	now := a.now()
+	for i := offset; i < last; i++ {
+		node := nodes[i]
+		cursor := "  "
+		name := node.name
+		if i == a.treeCursor {
+			cursor = "> "
+			name = termcolor.ColorStatus(name)
+		}
+		indent := strings.Repeat("  ", node.depth)
+		fmt.Fprintf(s, "%s%s%s %s  %s\n", cursor, indent, statusIcon(node.step.Status), name, stepDuration(node.step, now))
+
+		// show why a stage or step failed
+		if node.step.Message != "" && (node.step.Status == v1.ActivityStatusTypeFailed || node.step.Status == v1.ActivityStatusTypeError) {
+			fmt.Fprintf(s, "  %s    %s\n", indent, termcolor.ColorError(node.step.Message))
+		}
+	}
+	first := offset + 1
+	if len(nodes) == 0 {
+		first = 0
+		s.WriteString("the pipeline has no stages yet\n")
+	}
+
+	fmt.Fprintf(s, "%d-%d of %d stages and steps | up/down move  enter logs of the stage or step  esc back to the grid  q quit\n", first, last, len(nodes))
+}
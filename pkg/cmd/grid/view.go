@@ -12,22 +12,62 @@ import (
 )
 
 func (m model) View() string {
-	m.activityTable.lock.Lock()
-	defer m.activityTable.lock.Unlock()
+	a := m.activityTable
+	a.lock.Lock()
+	defer a.lock.Unlock()
 
-	if m.activityTable.stopped {
+	if a.stopped {
 		return fmt.Sprintf("\npress the %s to go back to the pipeline grid or %s to quit\n\n", info("space bar"), info("q"))
 	}
 
 	s := &strings.Builder{}
+	if a.expanded != "" {
+		m.treeView(s)
+		a.messageView(s)
+		if m.logs.isOpen() {
+			s.WriteString(m.logs.view())
+		}
+		return s.String()
+	}
+
 	t := table.CreateTable(s)
-	t.AddRow("REPOSITORY", "BRANCH", "BUILD", "CONTEXT", "STATUS", "LAST STEP")
+	headers := []string{"REPOSITORY", "BRANCH", "BUILD", "CONTEXT", "STATUS", "LAST STEP"}
+	if a.sortBy != sortStarted {
+		// the sortable columns are in the same order as their sort keys
+		arrow := "^"
+		if a.reverse {
+			arrow = "v"
+		}
+		headers[a.sortBy-sortRepository] += " " + arrow
+	}
+	if m.showTargets {
+		headers = append([]string{"KUBE CONTEXT", "NAMESPACE"}, headers...)
+	}
+	if m.detailsFn != nil {
+		headers = append(headers, "AUTHOR", "TITLE")
+	}
+	t.AddRow(headers...)
 
-	for i, name := range m.activityTable.names {
-		if i >= m.activityTable.height {
-			break
+	// show the targets which cannot be watched in the status and last step columns
+	for _, tg := range a.failedTargets() {
+		row := []string{tg.Context + "/" + tg.Namespace, "", "", ""}
+		if m.showTargets {
+			row = []string{tg.Context, tg.Namespace, "", "", "", ""}
 		}
-		act := m.activityTable.index[name]
+		row = append(row, termcolor.ColorError("Unreachable"), truncate(tg.err.Error(), maxTitleLength))
+		for len(row) < len(headers) {
+			row = append(row, "")
+		}
+		t.AddRow(row...)
+	}
+
+	last := a.offset + a.pageSize()
+	if last > len(a.names) {
+		last = len(a.names)
+	}
+	for i := a.offset; i < last; i++ {
+		name := a.names[i]
+		act := a.index[name]
 		if act == nil {
 			continue
 		}
@@ -35,16 +75,102 @@ func (m model) View() string {
 		as := &act.Spec
 
 		repo := as.GitOwner + "/" + as.GitRepository
-		if i == m.activityTable.current {
+		if i == a.current {
 			repo = termcolor.ColorStatus(repo)
 		}
-		t.AddRow(repo, as.GitBranch, as.Build, as.Context, ToPipelineStatus(as.Status), ToLastStep(act))
+		row := []string{repo, as.GitBranch, as.Build, as.Context, ToPipelineStatus(as.Status), ToLastStep(act)}
+		if m.showTargets {
+			owner := a.owners[name]
+			row = append([]string{owner.Context, owner.namespace(act)}, row...)
+		}
+		if m.detailsFn != nil {
+			d := a.details[name]
+			author := as.Author
+			if d != nil && d.Author != "" {
+				author = d.Author
+			}
+			row = append(row, author, truncate(d.Title(), maxTitleLength))
+		}
+		t.AddRow(row...)
 	}
 
 	t.Render()
+	if a.searching || a.search != "" {
+		cursor := ""
+		if a.searching {
+			cursor = "_"
+		}
+		fmt.Fprintf(s, "/%s%s\n", a.search, cursor)
+	}
+	s.WriteString(a.statusBar())
+	s.WriteString("\n")
+	a.messageView(s)
+	if m.logs.isOpen() {
+		s.WriteString(m.logs.view())
+	}
 	return s.String()
 }
 
+// messageView renders the result of the last action
+func (a *activityTable) messageView(s *strings.Builder) {
+	if a.message == "" {
+		return
+	}
+	message := a.message
+	if a.failed {
+		message = termcolor.ColorError(message)
+	}
+	s.WriteString(message)
+	s.WriteString("\n")
+}
+
+// statusBar summarises the page, the status counts of the activities and the current filters
+func (a *activityTable) statusBar() string {
+	running, failed, succeeded := 0, 0, 0
+	for _, act := range a.index {
+		switch {
+		case !act.Spec.Status.IsTerminated():
+			running++
+		case matchesStatus(act, statusFailed):
+			failed++
+		case act.Spec.Status == v1.ActivityStatusTypeSucceeded:
+			succeeded++
+		}
+	}
+	first, last := 0, a.offset+a.pageSize()
+	if last > len(a.names) {
+		last = len(a.names)
+	}
+	if len(a.names) > 0 {
+		first = a.offset + 1
+	}
+
+	parts := []string{
+		fmt.Sprintf("%d-%d of %d", first, last, len(a.names)),
+		fmt.Sprintf("%s running %s failed %s succeeded of %d", info(running), termcolor.ColorError(failed), info(succeeded), len(a.index)),
+		"sort: " + a.sortBy.String(),
+	}
+	if a.reverse {
+		parts[2] += " reversed"
+	}
+	if a.status != statusAll {
+		parts = append(parts, "showing: "+a.status)
+	}
+	parts = append(parts, "enter steps  l logs  / search  r running  f failed  0-5 sort  x stop  R rerun  b breakpoint  o open  e env  c copy  q quit")
+	return strings.Join(parts, " | ")
+}
+
+// maxTitleLength the maximum length of the commit message or pull request title in the grid
+const maxTitleLength = 60
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-3]) + "..."
+}
+
 func ToPipelineStatus(statusType v1.ActivityStatusType) string {
 	text := statusType.String()
 	switch statusType {
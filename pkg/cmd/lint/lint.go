@@ -12,12 +12,15 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/linter"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/yamls"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/jenkins-x/lighthouse-client/pkg/config/job"
 	"github.com/jenkins-x/lighthouse-client/pkg/triggerconfig"
 	"github.com/jenkins-x/lighthouse-client/pkg/triggerconfig/inrepo"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	yamlv3 "gopkg.in/yaml.v3"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"knative.dev/pkg/apis"
 	"sigs.k8s.io/yaml"
@@ -36,6 +39,14 @@ type Options struct {
 	Recursive bool
 	All       bool
 	Resolver  *inrepo.UsesResolver
+
+	// Config the configuration of the rules used for every file rather than the lint.yaml of each .lighthouse folder
+	Config *Config
+
+	issues     map[*linter.Test][]*Issue
+	configs    map[*linter.Test]*Config
+	dirConfigs map[string]*Config
+	docs       map[string]*yamlv3.Node
 }
 
 var (
@@ -48,11 +59,33 @@ var (
 
 	cmdLong = templates.LongDesc(`
 		Lints the lighthouse trigger and tekton pipelines
+
+		The results can be output as a table, TAP, SARIF 2.1.0 for GitHub code scanning, JUnit XML for CI test reports or JSON for tools.
+		The command fails if any file has an error whereas warnings are only reported.
+
+		As well as validating the pipelines it checks the semantics of the triggers.yaml files and the best practices of the steps written in the pipelines rather than the steps they use from a catalog.
+		Rules can be enabled or disabled and the longest pipeline timeout configured in a lint.yaml file in each .lighthouse folder such as:
+
+		    disabled:
+		    - privileged
+		    enabled:
+		    - image-digest
+		    - resource-requests
+		    maxTimeout: 2h
+
+		A '# jx-lint-ignore RULE' comment ignores the rule on its line, or on the next line if the comment is on its own line,
+		or in the whole file if the comment is before the YAML content.
 `)
 
 	cmdExample = templates.Examples(`
 		# Lints the lighthouse files and local pipeline files
 		jx pipeline lint
+
+		# Lints the pipelines saving the results for GitHub code scanning
+		jx pipeline lint --output sarif -o results.sarif
+
+		# Lints the pipelines saving the results as a JUnit test report
+		jx pipeline lint --output junit -o report.xml
 	`)
 )
 
@@ -75,7 +108,10 @@ func NewCmdPipelineLint() (*cobra.Command, *Options) {
 	cmd.Flags().BoolVarP(&o.Recursive, "recursive", "r", false, "Recurisvely find all '.lighthouse' folders such as if linting a Pipeline Catalog")
 	cmd.Flags().BoolVarP(&o.All, "all", "a", false, "Rather than looking for .lighthouse and triggers.yaml files it looks for all YAML files which are tekton kinds")
 
-	o.Options.AddFlags(cmd)
+	cmd.Flags().StringVarP(&o.Format, "output", "", FormatTable, "The output format. Valid values are: "+strings.Join(formats, ", "))
+	cmd.Flags().StringVarP(&o.OutFile, "out", "o", "", "The file to write the results to. If not specified the results are output to the terminal. The table output is written to a file in TAP format")
+	cmd.Flags().StringVarP(&o.Options.Format, "format", "", "", "If specify 'tap' lets use the TAP output otherwise use simple text output")
+	_ = cmd.Flags().MarkDeprecated("format", "use --output tap instead")
 
 	return cmd, o
 }
@@ -87,6 +123,14 @@ func (o *Options) Validate() error {
 		return fmt.Errorf("failed to validate base options: %w", err)
 	}
 
+	// the table cannot be saved to a file so lets keep writing TAP files
+	if o.Options.Format == FormatTap || (o.Format == FormatTable && o.OutFile != "") {
+		o.Format = FormatTap
+	}
+	if stringhelpers.StringArrayIndex(formats, o.Format) < 0 {
+		return options.InvalidOptionf("output", o.Format, "valid values are: %s", strings.Join(formats, ", "))
+	}
+
 	if o.Resolver == nil {
 		o.Resolver, err = o.CreateResolver()
 		if err != nil {
@@ -113,6 +157,9 @@ func (o *Options) Run() error {
 			if info == nil || info.IsDir() || !strings.HasSuffix(info.Name(), ".yaml") {
 				return nil
 			}
+			if info.Name() == ConfigFileName && filepath.Base(filepath.Dir(path)) == ".lighthouse" {
+				return nil
+			}
 			return o.ProcessFile(path)
 		})
 		if err != nil {
@@ -138,7 +185,16 @@ func (o *Options) Run() error {
 			return err
 		}
 	}
-	return o.LogResults()
+
+	report := o.Report()
+	err = o.writeResults(report)
+	if err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	if report.Errors > 0 {
+		return fmt.Errorf("found %d errors and %d warnings in %d files", report.Errors, report.Warnings, len(report.Files))
+	}
+	return nil
 }
 
 func (o *Options) ProcessFile(path string) error {
@@ -162,19 +218,21 @@ func (o *Options) ProcessFile(path string) error {
 		return nil
 	}
 
-	test := &linter.Test{
-		File: path,
+	cfg, err := o.loadConfig(lighthouseDir(path, o.Dir))
+	if err != nil {
+		return err
 	}
-	o.Tests = append(o.Tests, test)
+	test := o.addTest(path, cfg)
+	o.lintTektonResource(test, data)
 
 	dir := filepath.Dir(path)
 	o.Resolver.Dir = dir
-	pr, err := inrepo.LoadTektonResourceAsPipelineRun(o.Resolver, data)
+	ctx := o.GetContext()
+	pr, err := lighthouses.LoadTektonResourceAsPipelineRun(ctx, o.Resolver, path, data)
 	if err != nil {
 		test.Error = err
 		return nil
 	}
-	ctx := o.GetContext()
 	fieldError := ValidatePipelineRun(ctx, pr)
 	if fieldError != nil {
 		test.Error = fieldError
@@ -224,6 +282,10 @@ func (o *Options) ProcessDir(dir string) error {
 	if err != nil {
 		return fmt.Errorf("failed to read dir %s: %w", dir, err)
 	}
+	cfg, err := o.loadConfig(dir)
+	if err != nil {
+		return err
+	}
 	for _, f := range fs {
 		name := f.Name()
 		if !f.IsDir() || strings.HasPrefix(name, ".") {
@@ -240,54 +302,31 @@ func (o *Options) ProcessDir(dir string) error {
 			continue
 		}
 
-		test := &linter.Test{
-			File: triggersFile,
-		}
-		o.Tests = append(o.Tests, test)
+		test := o.addTest(triggersFile, cfg)
 		triggers := &triggerconfig.Config{}
 		err = yamls.LoadFile(triggersFile, triggers)
 		if err != nil {
 			test.Error = err
 			continue
 		}
+		o.lintTriggers(test, triggers, triggerDir)
 
-		o.loadConfigFile(triggers, triggerDir)
+		o.loadConfigFile(triggers, triggerDir, cfg)
 	}
 	return nil
 }
 
-func (o *Options) loadConfigFile(repoConfig *triggerconfig.Config, dir string) *triggerconfig.Config {
-	ctx := o.GetContext()
+func (o *Options) loadConfigFile(repoConfig *triggerconfig.Config, dir string, cfg *Config) *triggerconfig.Config {
 	for i := range repoConfig.Spec.Presubmits {
 		r := &repoConfig.Spec.Presubmits[i]
-		if r.SourcePath != "" {
-			path := filepath.Join(dir, r.SourcePath)
-			test := &linter.Test{
-				File: path,
-			}
-			o.Tests = append(o.Tests, test)
-			err := loadJobBaseFromSourcePath(ctx, o.Resolver, path)
-			if err != nil {
-				test.Error = err
-			}
-		}
+		o.lintSourcePath(dir, r.SourcePath, cfg)
 		if r.Agent == "" && r.PipelineRunSpec != nil {
 			r.Agent = job.TektonPipelineAgent
 		}
 	}
 	for i := range repoConfig.Spec.Postsubmits {
 		r := &repoConfig.Spec.Postsubmits[i]
-		if r.SourcePath != "" {
-			path := filepath.Join(dir, r.SourcePath)
-			test := &linter.Test{
-				File: path,
-			}
-			o.Tests = append(o.Tests, test)
-			err := loadJobBaseFromSourcePath(ctx, o.Resolver, path)
-			if err != nil {
-				test.Error = err
-			}
-		}
+		o.lintSourcePath(dir, r.SourcePath, cfg)
 		if r.Agent == "" && r.PipelineRunSpec != nil {
 			r.Agent = job.TektonPipelineAgent
 		}
@@ -295,6 +334,34 @@ func (o *Options) loadConfigFile(repoConfig *triggerconfig.Config, dir string) *
 	return repoConfig
 }
 
+// lintSourcePath lints the source file of a trigger if it exists. A missing source is reported against the triggers file
+func (o *Options) lintSourcePath(dir, sourcePath string, cfg *Config) {
+	if sourcePath == "" {
+		return
+	}
+	path := filepath.Join(dir, sourcePath)
+	exists, err := files.FileExists(path)
+	if err == nil && !exists {
+		return
+	}
+	for _, t := range o.Tests {
+		if t.File == path {
+			// the source is shared by more than one trigger
+			return
+		}
+	}
+	test := o.addTest(path, cfg)
+	err = loadJobBaseFromSourcePath(o.GetContext(), o.Resolver, path)
+	if err != nil {
+		test.Error = err
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		o.lintTektonResource(test, data)
+	}
+}
+
+// loadJobBaseFromSourcePath loads and validates the pipeline of the file
 func loadJobBaseFromSourcePath(ctx context.Context, resolver *inrepo.UsesResolver, path string) error {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -306,7 +373,7 @@ func loadJobBaseFromSourcePath(ctx context.Context, resolver *inrepo.UsesResolve
 
 	dir := filepath.Dir(path)
 	resolver.Dir = dir
-	pr, err := inrepo.LoadTektonResourceAsPipelineRun(resolver, data)
+	pr, err := lighthouses.LoadTektonResourceAsPipelineRun(ctx, resolver, path, data)
 	if err != nil {
 		return fmt.Errorf("failed to unmarshal YAML file %s: %w", path, err)
 	}
@@ -2,6 +2,7 @@ package lint_test
 
 import (
 	"context"
+	"os"
 	"path/filepath"
 	"testing"
 
@@ -32,7 +33,7 @@ func TestLintInvalid(t *testing.T) {
 	o.All = true
 	o.Ctx = context.TODO()
 	err := o.Run()
-	require.NoError(t, err, "Failed to run linter")
+	require.Error(t, err, "linter should fail on an invalid pipeline")
 
 	require.Len(t, o.Tests, 1, "resulting tests")
 	i := 0
@@ -41,3 +42,143 @@ func TestLintInvalid(t *testing.T) {
 	require.NotNil(t, tr.Error, "error for test %d", i)
 	t.Logf("got expected error %v\n", tr.Error)
 }
+
+func TestLintFlags(t *testing.T) {
+	cmd, o := lint.NewCmdPipelineLint()
+
+	err := cmd.ParseFlags([]string{"--output", lint.FormatSARIF, "-o", "results.sarif"})
+	require.NoError(t, err, "failed to parse flags")
+	require.Equal(t, lint.FormatSARIF, o.Format, "output format")
+	require.Equal(t, "results.sarif", o.OutFile, "the -o shorthand should be the output file")
+}
+
+func TestLintOutput(t *testing.T) {
+	extensions := map[string]string{
+		lint.FormatSARIF: "sarif",
+		lint.FormatJUnit: "xml",
+		lint.FormatJSON:  "json",
+	}
+	testCases := []struct {
+		name    string
+		all     bool
+		invalid bool
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name:    "invalid",
+			all:     true,
+			invalid: true,
+		},
+	}
+	for _, tc := range testCases {
+		for format, ext := range extensions {
+			_, o := lint.NewCmdPipelineLint()
+
+			o.Dir = filepath.Join("test_data", tc.name)
+			o.All = tc.all
+			o.Format = format
+			o.OutFile = filepath.Join(t.TempDir(), "results."+ext)
+			o.Ctx = context.TODO()
+			err := o.Run()
+			if tc.invalid {
+				require.Error(t, err, "linter should fail for %s with format %s", tc.name, format)
+			} else {
+				require.NoError(t, err, "Failed to run linter for %s with format %s", tc.name, format)
+			}
+
+			expectedFile := filepath.Join("test_data", "golden", tc.name+"."+ext)
+			expected, err := os.ReadFile(expectedFile)
+			require.NoError(t, err, "failed to load %s", expectedFile)
+
+			actual, err := os.ReadFile(o.OutFile)
+			require.NoError(t, err, "failed to load %s", o.OutFile)
+			require.Equal(t, string(expected), string(actual), "output of %s with format %s", tc.name, format)
+		}
+	}
+}
+
+func TestLintRules(t *testing.T) {
+	_, o := lint.NewCmdPipelineLint()
+
+	o.Dir = filepath.Join("test_data", "rules")
+	o.Ctx = context.TODO()
+	err := o.Run()
+	require.Error(t, err, "linter should fail on the rules")
+
+	type issue struct {
+		file string
+		line int
+		rule string
+	}
+	var actual []issue
+	for _, fr := range o.Report().Files {
+		for _, i := range fr.Issues {
+			actual = append(actual, issue{file: filepath.Base(fr.File), line: i.Line, rule: i.Rule})
+		}
+	}
+
+	expected := []issue{
+		{"triggers.yaml", 10, lint.RuleTriggerRerunCommand},
+		{"triggers.yaml", 12, lint.RuleTriggerDuplicateContext},
+		{"triggers.yaml", 13, lint.RuleTriggerSharedSource},
+		{"triggers.yaml", 16, lint.RuleTriggerMaxConcurrency},
+		{"triggers.yaml", 19, lint.RuleTriggerMissingSource},
+		{"triggers.yaml", 20, lint.RuleTriggerInvalidRegex},
+		{"triggers.yaml", 21, lint.RuleTriggerRerunCommand},
+		{"triggers.yaml", 23, lint.RuleTriggerDuplicateName},
+		{"triggers.yaml", 26, lint.RuleTriggerUnknownField},
+		{"triggers.yaml", 29, lint.RuleTriggerInvalidRegex},
+		{"triggers.yaml", 30, lint.RuleTriggerUnknownField},
+		{"pullrequest.yaml", 19, lint.RuleDuplicateStepName},
+		{"pullrequest.yaml", 20, lint.RuleImageDigest},
+		{"pullrequest.yaml", 20, lint.RuleImageLatestTag},
+		{"pullrequest.yaml", 23, lint.RuleEnvPlainSecret},
+		{"pullrequest.yaml", 24, lint.RuleScriptSetE},
+		{"pullrequest.yaml", 28, lint.RuleImageLatestTag},
+		{"pullrequest.yaml", 30, lint.RulePrivileged},
+		{"pullrequest.yaml", 35, lint.RulePipelineTimeout},
+	}
+	for _, e := range expected {
+		require.Contains(t, actual, e, "expected issue")
+	}
+
+	// the rules which are not enabled in the lint.yaml or ignored by comments are not reported
+	for _, a := range actual {
+		require.NotEqual(t, lint.RuleResourceRequests, a.rule, "rule which is not enabled reported at %s:%d", a.file, a.line)
+		require.NotEqual(t, lint.RuleHardCodedNamespace, a.rule, "ignored rule reported at %s:%d", a.file, a.line)
+		require.NotEqual(t, issue{"pullrequest.yaml", 28, lint.RuleImageDigest}, a, "ignored issue reported")
+		require.NotEqual(t, "release.yaml", a.file, "issue reported for valid pipeline")
+	}
+}
+
+func TestLintConfig(t *testing.T) {
+	_, o := lint.NewCmdPipelineLint()
+
+	o.Dir = filepath.Join("test_data", "config")
+	o.Recursive = true
+	o.Ctx = context.TODO()
+	err := o.Run()
+	require.NoError(t, err, "Failed to run linter")
+
+	type issue struct {
+		file string
+		line int
+		rule string
+	}
+	var actual []issue
+	for _, fr := range o.Report().Files {
+		for _, i := range fr.Issues {
+			actual = append(actual, issue{file: fr.File, line: i.Line, rule: i.Rule})
+		}
+	}
+
+	// each .lighthouse folder uses its own lint.yaml and the Task has no pipeline timeout
+	expected := []issue{
+		{"a/.lighthouse/jenkins-x/release.yaml", 19, lint.RulePipelineTimeout},
+		{"b/.lighthouse/jenkins-x/verify.yaml", 10, lint.RulePrivileged},
+		{"b/.lighthouse/jenkins-x/release.yaml", 14, lint.RulePrivileged},
+	}
+	require.ElementsMatch(t, expected, actual, "issues")
+}
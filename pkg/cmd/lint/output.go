@@ -0,0 +1,560 @@
+package lint
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/linter"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"gopkg.in/yaml.v3"
+	"knative.dev/pkg/apis"
+)
+
+const (
+	// FormatTable the human readable table of files and their errors
+	FormatTable = "table"
+
+	// FormatTap the Test Anything Protocol output
+	FormatTap = linter.FormatTap
+
+	// FormatSARIF the SARIF 2.1.0 output used by GitHub code scanning
+	FormatSARIF = "sarif"
+
+	// FormatJUnit the JUnit XML output used for CI test reports
+	FormatJUnit = "junit"
+
+	// FormatJSON the JSON output for tools
+	FormatJSON = "json"
+
+	// SeverityError an issue which fails the lint
+	SeverityError = "error"
+
+	// SeverityWarning an issue which is reported but does not fail the lint
+	SeverityWarning = "warning"
+
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	toolName     = "jx-pipeline lint"
+	toolURI      = "https://github.com/jenkins-x-plugins/jx-pipeline"
+)
+
+var (
+	formats = []string{FormatTable, FormatTap, FormatSARIF, FormatJUnit, FormatJSON}
+)
+
+// Issue a problem found in a file
+type Issue struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	Field    string `json:"field,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+}
+
+// FileResult the issues found in a file
+type FileResult struct {
+	// File the path of the file relative to the linted directory using forward slashes
+	File   string   `json:"file"`
+	Status string   `json:"status"`
+	Issues []*Issue `json:"issues,omitempty"`
+}
+
+// Report the results of linting all the files
+type Report struct {
+	Files    []*FileResult `json:"files"`
+	Errors   int           `json:"errors"`
+	Warnings int           `json:"warnings"`
+}
+
+// Report returns the issues found in each of the tests which are not disabled or ignored
+func (o *Options) Report() *Report {
+	report := &Report{
+		Files: []*FileResult{},
+	}
+	for _, test := range o.Tests {
+		fr := &FileResult{
+			File:   o.relativeFile(test.File),
+			Status: "ok",
+		}
+		cfg := o.testConfig(test)
+		ignored := loadIgnores(test.File)
+		for _, issue := range append(o.testIssues(test), o.issues[test]...) {
+			rule := FindRule(issue.Rule)
+			if (rule != nil && !cfg.IsEnabled(rule)) || ignored.isIgnored(issue) {
+				continue
+			}
+			fr.Issues = append(fr.Issues, issue)
+			if issue.Severity == SeverityError {
+				report.Errors++
+				fr.Status = SeverityError
+			} else {
+				report.Warnings++
+				if fr.Status == "ok" {
+					fr.Status = SeverityWarning
+				}
+			}
+		}
+		sort.SliceStable(fr.Issues, func(i, j int) bool {
+			a, b := fr.Issues[i], fr.Issues[j]
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+		report.Files = append(report.Files, fr)
+	}
+	return report
+}
+
+func (o *Options) relativeFile(path string) string {
+	rel, err := filepath.Rel(o.Dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// testIssues returns the issues of the error of the test locating each invalid field in the YAML of the file
+func (o *Options) testIssues(test *linter.Test) []*Issue {
+	if test.Error == nil {
+		return nil
+	}
+
+	fe := &apis.FieldError{}
+	if !errors.As(test.Error, &fe) {
+		rule := RulePipelineLoad
+		if filepath.Base(test.File) == "triggers.yaml" {
+			rule = RuleTriggersLoad
+		}
+		return []*Issue{
+			{
+				Rule:     rule,
+				Severity: SeverityError,
+				Message:  test.Error.Error(),
+			},
+		}
+	}
+
+	var answer []*Issue
+	for _, e := range fe.WrappedErrors() {
+		severity := SeverityError
+		if e.Level == apis.WarningLevel {
+			severity = SeverityWarning
+		}
+		message := e.Message
+		if e.Details != "" {
+			message += ": " + e.Details
+		}
+		paths := e.Paths
+		if len(paths) == 0 {
+			paths = []string{""}
+		}
+		for _, field := range paths {
+			line, column := FindPosition(o.loadYAMLNode(test.File), field)
+			answer = append(answer, &Issue{
+				Rule:     RulePipelineValidation,
+				Severity: severity,
+				Message:  message,
+				Field:    field,
+				Line:     line,
+				Column:   column,
+			})
+		}
+	}
+	return answer
+}
+
+// loadYAMLNode loads the first document of the YAML file returning nil if it cannot be parsed
+func loadYAMLNode(path string) *yaml.Node {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	doc := &yaml.Node{}
+	err = yaml.Unmarshal(data, doc)
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+// loadYAMLNode returns the parsed YAML file caching it for the other issues of the file
+func (o *Options) loadYAMLNode(path string) *yaml.Node {
+	doc, ok := o.docs[path]
+	if !ok {
+		doc = loadYAMLNode(path)
+		if o.docs == nil {
+			o.docs = map[string]*yaml.Node{}
+		}
+		o.docs[path] = doc
+	}
+	return doc
+}
+
+// FindPosition returns the line and column of the deepest node of the YAML document on the field path such as
+// 'spec.pipelineSpec.tasks[0].name' or zero if none of the path could be found
+func FindPosition(doc *yaml.Node, field string) (line, column int) {
+	if doc == nil || field == "" {
+		return 0, 0
+	}
+	node := doc
+	if node.Kind == yaml.DocumentNode {
+		if len(node.Content) == 0 {
+			return 0, 0
+		}
+		node = node.Content[0]
+	}
+	for _, part := range splitFieldPath(field) {
+		key := part
+		if strings.HasPrefix(part, "[") {
+			key = strings.TrimSuffix(strings.TrimPrefix(part, "["), "]")
+			if node.Kind == yaml.SequenceNode {
+				idx, err := strconv.Atoi(key)
+				if err != nil || idx < 0 || idx >= len(node.Content) {
+					return line, column
+				}
+				node = node.Content[idx]
+				line, column = node.Line, node.Column
+				continue
+			}
+		}
+		if node.Kind != yaml.MappingNode {
+			return line, column
+		}
+		found := false
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k := node.Content[i]
+			if k.Value == key {
+				line, column = k.Line, k.Column
+				node = node.Content[i+1]
+				found = true
+				break
+			}
+		}
+		if !found {
+			return line, column
+		}
+	}
+	return line, column
+}
+
+// splitFieldPath splits the field path into its names and bracketed indexes or keys
+func splitFieldPath(field string) []string {
+	var answer []string
+	name := strings.Builder{}
+	flush := func() {
+		if name.Len() > 0 {
+			answer = append(answer, name.String())
+			name.Reset()
+		}
+	}
+	for i := 0; i < len(field); i++ {
+		c := field[i]
+		switch c {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(field[i:], ']')
+			if end < 0 {
+				name.WriteString(field[i:])
+				i = len(field)
+				continue
+			}
+			answer = append(answer, field[i:i+end+1])
+			i += end
+		default:
+			name.WriteByte(c)
+		}
+	}
+	flush()
+	return answer
+}
+
+// writeResults writes the report in the output format to the output file or the terminal
+func (o *Options) writeResults(report *Report) error {
+	switch o.Format {
+	case FormatTable, FormatTap:
+		o.Options.Format = o.Format
+		o.Options.OutFile = o.OutFile
+		return o.LogResults()
+	}
+
+	if o.OutFile == "" {
+		return o.writeReport(os.Stdout, report)
+	}
+	dir := filepath.Dir(o.OutFile)
+	err := os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create dir %s: %w", dir, err)
+	}
+	f, err := os.Create(o.OutFile)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", o.OutFile, err)
+	}
+	err = o.writeReport(f, report)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to save file %s: %w", o.OutFile, err)
+	}
+	log.Logger().Infof("saved file %s", termcolor.ColorInfo(o.OutFile))
+	return nil
+}
+
+func (o *Options) writeReport(w io.Writer, report *Report) error {
+	switch o.Format {
+	case FormatSARIF:
+		return WriteSARIF(w, report)
+	case FormatJUnit:
+		return WriteJUnit(w, report)
+	default:
+		return WriteJSON(w, report)
+	}
+}
+
+// WriteJSON writes the report as JSON
+func WriteJSON(w io.Writer, report *Report) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	Help                 sarifMessage       `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Enabled bool   `json:"enabled"`
+	Level   string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// WriteSARIF writes the report as a SARIF 2.1.0 log with the file URIs relative to the source root
+func WriteSARIF(w io.Writer, report *Report) error {
+	driver := sarifDriver{
+		Name:           toolName,
+		InformationURI: toolURI,
+	}
+	ruleIndex := map[string]int{}
+	for i, r := range Rules {
+		ruleIndex[r.ID] = i
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   r.ID,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			Help:                 sarifMessage{Text: r.Docs},
+			DefaultConfiguration: sarifConfiguration{Enabled: !r.DisabledByDefault, Level: r.Severity},
+		})
+	}
+
+	run := sarifRun{
+		Tool:    sarifTool{Driver: driver},
+		Results: []sarifResult{},
+	}
+	for _, fr := range report.Files {
+		for _, issue := range fr.Issues {
+			location := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{
+					URI:       fr.File,
+					URIBaseID: "%SRCROOT%",
+				},
+			}
+			if issue.Line > 0 {
+				location.Region = &sarifRegion{
+					StartLine:   issue.Line,
+					StartColumn: issue.Column,
+				}
+			}
+			message := issue.Message
+			if issue.Field != "" {
+				message += ": " + issue.Field
+			}
+			run.Results = append(run.Results, sarifResult{
+				RuleID:    issue.Rule,
+				RuleIndex: ruleIndex[issue.Rule],
+				Level:     issue.Severity,
+				Message:   sarifMessage{Text: message},
+				Locations: []sarifLocation{{PhysicalLocation: location}},
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SARIF: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut *junitOutput  `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",cdata"`
+}
+
+type junitOutput struct {
+	Text string `xml:",cdata"`
+}
+
+// WriteJUnit writes the report as JUnit XML with a testcase for each file which fails if it has any errors.
+// Warnings are written to the output of the testcase
+func WriteJUnit(w io.Writer, report *Report) error {
+	suite := junitTestSuite{
+		Name: toolName,
+	}
+	for _, fr := range report.Files {
+		tc := junitTestCase{
+			Name:      fr.File,
+			ClassName: toolName,
+		}
+		var errs, warnings []string
+		for _, issue := range fr.Issues {
+			if issue.Severity == SeverityError {
+				errs = append(errs, issue.String())
+			} else {
+				warnings = append(warnings, issue.String())
+			}
+		}
+		if len(errs) > 0 {
+			suite.Failures++
+			tc.Failure = &junitFailure{
+				Message: fmt.Sprintf("%d error(s) in %s", len(errs), fr.File),
+				Text:    strings.Join(errs, "\n"),
+			}
+			for _, issue := range fr.Issues {
+				if issue.Severity == SeverityError {
+					tc.Failure.Type = issue.Rule
+					break
+				}
+			}
+		}
+		if len(warnings) > 0 {
+			tc.SystemOut = &junitOutput{Text: strings.Join(warnings, "\n")}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+
+	data, err := xml.MarshalIndent(junitTestSuites{
+		Name:     toolName,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JUnit XML: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, data)
+	return err
+}
+
+// String returns the position, rule and message of the issue
+func (i *Issue) String() string {
+	buf := strings.Builder{}
+	if i.Line > 0 {
+		fmt.Fprintf(&buf, "%d:%d: ", i.Line, i.Column)
+	}
+	fmt.Fprintf(&buf, "%s %s: %s", i.Severity, i.Rule, i.Message)
+	if i.Field != "" {
+		fmt.Fprintf(&buf, ": %s", i.Field)
+	}
+	return buf.String()
+}
@@ -0,0 +1,242 @@
+package lint
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/linter"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	secretEnvRegex = regexp.MustCompile(`(?i)(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|CREDENTIALS)`)
+	setERegex      = regexp.MustCompile(`(?m)^\s*set\s+(-[a-zA-Z]*e|-o\s+errexit|.*\s-[a-zA-Z]*e)`)
+	shellRegex     = regexp.MustCompile(`^#!\s*\S*/(env\s+)?(sh|bash|ash|dash|zsh|ksh)\b(.*)`)
+)
+
+// lintPipelineRun checks the best practices of the PipelineRun loaded from the tekton resource of the kind in the
+// file of the test
+func (o *Options) lintPipelineRun(test *linter.Test, kind string, pr *pipelinev1.PipelineRun) {
+	if pr.Namespace != "" {
+		o.addIssue(test, RuleHardCodedNamespace, "metadata.namespace", fmt.Sprintf("the pipeline has the hard coded namespace %s", pr.Namespace))
+	}
+
+	// the timeout of the other kinds is only set when lighthouse converts them to a PipelineRun
+	if kind == "PipelineRun" {
+		o.checkTimeout(test, pr)
+	}
+
+	ps := pr.Spec.PipelineSpec
+	if ps == nil {
+		return
+	}
+	for i := range ps.Tasks {
+		pt := &ps.Tasks[i]
+		if pt.TaskSpec != nil {
+			o.lintTaskSpec(test, taskSpecField(kind, "tasks", i), &pt.TaskSpec.TaskSpec)
+		}
+	}
+	for i := range ps.Finally {
+		pt := &ps.Finally[i]
+		if pt.TaskSpec != nil {
+			o.lintTaskSpec(test, taskSpecField(kind, "finally", i), &pt.TaskSpec.TaskSpec)
+		}
+	}
+}
+
+// taskSpecField returns the field path of the task spec of the pipeline task in the tekton resource of the kind
+func taskSpecField(kind, tasks string, i int) string {
+	switch kind {
+	case "Task":
+		return "spec"
+	case "TaskRun":
+		return "spec.taskSpec"
+	case "Pipeline":
+		return fmt.Sprintf("spec.%s[%d].taskSpec", tasks, i)
+	default:
+		return fmt.Sprintf("spec.pipelineSpec.%s[%d].taskSpec", tasks, i)
+	}
+}
+
+// loadTektonResource loads the tekton resource of the file as a PipelineRun with the same layout lighthouse uses
+// but without resolving the steps of `uses:` or prepending the steps of the prependStepsURL annotation so that the
+// steps have the indexes of the file
+func loadTektonResource(ctx context.Context, data []byte) (string, *pipelinev1.PipelineRun, error) {
+	data, _, err := pipelines.ConvertV1beta1YAML(ctx, data)
+	if err != nil {
+		return "", nil, err
+	}
+	tm := &metav1.TypeMeta{}
+	err = yaml.Unmarshal(data, tm)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal the kind: %w", err)
+	}
+
+	pr := &pipelinev1.PipelineRun{}
+	switch tm.Kind {
+	case "Pipeline":
+		p := &pipelinev1.Pipeline{}
+		err = yaml.Unmarshal(data, p)
+		pr.ObjectMeta = p.ObjectMeta
+		pr.Spec.PipelineSpec = &p.Spec
+	case "Task":
+		t := &pipelinev1.Task{}
+		err = yaml.Unmarshal(data, t)
+		pr.ObjectMeta = t.ObjectMeta
+		pr.Spec.PipelineSpec = embeddedTaskPipelineSpec(&t.Spec)
+	case "TaskRun":
+		tr := &pipelinev1.TaskRun{}
+		err = yaml.Unmarshal(data, tr)
+		pr.ObjectMeta = tr.ObjectMeta
+		if tr.Spec.TaskSpec != nil {
+			pr.Spec.PipelineSpec = embeddedTaskPipelineSpec(tr.Spec.TaskSpec)
+		}
+	default:
+		err = yaml.Unmarshal(data, pr)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to unmarshal the %s: %w", tm.Kind, err)
+	}
+	return tm.Kind, pr, nil
+}
+
+// embeddedTaskPipelineSpec returns the pipeline of the single task
+func embeddedTaskPipelineSpec(ts *pipelinev1.TaskSpec) *pipelinev1.PipelineSpec {
+	return &pipelinev1.PipelineSpec{
+		Tasks: []pipelinev1.PipelineTask{
+			{
+				TaskSpec: &pipelinev1.EmbeddedTask{TaskSpec: *ts},
+			},
+		},
+	}
+}
+
+// lintTektonResource checks the best practices of the tekton resource of the file. The steps which come from `uses:`
+// are left to the catalog they come from
+func (o *Options) lintTektonResource(test *linter.Test, data []byte) {
+	kind, pr, err := loadTektonResource(o.GetContext(), data)
+	if err != nil {
+		// the error is reported when lighthouse loads the file
+		log.Logger().Debugf("failed to load %s: %s", test.File, err.Error())
+		return
+	}
+	o.lintPipelineRun(test, kind, pr)
+}
+
+// checkTimeout checks the pipeline has a timeout within the limit of the lint.yaml if there is one
+func (o *Options) checkTimeout(test *linter.Test, pr *pipelinev1.PipelineRun) {
+	if pr.Spec.Timeouts == nil || pr.Spec.Timeouts.Pipeline == nil || pr.Spec.Timeouts.Pipeline.Duration == 0 {
+		o.addIssue(test, RulePipelineTimeout, "spec.timeouts.pipeline", "the pipeline has no timeout")
+		return
+	}
+	maxTimeout := o.testConfig(test).maxTimeout
+	timeout := pr.Spec.Timeouts.Pipeline.Duration
+	if maxTimeout > 0 && timeout > maxTimeout {
+		o.addIssue(test, RulePipelineTimeout, "spec.timeouts.pipeline", fmt.Sprintf("the pipeline timeout %s is over the limit of %s", timeout.String(), maxTimeout.String()))
+	}
+}
+
+// lintTaskSpec checks the best practices of the steps of the task
+func (o *Options) lintTaskSpec(test *linter.Test, field string, ts *pipelinev1.TaskSpec) {
+	templateRequests := false
+	templatePrivileged := false
+	if st := ts.StepTemplate; st != nil {
+		templateRequests = len(st.ComputeResources.Requests) > 0
+		templatePrivileged = st.SecurityContext != nil && st.SecurityContext.Privileged != nil && *st.SecurityContext.Privileged
+		if templatePrivileged {
+			o.addIssue(test, RulePrivileged, field+".stepTemplate.securityContext.privileged", "the step template runs privileged")
+		}
+		o.checkEnv(test, field+".stepTemplate", st.Env)
+	}
+
+	names := map[string]bool{}
+	for i := range ts.Steps {
+		step := &ts.Steps[i]
+		if strings.HasPrefix(step.Image, "uses:") {
+			continue
+		}
+		stepField := fmt.Sprintf("%s.steps[%d]", field, i)
+		name := step.Name
+		if name != "" {
+			if names[name] {
+				o.addIssue(test, RuleDuplicateStepName, stepField+".name", fmt.Sprintf("the step name %s is used by more than one step", name))
+			}
+			names[name] = true
+		} else {
+			name = fmt.Sprintf("%d", i+1)
+		}
+
+		o.checkImage(test, stepField+".image", name, step.Image)
+
+		if !templateRequests && len(step.ComputeResources.Requests) == 0 {
+			o.addIssue(test, RuleResourceRequests, stepField, fmt.Sprintf("the step %s has no resource requests", name))
+		}
+		if step.Script != "" && !scriptExitsOnError(step.Script) {
+			o.addIssue(test, RuleScriptSetE, stepField+".script", fmt.Sprintf("the script of step %s does not use set -e", name))
+		}
+		if !templatePrivileged && step.SecurityContext != nil && step.SecurityContext.Privileged != nil && *step.SecurityContext.Privileged {
+			o.addIssue(test, RulePrivileged, stepField+".securityContext.privileged", fmt.Sprintf("the step %s runs privileged", name))
+		}
+		o.checkEnv(test, stepField, step.Env)
+	}
+}
+
+// checkImage checks the image has a version and is pinned by digest
+func (o *Options) checkImage(test *linter.Test, field, name, image string) {
+	if image == "" || strings.Contains(image, "$(") {
+		return
+	}
+	if strings.Contains(image, "@") {
+		return
+	}
+	o.addIssue(test, RuleImageDigest, field, fmt.Sprintf("the image %s of step %s is not pinned by digest", image, name))
+
+	// the tag comes after the last colon which is not part of the registry host and port
+	tag := ""
+	idx := strings.LastIndex(image, ":")
+	if idx > strings.LastIndex(image, "/") {
+		tag = image[idx+1:]
+	}
+	switch tag {
+	case "":
+		o.addIssue(test, RuleImageLatestTag, field, fmt.Sprintf("the image %s of step %s has no tag", image, name))
+	case "latest":
+		o.addIssue(test, RuleImageLatestTag, field, fmt.Sprintf("the image %s of step %s uses the latest tag", image, name))
+	}
+}
+
+// checkEnv checks the environment variables do not have a plain secret value
+func (o *Options) checkEnv(test *linter.Test, field string, env []corev1.EnvVar) {
+	for i := range env {
+		e := &env[i]
+		if e.Value == "" || e.ValueFrom != nil || strings.Contains(e.Value, "$(") || !secretEnvRegex.MatchString(e.Name) {
+			continue
+		}
+		o.addIssue(test, RuleEnvPlainSecret, fmt.Sprintf("%s.env[%d].value", field, i), fmt.Sprintf("the environment variable %s has a plain value", e.Name))
+	}
+}
+
+// scriptExitsOnError returns true if the script is not a shell script or it exits on the first failing command
+func scriptExitsOnError(script string) bool {
+	firstLine := strings.TrimSpace(strings.SplitN(script, "\n", 2)[0])
+	if strings.HasPrefix(firstLine, "#!") {
+		m := shellRegex.FindStringSubmatch(firstLine)
+		if m == nil {
+			// not a shell script
+			return true
+		}
+		for _, arg := range strings.Fields(m[3]) {
+			if strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "--") && strings.Contains(arg, "e") {
+				return true
+			}
+		}
+	}
+	return setERegex.MatchString(script)
+}
@@ -0,0 +1,422 @@
+package lint
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/linter"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// ConfigFileName the name of the file in the .lighthouse folder which configures the rules
+	ConfigFileName = "lint.yaml"
+
+	// IgnoreComment the comment which ignores the rules on its line, or the next line if the comment is on its own
+	// line, or in the whole file if it is before the first YAML content
+	IgnoreComment = "jx-lint-ignore"
+
+	// RulePipelineLoad the pipeline file could not be loaded
+	RulePipelineLoad = "pipeline-load"
+
+	// RulePipelineValidation the pipeline failed the tekton validation
+	RulePipelineValidation = "pipeline-validation"
+
+	// RuleTriggersLoad the triggers file could not be loaded
+	RuleTriggersLoad = "triggers-load"
+
+	// RuleTriggerUnknownField a key in the triggers file is not known
+	RuleTriggerUnknownField = "trigger-unknown-field"
+
+	// RuleTriggerDuplicateName the job name is used by more than one trigger
+	RuleTriggerDuplicateName = "trigger-duplicate-name"
+
+	// RuleTriggerDuplicateContext the context is reported by more than one trigger
+	RuleTriggerDuplicateContext = "trigger-duplicate-context"
+
+	// RuleTriggerInvalidRegex a branch, file or trigger regex does not compile
+	RuleTriggerInvalidRegex = "trigger-invalid-regex"
+
+	// RuleTriggerRerunCommand the trigger and rerun command do not match each other
+	RuleTriggerRerunCommand = "trigger-rerun-command"
+
+	// RuleTriggerMissingSource the source file of a trigger does not exist
+	RuleTriggerMissingSource = "trigger-missing-source"
+
+	// RuleTriggerSharedSource the source file is used by more than one trigger of the same kind
+	RuleTriggerSharedSource = "trigger-shared-source"
+
+	// RuleTriggerMaxConcurrency the max concurrency of a trigger is negative
+	RuleTriggerMaxConcurrency = "trigger-max-concurrency"
+
+	// RuleImageLatestTag the image of a step uses the latest tag or no tag
+	RuleImageLatestTag = "image-latest-tag"
+
+	// RuleImageDigest the image of a step is not pinned by digest
+	RuleImageDigest = "image-digest"
+
+	// RuleResourceRequests a step has no resource requests
+	RuleResourceRequests = "resource-requests"
+
+	// RuleScriptSetE a shell script does not exit on the first failing command
+	RuleScriptSetE = "script-set-e"
+
+	// RuleEnvPlainSecret an environment variable of a step has a secret as a plain value
+	RuleEnvPlainSecret = "env-plain-secret"
+
+	// RulePipelineTimeout the pipeline has no timeout or it is over the limit
+	RulePipelineTimeout = "pipeline-timeout"
+
+	// RulePrivileged a step runs privileged
+	RulePrivileged = "privileged"
+
+	// RuleDuplicateStepName a task has more than one step with the same name
+	RuleDuplicateStepName = "duplicate-step-name"
+
+	// RuleHardCodedNamespace the pipeline has a hard coded namespace
+	RuleHardCodedNamespace = "hard-coded-namespace"
+)
+
+var (
+	// Rules the checks made by the linter in the order they are reported
+	Rules = []Rule{
+		{
+			ID:          RulePipelineLoad,
+			Severity:    SeverityError,
+			Description: "The tekton pipeline file could not be loaded or converted to a PipelineRun",
+			Docs:        "The file must be a valid tekton Pipeline, PipelineRun, Task or TaskRun whose 'uses' steps can be resolved.",
+		},
+		{
+			ID:          RulePipelineValidation,
+			Severity:    SeverityError,
+			Description: "The tekton pipeline is not valid",
+			Docs:        "The PipelineRun failed the tekton validation or a volume mounted by a step does not exist.",
+		},
+		{
+			ID:          RuleTriggersLoad,
+			Severity:    SeverityError,
+			Description: "The lighthouse triggers file could not be loaded",
+			Docs:        "The triggers.yaml file must be a valid lighthouse TriggerConfig.",
+		},
+		{
+			ID:          RuleTriggerUnknownField,
+			Severity:    SeverityError,
+			Description: "The triggers file has an unknown key",
+			Docs:        "Unknown keys are ignored by lighthouse so a typo such as 'brnches' silently changes when the trigger runs.",
+		},
+		{
+			ID:          RuleTriggerDuplicateName,
+			Severity:    SeverityError,
+			Description: "The job name is used by more than one trigger",
+			Docs:        "Each presubmit and postsubmit must have a unique name across the triggers file.",
+		},
+		{
+			ID:          RuleTriggerDuplicateContext,
+			Severity:    SeverityError,
+			Description: "The context is reported by more than one trigger",
+			Docs:        "Triggers of the same kind sharing a context overwrite each other's commit status.",
+		},
+		{
+			ID:          RuleTriggerInvalidRegex,
+			Severity:    SeverityError,
+			Description: "A regex of a trigger does not compile",
+			Docs:        "The branches, skip_branches, run_if_changed and trigger values are Go regular expressions.",
+		},
+		{
+			ID:          RuleTriggerRerunCommand,
+			Severity:    SeverityError,
+			Description: "The trigger and rerun command of a presubmit do not match each other",
+			Docs:        "Either both or neither of trigger and rerun_command must be set and the rerun_command must match the trigger regex.",
+		},
+		{
+			ID:          RuleTriggerMissingSource,
+			Severity:    SeverityError,
+			Description: "The source file of a trigger does not exist",
+			Docs:        "The source must be the path of a pipeline file relative to the folder of the triggers file.",
+		},
+		{
+			ID:          RuleTriggerSharedSource,
+			Severity:    SeverityWarning,
+			Description: "The source file is used by more than one trigger of the same kind",
+			Docs:        "Triggers of the same kind sharing a source run the same pipeline twice for each event.",
+		},
+		{
+			ID:          RuleTriggerMaxConcurrency,
+			Severity:    SeverityError,
+			Description: "The max concurrency of a trigger is negative",
+			Docs:        "The max_concurrency must be zero for no limit or the number of pipelines which may run at once.",
+		},
+		{
+			ID:                RuleImageLatestTag,
+			Severity:          SeverityWarning,
+			Description:       "The image of a step uses the latest tag or no tag",
+			Docs:              "Use a versioned tag so that the pipeline does not change when a new image is released.",
+			DisabledByDefault: true,
+		},
+		{
+			ID:                RuleImageDigest,
+			Severity:          SeverityWarning,
+			Description:       "The image of a step is not pinned by digest",
+			Docs:              "Pin images by digest such as 'image@sha256:...' so that a tag cannot be moved to another image.",
+			DisabledByDefault: true,
+		},
+		{
+			ID:                RuleResourceRequests,
+			Severity:          SeverityWarning,
+			Description:       "A step has no resource requests",
+			Docs:              "Set the computeResources requests of the step or the stepTemplate so that the pod can be scheduled sensibly.",
+			DisabledByDefault: true,
+		},
+		{
+			ID:                RuleScriptSetE,
+			Severity:          SeverityWarning,
+			Description:       "A shell script does not exit on the first failing command",
+			Docs:              "Add 'set -e' to the script so that a failing command fails the step.",
+			DisabledByDefault: true,
+		},
+		{
+			ID:          RuleEnvPlainSecret,
+			Severity:    SeverityError,
+			Description: "An environment variable has a secret as a plain value",
+			Docs:        "Use valueFrom with a secretKeyRef rather than a plain value for passwords, tokens and keys.",
+		},
+		{
+			ID:          RulePipelineTimeout,
+			Severity:    SeverityWarning,
+			Description: "The pipeline has no timeout or it is over the limit",
+			Docs:        "Set the timeouts of the pipeline within the maxTimeout of the lint.yaml if there is one.",
+		},
+		{
+			ID:          RulePrivileged,
+			Severity:    SeverityWarning,
+			Description: "A step runs privileged",
+			Docs:        "Privileged steps can access the node so prefer tools which do not need to be privileged such as kaniko.",
+		},
+		{
+			ID:          RuleDuplicateStepName,
+			Severity:    SeverityError,
+			Description: "A task has more than one step with the same name",
+			Docs:        "Each step of a task must have a unique name.",
+		},
+		{
+			ID:          RuleHardCodedNamespace,
+			Severity:    SeverityWarning,
+			Description: "The pipeline has a hard coded namespace",
+			Docs:        "Leave the namespace blank so the pipeline runs in the namespace lighthouse is configured to use.",
+		},
+	}
+
+	ignoreRegex = regexp.MustCompile(`#\s*` + IgnoreComment + `\s+([\w, -]+)`)
+)
+
+// Rule a check made by the linter
+type Rule struct {
+	ID          string
+	Severity    string
+	Description string
+	Docs        string
+
+	// DisabledByDefault the rule is only checked if it is enabled in the lint.yaml
+	DisabledByDefault bool
+}
+
+// Config the configuration of the rules loaded from the lint.yaml file of a .lighthouse folder
+type Config struct {
+	// Enabled the rules which are disabled by default to check
+	Enabled []string `json:"enabled,omitempty"`
+
+	// Disabled the rules to not check
+	Disabled []string `json:"disabled,omitempty"`
+
+	// MaxTimeout the longest timeout of a pipeline such as '2h'
+	MaxTimeout string `json:"maxTimeout,omitempty"`
+
+	maxTimeout time.Duration
+}
+
+// FindRule returns the rule for the ID or nil if there is none
+func FindRule(id string) *Rule {
+	for i := range Rules {
+		if Rules[i].ID == id {
+			return &Rules[i]
+		}
+	}
+	return nil
+}
+
+// LoadConfig loads the configuration of the rules from the lint.yaml file of the .lighthouse folder if it exists
+func LoadConfig(dir string) (*Config, error) {
+	cfg := &Config{}
+	path := filepath.Join(dir, ConfigFileName)
+	exists, err := files.FileExists(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check if file exists %s: %w", path, err)
+	}
+	if exists {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load file %s: %w", path, err)
+		}
+		err = yaml.UnmarshalStrict(data, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unmarshal file %s: %w", path, err)
+		}
+	}
+
+	for _, id := range append(append([]string{}, cfg.Enabled...), cfg.Disabled...) {
+		if FindRule(id) == nil {
+			return nil, fmt.Errorf("unknown rule %s in %s", id, path)
+		}
+	}
+	if cfg.MaxTimeout != "" {
+		cfg.maxTimeout, err = time.ParseDuration(cfg.MaxTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maxTimeout %s in %s: %w", cfg.MaxTimeout, path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// loadConfig returns the configuration of the rules of the .lighthouse folder caching it for the other files of the
+// folder. The Config of the options is used for every folder if it is set
+func (o *Options) loadConfig(dir string) (*Config, error) {
+	if o.Config != nil {
+		return o.Config, nil
+	}
+	cfg := o.dirConfigs[dir]
+	if cfg != nil {
+		return cfg, nil
+	}
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lint config: %w", err)
+	}
+	if o.dirConfigs == nil {
+		o.dirConfigs = map[string]*Config{}
+	}
+	o.dirConfigs[dir] = cfg
+	return cfg, nil
+}
+
+// lighthouseDir returns the .lighthouse folder containing the file or the .lighthouse folder of the directory if the
+// file is not in one
+func lighthouseDir(path, dir string) string {
+	for d := filepath.Dir(path); d != filepath.Dir(d); d = filepath.Dir(d) {
+		if filepath.Base(d) == ".lighthouse" {
+			return d
+		}
+	}
+	return filepath.Join(dir, ".lighthouse")
+}
+
+// addTest adds the test of the file whose issues are reported using the configuration of the rules
+func (o *Options) addTest(path string, cfg *Config) *linter.Test {
+	test := &linter.Test{
+		File: path,
+	}
+	o.Tests = append(o.Tests, test)
+	if o.configs == nil {
+		o.configs = map[*linter.Test]*Config{}
+	}
+	o.configs[test] = cfg
+	return test
+}
+
+// testConfig returns the configuration of the rules of the test
+func (o *Options) testConfig(test *linter.Test) *Config {
+	cfg := o.configs[test]
+	if cfg == nil {
+		return &Config{}
+	}
+	return cfg
+}
+
+// IsEnabled returns true if the rule should be checked
+func (c *Config) IsEnabled(rule *Rule) bool {
+	if stringhelpers.StringArrayIndex(c.Disabled, rule.ID) >= 0 {
+		return false
+	}
+	return !rule.DisabledByDefault || stringhelpers.StringArrayIndex(c.Enabled, rule.ID) >= 0
+}
+
+// addIssue adds an issue of the rule to the test locating the field in the YAML of the file
+func (o *Options) addIssue(test *linter.Test, ruleID, field, message string) {
+	line, column := FindPosition(o.loadYAMLNode(test.File), field)
+	o.addIssueAt(test, ruleID, message, field, line, column)
+}
+
+// addIssueAt adds an issue of the rule to the test at the line and column of the file
+func (o *Options) addIssueAt(test *linter.Test, ruleID, message, field string, line, column int) {
+	rule := FindRule(ruleID)
+	if o.issues == nil {
+		o.issues = map[*linter.Test][]*Issue{}
+	}
+	o.issues[test] = append(o.issues[test], &Issue{
+		Rule:     rule.ID,
+		Severity: rule.Severity,
+		Message:  message,
+		Field:    field,
+		Line:     line,
+		Column:   column,
+	})
+}
+
+// ignores the rules ignored by the comments in a file
+type ignores struct {
+	file  map[string]bool
+	lines map[int]map[string]bool
+}
+
+// loadIgnores finds the rules ignored by the jx-lint-ignore comments in the file
+func loadIgnores(path string) *ignores {
+	answer := &ignores{
+		file:  map[string]bool{},
+		lines: map[int]map[string]bool{},
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return answer
+	}
+	header := true
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		comment := strings.HasPrefix(text, "#")
+		if text != "" && !comment && text != "---" {
+			header = false
+		}
+		m := ignoreRegex.FindStringSubmatch(text)
+		if len(m) < 2 {
+			continue
+		}
+		// a comment on its own line ignores the next line
+		ignoreLine := line
+		if comment {
+			ignoreLine++
+		}
+		for _, id := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' }) {
+			if header {
+				answer.file[id] = true
+				continue
+			}
+			if answer.lines[ignoreLine] == nil {
+				answer.lines[ignoreLine] = map[string]bool{}
+			}
+			answer.lines[ignoreLine][id] = true
+		}
+	}
+	return answer
+}
+
+// isIgnored returns true if the issue is ignored by a comment
+func (i *ignores) isIgnored(issue *Issue) bool {
+	return i.file[issue.Rule] || i.lines[issue.Line][issue.Rule]
+}
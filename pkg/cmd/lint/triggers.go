@@ -0,0 +1,270 @@
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/linter"
+	"github.com/jenkins-x/lighthouse-client/pkg/config/job"
+	"github.com/jenkins-x/lighthouse-client/pkg/triggerconfig"
+	"gopkg.in/yaml.v3"
+)
+
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// trigger the fields of a presubmit or postsubmit checked by the linter
+type trigger struct {
+	kind  string
+	field string
+	base  *job.Base
+	job.Brancher
+	job.RegexpChangeMatcher
+	job.Reporter
+	trigger      string
+	rerunCommand string
+}
+
+// triggers returns the presubmits and postsubmits of the config with the path of their field in the triggers file
+func triggers(repoConfig *triggerconfig.Config) []*trigger {
+	var answer []*trigger
+	for i := range repoConfig.Spec.Presubmits {
+		r := &repoConfig.Spec.Presubmits[i]
+		answer = append(answer, &trigger{
+			kind:                "presubmit",
+			field:               fmt.Sprintf("spec.presubmits[%d]", i),
+			base:                &r.Base,
+			Brancher:            r.Brancher,
+			RegexpChangeMatcher: r.RegexpChangeMatcher,
+			Reporter:            r.Reporter,
+			trigger:             r.Trigger,
+			rerunCommand:        r.RerunCommand,
+		})
+	}
+	for i := range repoConfig.Spec.Postsubmits {
+		r := &repoConfig.Spec.Postsubmits[i]
+		answer = append(answer, &trigger{
+			kind:                "postsubmit",
+			field:               fmt.Sprintf("spec.postsubmits[%d]", i),
+			base:                &r.Base,
+			Brancher:            r.Brancher,
+			RegexpChangeMatcher: r.RegexpChangeMatcher,
+			Reporter:            r.Reporter,
+		})
+	}
+	return answer
+}
+
+// lintTriggers checks the semantics of the triggers file which has been loaded
+func (o *Options) lintTriggers(test *linter.Test, repoConfig *triggerconfig.Config, dir string) {
+	// lighthouse ignores unknown keys so lets find any typos
+	for _, k := range findUnknownKeys(o.loadYAMLNode(test.File), reflect.TypeOf(triggerconfig.Config{}), "") {
+		o.addIssueAt(test, RuleTriggerUnknownField, fmt.Sprintf("unknown field %s", k.field), k.field, k.node.Line, k.node.Column)
+	}
+
+	names := map[string]string{}
+	contexts := map[string]string{}
+	sources := map[string]string{}
+	for _, t := range triggers(repoConfig) {
+		name := t.base.Name
+		if previous := names[name]; previous != "" {
+			o.addIssue(test, RuleTriggerDuplicateName, t.field+".name", fmt.Sprintf("the %s name %s is also used by %s", t.kind, name, previous))
+		} else {
+			names[name] = t.kind + " " + name
+		}
+
+		if t.Context != "" {
+			key := t.kind + "/" + t.Context
+			if previous := contexts[key]; previous != "" {
+				o.addIssue(test, RuleTriggerDuplicateContext, t.field+".context", fmt.Sprintf("the context %s of %s %s is also reported by %s", t.Context, t.kind, name, previous))
+			} else {
+				contexts[key] = t.kind + " " + name
+			}
+		}
+
+		for i, b := range t.Branches {
+			o.checkRegex(test, fmt.Sprintf("%s.branches[%d]", t.field, i), b)
+		}
+		for i, b := range t.SkipBranches {
+			o.checkRegex(test, fmt.Sprintf("%s.skip_branches[%d]", t.field, i), b)
+		}
+		if t.RunIfChanged != "" {
+			o.checkRegex(test, t.field+".run_if_changed", t.RunIfChanged)
+		}
+		o.checkRerunCommand(test, t)
+
+		if t.base.MaxConcurrency < 0 {
+			o.addIssue(test, RuleTriggerMaxConcurrency, t.field+".max_concurrency", fmt.Sprintf("the max_concurrency of %s %s is %d", t.kind, name, t.base.MaxConcurrency))
+		}
+
+		source := t.base.SourcePath
+		if source == "" {
+			continue
+		}
+		path := filepath.Join(dir, source)
+		exists, err := files.FileExists(path)
+		if err != nil || !exists {
+			o.addIssue(test, RuleTriggerMissingSource, t.field+".source", fmt.Sprintf("the source %s of %s %s does not exist", source, t.kind, name))
+			continue
+		}
+		key := t.kind + "/" + filepath.Clean(source)
+		if previous := sources[key]; previous != "" {
+			o.addIssue(test, RuleTriggerSharedSource, t.field+".source", fmt.Sprintf("the source %s of %s %s is also used by %s", source, t.kind, name, previous))
+		} else {
+			sources[key] = t.kind + " " + name
+		}
+	}
+}
+
+func (o *Options) checkRegex(test *linter.Test, field, text string) {
+	_, err := regexp.Compile(text)
+	if err != nil {
+		o.addIssue(test, RuleTriggerInvalidRegex, field, fmt.Sprintf("invalid regex %s: %s", text, err.Error()))
+	}
+}
+
+// checkRerunCommand checks both or neither of the trigger and rerun command are set and they match each other
+func (o *Options) checkRerunCommand(test *linter.Test, t *trigger) {
+	switch {
+	case t.trigger == "" && t.rerunCommand == "":
+		return
+	case t.trigger == "":
+		o.addIssue(test, RuleTriggerRerunCommand, t.field+".rerun_command", fmt.Sprintf("the %s %s has a rerun_command but no trigger", t.kind, t.base.Name))
+		return
+	case t.rerunCommand == "":
+		o.addIssue(test, RuleTriggerRerunCommand, t.field+".trigger", fmt.Sprintf("the %s %s has a trigger but no rerun_command", t.kind, t.base.Name))
+		return
+	}
+	re, err := regexp.Compile(t.trigger)
+	if err != nil {
+		o.addIssue(test, RuleTriggerInvalidRegex, t.field+".trigger", fmt.Sprintf("invalid regex %s: %s", t.trigger, err.Error()))
+		return
+	}
+	if !re.MatchString(t.rerunCommand) {
+		o.addIssue(test, RuleTriggerRerunCommand, t.field+".rerun_command", fmt.Sprintf("the rerun_command %s of %s %s does not match the trigger %s", t.rerunCommand, t.kind, t.base.Name, t.trigger))
+	}
+}
+
+// unknownKey a key of the YAML which is not a field of the type it is unmarshalled into
+type unknownKey struct {
+	field string
+	node  *yaml.Node
+}
+
+// findUnknownKeys walks the YAML node against the JSON fields of the type returning every key which is not a field.
+// The values of types which unmarshal themselves are not checked
+func findUnknownKeys(node *yaml.Node, t reflect.Type, field string) []unknownKey {
+	if node == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+		return nil
+	}
+
+	var answer []unknownKey
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			answer = append(answer, findUnknownKeys(child, t, field)...)
+		}
+	case yaml.SequenceNode:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return nil
+		}
+		for i, child := range node.Content {
+			answer = append(answer, findUnknownKeys(child, t.Elem(), fmt.Sprintf("%s[%d]", field, i))...)
+		}
+	case yaml.MappingNode:
+		var fields map[string]reflect.Type
+		switch t.Kind() {
+		case reflect.Struct:
+			fields = jsonFields(t)
+		case reflect.Map:
+		default:
+			return nil
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			k, v := node.Content[i], node.Content[i+1]
+			if k.Value == "<<" {
+				// the merged values are checked where they are anchored
+				continue
+			}
+			path := k.Value
+			if field != "" {
+				path = field + "." + k.Value
+			}
+			if t.Kind() == reflect.Map {
+				answer = append(answer, findUnknownKeys(v, t.Elem(), path)...)
+				continue
+			}
+			ft, ok := findField(fields, k.Value)
+			if !ok {
+				answer = append(answer, unknownKey{field: path, node: k})
+				continue
+			}
+			answer = append(answer, findUnknownKeys(v, ft, path)...)
+		}
+	}
+	return answer
+}
+
+// jsonFields returns the types of the fields of the struct by their JSON name including the fields of embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	answer := map[string]reflect.Type{}
+	embedded := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			for k, v := range jsonFields(ft) {
+				embedded[k] = v
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		answer[name] = f.Type
+	}
+	// the fields of the struct hide those of its embedded structs
+	for k, v := range embedded {
+		if _, ok := answer[k]; !ok {
+			answer[k] = v
+		}
+	}
+	return answer
+}
+
+// findField returns the type of the field of the key matching case insensitively like encoding/json
+func findField(fields map[string]reflect.Type, key string) (reflect.Type, bool) {
+	if ft, ok := fields[key]; ok {
+		return ft, true
+	}
+	for name, ft := range fields {
+		if strings.EqualFold(name, key) {
+			return ft, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,390 @@
+package otelexport
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/otlp"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/spf13/cobra"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// SourceActivities exports the PipelineActivity resources
+	SourceActivities = "activities"
+
+	// SourcePipelineRuns exports the Tekton PipelineRuns and their TaskRuns
+	SourcePipelineRuns = "pipelineruns"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Namespace    string
+	Source       string
+	File         string
+	Endpoint     string
+	Headers      []string
+	ServiceName  string
+	Window       time.Duration
+	Watch        bool
+	PollPeriod   time.Duration
+	BuildFilter  tektonlog.BuildPodInfoFilter
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	Exporter     otlp.Exporter
+	Now          time.Time
+	Exported     []string
+	exported     map[string]bool
+}
+
+// run a completed pipeline run which can be exported as a trace
+type run struct {
+	name      string
+	activity  *v1.PipelineActivity
+	stagePods map[string]string
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Exports completed pipelines as OpenTelemetry traces with a trace per build containing a span for each task and step.
+
+		The traces can be posted to an OTLP/HTTP endpoint or appended to a file using the OTLP JSON encoding.
+`)
+
+	cmdExample = templates.Examples(`
+		# Export the pipelines of the last day to an OpenTelemetry collector
+		jx pipeline otel-export --window 24h --endpoint http://otel-collector:4318
+
+		# Export the pipelines of a repository to a file
+		jx pipeline otel-export --repo cheese --file traces.jsonl
+
+		# Export each pipeline as it completes using the PipelineRuns rather than the PipelineActivities
+		jx pipeline otel-export --watch --source pipelineruns --endpoint http://otel-collector:4318
+	`)
+
+	sources = []string{SourceActivities, SourcePipelineRuns}
+)
+
+// NewCmdPipelineOtelExport creates the command
+func NewCmdPipelineOtelExport() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "otel-export",
+		Short:   "Exports pipelines as OpenTelemetry traces",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"otel"},
+		Run: func(_ *cobra.Command, _ []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().StringVarP(&o.Source, "source", "s", SourceActivities, "The resources to export. Valid values are: "+strings.Join(sources, ", "))
+	cmd.Flags().StringVarP(&o.File, "file", "", "", "The file to append the traces to as lines of OTLP JSON")
+	cmd.Flags().StringVarP(&o.Endpoint, "endpoint", "e", "", "The OTLP/HTTP endpoint to post the traces to such as http://localhost:4318. Defaults to the /v1/traces path if none is specified")
+	cmd.Flags().StringArrayVarP(&o.Headers, "header", "", nil, "A header to send to the endpoint such as 'Authorization=Bearer token'. Can be specified multiple times")
+	cmd.Flags().StringVarP(&o.ServiceName, "service-name", "", "jx-pipeline", "The service name of the exported traces")
+	cmd.Flags().DurationVarP(&o.Window, "window", "", 0, "Only export pipelines which started within this duration such as 24h. Defaults to all pipelines")
+	cmd.Flags().BoolVarP(&o.Watch, "watch", "", false, "Watches for pipelines which complete and exports each one. Pipelines which have already completed are not exported")
+	cmd.Flags().DurationVarP(&o.PollPeriod, "poll-period", "", 10*time.Second, "How often to look for completed pipelines when watching")
+	cmd.Flags().StringVarP(&o.BuildFilter.Filter, "filter", "f", "", "Filters the pipelines by those that contain the given text")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if stringhelpers.StringArrayIndex(sources, o.Source) < 0 {
+		return options.InvalidOptionf("source", o.Source, "valid values are: %s", strings.Join(sources, ", "))
+	}
+	if o.Window < 0 {
+		return options.InvalidOptionf("window", o.Window, "must not be negative")
+	}
+	if o.Watch && o.PollPeriod <= 0 {
+		return options.InvalidOptionf("poll-period", o.PollPeriod, "must be positive")
+	}
+
+	var err error
+	if o.Exporter == nil {
+		o.Exporter, err = o.createExporter()
+		if err != nil {
+			return err
+		}
+	}
+
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	if o.TektonClient == nil {
+		f := kubeclient.NewFactory()
+		cfg, err := f.CreateKubeConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes config: %w", err)
+		}
+		o.TektonClient, err = tektonclient.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building tekton client: %w", err)
+		}
+	}
+	if o.exported == nil {
+		o.exported = map[string]bool{}
+	}
+	return nil
+}
+
+func (o *Options) createExporter() (otlp.Exporter, error) {
+	if o.File != "" && o.Endpoint != "" {
+		return nil, options.InvalidOptionf("file", o.File, "cannot be used with --endpoint")
+	}
+	if o.File != "" {
+		return &otlp.FileExporter{Path: o.File}, nil
+	}
+	if o.Endpoint == "" {
+		return nil, options.MissingOption("endpoint")
+	}
+	headers := map[string]string{}
+	for _, h := range o.Headers {
+		k, v, ok := strings.Cut(h, "=")
+		if !ok || k == "" {
+			return nil, options.InvalidOptionf("header", h, "should be of the form name=value")
+		}
+		headers[k] = v
+	}
+	return otlp.NewHTTPExporter(o.Endpoint, headers)
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	if !o.Watch {
+		count, err := o.exportCompleted(ctx, o.now())
+		if err != nil {
+			return err
+		}
+		log.Logger().Infof("exported %s pipelines as traces", termcolor.ColorInfo(count))
+		return nil
+	}
+
+	// lets ignore the pipelines which have already completed
+	names, err := o.completedNames(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		o.exported[name] = true
+	}
+	log.Logger().Infof("watching for pipelines which complete in namespace %s", termcolor.ColorInfo(o.Namespace))
+
+	ticker := time.NewTicker(o.PollPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			_, err = o.exportCompleted(ctx, time.Now())
+			if err != nil {
+				log.Logger().Warnf("failed to export pipelines: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (o *Options) now() time.Time {
+	if o.Now.IsZero() {
+		return time.Now()
+	}
+	return o.Now
+}
+
+// exportCompleted exports the completed pipelines which have not been exported yet
+func (o *Options) exportCompleted(ctx context.Context, now time.Time) (int, error) {
+	runs, err := o.completedRuns(ctx, now)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, r := range runs {
+		data := otlp.ToTracesData(r.activity, o.ServiceName, r.stagePods, now)
+		err = o.Exporter.Export(ctx, data)
+		if err != nil {
+			return count, fmt.Errorf("failed to export the trace of %s: %w", r.name, err)
+		}
+		log.Logger().Debugf("exported the trace of %s", r.name)
+		o.exported[r.name] = true
+		o.Exported = append(o.Exported, r.name)
+		count++
+	}
+	return count, nil
+}
+
+// completedNames returns the names of the pipelines which have already completed without loading their TaskRuns
+func (o *Options) completedNames(ctx context.Context) ([]string, error) {
+	var answer []string
+	if o.Source == SourcePipelineRuns {
+		prs, err := o.listPipelineRuns(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range prs {
+			if tektonlog.PipelineRunIsComplete(&prs[i]) {
+				answer = append(answer, prs[i].Name)
+			}
+		}
+		return answer, nil
+	}
+	activities, err := o.listActivities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range activities {
+		if activities[i].Spec.Status.IsTerminated() {
+			answer = append(answer, activities[i].Name)
+		}
+	}
+	return answer, nil
+}
+
+// completedRuns returns the completed pipelines matching the filters which have not been exported yet
+func (o *Options) completedRuns(ctx context.Context, now time.Time) ([]*run, error) {
+	var answer []*run
+	if o.Source == SourcePipelineRuns {
+		prs, err := o.listPipelineRuns(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range prs {
+			pr := &prs[i]
+			if !tektonlog.PipelineRunIsComplete(pr) || o.exported[pr.Name] {
+				continue
+			}
+			// lets filter on the labels and start time before loading the TaskRuns and pods of the PipelineRun
+			pa := o.toActivity(pr)
+			if !o.BuildFilter.MatchesWindow(pa, o.Window, now) {
+				continue
+			}
+			r, err := o.toRun(ctx, pr, pa)
+			if err != nil {
+				return nil, err
+			}
+			answer = append(answer, r)
+		}
+		return answer, nil
+	}
+
+	activities, err := o.listActivities(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range activities {
+		pa := &activities[i]
+		if !pa.Spec.Status.IsTerminated() || o.exported[pa.Name] || !o.BuildFilter.MatchesWindow(pa, o.Window, now) {
+			continue
+		}
+		answer = append(answer, &run{
+			name:     pa.Name,
+			activity: pa,
+		})
+	}
+	return answer, nil
+}
+
+// toActivity returns the PipelineActivity of the PipelineRun with its metadata and start time but without its steps
+func (o *Options) toActivity(pr *pipelinev1.PipelineRun) *v1.PipelineActivity {
+	pa := &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              pr.Name,
+			Namespace:         o.Namespace,
+			UID:               pr.UID,
+			CreationTimestamp: pr.CreationTimestamp,
+		},
+	}
+	pipelines.UpdatePipelineActivityMetadata(pr, pa)
+	pa.Spec.StartedTimestamp = pr.Status.StartTime
+	return pa
+}
+
+// toRun converts the PipelineRun into the PipelineActivity so that it is exported in the same way as the activities
+func (o *Options) toRun(ctx context.Context, pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity) (*run, error) {
+	err := pipelines.ToPipelineActivity(o.TektonClient, pr, pa, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert PipelineRun %s: %w", pr.Name, err)
+	}
+	ps := &pa.Spec
+	ps.Status = pipelines.ToPipelineRunStatus(pr)
+	if pr.Status.StartTime != nil {
+		ps.StartedTimestamp = pr.Status.StartTime
+	}
+	ps.CompletedTimestamp = pr.Status.CompletionTime
+
+	stagePods, err := pipelines.StagePodNames(ctx, o.TektonClient, o.Namespace, pr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find the pods of PipelineRun %s: %w", pr.Name, err)
+	}
+	return &run{
+		name:      pr.Name,
+		activity:  pa,
+		stagePods: stagePods,
+	}, nil
+}
+
+func (o *Options) listActivities(ctx context.Context) ([]v1.PipelineActivity, error) {
+	items, err := tektonlog.ListFilteredPipelineActivities(ctx, o.JXClient, o.Namespace, &o.BuildFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineActivity resources in namespace %s: %w", o.Namespace, err)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+	})
+	return items, nil
+}
+
+func (o *Options) listPipelineRuns(ctx context.Context) ([]pipelinev1.PipelineRun, error) {
+	items, err := tektonlog.ListFilteredPipelineRuns(ctx, o.TektonClient, o.Namespace, pipelines.ServedAPIVersion(o.TektonClient), &o.BuildFilter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PipelineRuns in namespace %s: %w", o.Namespace, err)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreationTimestamp.Before(&items[j].CreationTimestamp)
+	})
+	return items, nil
+}
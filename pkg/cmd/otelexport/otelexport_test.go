@@ -0,0 +1,264 @@
+//go:build unit
+// +build unit
+
+package otelexport_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/otelexport"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/otlp"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+	duckv1 "knative.dev/pkg/apis/duck/v1"
+)
+
+func TestOtelExportActivities(t *testing.T) {
+	ns := "jx"
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) *metav1.Time {
+		t := metav1.NewTime(start.Add(time.Duration(seconds) * time.Second))
+		return &t
+	}
+	newActivity := func(name string, status v1.ActivityStatusType) *v1.PipelineActivity {
+		return &v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: map[string]string{
+					"podName": name + "-pod",
+				},
+			},
+			Spec: v1.PipelineActivitySpec{
+				Pipeline:           "myorg/cheese/main",
+				Build:              "1",
+				GitOwner:           "myorg",
+				GitRepository:      "cheese",
+				GitBranch:          "main",
+				LastCommitSHA:      "abc123",
+				Status:             status,
+				StartedTimestamp:   at(0),
+				CompletedTimestamp: at(60),
+				Steps: []v1.PipelineActivityStep{
+					{
+						Kind: v1.ActivityStepKindTypeStage,
+						Stage: &v1.StageActivityStep{
+							CoreActivityStep: v1.CoreActivityStep{
+								Name:               "from-build-pack",
+								Status:             status,
+								StartedTimestamp:   at(5),
+								CompletedTimestamp: at(60),
+							},
+							Steps: []v1.CoreActivityStep{
+								{
+									Name:               "Git Clone",
+									Status:             v1.ActivityStatusTypeSucceeded,
+									StartedTimestamp:   at(5),
+									CompletedTimestamp: at(10),
+								},
+								{
+									Name:               "Build",
+									Status:             status,
+									StartedTimestamp:   at(10),
+									CompletedTimestamp: at(60),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	running := newActivity("myorg-cheese-main-2", v1.ActivityStatusTypeRunning)
+	running.Spec.CompletedTimestamp = nil
+
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	_, o := otelexport.NewCmdPipelineOtelExport()
+	o.KubeClient = fake.NewSimpleClientset()
+	o.JXClient = fakejx.NewSimpleClientset(newActivity("myorg-cheese-main-1", v1.ActivityStatusTypeFailed), running)
+	o.TektonClient = faketekton.NewSimpleClientset()
+	o.Namespace = ns
+	o.File = file
+	o.Ctx = context.Background()
+
+	err := o.Run()
+	require.NoError(t, err, "failed to run")
+	assert.Equal(t, []string{"myorg-cheese-main-1"}, o.Exported, "should only export the completed activities")
+
+	traces := loadTraces(t, file)
+	require.Len(t, traces, 1)
+	spans := traces[0].ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 4)
+
+	root, stage, clone, build := spans[0], spans[1], spans[2], spans[3]
+	assert.Equal(t, "myorg/cheese/main #1", root.Name)
+	assert.Empty(t, root.ParentSpanID)
+	assert.Len(t, root.TraceID, 32)
+	assert.Len(t, root.SpanID, 16)
+	assert.Equal(t, "cheese", root.Attribute(otlp.AttributeRepository))
+	assert.Equal(t, "main", root.Attribute(otlp.AttributeBranch))
+	assert.Equal(t, "abc123", root.Attribute(otlp.AttributeSHA))
+	assert.Equal(t, "Failed", root.Attribute(otlp.AttributeStatus))
+	assert.Equal(t, "myorg-cheese-main-1-pod", root.Attribute(otlp.AttributePod))
+	assert.Equal(t, otlp.StatusCodeError, root.Status.Code)
+	assert.Equal(t, "1704189600000000000", root.StartTimeUnixNano)
+	assert.Equal(t, "1704189660000000000", root.EndTimeUnixNano)
+
+	assert.Equal(t, "from-build-pack", stage.Name)
+	assert.Equal(t, root.SpanID, stage.ParentSpanID)
+	assert.Equal(t, "Git Clone", clone.Name)
+	assert.Equal(t, stage.SpanID, clone.ParentSpanID)
+	assert.Equal(t, otlp.StatusCodeOk, clone.Status.Code)
+	assert.Equal(t, "Build", build.Name)
+	assert.Equal(t, stage.SpanID, build.ParentSpanID)
+	for _, s := range spans {
+		assert.Equal(t, root.TraceID, s.TraceID, "span %s should be in the same trace", s.Name)
+	}
+}
+
+func TestOtelExportPipelineRuns(t *testing.T) {
+	ns := "jx"
+	start := metav1.NewTime(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC))
+	end := metav1.NewTime(start.Add(time.Minute))
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-1",
+			Namespace: ns,
+			Labels: map[string]string{
+				"lighthouse.jenkins-x.io/refs.org":      "myorg",
+				"lighthouse.jenkins-x.io/refs.repo":     "cheese",
+				"lighthouse.jenkins-x.io/branch":        "main",
+				"lighthouse.jenkins-x.io/buildNum":      "1",
+				"lighthouse.jenkins-x.io/lastCommitSHA": "abc123",
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			Status: duckv1.Status{
+				Conditions: duckv1.Conditions{
+					{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue},
+				},
+			},
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      &start,
+				CompletionTime: &end,
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{Name: "cheese-main-1-build", PipelineTaskName: "build"},
+				},
+			},
+		},
+	}
+	tr := &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-1-build",
+			Namespace: ns,
+			Labels: map[string]string{
+				pipelines.PipelineRunLabel: pr.Name,
+			},
+		},
+		Status: pipelinev1.TaskRunStatus{
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				PodName:        "cheese-main-1-build-pod",
+				StartTime:      &start,
+				CompletionTime: &end,
+				Steps: []pipelinev1.StepState{
+					{
+						Name: "compile",
+						ContainerState: corev1.ContainerState{
+							Terminated: &corev1.ContainerStateTerminated{
+								StartedAt:  start,
+								FinishedAt: end,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	file := filepath.Join(t.TempDir(), "traces.jsonl")
+	_, o := otelexport.NewCmdPipelineOtelExport()
+	o.KubeClient = fake.NewSimpleClientset()
+	o.JXClient = fakejx.NewSimpleClientset()
+	o.TektonClient = faketekton.NewSimpleClientset(pr, tr)
+	o.Namespace = ns
+	o.Source = otelexport.SourcePipelineRuns
+	o.File = file
+	o.Ctx = context.Background()
+
+	err := o.Run()
+	require.NoError(t, err, "failed to run")
+
+	traces := loadTraces(t, file)
+	require.Len(t, traces, 1)
+	spans := traces[0].ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 3)
+	assert.Equal(t, "Succeeded", spans[0].Attribute(otlp.AttributeStatus))
+	assert.Equal(t, "abc123", spans[0].Attribute(otlp.AttributeSHA))
+	assert.Equal(t, "build", spans[1].Name)
+	assert.Equal(t, "cheese-main-1-build-pod", spans[1].Attribute(otlp.AttributePod))
+	assert.Equal(t, spans[1].SpanID, spans[2].ParentSpanID)
+
+	// the TaskRuns of PipelineRuns outside the window or not matching the filter should not be loaded
+	oldPR := pr.DeepCopy()
+	oldPR.Name = "cheese-main-0"
+	oldStart := metav1.NewTime(start.Add(-48 * time.Hour))
+	oldPR.Status.StartTime = &oldStart
+	otherPR := pr.DeepCopy()
+	otherPR.Name = "wine-main-1"
+	otherPR.Labels["lighthouse.jenkins-x.io/refs.repo"] = "wine"
+	tektonClient := faketekton.NewSimpleClientset(pr, tr, oldPR, otherPR)
+
+	_, o = otelexport.NewCmdPipelineOtelExport()
+	o.KubeClient = fake.NewSimpleClientset()
+	o.JXClient = fakejx.NewSimpleClientset()
+	o.TektonClient = tektonClient
+	o.Namespace = ns
+	o.Source = otelexport.SourcePipelineRuns
+	o.File = filepath.Join(t.TempDir(), "traces.jsonl")
+	o.Window = 24 * time.Hour
+	o.Now = end.Add(time.Hour)
+	o.BuildFilter.Filter = "cheese"
+	o.Ctx = context.Background()
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run")
+	assert.Equal(t, []string{pr.Name}, o.Exported)
+	for _, a := range tektonClient.Actions() {
+		if la, ok := a.(k8stesting.ListAction); ok && a.GetResource().Resource == "taskruns" {
+			assert.Contains(t, la.GetListRestrictions().Labels.String(), pr.Name, "should only load the TaskRuns of the matching PipelineRun")
+		}
+	}
+}
+
+func loadTraces(t *testing.T, file string) []*otlp.TracesData {
+	f, err := os.Open(file)
+	require.NoError(t, err, "failed to open %s", file)
+	defer f.Close()
+
+	var answer []*otlp.TracesData
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		data := &otlp.TracesData{}
+		err = json.Unmarshal(scanner.Bytes(), data)
+		require.NoError(t, err, "failed to parse line %s", scanner.Text())
+		answer = append(answer, data)
+	}
+	require.NoError(t, scanner.Err())
+	return answer
+}
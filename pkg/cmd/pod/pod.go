@@ -133,7 +133,7 @@ func (o *Options) Run() error {
 
 	ctx := o.GetContext()
 
-	names, paMap, _, err := o.TektonLogger.GetTektonPipelinesWithActivePipelineActivity(ctx, &o.BuildFilter)
+	names, paMap, prMap, err := o.TektonLogger.GetTektonPipelinesWithActivePipelineActivity(ctx, &o.BuildFilter)
 	if err != nil {
 		return err
 	}
@@ -162,6 +162,10 @@ func (o *Options) Run() error {
 		if pa == nil {
 			continue
 		}
+		if pa.Labels["podName"] == "" {
+			// the pod name is only known once the TaskRuns have been loaded
+			o.TektonLogger.ResolvePipelineActivity(pa, prMap[name])
+		}
 		build := &pa.Spec
 		duration := strings.TrimSuffix(now.Sub(pa.CreationTimestamp.Time).Round(time.Minute).String(), "0s")
 
@@ -0,0 +1,279 @@
+package results
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input/inputfactory"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/spf13/cobra"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Args         []string
+	Format       string
+	Namespace    string
+	BuildFilter  tektonlog.BuildPodInfoFilter
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	TektonLogger *tektonlog.TektonLogger
+	Input        input.Interface
+	Out          io.Writer
+	Results      *pipelines.Results
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Displays the results of a pipeline and its tasks such as image digests or versions
+
+`)
+
+	cmdExample = templates.Examples(`
+		# Pick the pipeline to view the results of
+		jx pipeline results
+
+		# View the results of a build of a repository
+		jx pipeline results --repo cheese --branch main --build 12
+
+		# Export the results of the latest build as environment variables
+		eval $(jx pipeline results --repo cheese --branch main -o env)
+	`)
+
+	formats = []string{"table", "json", "yaml", "env"}
+
+	envNameRegex = regexp.MustCompile(`[^A-Z0-9]+`)
+)
+
+// NewCmdPipelineResults creates the command
+func NewCmdPipelineResults() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "results [flags]",
+		Short:   "Displays the results of a pipeline and its tasks",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"result"},
+		Run: func(_ *cobra.Command, args []string) {
+			o.Args = args
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().StringVarP(&o.Format, "output", "o", "table", "The output format. Valid values are: "+strings.Join(formats, ", "))
+	cmd.Flags().StringVarP(&o.BuildFilter.Filter, "filter", "f", "", "Filters all the available jobs by those that contain the given text")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Build, "build", "", "", "The build number to view")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+	cmd.Flags().StringVarP(&o.BuildFilter.GitURL, "giturl", "g", "", "The git URL to filter on. If you specify a link to a github repository or PR we can filter the query of builds accordingly")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	found := false
+	for _, f := range formats {
+		if o.Format == f {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return options.InvalidOptionf("output", o.Format, "valid values are: %s", strings.Join(formats, ", "))
+	}
+
+	err := o.BuildFilter.Validate()
+	if err != nil {
+		return err
+	}
+
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+
+	if o.TektonClient == nil {
+		f := kubeclient.NewFactory()
+		cfg, err := f.CreateKubeConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes config: %w", err)
+		}
+		o.TektonClient, err = tektonclient.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building tekton client: %w", err)
+		}
+	}
+
+	if o.TektonLogger == nil {
+		o.TektonLogger = &tektonlog.TektonLogger{
+			KubeClient:   o.KubeClient,
+			TektonClient: o.TektonClient,
+			JXClient:     o.JXClient,
+			Namespace:    o.Namespace,
+		}
+	}
+	if o.Input == nil {
+		o.Input = inputfactory.NewInput(&o.BaseOptions)
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	names, paMap, prMap, err := o.TektonLogger.GetTektonPipelinesWithActivePipelineActivity(ctx, &o.BuildFilter)
+	if err != nil {
+		return err
+	}
+
+	filter := o.BuildFilter.Filter
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+	var filteredNames []string
+	for _, n := range names {
+		if strings.Contains(strings.ToLower(n), strings.ToLower(filter)) {
+			filteredNames = append(filteredNames, n)
+		}
+	}
+	if len(filteredNames) == 0 {
+		return fmt.Errorf("no pipelines found in namespace %s", o.Namespace)
+	}
+
+	name := filteredNames[0]
+	if len(filteredNames) > 1 {
+		name, err = o.Input.PickNameWithDefault(filteredNames, "Pick the pipeline you wish to view the results of: ", "", "Please select the pipeline you wish to view")
+		if err != nil {
+			return fmt.Errorf("failed to pick a pipeline: %w", err)
+		}
+	}
+	pa := paMap[name]
+	if pa == nil {
+		return fmt.Errorf("could not find a PipelineActivity for %s", name)
+	}
+
+	// lets only load the TaskRuns of the pipeline we picked
+	o.TektonLogger.ResolvePipelineActivity(pa, prMap[name])
+
+	o.Results, err = pipelines.GetResults(pa)
+	if err != nil {
+		return err
+	}
+	if o.Results == nil {
+		o.Results = &pipelines.Results{}
+	}
+	return o.render(pa)
+}
+
+func (o *Options) render(pa *v1.PipelineActivity) error {
+	switch o.Format {
+	case "json":
+		data, err := json.MarshalIndent(o.Results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal results to JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(o.Out, string(data))
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(o.Results)
+		if err != nil {
+			return fmt.Errorf("failed to marshal results to YAML: %w", err)
+		}
+		_, err = o.Out.Write(data)
+		return err
+	case "env":
+		return o.renderEnv()
+	}
+
+	if o.Results.IsEmpty() {
+		log.Logger().Infof("no results for pipeline %s #%s", pa.Spec.Pipeline, pa.Spec.Build)
+		return nil
+	}
+	t := table.CreateTable(o.Out)
+	t.AddRow("STAGE", "RESULT", "VALUE")
+	for _, r := range o.Results.Pipeline {
+		t.AddRow("", r.Name, r.Value)
+	}
+	for _, s := range o.Results.Tasks {
+		for _, r := range s.Results {
+			t.AddRow(s.Stage, r.Name, r.Value)
+		}
+	}
+	t.Render()
+	return nil
+}
+
+// renderEnv writes the results as shell variables with the task results prefixed with their stage name
+func (o *Options) renderEnv() error {
+	values := map[string]string{}
+	for _, r := range o.Results.Pipeline {
+		values[ToEnvName(r.Name)] = r.Value
+	}
+	for _, s := range o.Results.Tasks {
+		for _, r := range s.Results {
+			values[ToEnvName(s.Stage+"_"+r.Name)] = r.Value
+		}
+	}
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		_, err := fmt.Fprintf(o.Out, "export %s=%s\n", k, shellQuote(values[k]))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToEnvName converts the result name into an environment variable name
+func ToEnvName(name string) string {
+	return strings.Trim(envNameRegex.ReplaceAllString(strings.ToUpper(name), "_"), "_")
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
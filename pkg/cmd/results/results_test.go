@@ -0,0 +1,121 @@
+//go:build unit
+// +build unit
+
+package results_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/results"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPipelineResults(t *testing.T) {
+	ns := "jx"
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-1",
+			Namespace: ns,
+			Labels: map[string]string{
+				"lighthouse.jenkins-x.io/refs.org":  "myorg",
+				"lighthouse.jenkins-x.io/refs.repo": "cheese",
+				"lighthouse.jenkins-x.io/branch":    "main",
+				"lighthouse.jenkins-x.io/buildNum":  "1",
+				"build":                             "1",
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				Results: []pipelinev1.PipelineRunResult{
+					{Name: "image-digest", Value: *pipelinev1.NewStructuredValues("sha256:1234")},
+				},
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{Name: "cheese-main-1-build", PipelineTaskName: "build"},
+				},
+			},
+		},
+	}
+	tr := &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cheese-main-1-build",
+			Namespace: ns,
+			Labels: map[string]string{
+				pipelines.PipelineRunLabel: pr.Name,
+			},
+		},
+		Status: pipelinev1.TaskRunStatus{
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				Results: []pipelinev1.TaskRunResult{
+					{Name: "version", Value: *pipelinev1.NewStructuredValues("1.2.3")},
+					{Name: "tags", Value: *pipelinev1.NewStructuredValues("latest", "1.2.3")},
+				},
+			},
+		},
+	}
+
+	testCases := []struct {
+		format   string
+		expected []string
+	}{
+		{
+			format: "env",
+			expected: []string{
+				"export BUILD_TAGS='[\"latest\",\"1.2.3\"]'",
+				"export BUILD_VERSION='1.2.3'",
+				"export IMAGE_DIGEST='sha256:1234'",
+			},
+		},
+		{
+			format: "json",
+			expected: []string{
+				`"name": "image-digest"`,
+				`"stage": "build"`,
+				`"value": "1.2.3"`,
+			},
+		},
+		{
+			format: "yaml",
+			expected: []string{
+				"pipeline:",
+				"- name: image-digest",
+				"  value: sha256:1234",
+				"  stage: build",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		stdout := &strings.Builder{}
+		_, o := results.NewCmdPipelineResults()
+		o.KubeClient = fake.NewSimpleClientset()
+		o.JXClient = fakejx.NewSimpleClientset()
+		o.TektonClient = faketekton.NewSimpleClientset(pr, tr)
+		o.Namespace = ns
+		o.Format = tc.format
+		o.BuildFilter.Repository = "cheese"
+		o.Out = stdout
+		o.Ctx = context.Background()
+
+		err := o.Run()
+		require.NoError(t, err, "failed to run for format %s", tc.format)
+
+		text := stdout.String()
+		t.Logf("format %s got:\n%s\n", tc.format, text)
+		for _, expected := range tc.expected {
+			assert.Contains(t, text, expected, "for format %s", tc.format)
+		}
+	}
+}
+
+func TestToEnvName(t *testing.T) {
+	assert.Equal(t, "IMAGE_DIGEST", results.ToEnvName("image-digest"))
+	assert.Equal(t, "BUILD_ARCH_AMD64_VERSION", results.ToEnvName("build [arch=amd64]_version"))
+}
@@ -4,19 +4,26 @@ import (
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/activities"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/breakpoint"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/convert"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/diff"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/effective"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/env"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/exporter"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/fmt"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/gc"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/get"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/getlog"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/grid"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/importcmd"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/lint"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/otelexport"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/override"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/pod"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/results"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/set"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/start"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/stats"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/stop"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/timeline"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/version"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/wait"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/common"
@@ -43,19 +50,26 @@ func Main() *cobra.Command {
 	cmd.AddCommand(cobras.SplitCommand(activities.NewCmdActivities()))
 	cmd.AddCommand(cobras.SplitCommand(breakpoint.NewCmdPipelineBreakpoint()))
 	cmd.AddCommand(convert.NewCmdPipelineConvert())
+	cmd.AddCommand(cobras.SplitCommand(diff.NewCmdPipelineDiff()))
 	cmd.AddCommand(cobras.SplitCommand(effective.NewCmdPipelineEffective()))
 	cmd.AddCommand(cobras.SplitCommand(env.NewCmdPipelineEnv()))
+	cmd.AddCommand(cobras.SplitCommand(exporter.NewCmdPipelineExporter()))
+	cmd.AddCommand(cobras.SplitCommand(gc.NewCmdPipelineGC()))
 	cmd.AddCommand(cobras.SplitCommand(get.NewCmdPipelineGet()))
 	cmd.AddCommand(cobras.SplitCommand(getlog.NewCmdGetBuildLogs()))
 	cmd.AddCommand(cobras.SplitCommand(grid.NewCmdPipelineGrid()))
 	cmd.AddCommand(cobras.SplitCommand(fmt.NewCmdPipelineFormat()))
 	cmd.AddCommand(cobras.SplitCommand(importcmd.NewCmdPipelineImport()))
 	cmd.AddCommand(cobras.SplitCommand(lint.NewCmdPipelineLint()))
+	cmd.AddCommand(cobras.SplitCommand(otelexport.NewCmdPipelineOtelExport()))
 	cmd.AddCommand(cobras.SplitCommand(override.NewCmdPipelineOverride()))
 	cmd.AddCommand(cobras.SplitCommand(pod.NewCmdGetBuildPods()))
+	cmd.AddCommand(cobras.SplitCommand(results.NewCmdPipelineResults()))
 	cmd.AddCommand(cobras.SplitCommand(set.NewCmdPipelineSet()))
 	cmd.AddCommand(cobras.SplitCommand(start.NewCmdPipelineStart()))
+	cmd.AddCommand(cobras.SplitCommand(stats.NewCmdPipelineStats()))
 	cmd.AddCommand(cobras.SplitCommand(stop.NewCmdPipelineStop()))
+	cmd.AddCommand(cobras.SplitCommand(timeline.NewCmdPipelineTimeline()))
 	cmd.AddCommand(cobras.SplitCommand(wait.NewCmdPipelineWait()))
 	cmd.AddCommand(cobras.SplitCommand(version.NewCmdVersion()))
 	return cmd
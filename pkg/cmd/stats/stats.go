@@ -0,0 +1,193 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/stats"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Format      string
+	Namespace   string
+	GroupBy     string
+	Window      time.Duration
+	BuildFilter tektonlog.BuildPodInfoFilter
+	KubeClient  kubernetes.Interface
+	JXClient    versioned.Interface
+	Out         io.Writer
+	Now         time.Time
+	Results     []*stats.GroupStats
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Displays the success rate, duration percentiles, queue time, slowest stages and flakiness of pipelines.
+
+		The queue time is how long a pipeline waited from being started until the first step of its pods started.
+		A commit is flaky if the same pipeline (repository and context) both failed and succeeded for it; the flakiness is the fraction of the pipeline commits which are flaky.
+`)
+
+	cmdExample = templates.Examples(`
+		# View the statistics of each repository over the last week
+		jx pipeline stats
+
+		# View the statistics of the branches of a repository over the last day
+		jx pipeline stats --repo cheese --group-by branch --window 24h
+
+		# View the statistics of each stage as JSON
+		jx pipeline stats --group-by stage -o json
+	`)
+
+	formats = []string{"table", "json"}
+)
+
+// NewCmdPipelineStats creates the command
+func NewCmdPipelineStats() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "stats",
+		Short:   "Displays the success rate, duration percentiles and flakiness of pipelines",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"stat", "statistics"},
+		Run: func(_ *cobra.Command, _ []string) {
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().StringVarP(&o.Format, "output", "o", "table", "The output format. Valid values are: "+strings.Join(formats, ", "))
+	cmd.Flags().StringVarP(&o.GroupBy, "group-by", "", stats.GroupByRepo, "How to group the pipelines. Valid values are: "+strings.Join(stats.GroupBys, ", "))
+	cmd.Flags().DurationVarP(&o.Window, "window", "", 7*24*time.Hour, "The time window of pipelines to include by their start time")
+	cmd.Flags().StringVarP(&o.BuildFilter.Filter, "filter", "f", "", "Filters the pipelines by those that contain the given text")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if stringhelpers.StringArrayIndex(formats, o.Format) < 0 {
+		return options.InvalidOptionf("output", o.Format, "valid values are: %s", strings.Join(formats, ", "))
+	}
+	if stringhelpers.StringArrayIndex(stats.GroupBys, o.GroupBy) < 0 {
+		return options.InvalidOptionf("group-by", o.GroupBy, "valid values are: %s", strings.Join(stats.GroupBys, ", "))
+	}
+	if o.Window < 0 {
+		return options.InvalidOptionf("window", o.Window, "must not be negative")
+	}
+
+	var err error
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	list, err := tektonlog.ListFilteredPipelineActivities(ctx, o.JXClient, o.Namespace, &o.BuildFilter)
+	if err != nil {
+		return fmt.Errorf("failed to list PipelineActivity resources in namespace %s: %w", o.Namespace, err)
+	}
+
+	var items []v1.PipelineActivity
+	for i := range list {
+		pa := &list[i]
+		if o.BuildFilter.MatchesWindow(pa, o.Window, o.Now) {
+			items = append(items, *pa)
+		}
+	}
+
+	o.Results, err = stats.Compute(items, o.GroupBy)
+	if err != nil {
+		return err
+	}
+
+	if o.Format == "json" {
+		data, err := json.MarshalIndent(o.Results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal stats to JSON: %w", err)
+		}
+		_, err = fmt.Fprintln(o.Out, string(data))
+		return err
+	}
+
+	if len(o.Results) == 0 {
+		log.Logger().Infof("no pipelines found in namespace %s in the last %s", o.Namespace, o.Window.String())
+		return nil
+	}
+	t := table.CreateTable(o.Out)
+	t.AddRow(strings.ToUpper(o.GroupBy), "RUNS", "SUCCESS", "FAILURE", "ABORT", "P50", "P90", "P99", "QUEUE P50", "FLAKY", "SLOWEST STAGES")
+	for _, g := range o.Results {
+		name := g.Name
+		if name == "" {
+			name = "<none>"
+		}
+		var slowest []string
+		for _, s := range g.SlowestStages {
+			slowest = append(slowest, s.Name+" "+s.DurationP90.String())
+		}
+		t.AddRow(name,
+			strconv.Itoa(g.Runs),
+			percent(g.SuccessRate),
+			percent(g.FailureRate),
+			percent(g.AbortRate),
+			g.DurationP50.String(),
+			g.DurationP90.String(),
+			g.DurationP99.String(),
+			g.QueueP50.String(),
+			fmt.Sprintf("%d/%d", g.FlakyCommits, g.Commits),
+			strings.Join(slowest, ", "))
+	}
+	t.Render()
+	return nil
+}
+
+func percent(value float64) string {
+	return strconv.FormatFloat(value*100, 'f', 1, 64) + "%"
+}
@@ -0,0 +1,109 @@
+//go:build unit
+// +build unit
+
+package stats_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/stats"
+	pstats "github.com/jenkins-x-plugins/jx-pipeline/pkg/stats"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPipelineStats(t *testing.T) {
+	ns := "jx"
+	now := time.Date(2026, time.March, 8, 10, 0, 0, 0, time.UTC)
+	newActivity := func(name, repo string, status v1.ActivityStatusType, startedAgo, duration time.Duration) *v1.PipelineActivity {
+		started := metav1.NewTime(now.Add(-startedAgo))
+		completed := metav1.NewTime(started.Add(duration))
+		return &v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: map[string]string{
+					tektonlog.LabelLighthouseOwner:  "myorg",
+					tektonlog.LabelLighthouseRepo:   repo,
+					tektonlog.LabelLighthouseBranch: "main",
+				},
+			},
+			Spec: v1.PipelineActivitySpec{
+				Pipeline:           "myorg/" + repo + "/main",
+				GitOwner:           "myorg",
+				GitRepository:      repo,
+				GitBranch:          "main",
+				Status:             status,
+				StartedTimestamp:   &started,
+				CompletedTimestamp: &completed,
+			},
+		}
+	}
+	jxClient := fakejx.NewSimpleClientset(
+		newActivity("myorg-repo-a-main-1", "repo-a", v1.ActivityStatusTypeSucceeded, time.Hour, 2*time.Minute),
+		newActivity("myorg-repo-a-main-2", "repo-a", v1.ActivityStatusTypeFailed, 2*time.Hour, 4*time.Minute),
+		newActivity("myorg-repo-b-main-1", "repo-b", v1.ActivityStatusTypeSucceeded, 3*time.Hour, 3*time.Minute),
+		newActivity("myorg-repo-b-main-2", "repo-b", v1.ActivityStatusTypeFailed, 30*24*time.Hour, time.Minute),
+	)
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: ns,
+			},
+		},
+	)
+
+	newOptions := func() (*stats.Options, *strings.Builder) {
+		out := &strings.Builder{}
+		_, o := stats.NewCmdPipelineStats()
+		o.Ctx = context.Background()
+		o.JXClient = jxClient
+		o.KubeClient = kubeClient
+		o.Namespace = ns
+		o.Now = now
+		o.Out = out
+		return o, out
+	}
+
+	o, out := newOptions()
+	err := o.Run()
+	require.NoError(t, err, "failed to run stats")
+
+	text := out.String()
+	t.Logf("got:\n%s\n", text)
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, []string{"REPO", "RUNS", "SUCCESS", "FAILURE", "ABORT", "P50", "P90", "P99"}, strings.Fields(lines[0])[:8])
+	assert.Equal(t, []string{"myorg/repo-a", "2", "50.0%", "50.0%", "0.0%", "2m0s", "4m0s", "4m0s"}, strings.Fields(lines[1])[:8])
+	assert.Equal(t, []string{"myorg/repo-b", "1", "100.0%", "0.0%", "0.0%", "3m0s"}, strings.Fields(lines[2])[:6], "should exclude activities outside of the window")
+
+	// activities without the lighthouse labels should still be found when filtering
+	unlabelled := newActivity("myorg-repo-a-main-3", "repo-a", v1.ActivityStatusTypeSucceeded, time.Hour, 2*time.Minute)
+	unlabelled.Labels = nil
+	_, err = jxClient.JenkinsV1().PipelineActivities(ns).Create(context.Background(), unlabelled, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	o, out = newOptions()
+	o.Format = "json"
+	o.BuildFilter.Repository = "repo-a"
+	err = o.Run()
+	require.NoError(t, err, "failed to run stats")
+
+	var results []pstats.GroupStats
+	err = json.Unmarshal([]byte(out.String()), &results)
+	require.NoError(t, err, "failed to parse JSON %s", out.String())
+	require.Len(t, results, 1)
+	assert.Equal(t, "myorg/repo-a", results[0].Name)
+	assert.Equal(t, 3, results[0].Runs)
+	assert.Equal(t, pstats.Seconds(120), results[0].DurationP50)
+}
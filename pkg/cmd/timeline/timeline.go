@@ -0,0 +1,397 @@
+package timeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/tektonlog"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/helper"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/cobras/templates"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/input/inputfactory"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/jxclient"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/options"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/table"
+	"github.com/jenkins-x/jx-kube-client/v3/pkg/kubeclient"
+	"github.com/spf13/cobra"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// FormatGantt renders the timeline as an ASCII Gantt chart
+	FormatGantt = "gantt"
+
+	// FormatTrace renders the timeline as Chrome trace event JSON which can be opened in Perfetto
+	FormatTrace = "trace"
+
+	queueChar = '.'
+	taskChar  = '#'
+	stepChar  = '='
+)
+
+// Options the command line options
+type Options struct {
+	options.BaseOptions
+
+	Args         []string
+	Format       string
+	Width        int
+	Namespace    string
+	BuildFilter  tektonlog.BuildPodInfoFilter
+	KubeClient   kubernetes.Interface
+	JXClient     versioned.Interface
+	TektonClient tektonclient.Interface
+	TektonLogger *tektonlog.TektonLogger
+	Input        input.Interface
+	Out          io.Writer
+	Timeline     *pipelines.Timeline
+	Now          time.Time
+}
+
+var (
+	cmdLong = templates.LongDesc(`
+		Displays the timeline of the tasks and steps of a pipeline so you can see which tasks ran in parallel and how long they waited for their pods to be scheduled
+
+`)
+
+	cmdExample = templates.Examples(`
+		# Pick the pipeline to view the timeline of
+		jx pipeline timeline
+
+		# View the timeline of a build of a repository
+		jx pipeline timeline --repo cheese --branch main --build 12
+
+		# Export the timeline as a trace to open in https://ui.perfetto.dev
+		jx pipeline timeline --repo cheese --branch main --format trace > trace.json
+	`)
+
+	formats = []string{FormatGantt, FormatTrace}
+)
+
+// NewCmdPipelineTimeline creates the command
+func NewCmdPipelineTimeline() (*cobra.Command, *Options) {
+	o := &Options{}
+
+	cmd := &cobra.Command{
+		Use:     "timeline [flags]",
+		Short:   "Displays the timeline of the tasks and steps of a pipeline",
+		Long:    cmdLong,
+		Example: cmdExample,
+		Aliases: []string{"gantt"},
+		Run: func(_ *cobra.Command, args []string) {
+			o.Args = args
+			err := o.Run()
+			helper.CheckErr(err)
+		},
+	}
+	cmd.Flags().StringVarP(&o.Namespace, "namespace", "n", "", "The namespace to look for the pipelines. Defaults to the current namespace")
+	cmd.Flags().StringVarP(&o.Format, "format", "", FormatGantt, "The output format. Valid values are: "+strings.Join(formats, ", "))
+	cmd.Flags().IntVarP(&o.Width, "width", "", 60, "The number of characters to use for the bars of the gantt chart")
+	cmd.Flags().StringVarP(&o.BuildFilter.Filter, "filter", "f", "", "Filters all the available jobs by those that contain the given text")
+	cmd.Flags().StringVarP(&o.BuildFilter.Owner, "owner", "", "", "Filters the owner (person/organisation) of the repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Repository, "repo", "r", "", "Filters the build repository")
+	cmd.Flags().StringVarP(&o.BuildFilter.Branch, "branch", "", "", "Filters the branch")
+	cmd.Flags().StringVarP(&o.BuildFilter.Build, "build", "", "", "The build number to view")
+	cmd.Flags().StringVarP(&o.BuildFilter.Context, "context", "", "", "Filters the context of the build")
+	cmd.Flags().StringVarP(&o.BuildFilter.GitURL, "giturl", "g", "", "The git URL to filter on. If you specify a link to a github repository or PR we can filter the query of builds accordingly")
+
+	o.AddBaseFlags(cmd)
+	return cmd, o
+}
+
+// Validate verifies things are setup correctly
+func (o *Options) Validate() error {
+	if o.Format != FormatGantt && o.Format != FormatTrace {
+		return options.InvalidOptionf("format", o.Format, "valid values are: %s", strings.Join(formats, ", "))
+	}
+	if o.Width <= 0 {
+		return options.InvalidOptionf("width", o.Width, "must be positive")
+	}
+
+	err := o.BuildFilter.Validate()
+	if err != nil {
+		return err
+	}
+
+	o.KubeClient, o.Namespace, err = kube.LazyCreateKubeClientAndNamespace(o.KubeClient, o.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to create kube client: %w", err)
+	}
+	o.JXClient, err = jxclient.LazyCreateJXClient(o.JXClient)
+	if err != nil {
+		return fmt.Errorf("failed to create the jx client: %w", err)
+	}
+
+	if o.TektonClient == nil {
+		f := kubeclient.NewFactory()
+		cfg, err := f.CreateKubeConfig()
+		if err != nil {
+			return fmt.Errorf("failed to get kubernetes config: %w", err)
+		}
+		o.TektonClient, err = tektonclient.NewForConfig(cfg)
+		if err != nil {
+			return fmt.Errorf("error building tekton client: %w", err)
+		}
+	}
+
+	if o.TektonLogger == nil {
+		o.TektonLogger = &tektonlog.TektonLogger{
+			KubeClient:   o.KubeClient,
+			TektonClient: o.TektonClient,
+			JXClient:     o.JXClient,
+			Namespace:    o.Namespace,
+		}
+	}
+	if o.Input == nil {
+		o.Input = inputfactory.NewInput(&o.BaseOptions)
+	}
+	if o.Out == nil {
+		o.Out = os.Stdout
+	}
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	return nil
+}
+
+// Run implements this command
+func (o *Options) Run() error {
+	err := o.Validate()
+	if err != nil {
+		return fmt.Errorf("failed to validate options: %w", err)
+	}
+
+	ctx := o.GetContext()
+	names, paMap, prMap, err := o.TektonLogger.GetTektonPipelinesWithActivePipelineActivity(ctx, &o.BuildFilter)
+	if err != nil {
+		return err
+	}
+
+	filter := o.BuildFilter.Filter
+	if len(o.Args) > 0 {
+		filter = o.Args[0]
+	}
+	var filteredNames []string
+	for _, n := range names {
+		if strings.Contains(strings.ToLower(n), strings.ToLower(filter)) {
+			filteredNames = append(filteredNames, n)
+		}
+	}
+	if len(filteredNames) == 0 {
+		return fmt.Errorf("no pipelines found in namespace %s", o.Namespace)
+	}
+
+	name := filteredNames[0]
+	if len(filteredNames) > 1 {
+		name, err = o.Input.PickNameWithDefault(filteredNames, "Pick the pipeline you wish to view the timeline of: ", "", "Please select the pipeline you wish to view")
+		if err != nil {
+			return fmt.Errorf("failed to pick a pipeline: %w", err)
+		}
+	}
+	pa := paMap[name]
+	if pa == nil {
+		return fmt.Errorf("could not find a PipelineActivity for %s", name)
+	}
+	prList := prMap[name]
+	if len(prList) == 0 {
+		return fmt.Errorf("could not find any PipelineRuns for %s", name)
+	}
+
+	o.Timeline, err = pipelines.LoadTimeline(ctx, o.TektonClient, o.Namespace, prList)
+	if err != nil {
+		return fmt.Errorf("failed to load the timeline of %s: %w", name, err)
+	}
+	if o.Format == FormatTrace {
+		return o.renderTrace(pa)
+	}
+	return o.renderGantt()
+}
+
+// renderGantt renders a row for each task and its steps with a bar showing when they ran relative to the build
+func (o *Options) renderGantt() error {
+	tl := o.Timeline
+	start := tl.Started
+	end := tl.End(o.Now)
+	total := end.Sub(start)
+
+	t := table.CreateTable(o.Out)
+	t.AddRow("STAGE", "QUEUED", "STARTED", "DURATION", "TIMELINE "+formatDuration(total))
+	for i := range tl.Tasks {
+		task := &tl.Tasks[i]
+		queueEnd := task.QueueEnd(o.Now)
+		bar := o.newBar()
+		o.fillBar(bar, start, total, task.Created, queueEnd, queueChar)
+		queued := formatDuration(queueEnd.Sub(task.Created))
+		started := ""
+		duration := ""
+		if !task.Started.IsZero() {
+			taskEnd := task.End(o.Now)
+			o.fillBar(bar, start, total, task.Started, taskEnd, taskChar)
+			started = "+" + formatDuration(task.Started.Sub(start))
+			duration = formatDuration(taskEnd.Sub(task.Started))
+		}
+		t.AddRow(task.Stage, queued, started, duration, string(bar))
+
+		for j := range task.Steps {
+			step := &task.Steps[j]
+			bar = o.newBar()
+			started = ""
+			duration = ""
+			if !step.Started.IsZero() {
+				stepEnd := step.Completed
+				if stepEnd.IsZero() {
+					stepEnd = task.End(o.Now)
+				}
+				o.fillBar(bar, start, total, step.Started, stepEnd, stepChar)
+				started = "+" + formatDuration(step.Started.Sub(start))
+				duration = formatDuration(stepEnd.Sub(step.Started))
+			}
+			t.AddRow("  "+step.Name, "", started, duration, string(bar))
+		}
+	}
+	t.Render()
+
+	_, err := fmt.Fprintf(o.Out, "\n%c queued waiting for a pod  %c task running  %c step running\n", queueChar, taskChar, stepChar)
+	return err
+}
+
+func (o *Options) newBar() []rune {
+	return []rune(strings.Repeat(" ", o.Width))
+}
+
+// fillBar fills the characters of the bar between the from and to times, using at least 1 character so that short
+// tasks are still visible
+func (o *Options) fillBar(bar []rune, start time.Time, total time.Duration, from, to time.Time, ch rune) {
+	if from.IsZero() || to.Before(from) {
+		return
+	}
+	first := o.column(start, total, from)
+	last := o.column(start, total, to)
+	if last <= first {
+		last = first + 1
+	}
+	for i := first; i < last && i < len(bar); i++ {
+		bar[i] = ch
+	}
+}
+
+func (o *Options) column(start time.Time, total time.Duration, t time.Time) int {
+	if total <= 0 {
+		return 0
+	}
+	col := int(float64(t.Sub(start)) / float64(total) * float64(o.Width))
+	if col < 0 {
+		return 0
+	}
+	if col > o.Width {
+		return o.Width
+	}
+	return col
+}
+
+func formatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	return d.Round(time.Second).String()
+}
+
+// TraceEvent an event in the Chrome trace event format
+type TraceEvent struct {
+	Name      string            `json:"name"`
+	Category  string            `json:"cat,omitempty"`
+	Phase     string            `json:"ph"`
+	Timestamp int64             `json:"ts"`
+	Duration  int64             `json:"dur,omitempty"`
+	PID       int               `json:"pid"`
+	TID       int               `json:"tid"`
+	Args      map[string]string `json:"args,omitempty"`
+}
+
+// Trace the Chrome trace event JSON document
+type Trace struct {
+	TraceEvents     []TraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string       `json:"displayTimeUnit"`
+}
+
+// ToTrace converts the timeline into a trace with a thread for each task holding its queue time, task and steps
+func ToTrace(pa *v1.PipelineActivity, tl *pipelines.Timeline, now time.Time) *Trace {
+	trace := &Trace{
+		DisplayTimeUnit: "ms",
+	}
+	trace.TraceEvents = append(trace.TraceEvents, TraceEvent{
+		Name:  "process_name",
+		Phase: "M",
+		PID:   1,
+		Args: map[string]string{
+			"name": fmt.Sprintf("%s #%s", pa.Spec.Pipeline, pa.Spec.Build),
+		},
+	})
+	for i := range tl.Tasks {
+		task := &tl.Tasks[i]
+		tid := i + 1
+		trace.TraceEvents = append(trace.TraceEvents, TraceEvent{
+			Name:  "thread_name",
+			Phase: "M",
+			PID:   1,
+			TID:   tid,
+			Args: map[string]string{
+				"name": task.Stage,
+			},
+		})
+		queueEnd := task.QueueEnd(now)
+		trace.TraceEvents = append(trace.TraceEvents, toTraceEvent("queued", "queue", tid, task.Created, queueEnd, map[string]string{
+			"task": task.Task,
+		}))
+		if task.Started.IsZero() {
+			continue
+		}
+		taskEnd := task.End(now)
+		trace.TraceEvents = append(trace.TraceEvents, toTraceEvent(task.Stage, "task", tid, task.Started, taskEnd, map[string]string{
+			"task": task.Task,
+		}))
+		for j := range task.Steps {
+			step := &task.Steps[j]
+			if step.Started.IsZero() {
+				continue
+			}
+			stepEnd := step.Completed
+			if stepEnd.IsZero() {
+				stepEnd = taskEnd
+			}
+			trace.TraceEvents = append(trace.TraceEvents, toTraceEvent(step.Name, "step", tid, step.Started, stepEnd, nil))
+		}
+	}
+	return trace
+}
+
+func toTraceEvent(name, category string, tid int, from, to time.Time, args map[string]string) TraceEvent {
+	return TraceEvent{
+		Name:      name,
+		Category:  category,
+		Phase:     "X",
+		Timestamp: from.UnixMicro(),
+		Duration:  to.Sub(from).Microseconds(),
+		PID:       1,
+		TID:       tid,
+		Args:      args,
+	}
+}
+
+func (o *Options) renderTrace(pa *v1.PipelineActivity) error {
+	data, err := json.MarshalIndent(ToTrace(pa, o.Timeline, o.Now), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal the trace to JSON: %w", err)
+	}
+	_, err = fmt.Fprintln(o.Out, string(data))
+	return err
+}
@@ -0,0 +1,149 @@
+//go:build unit
+// +build unit
+
+package timeline_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/cmd/timeline"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	fakejx "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	faketekton "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPipelineTimeline(t *testing.T) {
+	ns := "jx"
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) metav1.Time {
+		return metav1.NewTime(start.Add(time.Duration(seconds) * time.Second))
+	}
+	atPtr := func(seconds int) *metav1.Time {
+		t := at(seconds)
+		return &t
+	}
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              "cheese-main-1",
+			Namespace:         ns,
+			CreationTimestamp: at(0),
+			Labels: map[string]string{
+				"lighthouse.jenkins-x.io/refs.org":  "myorg",
+				"lighthouse.jenkins-x.io/refs.repo": "cheese",
+				"lighthouse.jenkins-x.io/branch":    "main",
+				"lighthouse.jenkins-x.io/buildNum":  "1",
+				"build":                             "1",
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				StartTime:      atPtr(0),
+				CompletionTime: atPtr(100),
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{Name: "cheese-main-1-build", PipelineTaskName: "build"},
+					{Name: "cheese-main-1-lint", PipelineTaskName: "lint"},
+				},
+			},
+		},
+	}
+	newTaskRun := func(name string, created, started, finished int) *pipelinev1.TaskRun {
+		return &pipelinev1.TaskRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				Namespace:         ns,
+				CreationTimestamp: at(created),
+				Labels: map[string]string{
+					pipelines.PipelineRunLabel: pr.Name,
+				},
+			},
+			Status: pipelinev1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+					StartTime:      atPtr(created),
+					CompletionTime: atPtr(finished),
+					Steps: []pipelinev1.StepState{
+						{
+							Name: "checkout",
+							ContainerState: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									StartedAt:  at(started),
+									FinishedAt: at(started + 10),
+								},
+							},
+						},
+						{
+							Name: "run",
+							ContainerState: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{
+									StartedAt:  at(started + 10),
+									FinishedAt: at(finished),
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	build := newTaskRun("cheese-main-1-build", 0, 20, 100)
+	lint := newTaskRun("cheese-main-1-lint", 0, 5, 50)
+
+	newOptions := func(format string, out *strings.Builder) *timeline.Options {
+		_, o := timeline.NewCmdPipelineTimeline()
+		o.KubeClient = fake.NewSimpleClientset()
+		o.JXClient = fakejx.NewSimpleClientset()
+		o.TektonClient = faketekton.NewSimpleClientset(pr, build, lint)
+		o.Namespace = ns
+		o.Format = format
+		o.Width = 20
+		o.BuildFilter.Repository = "cheese"
+		o.Out = out
+		o.Ctx = context.Background()
+		return o
+	}
+
+	stdout := &strings.Builder{}
+	o := newOptions(timeline.FormatGantt, stdout)
+	err := o.Run()
+	require.NoError(t, err, "failed to run gantt")
+
+	text := stdout.String()
+	t.Logf("gantt got:\n%s\n", text)
+	require.Len(t, o.Timeline.Tasks, 2)
+	assert.Equal(t, 20*time.Second, o.Timeline.Tasks[0].Started.Sub(o.Timeline.Tasks[0].Created), "queue time of build")
+	assert.Contains(t, text, "....################")
+	assert.Contains(t, text, ".#########  ")
+	assert.Contains(t, text, "    ==")
+
+	stdout = &strings.Builder{}
+	o = newOptions(timeline.FormatTrace, stdout)
+	err = o.Run()
+	require.NoError(t, err, "failed to run trace")
+
+	trace := &timeline.Trace{}
+	err = json.Unmarshal([]byte(stdout.String()), trace)
+	require.NoError(t, err, "failed to parse trace JSON %s", stdout.String())
+
+	var names []string
+	for _, e := range trace.TraceEvents {
+		if e.Phase == "X" {
+			names = append(names, e.Category+":"+e.Name)
+		}
+		if e.Category == "queue" && e.Args["task"] == "build" {
+			assert.Equal(t, int64(20*time.Second/time.Microsecond), e.Duration, "queue duration of build")
+		}
+	}
+	assert.Equal(t, []string{
+		"queue:queued", "task:build", "step:checkout", "step:run",
+		"queue:queued", "task:lint", "step:checkout", "step:run",
+	}, names)
+}
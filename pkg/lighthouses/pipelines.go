@@ -1,10 +1,13 @@
 package lighthouses
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
 	"github.com/jenkins-x/lighthouse-client/pkg/triggerconfig/inrepo"
 
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
@@ -22,9 +25,22 @@ func LoadEffectivePipelineRun(resolver *inrepo.UsesResolver, path string) (*pipe
 
 	dir := filepath.Dir(path)
 	resolver.Dir = dir
-	pr, err := inrepo.LoadTektonResourceAsPipelineRun(resolver, data)
+	pr, err := LoadTektonResourceAsPipelineRun(context.Background(), resolver, path, data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal YAML file %s: %w", path, err)
 	}
 	return pr, nil
 }
+
+// LoadTektonResourceAsPipelineRun loads the given tekton resource as a PipelineRun, converting any
+// tekton.dev/v1beta1 resource to tekton.dev/v1 first and warning about any deprecated fields it uses
+func LoadTektonResourceAsPipelineRun(ctx context.Context, resolver *inrepo.UsesResolver, path string, data []byte) (*pipelinev1.PipelineRun, error) {
+	converted, warnings, err := pipelines.ConvertV1beta1YAML(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert %s to %s: %w", path, pipelines.TektonAPIVersionV1, err)
+	}
+	for _, w := range warnings {
+		log.Logger().Warnf("%s: %s", path, w)
+	}
+	return inrepo.LoadTektonResourceAsPipelineRun(resolver, converted)
+}
@@ -0,0 +1,276 @@
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/stringhelpers"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// LabelRepo the label for the owner and name of the repository
+	LabelRepo = "repo"
+
+	// LabelBranch the label for the branch of the build
+	LabelBranch = "branch"
+
+	// LabelContext the label for the context of the build
+	LabelContext = "context"
+
+	// LabelStatus the label for the status of the pipeline or stage
+	LabelStatus = "status"
+
+	// LabelStage the label for the name of the stage
+	LabelStage = "stage"
+
+	// OtherValue the label value used when a value is not kept to bound the cardinality of the metrics
+	OtherValue = "other"
+
+	namespace = "jx_pipeline"
+)
+
+var (
+	// Labels the labels which can be enabled on the metrics
+	Labels = []string{LabelRepo, LabelBranch, LabelContext}
+
+	// DefaultBuckets the default histogram buckets in seconds which range from 10 seconds to 2 hours
+	DefaultBuckets = []float64{10, 30, 60, 120, 300, 600, 1200, 1800, 3600, 7200}
+)
+
+// Config configures the labels of the metrics so that their cardinality is bounded
+type Config struct {
+	// Labels the labels to include from repo, branch and context
+	Labels []string
+
+	// Branches the branches to keep as label values. Other branches use the OtherValue. If nil all branches are kept
+	Branches *regexp.Regexp
+
+	// MaxRepositories the maximum number of repositories to keep as label values. Once reached any new repositories
+	// use the OtherValue. Zero means no limit
+	MaxRepositories int
+
+	// Buckets the histogram buckets in seconds
+	Buckets []float64
+}
+
+// Metrics the Prometheus metrics of PipelineActivity resources
+type Metrics struct {
+	config       Config
+	lock         sync.Mutex
+	repos        map[string]bool
+	completed    map[string]bool
+	active       map[string]v1.ActivityStatusType
+	activeLabels map[string][]string
+	successTimes map[string]float64
+
+	runs          *prometheus.CounterVec
+	duration      *prometheus.HistogramVec
+	stageRuns     *prometheus.CounterVec
+	stageDuration *prometheus.HistogramVec
+	lastSuccess   *prometheus.GaugeVec
+	builds        *prometheus.Desc
+}
+
+// NewMetrics creates the metrics for the given config
+func NewMetrics(config Config) (*Metrics, error) {
+	for _, l := range config.Labels {
+		if stringhelpers.StringArrayIndex(Labels, l) < 0 {
+			return nil, fmt.Errorf("unknown label %s. Valid values are: %v", l, Labels)
+		}
+	}
+	if len(config.Buckets) == 0 {
+		config.Buckets = DefaultBuckets
+	}
+
+	labels := config.Labels
+	statusLabels := append(append([]string{}, labels...), LabelStatus)
+	stageLabels := append(append([]string{}, labels...), LabelStage, LabelStatus)
+	var successLabels []string
+	for _, l := range labels {
+		if l == LabelRepo || l == LabelBranch {
+			successLabels = append(successLabels, l)
+		}
+	}
+
+	return &Metrics{
+		config:       config,
+		repos:        map[string]bool{},
+		completed:    map[string]bool{},
+		active:       map[string]v1.ActivityStatusType{},
+		activeLabels: map[string][]string{},
+		successTimes: map[string]float64{},
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "runs_total",
+			Help:      "The number of completed pipelines",
+		}, statusLabels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "duration_seconds",
+			Help:      "The duration of completed pipelines in seconds",
+			Buckets:   config.Buckets,
+		}, statusLabels),
+		stageRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "stage_runs_total",
+			Help:      "The number of completed pipeline stages",
+		}, stageLabels),
+		stageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "stage_duration_seconds",
+			Help:      "The duration of completed pipeline stages in seconds",
+			Buckets:   config.Buckets,
+		}, stageLabels),
+		lastSuccess: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "last_success_timestamp_seconds",
+			Help:      "The unix time when the last successful pipeline completed",
+		}, successLabels),
+		builds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "builds"),
+			"The number of running or pending pipelines",
+			statusLabels, nil,
+		),
+	}, nil
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.runs.Describe(ch)
+	m.duration.Describe(ch)
+	m.stageRuns.Describe(ch)
+	m.stageDuration.Describe(ch)
+	m.lastSuccess.Describe(ch)
+	ch <- m.builds
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.runs.Collect(ch)
+	m.duration.Collect(ch)
+	m.stageRuns.Collect(ch)
+	m.stageDuration.Collect(ch)
+	m.lastSuccess.Collect(ch)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	counts := map[string]float64{}
+	values := map[string][]string{}
+	for name, status := range m.active {
+		lv := append(append([]string{}, m.activeLabels[name]...), string(status))
+		key := fmt.Sprintf("%q", lv)
+		counts[key]++
+		values[key] = lv
+	}
+	for key, count := range counts {
+		ch <- prometheus.MustNewConstMetric(m.builds, prometheus.GaugeValue, count, values[key]...)
+	}
+}
+
+// OnActivity updates the metrics when a PipelineActivity is added or updated. Completed activities are only counted
+// the first time they are seen
+func (m *Metrics) OnActivity(pa *v1.PipelineActivity) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	name := pa.Name
+	ps := &pa.Spec
+	labels := m.labelValues(pa)
+	if !ps.Status.IsTerminated() {
+		switch ps.Status {
+		case v1.ActivityStatusTypeRunning, v1.ActivityStatusTypePending:
+			m.active[name] = ps.Status
+			m.activeLabels[name] = labels
+		default:
+			m.removeActive(name)
+		}
+		return
+	}
+	m.removeActive(name)
+	if m.completed[name] {
+		return
+	}
+	m.completed[name] = true
+
+	status := string(ps.Status)
+	statusLabels := append(append([]string{}, labels...), status)
+	m.runs.WithLabelValues(statusLabels...).Inc()
+	if ps.StartedTimestamp != nil && ps.CompletedTimestamp != nil {
+		m.duration.WithLabelValues(statusLabels...).Observe(ps.CompletedTimestamp.Sub(ps.StartedTimestamp.Time).Seconds())
+	}
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil || !stage.Status.IsTerminated() {
+			continue
+		}
+		stageLabels := append(append([]string{}, labels...), stage.Name, string(stage.Status))
+		m.stageRuns.WithLabelValues(stageLabels...).Inc()
+		if stage.StartedTimestamp != nil && stage.CompletedTimestamp != nil {
+			m.stageDuration.WithLabelValues(stageLabels...).Observe(stage.CompletedTimestamp.Sub(stage.StartedTimestamp.Time).Seconds())
+		}
+	}
+
+	if ps.Status == v1.ActivityStatusTypeSucceeded && ps.CompletedTimestamp != nil {
+		var successLabels []string
+		for i, l := range m.config.Labels {
+			if l == LabelRepo || l == LabelBranch {
+				successLabels = append(successLabels, labels[i])
+			}
+		}
+		key := fmt.Sprintf("%q", successLabels)
+		completed := float64(ps.CompletedTimestamp.Unix())
+		if completed > m.successTimes[key] {
+			m.successTimes[key] = completed
+			m.lastSuccess.WithLabelValues(successLabels...).Set(completed)
+		}
+	}
+}
+
+// OnDelete removes a deleted PipelineActivity from the running and pending builds
+func (m *Metrics) OnDelete(pa *v1.PipelineActivity) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.removeActive(pa.Name)
+	delete(m.completed, pa.Name)
+}
+
+func (m *Metrics) removeActive(name string) {
+	delete(m.active, name)
+	delete(m.activeLabels, name)
+}
+
+// labelValues returns the values of the configured labels replacing values which would exceed the cardinality limits
+func (m *Metrics) labelValues(pa *v1.PipelineActivity) []string {
+	ps := &pa.Spec
+	var answer []string
+	for _, l := range m.config.Labels {
+		switch l {
+		case LabelRepo:
+			answer = append(answer, m.repoValue(ps.GitOwner+"/"+ps.GitRepository))
+		case LabelBranch:
+			branch := ps.GitBranch
+			if m.config.Branches != nil && !m.config.Branches.MatchString(branch) {
+				branch = OtherValue
+			}
+			answer = append(answer, branch)
+		case LabelContext:
+			answer = append(answer, ps.Context)
+		}
+	}
+	return answer
+}
+
+func (m *Metrics) repoValue(repo string) string {
+	if m.repos[repo] || m.config.MaxRepositories <= 0 {
+		return repo
+	}
+	if len(m.repos) >= m.config.MaxRepositories {
+		return OtherValue
+	}
+	m.repos[repo] = true
+	return repo
+}
@@ -0,0 +1,115 @@
+//go:build unit
+// +build unit
+
+package metrics_test
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/metrics"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMetrics(t *testing.T) {
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	at := func(seconds int) *metav1.Time {
+		t := metav1.NewTime(start.Add(time.Duration(seconds) * time.Second))
+		return &t
+	}
+	newActivity := func(name, repo, branch string, status v1.ActivityStatusType, duration int) *v1.PipelineActivity {
+		pa := &v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Spec: v1.PipelineActivitySpec{
+				GitOwner:         "myorg",
+				GitRepository:    repo,
+				GitBranch:        branch,
+				Context:          "release",
+				Status:           status,
+				StartedTimestamp: at(0),
+				Steps: []v1.PipelineActivityStep{
+					{
+						Kind: v1.ActivityStepKindTypeStage,
+						Stage: &v1.StageActivityStep{
+							CoreActivityStep: v1.CoreActivityStep{
+								Name:             "build",
+								Status:           status,
+								StartedTimestamp: at(0),
+							},
+						},
+					},
+				},
+			},
+		}
+		if status.IsTerminated() {
+			pa.Spec.CompletedTimestamp = at(duration)
+			pa.Spec.Steps[0].Stage.CompletedTimestamp = at(duration)
+		}
+		return pa
+	}
+
+	m, err := metrics.NewMetrics(metrics.Config{
+		Labels:          []string{metrics.LabelRepo, metrics.LabelBranch},
+		Branches:        regexp.MustCompile("^main$"),
+		MaxRepositories: 2,
+	})
+	require.NoError(t, err)
+
+	running := newActivity("cheese-main-3", "cheese", "main", v1.ActivityStatusTypeRunning, 0)
+	for _, pa := range []*v1.PipelineActivity{
+		newActivity("cheese-main-1", "cheese", "main", v1.ActivityStatusTypeSucceeded, 100),
+		newActivity("cheese-main-2", "cheese", "main", v1.ActivityStatusTypeFailed, 40),
+		newActivity("cheese-pr-1-1", "cheese", "PR-1", v1.ActivityStatusTypeSucceeded, 20),
+		newActivity("wine-main-1", "wine", "main", v1.ActivityStatusTypeSucceeded, 20),
+		newActivity("beer-main-1", "beer", "main", v1.ActivityStatusTypeSucceeded, 20),
+		running,
+		running,
+	} {
+		m.OnActivity(pa)
+	}
+	// lets check updates of completed activities are only counted once
+	m.OnActivity(newActivity("cheese-main-1", "cheese", "main", v1.ActivityStatusTypeSucceeded, 100))
+
+	text := scrape(t, m)
+	t.Logf("got metrics:\n%s\n", text)
+	for _, expected := range []string{
+		`jx_pipeline_runs_total{branch="main",repo="myorg/cheese",status="Succeeded"} 1`,
+		`jx_pipeline_runs_total{branch="main",repo="myorg/cheese",status="Failed"} 1`,
+		`jx_pipeline_runs_total{branch="other",repo="myorg/cheese",status="Succeeded"} 1`,
+		`jx_pipeline_runs_total{branch="main",repo="myorg/wine",status="Succeeded"} 1`,
+		`jx_pipeline_runs_total{branch="main",repo="other",status="Succeeded"} 1`,
+		`jx_pipeline_duration_seconds_sum{branch="main",repo="myorg/cheese",status="Succeeded"} 100`,
+		`jx_pipeline_stage_duration_seconds_count{branch="main",repo="myorg/cheese",stage="build",status="Failed"} 1`,
+		`jx_pipeline_builds{branch="main",repo="myorg/cheese",status="Running"} 1`,
+		`jx_pipeline_last_success_timestamp_seconds{branch="main",repo="myorg/cheese"} 1.7041897e+09`,
+	} {
+		assert.Contains(t, text, expected)
+	}
+
+	// when the running build completes it is no longer included in the builds gauge
+	m.OnActivity(newActivity("cheese-main-3", "cheese", "main", v1.ActivityStatusTypeSucceeded, 300))
+	text = scrape(t, m)
+	assert.NotContains(t, text, "jx_pipeline_builds{")
+	assert.Contains(t, text, `jx_pipeline_runs_total{branch="main",repo="myorg/cheese",status="Succeeded"} 2`)
+	assert.Contains(t, text, `jx_pipeline_last_success_timestamp_seconds{branch="main",repo="myorg/cheese"} 1.7041899e+09`)
+
+	_, err = metrics.NewMetrics(metrics.Config{Labels: []string{"author"}})
+	require.Error(t, err, "should fail for an unknown label")
+}
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(m))
+	w := httptest.NewRecorder()
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	return w.Body.String()
+}
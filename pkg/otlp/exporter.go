@@ -0,0 +1,104 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TracesPath the default path of the OTLP/HTTP traces endpoint
+const TracesPath = "/v1/traces"
+
+// Exporter exports traces
+type Exporter interface {
+	Export(ctx context.Context, data *TracesData) error
+}
+
+// FileExporter appends each export as a line of OTLP JSON to a file as used by the OpenTelemetry collector file
+// receiver and exporter
+type FileExporter struct {
+	lock sync.Mutex
+	Path string
+}
+
+// Export appends the traces as a single line of JSON
+func (e *FileExporter) Export(_ context.Context, data *TracesData) error {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal traces to JSON: %w", err)
+	}
+	line = append(line, '\n')
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	f, err := os.OpenFile(e.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", e.Path, err)
+	}
+	_, err = f.Write(line)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to write file %s: %w", e.Path, err)
+	}
+	return f.Close()
+}
+
+// HTTPExporter posts the traces as JSON to an OTLP/HTTP endpoint
+type HTTPExporter struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// NewHTTPExporter creates an exporter for the given endpoint defaulting the path to /v1/traces
+func NewHTTPExporter(endpoint string, headers map[string]string) (*HTTPExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse endpoint %s: %w", endpoint, err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("endpoint %s should be an absolute URL such as http://localhost:4318", endpoint)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = TracesPath
+	}
+	return &HTTPExporter{
+		URL:     u.String(),
+		Headers: headers,
+		Client:  http.DefaultClient,
+	}, nil
+}
+
+// Export posts the traces to the endpoint
+func (e *HTTPExporter) Export(ctx context.Context, data *TracesData) error {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal traces to JSON: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request to %s: %w", e.URL, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post traces to %s: %w", e.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to post traces to %s: status %d %s", e.URL, resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
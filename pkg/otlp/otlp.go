@@ -0,0 +1,255 @@
+package otlp
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AttributeServiceName the resource attribute for the name of the service
+	AttributeServiceName = "service.name"
+
+	// AttributeOwner the span attribute for the git owner of the repository
+	AttributeOwner = "jx.repository.owner"
+
+	// AttributeRepository the span attribute for the git repository name
+	AttributeRepository = "jx.repository.name"
+
+	// AttributeGitURL the span attribute for the git clone URL of the repository
+	AttributeGitURL = "vcs.repository.url.full"
+
+	// AttributeBranch the span attribute for the branch or pull request of the build
+	AttributeBranch = "vcs.ref.head.name"
+
+	// AttributeSHA the span attribute for the git commit SHA being built
+	AttributeSHA = "vcs.ref.head.revision"
+
+	// AttributeBuild the span attribute for the build number
+	AttributeBuild = "jx.build.number"
+
+	// AttributeContext the span attribute for the context of the build
+	AttributeContext = "jx.build.context"
+
+	// AttributeStatus the span attribute for the status of the pipeline, stage or step
+	AttributeStatus = "jx.status"
+
+	// AttributePod the span attribute for the name of the pod running the pipeline or stage
+	AttributePod = "k8s.pod.name"
+
+	// AttributeNamespace the span attribute for the namespace of the pipeline
+	AttributeNamespace = "k8s.namespace.name"
+
+	// SpanKindInternal the OTLP span kind for internal operations
+	SpanKindInternal = 1
+
+	// StatusCodeUnset the OTLP status code for spans which are still running
+	StatusCodeUnset = 0
+
+	// StatusCodeOk the OTLP status code for spans which succeeded
+	StatusCodeOk = 1
+
+	// StatusCodeError the OTLP status code for spans which failed
+	StatusCodeError = 2
+
+	scopeName = "github.com/jenkins-x-plugins/jx-pipeline"
+)
+
+// TracesData the OTLP JSON encoding of an ExportTraceServiceRequest
+type TracesData struct {
+	ResourceSpans []ResourceSpans `json:"resourceSpans"`
+}
+
+// ResourceSpans the spans of a resource
+type ResourceSpans struct {
+	Resource   Resource     `json:"resource"`
+	ScopeSpans []ScopeSpans `json:"scopeSpans"`
+}
+
+// Resource the resource which created the spans
+type Resource struct {
+	Attributes []KeyValue `json:"attributes,omitempty"`
+}
+
+// ScopeSpans the spans of an instrumentation scope
+type ScopeSpans struct {
+	Scope Scope  `json:"scope"`
+	Spans []Span `json:"spans"`
+}
+
+// Scope the instrumentation scope which created the spans
+type Scope struct {
+	Name string `json:"name"`
+}
+
+// Span a single span of a trace. The IDs are hex encoded as required by the OTLP JSON encoding
+type Span struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []KeyValue `json:"attributes,omitempty"`
+	Status            Status     `json:"status"`
+}
+
+// Status the status of a span
+type Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// KeyValue a span or resource attribute
+type KeyValue struct {
+	Key   string   `json:"key"`
+	Value AnyValue `json:"value"`
+}
+
+// AnyValue the value of an attribute
+type AnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+// Attribute returns the value of the attribute with the given key or an empty string if there is none
+func (s *Span) Attribute(key string) string {
+	for _, kv := range s.Attributes {
+		if kv.Key == key {
+			return kv.Value.StringValue
+		}
+	}
+	return ""
+}
+
+// ToTracesData converts the PipelineActivity into a single trace with a root span for the pipeline, a child span for
+// each stage and a grandchild span for each step. The stagePods map optionally maps stage names to the pods that
+// ran them. Any spans which have not completed end at the given time
+func ToTracesData(pa *v1.PipelineActivity, serviceName string, stagePods map[string]string, now time.Time) *TracesData {
+	ps := &pa.Spec
+	traceID := ToTraceID(pa)
+	rootID := toSpanID(traceID, "")
+	rootAttributes := addAttribute(nil, AttributeNamespace, pa.Namespace)
+	rootAttributes = addAttribute(rootAttributes, AttributeOwner, ps.GitOwner)
+	rootAttributes = addAttribute(rootAttributes, AttributeRepository, ps.GitRepository)
+	rootAttributes = addAttribute(rootAttributes, AttributeGitURL, ps.GitURL)
+	rootAttributes = addAttribute(rootAttributes, AttributeBranch, ps.GitBranch)
+	rootAttributes = addAttribute(rootAttributes, AttributeSHA, ps.LastCommitSHA)
+	rootAttributes = addAttribute(rootAttributes, AttributeBuild, ps.Build)
+	rootAttributes = addAttribute(rootAttributes, AttributeContext, ps.Context)
+	rootAttributes = addAttribute(rootAttributes, AttributeStatus, string(ps.Status))
+	if pa.Labels != nil {
+		rootAttributes = addAttribute(rootAttributes, AttributePod, pa.Labels["podName"])
+	}
+
+	name := ps.Pipeline
+	if name == "" {
+		name = pa.Name
+	}
+	if ps.Build != "" {
+		name += " #" + ps.Build
+	}
+	spans := []Span{
+		newSpan(traceID, rootID, "", name, ps.StartedTimestamp, ps.CompletedTimestamp, ps.Status, ps.Message, rootAttributes, now),
+	}
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil || stage.StartedTimestamp == nil {
+			continue
+		}
+		stageID := toSpanID(traceID, stage.Name)
+		stageAttributes := addAttribute(nil, AttributeStatus, string(stage.Status))
+		stageAttributes = addAttribute(stageAttributes, AttributePod, stagePods[stage.Name])
+		spans = append(spans, newSpan(traceID, stageID, rootID, stage.Name, stage.StartedTimestamp, stage.CompletedTimestamp, stage.Status, stage.Message, stageAttributes, now))
+
+		for j := range stage.Steps {
+			step := &stage.Steps[j]
+			if step.StartedTimestamp == nil {
+				continue
+			}
+			stepID := toSpanID(traceID, stage.Name+"/"+step.Name)
+			stepAttributes := addAttribute(nil, AttributeStatus, string(step.Status))
+			spans = append(spans, newSpan(traceID, stepID, stageID, step.Name, step.StartedTimestamp, step.CompletedTimestamp, step.Status, step.Message, stepAttributes, now))
+		}
+	}
+	return &TracesData{
+		ResourceSpans: []ResourceSpans{
+			{
+				Resource: Resource{
+					Attributes: addAttribute(nil, AttributeServiceName, serviceName),
+				},
+				ScopeSpans: []ScopeSpans{
+					{
+						Scope: Scope{
+							Name: scopeName,
+						},
+						Spans: spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// ToTraceID returns the trace ID of the PipelineActivity. It is derived from the activity so that exporting the same
+// build more than once results in the same trace
+func ToTraceID(pa *v1.PipelineActivity) string {
+	h := sha256.Sum256([]byte(pa.Namespace + "/" + pa.Name + "/" + string(pa.UID)))
+	return hex.EncodeToString(h[:16])
+}
+
+func toSpanID(traceID, path string) string {
+	h := sha256.Sum256([]byte(traceID + "/" + path))
+	return hex.EncodeToString(h[:8])
+}
+
+func newSpan(traceID, spanID, parentID, name string, started, completed *metav1.Time, status v1.ActivityStatusType, message v1.ActivityMessageType, attributes []KeyValue, now time.Time) Span {
+	start := now
+	if started != nil {
+		start = started.Time
+	}
+	end := now
+	if completed != nil && !completed.IsZero() {
+		end = completed.Time
+	}
+	if end.Before(start) {
+		end = start
+	}
+	return Span{
+		TraceID:           traceID,
+		SpanID:            spanID,
+		ParentSpanID:      parentID,
+		Name:              name,
+		Kind:              SpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        attributes,
+		Status:            toStatus(status, message),
+	}
+}
+
+func toStatus(status v1.ActivityStatusType, message v1.ActivityMessageType) Status {
+	switch status {
+	case v1.ActivityStatusTypeSucceeded, v1.ActivityStatusTypeNotExecuted:
+		return Status{Code: StatusCodeOk}
+	case v1.ActivityStatusTypeFailed, v1.ActivityStatusTypeError, v1.ActivityStatusTypeTimedOut,
+		v1.ActivityStatusTypeAborted, v1.ActivityStatusTypeCancelled:
+		return Status{Code: StatusCodeError, Message: string(message)}
+	default:
+		return Status{Code: StatusCodeUnset}
+	}
+}
+
+func addAttribute(attributes []KeyValue, key, value string) []KeyValue {
+	if value == "" {
+		return attributes
+	}
+	return append(attributes, KeyValue{
+		Key:   key,
+		Value: AnyValue{StringValue: value},
+	})
+}
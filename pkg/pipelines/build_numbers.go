@@ -0,0 +1,40 @@
+package pipelines
+
+import (
+	"context"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/sourcerepos"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+)
+
+// BuildNumberAllocator allocates the next build number for a branch of a repository
+type BuildNumberAllocator interface {
+	// NextBuildNumber returns the next build number given the highest build number of the existing activities or 0 if
+	// the allocator cannot allocate numbers for the repository
+	NextBuildNumber(ctx context.Context, owner, repository, branch string, lastBuild int) (int, error)
+}
+
+// SourceRepositoryBuildNumbers allocates build numbers using the last build number annotation on the SourceRepository
+type SourceRepositoryBuildNumbers struct {
+	JXClient  versioned.Interface
+	Namespace string
+
+	// DryRun returns the build numbers which would be allocated without updating the SourceRepository
+	DryRun bool
+}
+
+// NewSourceRepositoryBuildNumbers creates a new allocator of build numbers for the SourceRepository resources in the namespace
+func NewSourceRepositoryBuildNumbers(jxClient versioned.Interface, ns string) *SourceRepositoryBuildNumbers {
+	return &SourceRepositoryBuildNumbers{
+		JXClient:  jxClient,
+		Namespace: ns,
+	}
+}
+
+// NextBuildNumber allocates the next build number using optimistic concurrency on the SourceRepository
+func (a *SourceRepositoryBuildNumbers) NextBuildNumber(ctx context.Context, owner, repository, branch string, lastBuild int) (int, error) {
+	if a.DryRun {
+		return sourcerepos.PeekBuildNumber(ctx, a.JXClient, a.Namespace, owner, repository, branch, lastBuild)
+	}
+	return sourcerepos.NextBuildNumber(ctx, a.JXClient, a.Namespace, owner, repository, branch, lastBuild)
+}
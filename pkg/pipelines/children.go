@@ -0,0 +1,195 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// CustomRunKind the kind of a child reference of a PipelineRun which refers to a CustomRun rather than a TaskRun
+const CustomRunKind = "CustomRun"
+
+// IsCustomRun returns true if the child reference refers to a CustomRun which has no pod or logs
+func IsCustomRun(childReference *pipelinev1.ChildStatusReference) bool {
+	return childReference.Kind == CustomRunKind
+}
+
+// GetPipelineSpec returns the resolved spec of the PipelineRun or nil if it is not available
+func GetPipelineSpec(pr *pipelinev1.PipelineRun) *pipelinev1.PipelineSpec {
+	if pr.Status.PipelineSpec != nil {
+		return pr.Status.PipelineSpec
+	}
+	return pr.Spec.PipelineSpec
+}
+
+// ChildStageNamer names the stage of each child reference of a PipelineRun so that the TaskRuns of a matrix
+// fan-out get a separate stage labelled with their matrix params
+type ChildStageNamer struct {
+	pr      *pipelinev1.PipelineRun
+	counts  map[string]int
+	indexes map[string]int
+}
+
+// NewChildStageNamer creates a new namer for the child references of the given PipelineRun
+func NewChildStageNamer(pr *pipelinev1.PipelineRun) *ChildStageNamer {
+	n := &ChildStageNamer{
+		pr:      pr,
+		counts:  map[string]int{},
+		indexes: map[string]int{},
+	}
+	for _, childReference := range pr.Status.ChildReferences {
+		n.counts[ToStageName(childReference.DisplayName, childReference.PipelineTaskName)]++
+	}
+	return n
+}
+
+// StageName returns the stage name of the child reference given the params of its TaskRun or CustomRun
+func (n *ChildStageNamer) StageName(childReference *pipelinev1.ChildStatusReference, params map[string]string) string {
+	stageName := ToStageName(childReference.DisplayName, childReference.PipelineTaskName)
+	if n.counts[stageName] <= 1 {
+		return stageName
+	}
+	n.indexes[stageName]++
+
+	names := n.matrixParamNames(childReference.PipelineTaskName)
+	if len(names) == 0 {
+		for k := range params {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+	}
+	var values []string
+	for _, name := range names {
+		if value, ok := params[name]; ok {
+			values = append(values, name+"="+value)
+		}
+	}
+	if len(values) == 0 {
+		return stageName + " #" + strconv.Itoa(n.indexes[stageName])
+	}
+	return stageName + " [" + strings.Join(values, ", ") + "]"
+}
+
+func (n *ChildStageNamer) matrixParamNames(taskName string) []string {
+	ps := GetPipelineSpec(n.pr)
+	if ps == nil {
+		return nil
+	}
+	var answer []string
+	add := func(name string) {
+		for _, existing := range answer {
+			if existing == name {
+				return
+			}
+		}
+		answer = append(answer, name)
+	}
+	for _, tasks := range [][]pipelinev1.PipelineTask{ps.Tasks, ps.Finally} {
+		for i := range tasks {
+			pt := &tasks[i]
+			if pt.Name != taskName || pt.Matrix == nil {
+				continue
+			}
+			for _, p := range pt.Matrix.Params {
+				add(p.Name)
+			}
+			for _, include := range pt.Matrix.Include {
+				for _, p := range include.Params {
+					add(p.Name)
+				}
+			}
+		}
+	}
+	return answer
+}
+
+// TaskRunParams returns the params of the TaskRun as strings
+func TaskRunParams(tr *pipelinev1.TaskRun) map[string]string {
+	answer := map[string]string{}
+	for _, p := range tr.Spec.Params {
+		answer[p.Name] = paramValueString(p.Value.StringVal, p.Value.ArrayVal, p.Value.ObjectVal)
+	}
+	return answer
+}
+
+// CustomRunParams returns the params of the CustomRun as strings
+func CustomRunParams(cr *pipelinev1beta1.CustomRun) map[string]string {
+	answer := map[string]string{}
+	for _, p := range cr.Spec.Params {
+		answer[p.Name] = paramValueString(p.Value.StringVal, p.Value.ArrayVal, p.Value.ObjectVal)
+	}
+	return answer
+}
+
+func paramValueString(stringVal string, arrayVal []string, objectVal map[string]string) string {
+	if len(arrayVal) > 0 {
+		return strings.Join(arrayVal, ",")
+	}
+	if len(objectVal) > 0 {
+		var values []string
+		for k, v := range objectVal {
+			values = append(values, k+":"+v)
+		}
+		sort.Strings(values)
+		return strings.Join(values, ",")
+	}
+	return stringVal
+}
+
+// ToCustomRunStatus returns the activity status of the CustomRun
+func ToCustomRunStatus(cr *pipelinev1beta1.CustomRun) v1.ActivityStatusType {
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return v1.ActivityStatusTypePending
+	}
+	switch condition.Status {
+	case corev1.ConditionTrue:
+		return v1.ActivityStatusTypeSucceeded
+	case corev1.ConditionFalse:
+		switch condition.Reason {
+		case pipelinev1beta1.CustomRunReasonTimedOut.String():
+			return v1.ActivityStatusTypeTimedOut
+		case pipelinev1beta1.CustomRunReasonCancelled.String():
+			return v1.ActivityStatusTypeCancelled
+		}
+		return v1.ActivityStatusTypeFailed
+	}
+	if cr.Status.StartTime != nil {
+		return v1.ActivityStatusTypeRunning
+	}
+	return v1.ActivityStatusTypePending
+}
+
+// ToCustomRunStage creates the stage for a CustomRun which has no steps
+func ToCustomRunStage(stageName string, cr *pipelinev1beta1.CustomRun) *v1.PipelineActivityStep {
+	stage := createStep(stageName, cr.Status.StartTime, ToCustomRunStatus(cr))
+	stage.Stage.CompletedTimestamp = cr.Status.CompletionTime
+	return stage
+}
+
+// CustomRunMessage returns the message of the CustomRun
+func CustomRunMessage(cr *pipelinev1beta1.CustomRun) string {
+	condition := cr.Status.GetCondition(apis.ConditionSucceeded)
+	if condition == nil {
+		return ""
+	}
+	return strings.ReplaceAll(condition.Message, "CustomRun", "Stage")
+}
+
+// GetCustomRun loads the CustomRun of the given name
+func (l *TaskRunLoader) GetCustomRun(ctx context.Context, name string) (*pipelinev1beta1.CustomRun, error) {
+	cr, err := l.client.TektonV1beta1().CustomRuns(l.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CustomRun %s in namespace %s: %w", name, l.namespace, err)
+	}
+	return cr, nil
+}
@@ -0,0 +1,148 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// ConvertV1beta1YAML converts a tekton.dev/v1beta1 Pipeline, PipelineRun, Task or TaskRun YAML document into
+// tekton.dev/v1 using Tekton's conversion functions. Any other document is returned unchanged.
+// The returned warnings describe any deprecated v1beta1 fields used by the document.
+//
+// Only the type of the document is decoded up front so that documents without a kind, which lighthouse treats as
+// PipelineRuns, are left for the caller to load
+func ConvertV1beta1YAML(ctx context.Context, data []byte) ([]byte, []string, error) {
+	tm := &metav1.TypeMeta{}
+	err := yaml.Unmarshal(data, tm)
+	if err != nil || tm.APIVersion != TektonAPIVersionV1beta1 {
+		return data, nil, nil
+	}
+
+	var warnings []string
+	var answer interface{}
+	switch tm.Kind {
+	case "Pipeline":
+		from := &pipelinev1beta1.Pipeline{}
+		err = yaml.Unmarshal(data, from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal %s Pipeline: %w", TektonAPIVersionV1beta1, err)
+		}
+		warnings = pipelineSpecWarnings(&from.Spec, "spec")
+		answer, err = ToV1Pipeline(ctx, from)
+	case "PipelineRun":
+		from := &pipelinev1beta1.PipelineRun{}
+		err = yaml.Unmarshal(data, from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal %s PipelineRun: %w", TektonAPIVersionV1beta1, err)
+		}
+		warnings = pipelineRunSpecWarnings(&from.Spec)
+		answer, err = ToV1PipelineRun(ctx, from)
+	case "Task":
+		from := &pipelinev1beta1.Task{}
+		err = yaml.Unmarshal(data, from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal %s Task: %w", TektonAPIVersionV1beta1, err)
+		}
+		warnings = taskSpecWarnings(&from.Spec, "spec")
+		answer, err = ToV1Task(ctx, from)
+	case "TaskRun":
+		from := &pipelinev1beta1.TaskRun{}
+		err = yaml.Unmarshal(data, from)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to unmarshal %s TaskRun: %w", TektonAPIVersionV1beta1, err)
+		}
+		if from.Spec.Resources != nil {
+			warnings = append(warnings, deprecatedResourcesWarning("spec.resources"))
+		}
+		if from.Spec.TaskSpec != nil {
+			warnings = append(warnings, taskSpecWarnings(from.Spec.TaskSpec, "spec.taskSpec")...)
+		}
+		warnings = append(warnings, taskRefWarnings(from.Spec.TaskRef, "spec.taskRef")...)
+		answer, err = ToV1TaskRun(ctx, from)
+	default:
+		return data, nil, nil
+	}
+	if err != nil {
+		return nil, warnings, err
+	}
+	converted, err := yaml.Marshal(answer)
+	if err != nil {
+		return nil, warnings, fmt.Errorf("failed to marshal %s %s: %w", TektonAPIVersionV1, tm.Kind, err)
+	}
+	return converted, warnings, nil
+}
+
+func pipelineRunSpecWarnings(spec *pipelinev1beta1.PipelineRunSpec) []string {
+	var warnings []string
+	if len(spec.Resources) > 0 {
+		warnings = append(warnings, deprecatedResourcesWarning("spec.resources"))
+	}
+	if spec.Timeout != nil {
+		warnings = append(warnings, "spec.timeout is deprecated: use spec.timeouts.pipeline instead")
+	}
+	if spec.PipelineSpec != nil {
+		warnings = append(warnings, pipelineSpecWarnings(spec.PipelineSpec, "spec.pipelineSpec")...)
+	}
+	if spec.PipelineRef != nil && spec.PipelineRef.Bundle != "" {
+		warnings = append(warnings, "spec.pipelineRef.bundle is deprecated: use the bundles resolver instead")
+	}
+	return warnings
+}
+
+func pipelineSpecWarnings(spec *pipelinev1beta1.PipelineSpec, path string) []string {
+	var warnings []string
+	if len(spec.Resources) > 0 {
+		warnings = append(warnings, deprecatedResourcesWarning(path+".resources"))
+	}
+	for j, tasks := range [][]pipelinev1beta1.PipelineTask{spec.Tasks, spec.Finally} {
+		name := "tasks"
+		if j > 0 {
+			name = "finally"
+		}
+		for i := range tasks {
+			pt := &tasks[i]
+			taskPath := fmt.Sprintf("%s.%s[%d]", path, name, i)
+			if pt.Resources != nil {
+				warnings = append(warnings, deprecatedResourcesWarning(taskPath+".resources"))
+			}
+			warnings = append(warnings, taskRefWarnings(pt.TaskRef, taskPath+".taskRef")...)
+			if pt.TaskSpec != nil {
+				warnings = append(warnings, taskSpecWarnings(&pt.TaskSpec.TaskSpec, taskPath+".taskSpec")...)
+			}
+		}
+	}
+	return warnings
+}
+
+func taskSpecWarnings(spec *pipelinev1beta1.TaskSpec, path string) []string {
+	var warnings []string
+	if spec.Resources != nil {
+		warnings = append(warnings, deprecatedResourcesWarning(path+".resources"))
+	}
+	if spec.HasDeprecatedFields() {
+		warnings = append(warnings, path+" uses deprecated container fields on its steps or stepTemplate which are not supported by "+TektonAPIVersionV1)
+	}
+	return warnings
+}
+
+func taskRefWarnings(ref *pipelinev1beta1.TaskRef, path string) []string {
+	if ref == nil {
+		return nil
+	}
+	var warnings []string
+	if ref.Bundle != "" {
+		warnings = append(warnings, path+".bundle is deprecated: use the bundles resolver instead")
+	}
+	if ref.Kind == "ClusterTask" {
+		warnings = append(warnings, path+" refers to a ClusterTask which is deprecated: use the cluster resolver instead")
+	}
+	return warnings
+}
+
+func deprecatedResourcesWarning(path string) string {
+	return path + " uses PipelineResources which are deprecated and ignored"
+}
@@ -19,143 +19,132 @@ import (
 	"knative.dev/pkg/apis"
 )
 
-// ToPipelineActivityName creates an activity name from a pipeline run
+// ToPipelineActivityName creates an activity name from a pipeline run.
+//
+// If the PipelineRun has no build number yet the next one is guessed from the existing PipelineActivity resources.
+// Use ToPipelineActivityNameWithAllocator when the activity is going to be created so build numbers are allocated safely
 func ToPipelineActivityName(pr *pipelinev1.PipelineRun, paList []v1.PipelineActivity) string {
+	name, _ := ToPipelineActivityNameWithAllocator(context.TODO(), pr, paList, nil)
+	return name
+}
+
+// ToPipelineActivityNameWithAllocator creates an activity name from a pipeline run using the allocator to allocate
+// the build number if the PipelineRun does not have one yet and there is no existing PipelineActivity for it.
+//
+// If the allocator is nil or cannot allocate a number for the repository we fall back to scanning the existing
+// PipelineActivity resources for the highest build number
+func ToPipelineActivityNameWithAllocator(ctx context.Context, pr *pipelinev1.PipelineRun, paList []v1.PipelineActivity, allocator BuildNumberAllocator) (string, error) {
 	labels := pr.Labels
 	if labels == nil {
-		return ""
+		return "", nil
 	}
 
 	build := labels["build"]
-	owner := naming.ToValidName(activities.GetLabel(labels, activities.OwnerLabels))
-	repository := naming.ToValidName(activities.GetLabel(labels, activities.RepoLabels))
-	branch := naming.ToValidName(activities.GetLabel(labels, activities.BranchLabels))
+	rawOwner := activities.GetLabel(labels, activities.OwnerLabels)
+	rawRepository := activities.GetLabel(labels, activities.RepoLabels)
+	rawBranch := activities.GetLabel(labels, activities.BranchLabels)
+	owner := naming.ToValidName(rawOwner)
+	repository := naming.ToValidName(rawRepository)
+	branch := naming.ToValidName(rawBranch)
 
 	if owner == "" || repository == "" || branch == "" {
-		return ""
+		return "", nil
 	}
 
 	prefix := owner + "-" + repository + "-" + branch + "-"
-	if build == "" {
-		buildID := labels["lighthouse.jenkins-x.io/buildNum"]
-		if buildID == "" {
-			return ""
+	if build != "" {
+		return naming.ToValidName(prefix + build), nil
+	}
+	buildID := labels["lighthouse.jenkins-x.io/buildNum"]
+	if buildID == "" {
+		return "", nil
+	}
+	for i := range paList {
+		pa := &paList[i]
+		if pa.Labels == nil {
+			continue
 		}
-		for i := range paList {
-			pa := &paList[i]
-			if pa.Labels == nil {
-				continue
-			}
-			if pa.Labels["buildID"] == buildID || pa.Labels["lighthouse.jenkins-x.io/buildNum"] == buildID {
-				if pa.Spec.Build != "" {
-					pr.Labels["build"] = pa.Spec.Build
-					return pa.Name
-				}
+		if pa.Labels["buildID"] == buildID || pa.Labels["lighthouse.jenkins-x.io/buildNum"] == buildID {
+			if pa.Spec.Build != "" {
+				pr.Labels["build"] = pa.Spec.Build
+				return pa.Name, nil
 			}
 		}
+	}
 
-		// no PA has the buildNum yet so lets try find the next PA build number...
-		b := 1
-		found := false
-		var name string
-		for i := range paList {
-			pa := &paList[i]
-			if strings.HasPrefix(pa.Name, prefix) {
-				buildNum, _ := strconv.Atoi(strings.Split(pa.Name, prefix)[1])
-				if buildNum >= b {
-					b = buildNum
-					found = true
-				}
+	// no PA has the buildNum yet so lets find the highest PA build number...
+	b := 0
+	for i := range paList {
+		pa := &paList[i]
+		if strings.HasPrefix(pa.Name, prefix) {
+			buildNum, _ := strconv.Atoi(strings.Split(pa.Name, prefix)[1])
+			if buildNum > b {
+				b = buildNum
 			}
 		}
-		if found {
-			b++
-		}
-		build = strconv.Itoa(b)
-		pr.Labels["build"] = build
-		name = naming.ToValidName(prefix + build)
-		return name
 	}
-	return naming.ToValidName(prefix + build)
-}
 
-func ToPipelineActivity(tektonclient tektonversioned.Interface, pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity, overwriteSteps bool) error {
-	annotations := pr.Annotations
-	labels := pr.Labels
-	if pa.APIVersion == "" {
-		pa.APIVersion = "jenkins.io/v1"
-	}
-	if pa.Kind == "" {
-		pa.Kind = "PipelineActivity"
-	}
-	pa.Namespace = pr.Namespace
-
-	if pa.Annotations == nil {
-		pa.Annotations = map[string]string{}
-	}
-	if pa.Labels == nil {
-		pa.Labels = map[string]string{}
-	}
-	for k, v := range annotations {
-		switch k {
-		case "lighthouse.jenkins-x.io/traceparent", "lighthouse.jenkins-x.io/tracestate":
-			// the opentelemetry annotations holding trace context shouldn't be copied to other resources
-		default:
-			pa.Annotations[k] = v
+	next := 0
+	if allocator != nil {
+		var err error
+		next, err = allocator.NextBuildNumber(ctx, rawOwner, rawRepository, rawBranch, b)
+		if err != nil {
+			return "", fmt.Errorf("failed to allocate build number for %s: %w", strings.TrimSuffix(prefix, "-"), err)
 		}
 	}
-	for k, v := range labels {
-		pa.Labels[k] = v
+	if next <= 0 {
+		next = b + 1
 	}
+	build = strconv.Itoa(next)
+	pr.Labels["build"] = build
+	return naming.ToValidName(prefix + build), nil
+}
 
+// ToPipelineActivity converts the PipelineRun and its TaskRuns into the PipelineActivity
+func ToPipelineActivity(tektonclient tektonversioned.Interface, pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity, overwriteSteps bool) error {
+	ctx := context.TODO()
+	UpdatePipelineActivityMetadata(pr, pa)
 	ps := &pa.Spec
-	if labels != nil {
-		if ps.GitOwner == "" {
-			ps.GitOwner = activities.GetLabel(labels, activities.OwnerLabels)
-		}
-		if ps.GitRepository == "" {
-			ps.GitRepository = activities.GetLabel(labels, activities.RepoLabels)
-		}
-		if ps.GitBranch == "" {
-			ps.GitBranch = activities.GetLabel(labels, activities.BranchLabels)
-		}
-		if ps.Build == "" {
-			ps.Build = activities.GetLabel(labels, activities.BuildLabels)
-		}
-		if ps.Context == "" {
-			ps.Context = activities.GetLabel(labels, activities.ContextLabels)
-		}
-		if ps.BaseSHA == "" {
-			ps.BaseSHA = labels["lighthouse.jenkins-x.io/baseSHA"]
-		}
-		if ps.LastCommitSHA == "" {
-			ps.LastCommitSHA = labels["lighthouse.jenkins-x.io/lastCommitSHA"]
-		}
-	}
-	if ps.GitOwner != "" && ps.GitRepository != "" && ps.GitBranch != "" && ps.Pipeline == "" {
-		ps.Pipeline = fmt.Sprintf("%s/%s/%s", ps.GitOwner, ps.GitRepository, ps.GitBranch)
-	}
-	if annotations != nil {
-		if ps.GitURL == "" {
-			ps.GitURL = annotations["lighthouse.jenkins-x.io/cloneURI"]
-		}
+
+	taskRuns, err := NewTaskRunLoader(ctx, tektonclient, pa.Namespace, pr)
+	if err != nil {
+		return err
 	}
 
 	podName := ""
 	stageNames := map[string]bool{}
+	instances := map[string][]string{}
+	namer := NewChildStageNamer(pr)
+	results := &Results{
+		Pipeline: ToPipelineRunResults(pr),
+	}
 	var steps []v1.PipelineActivityStep
-	var taskruns []pipelinev1.TaskRun
-	for _, childReference := range pr.Status.ChildReferences {
-		taskrun, err := tektonclient.TektonV1().TaskRuns(pa.Namespace).Get(context.TODO(), childReference.Name, metav1.GetOptions{})
-		if err != nil {
-			return fmt.Errorf("failed to get TaskRun %s in namespace %s: %w", childReference.Name, pa.Namespace, err)
+	var messages []string
+	for i := range pr.Status.ChildReferences {
+		childReference := &pr.Status.ChildReferences[i]
+		if IsCustomRun(childReference) {
+			customRun, err := taskRuns.GetCustomRun(ctx, childReference.Name)
+			if err != nil {
+				return err
+			}
+			stageName := namer.StageName(childReference, CustomRunParams(customRun))
+			stageNames[stageName] = true
+			instances[childReference.PipelineTaskName] = append(instances[childReference.PipelineTaskName], stageName)
+			messages = append(messages, CustomRunMessage(customRun))
+			results.AddStage(stageName, childReference.PipelineTaskName, ToCustomRunResults(customRun))
+			steps = append(steps, *ToCustomRunStage(stageName, customRun))
+			continue
 		}
-		taskruns = append(taskruns, *taskrun)
-		stageName := childReference.DisplayName
-		if stageName == "" {
-			stageName = strings.ReplaceAll(childReference.PipelineTaskName, "-", " ")
+
+		taskrun, err := taskRuns.Get(ctx, childReference.Name)
+		if err != nil {
+			return err
 		}
+		messages = append(messages, taskRunMessage(taskrun))
+		stageName := namer.StageName(childReference, TaskRunParams(taskrun))
 		stageNames[stageName] = true
+		instances[childReference.PipelineTaskName] = append(instances[childReference.PipelineTaskName], stageName)
+		results.AddStage(stageName, childReference.PipelineTaskName, ToTaskRunResults(taskrun))
 		var stage *v1.PipelineActivityStep
 		if podName == "" {
 			podName = taskrun.Status.PodName
@@ -347,13 +336,122 @@ func ToPipelineActivity(tektonclient tektonversioned.Interface, pr *pipelinev1.P
 		pa.Labels["podName"] = podName
 	}
 
+	graph := ToStageGraph(pr)
+	for i := range graph {
+		node := &graph[i]
+		stages := instances[node.Task]
+		if len(stages) > 1 || (len(stages) == 1 && stages[0] != node.Name) {
+			node.Instances = stages
+		}
+	}
+	err = SetStageGraph(pa, graph)
+	if err != nil {
+		return err
+	}
+	err = SetResults(pa, results)
+	if err != nil {
+		return err
+	}
+
 	activities.UpdateStatus(pa, false, nil)
 
 	addConditionsMessage(pr, pa)
-	addTaskRunsMessage(taskruns, pa)
+	addStageMessages(messages, pa)
 	return nil
 }
 
+// UpdatePipelineActivityMetadata copies the labels, annotations and git details of the PipelineRun into the
+// PipelineActivity without loading any TaskRuns
+func UpdatePipelineActivityMetadata(pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity) {
+	annotations := pr.Annotations
+	labels := pr.Labels
+	if pa.APIVersion == "" {
+		pa.APIVersion = "jenkins.io/v1"
+	}
+	if pa.Kind == "" {
+		pa.Kind = "PipelineActivity"
+	}
+	pa.Namespace = pr.Namespace
+
+	if pa.Annotations == nil {
+		pa.Annotations = map[string]string{}
+	}
+	if pa.Labels == nil {
+		pa.Labels = map[string]string{}
+	}
+	for k, v := range annotations {
+		switch k {
+		case "lighthouse.jenkins-x.io/traceparent", "lighthouse.jenkins-x.io/tracestate":
+			// the opentelemetry annotations holding trace context shouldn't be copied to other resources
+		default:
+			pa.Annotations[k] = v
+		}
+	}
+	for k, v := range labels {
+		pa.Labels[k] = v
+	}
+
+	ps := &pa.Spec
+	if labels != nil {
+		if ps.GitOwner == "" {
+			ps.GitOwner = activities.GetLabel(labels, activities.OwnerLabels)
+		}
+		if ps.GitRepository == "" {
+			ps.GitRepository = activities.GetLabel(labels, activities.RepoLabels)
+		}
+		if ps.GitBranch == "" {
+			ps.GitBranch = activities.GetLabel(labels, activities.BranchLabels)
+		}
+		if ps.Build == "" {
+			ps.Build = activities.GetLabel(labels, activities.BuildLabels)
+		}
+		if ps.Context == "" {
+			ps.Context = activities.GetLabel(labels, activities.ContextLabels)
+		}
+		if ps.BaseSHA == "" {
+			ps.BaseSHA = labels["lighthouse.jenkins-x.io/baseSHA"]
+		}
+		if ps.LastCommitSHA == "" {
+			ps.LastCommitSHA = labels["lighthouse.jenkins-x.io/lastCommitSHA"]
+		}
+	}
+	if ps.GitOwner != "" && ps.GitRepository != "" && ps.GitBranch != "" && ps.Pipeline == "" {
+		ps.Pipeline = fmt.Sprintf("%s/%s/%s", ps.GitOwner, ps.GitRepository, ps.GitBranch)
+	}
+	if annotations != nil {
+		if ps.GitURL == "" {
+			ps.GitURL = annotations["lighthouse.jenkins-x.io/cloneURI"]
+		}
+	}
+}
+
+// ToPipelineRunStatus returns the activity status of the PipelineRun from its Succeeded condition without loading
+// any TaskRuns
+func ToPipelineRunStatus(pr *pipelinev1.PipelineRun) v1.ActivityStatusType {
+	c := pr.Status.GetCondition(apis.ConditionSucceeded)
+	if c == nil {
+		return v1.ActivityStatusTypePending
+	}
+	switch c.Status {
+	case corev1.ConditionTrue:
+		return v1.ActivityStatusTypeSucceeded
+	case corev1.ConditionFalse:
+		switch c.Reason {
+		case pipelinev1.PipelineRunReasonTimedOut.String():
+			return v1.ActivityStatusTypeTimedOut
+		case pipelinev1.PipelineRunReasonCancelled.String():
+			return v1.ActivityStatusTypeCancelled
+		default:
+			return v1.ActivityStatusTypeFailed
+		}
+	default:
+		if c.Reason == v1.ActivityStatusTypePending.String() {
+			return v1.ActivityStatusTypePending
+		}
+		return v1.ActivityStatusTypeRunning
+	}
+}
+
 // addConditionsMessage reads the pr and gets the message for each condition then add it to the pa as Spec.Message
 // It also edit the message so that it says PipelineActivity instead of PipelineRun
 // It also replaces the pr.name with pa.name
@@ -373,23 +471,23 @@ func addConditionsMessage(pr *pipelinev1.PipelineRun, pa *v1.PipelineActivity) {
 	}
 }
 
-// addConditionsMessage reads the pr and gets the message for each taskrun then add it to the pa as Spec.Steps[k].Stage.Message
-// It replace TaskRun with Stage
-func addTaskRunsMessage(taskruns []pipelinev1.TaskRun, pa *v1.PipelineActivity) {
-	k1 := 0
-	for i := range taskruns {
-		taskrun := taskruns[i]
-		msg := ""
-		for k2 := range taskrun.Status.Conditions {
-			msg = taskrun.Status.Conditions[k2].Message
-		}
-		msg = strings.ReplaceAll(msg, "TaskRun", "Stage")
+// taskRunMessage returns the message of the last condition of the TaskRun replacing TaskRun with Stage
+func taskRunMessage(taskrun *pipelinev1.TaskRun) string {
+	msg := ""
+	for k := range taskrun.Status.Conditions {
+		msg = taskrun.Status.Conditions[k].Message
+	}
+	return strings.ReplaceAll(msg, "TaskRun", "Stage")
+}
+
+// addStageMessages adds the message of each TaskRun or CustomRun to the pa as Spec.Steps[k].Stage.Message
+func addStageMessages(messages []string, pa *v1.PipelineActivity) {
+	for k, msg := range messages {
 		// Without this check, there is a panic in the codebase
 		// ToDo(@maintainers): Test case for this
-		if len(pa.Spec.Steps) > k1 {
-			pa.Spec.Steps[k1].Stage.Message = v1.ActivityMessageType(msg)
+		if len(pa.Spec.Steps) > k && pa.Spec.Steps[k].Stage != nil {
+			pa.Spec.Steps[k].Stage.Message = v1.ActivityMessageType(msg)
 		}
-		k1++
 	}
 }
 
@@ -8,12 +8,17 @@ import (
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
 	"github.com/jenkins-x-plugins/jx-pipeline/pkg/testpipelines"
 	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/yamls"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"knative.dev/pkg/apis"
 )
 
 const (
@@ -248,6 +253,51 @@ func TestPipelineBuildNumber(t *testing.T) {
 	}
 }
 
+func TestPipelineBuildNumberWithAllocator(t *testing.T) {
+	ctx := context.Background()
+	sr := &v1.SourceRepository{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jenkins-x-plugins-jx-pipeline",
+			Namespace: "jx",
+			Annotations: map[string]string{
+				"jenkins.io/last-build-number-for-master": "9",
+			},
+		},
+		Spec: v1.SourceRepositorySpec{
+			Org:  TestOrg,
+			Repo: PipelineRepo,
+		},
+	}
+	jxClient := jxfake.NewSimpleClientset(sr)
+	allocator := pipelines.NewSourceRepositoryBuildNumbers(jxClient, "jx")
+
+	pr := generatePipelineRunWithLabels("master", TestOrg, PipelineRepo, "16013832387908")
+	name, err := pipelines.ToPipelineActivityNameWithAllocator(ctx, pr, paList, allocator)
+	require.NoError(t, err)
+	assert.Equal(t, "jenkins-x-plugins-jx-pipeline-master-10", name, "should use the SourceRepository annotation")
+	assert.Equal(t, "10", pr.Labels["build"])
+
+	pr = generatePipelineRunWithLabels("pr-404", TestOrg, PipelineRepo, "16013832387909")
+	name, err = pipelines.ToPipelineActivityNameWithAllocator(ctx, pr, paList, allocator)
+	require.NoError(t, err)
+	assert.Equal(t, "jenkins-x-plugins-jx-pipeline-pr-404-2", name, "should seed the annotation from the existing activities")
+
+	pr = generatePipelineRunWithLabels("master", TestOrg, "jx-changelog", "1601383238724")
+	name, err = pipelines.ToPipelineActivityNameWithAllocator(ctx, pr, paList, allocator)
+	require.NoError(t, err)
+	assert.Equal(t, "jenkins-x-plugins-jx-changelog-master-50", name, "should reuse the existing activity")
+
+	pr = generatePipelineRunWithLabels("master", TestOrg, SecretRepo, "1601383238799")
+	name, err = pipelines.ToPipelineActivityNameWithAllocator(ctx, pr, paList, allocator)
+	require.NoError(t, err)
+	assert.Equal(t, "jenkins-x-plugins-jx-secret-master-5", name, "should fall back to scanning without a SourceRepository")
+
+	found, err := jxClient.JenkinsV1().SourceRepositories("jx").Get(ctx, sr.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "10", found.Annotations["jenkins.io/last-build-number-for-master"])
+	assert.Equal(t, "2", found.Annotations["jenkins.io/last-build-number-for-pr-404"])
+}
+
 func BenchmarkPipelineBuildNumber(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		pipelines.ToPipelineActivityName(generatePipelineRunWithLabels("master", TestOrg, "jx-test", "1601383238723"), paList)
@@ -381,3 +431,128 @@ func TestPipelineActivityMessage(t *testing.T) {
 		require.Equal(t, v.expectedMessage, pa.Spec.Message.String())
 	}
 }
+
+func TestPipelineActivityMatrixCustomRunsAndFinally(t *testing.T) {
+	ns := "jx"
+	now := metav1.Now()
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myrepo-1",
+			Namespace: ns,
+			Labels: map[string]string{
+				orgLabel:      TestOrg,
+				repoLabel:     "myrepo",
+				branchLabel:   "main",
+				buildNumLabel: "1",
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				PipelineSpec: &pipelinev1.PipelineSpec{
+					Tasks: []pipelinev1.PipelineTask{
+						{
+							Name: "build",
+							Matrix: &pipelinev1.Matrix{
+								Params: pipelinev1.Params{
+									{Name: "arch", Value: *pipelinev1.NewStructuredValues("amd64", "arm64")},
+								},
+							},
+						},
+						{Name: "approve", RunAfter: []string{"build"}},
+					},
+					Finally: []pipelinev1.PipelineTask{
+						{Name: "notify"},
+					},
+				},
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{Name: "myrepo-1-build-0", PipelineTaskName: "build"},
+					{Name: "myrepo-1-build-1", PipelineTaskName: "build"},
+					{
+						TypeMeta:         runtime.TypeMeta{APIVersion: "tekton.dev/v1beta1", Kind: pipelines.CustomRunKind},
+						Name:             "myrepo-1-approve",
+						PipelineTaskName: "approve",
+					},
+					{Name: "myrepo-1-notify", PipelineTaskName: "notify"},
+				},
+			},
+		},
+	}
+	taskRun := func(name, arch string) *pipelinev1.TaskRun {
+		tr := &pipelinev1.TaskRun{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels: map[string]string{
+					pipelines.PipelineRunLabel: pr.Name,
+				},
+			},
+			Status: pipelinev1.TaskRunStatus{
+				TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+					PodName: name + "-pod",
+					Steps: []pipelinev1.StepState{
+						{
+							Name: "make",
+							ContainerState: corev1.ContainerState{
+								Terminated: &corev1.ContainerStateTerminated{StartedAt: now, FinishedAt: now},
+							},
+						},
+					},
+				},
+			},
+		}
+		if arch != "" {
+			tr.Spec.Params = pipelinev1.Params{
+				{Name: "arch", Value: *pipelinev1.NewStructuredValues(arch)},
+			}
+		}
+		return tr
+	}
+	customRun := &pipelinev1beta1.CustomRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myrepo-1-approve",
+			Namespace: ns,
+		},
+	}
+	customRun.Status.StartTime = &now
+	customRun.Status.SetCondition(&apis.Condition{
+		Type:    apis.ConditionSucceeded,
+		Status:  corev1.ConditionFalse,
+		Reason:  pipelinev1beta1.CustomRunReasonTimedOut.String(),
+		Message: "CustomRun timed out waiting for approval",
+	})
+
+	tektonClient := tektonfake.NewSimpleClientset(
+		pr,
+		taskRun("myrepo-1-build-0", "amd64"),
+		taskRun("myrepo-1-build-1", "arm64"),
+		taskRun("myrepo-1-notify", ""),
+		customRun,
+	)
+	pa := &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-main-1",
+			Namespace: ns,
+		},
+	}
+	err := pipelines.ToPipelineActivity(tektonClient, pr, pa, false)
+	require.NoError(t, err)
+
+	var names []string
+	for _, step := range pa.Spec.Steps {
+		require.NotNil(t, step.Stage)
+		names = append(names, step.Stage.Name)
+	}
+	assert.Equal(t, []string{"build [arch=amd64]", "build [arch=arm64]", "approve", "notify"}, names)
+
+	approve := pa.Spec.Steps[2].Stage
+	assert.Equal(t, v1.ActivityStatusTypeTimedOut, approve.Status)
+	assert.Empty(t, approve.Steps, "a CustomRun has no steps")
+	assert.Equal(t, "Stage timed out waiting for approval", string(approve.Message))
+
+	graph, err := pipelines.GetStageGraph(pa)
+	require.NoError(t, err)
+	require.Len(t, graph, 3)
+	assert.Equal(t, []string{"build [arch=amd64]", "build [arch=arm64]"}, graph[0].Instances)
+	assert.Empty(t, graph[1].Instances)
+	assert.True(t, graph[2].Finally)
+}
@@ -0,0 +1,133 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"fmt"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+// ResultsAnnotation the annotation on a PipelineActivity holding the pipeline and task results as JSON
+const ResultsAnnotation = "pipeline.jenkins-x.io/results"
+
+// Result a named result of a pipeline or task
+type Result struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// StageResults the results of the TaskRun or CustomRun of a stage
+type StageResults struct {
+	// Stage the name of the stage in the PipelineActivity
+	Stage string `json:"stage"`
+
+	// Task the name of the pipeline task
+	Task string `json:"task"`
+
+	// Results the results of the task
+	Results []Result `json:"results"`
+}
+
+// Results the results of a pipeline and its tasks
+type Results struct {
+	// Pipeline the results of the pipeline
+	Pipeline []Result `json:"pipeline,omitempty"`
+
+	// Tasks the results of each stage with results
+	Tasks []StageResults `json:"tasks,omitempty"`
+}
+
+// IsEmpty returns true if there are no results
+func (r *Results) IsEmpty() bool {
+	return r == nil || (len(r.Pipeline) == 0 && len(r.Tasks) == 0)
+}
+
+// AddStage adds the results of a stage if there are any
+func (r *Results) AddStage(stageName, taskName string, results []Result) {
+	if len(results) == 0 {
+		return
+	}
+	r.Tasks = append(r.Tasks, StageResults{
+		Stage:   stageName,
+		Task:    taskName,
+		Results: results,
+	})
+}
+
+// ToPipelineRunResults returns the results of the PipelineRun
+func ToPipelineRunResults(pr *pipelinev1.PipelineRun) []Result {
+	var answer []Result
+	for _, r := range pr.Status.Results {
+		answer = append(answer, Result{Name: r.Name, Value: ResultValueString(r.Value.StringVal, r.Value.ArrayVal, r.Value.ObjectVal)})
+	}
+	return answer
+}
+
+// ToTaskRunResults returns the results of the TaskRun
+func ToTaskRunResults(tr *pipelinev1.TaskRun) []Result {
+	var answer []Result
+	for _, r := range tr.Status.Results {
+		answer = append(answer, Result{Name: r.Name, Value: ResultValueString(r.Value.StringVal, r.Value.ArrayVal, r.Value.ObjectVal)})
+	}
+	return answer
+}
+
+// ToCustomRunResults returns the results of the CustomRun
+func ToCustomRunResults(cr *pipelinev1beta1.CustomRun) []Result {
+	var answer []Result
+	for _, r := range cr.Status.Results {
+		answer = append(answer, Result{Name: r.Name, Value: r.Value})
+	}
+	return answer
+}
+
+// ResultValueString returns the string value of a result using JSON for array and object results
+func ResultValueString(stringVal string, arrayVal []string, objectVal map[string]string) string {
+	var value interface{}
+	switch {
+	case arrayVal != nil:
+		value = arrayVal
+	case objectVal != nil:
+		value = objectVal
+	default:
+		return stringVal
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return stringVal
+	}
+	return string(data)
+}
+
+// GetResults returns the results stored on the PipelineActivity or nil if there are none
+func GetResults(pa *v1.PipelineActivity) (*Results, error) {
+	text := pa.Annotations[ResultsAnnotation]
+	if text == "" {
+		return nil, nil
+	}
+	answer := &Results{}
+	err := json.Unmarshal([]byte(text), answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s on PipelineActivity %s: %w", ResultsAnnotation, pa.Name, err)
+	}
+	return answer, nil
+}
+
+// SetResults stores the results on the PipelineActivity
+func SetResults(pa *v1.PipelineActivity, results *Results) error {
+	if results.IsEmpty() {
+		delete(pa.Annotations, ResultsAnnotation)
+		return nil
+	}
+	data, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("failed to marshal results: %w", err)
+	}
+	if pa.Annotations == nil {
+		pa.Annotations = map[string]string{}
+	}
+	pa.Annotations[ResultsAnnotation] = string(data)
+	return nil
+}
@@ -0,0 +1,137 @@
+package pipelines
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+// StageGraphAnnotation the annotation on a PipelineActivity holding the dependencies between its stages as JSON
+const StageGraphAnnotation = "pipeline.jenkins-x.io/stage-graph"
+
+// StageNode the position of a stage within the task graph of the pipeline
+type StageNode struct {
+	// Name the name of the stage in the PipelineActivity
+	Name string `json:"name"`
+
+	// Task the name of the pipeline task
+	Task string `json:"task"`
+
+	// RunAfter the pipeline tasks which have to complete before this one either via runAfter or by using their results
+	RunAfter []string `json:"runAfter,omitempty"`
+
+	// Finally whether this is a finally task which runs once all the other tasks have completed
+	Finally bool `json:"finally,omitempty"`
+
+	// Skipped whether the task was skipped
+	Skipped bool `json:"skipped,omitempty"`
+
+	// SkipReason why the task was skipped
+	SkipReason string `json:"skipReason,omitempty"`
+
+	// When the when expressions which caused the task to be skipped
+	When []string `json:"when,omitempty"`
+
+	// Instances the names of the stages of a task which ran more than once such as a matrix fan-out
+	Instances []string `json:"instances,omitempty"`
+}
+
+// ToStageGraph returns the stage graph of the tasks of the PipelineRun
+func ToStageGraph(pr *pipelinev1.PipelineRun) []StageNode {
+	displayNames := map[string]string{}
+	for _, childReference := range pr.Status.ChildReferences {
+		if childReference.DisplayName != "" {
+			displayNames[childReference.PipelineTaskName] = childReference.DisplayName
+		}
+	}
+	skipped := map[string]*pipelinev1.SkippedTask{}
+	for i := range pr.Status.SkippedTasks {
+		st := &pr.Status.SkippedTasks[i]
+		skipped[st.Name] = st
+	}
+
+	var answer []StageNode
+	addTask := func(pt *pipelinev1.PipelineTask, finally bool) {
+		displayName := displayNames[pt.Name]
+		if displayName == "" && !strings.Contains(pt.DisplayName, "$(") {
+			displayName = pt.DisplayName
+		}
+		node := StageNode{
+			Name:    ToStageName(displayName, pt.Name),
+			Task:    pt.Name,
+			Finally: finally,
+		}
+		if deps := pt.Deps(); len(deps) > 0 {
+			node.RunAfter = deps
+		}
+		if st := skipped[pt.Name]; st != nil {
+			node.Skipped = true
+			node.SkipReason = string(st.Reason)
+			for _, w := range st.WhenExpressions {
+				node.When = append(node.When, fmt.Sprintf("%s %s %s", w.Input, w.Operator, strings.Join(w.Values, ",")))
+			}
+		}
+		answer = append(answer, node)
+	}
+
+	ps := GetPipelineSpec(pr)
+	if ps == nil {
+		// we don't know the pipeline so lets just use the tasks that have run
+		for _, childReference := range pr.Status.ChildReferences {
+			answer = append(answer, StageNode{
+				Name: ToStageName(childReference.DisplayName, childReference.PipelineTaskName),
+				Task: childReference.PipelineTaskName,
+			})
+		}
+		return answer
+	}
+	for i := range ps.Tasks {
+		addTask(&ps.Tasks[i], false)
+	}
+	for i := range ps.Finally {
+		addTask(&ps.Finally[i], true)
+	}
+	return answer
+}
+
+// ToStageName returns the stage name of a pipeline task in a PipelineActivity
+func ToStageName(displayName, pipelineTaskName string) string {
+	if displayName != "" {
+		return displayName
+	}
+	return strings.ReplaceAll(pipelineTaskName, "-", " ")
+}
+
+// GetStageGraph returns the stage graph stored on the PipelineActivity or nil if there is none
+func GetStageGraph(pa *v1.PipelineActivity) ([]StageNode, error) {
+	text := pa.Annotations[StageGraphAnnotation]
+	if text == "" {
+		return nil, nil
+	}
+	var answer []StageNode
+	err := json.Unmarshal([]byte(text), &answer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse annotation %s on PipelineActivity %s: %w", StageGraphAnnotation, pa.Name, err)
+	}
+	return answer, nil
+}
+
+// SetStageGraph stores the stage graph on the PipelineActivity
+func SetStageGraph(pa *v1.PipelineActivity, nodes []StageNode) error {
+	if len(nodes) == 0 {
+		delete(pa.Annotations, StageGraphAnnotation)
+		return nil
+	}
+	data, err := json.Marshal(nodes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stage graph: %w", err)
+	}
+	if pa.Annotations == nil {
+		pa.Annotations = map[string]string{}
+	}
+	pa.Annotations[StageGraphAnnotation] = string(data)
+	return nil
+}
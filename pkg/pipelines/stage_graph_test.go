@@ -0,0 +1,75 @@
+package pipelines_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+)
+
+func TestStageGraph(t *testing.T) {
+	pr := &pipelinev1.PipelineRun{
+		Spec: pipelinev1.PipelineRunSpec{
+			PipelineSpec: &pipelinev1.PipelineSpec{
+				Tasks: []pipelinev1.PipelineTask{
+					{Name: "clone"},
+					{Name: "build", RunAfter: []string{"clone"}},
+					{
+						Name:     "lint",
+						RunAfter: []string{"clone"},
+						When: pipelinev1.WhenExpressions{
+							{Input: "$(params.lint)", Operator: "in", Values: []string{"true"}},
+						},
+					},
+					{
+						Name:     "test",
+						RunAfter: []string{"build"},
+						Params: pipelinev1.Params{
+							{Name: "image", Value: *pipelinev1.NewStructuredValues("$(tasks.build.results.image)")},
+						},
+					},
+				},
+				Finally: []pipelinev1.PipelineTask{
+					{Name: "notify"},
+				},
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{PipelineTaskName: "clone", DisplayName: "Clone Sources"},
+				},
+				SkippedTasks: []pipelinev1.SkippedTask{
+					{
+						Name:   "lint",
+						Reason: pipelinev1.WhenExpressionsSkip,
+						WhenExpressions: pipelinev1.WhenExpressions{
+							{Input: "false", Operator: "in", Values: []string{"true"}},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	nodes := pipelines.ToStageGraph(pr)
+	expected := []pipelines.StageNode{
+		{Name: "Clone Sources", Task: "clone"},
+		{Name: "build", Task: "build", RunAfter: []string{"clone"}},
+		{Name: "lint", Task: "lint", RunAfter: []string{"clone"}, Skipped: true, SkipReason: string(pipelinev1.WhenExpressionsSkip), When: []string{"false in true"}},
+		{Name: "test", Task: "test", RunAfter: []string{"build"}},
+		{Name: "notify", Task: "notify", Finally: true},
+	}
+	assert.Equal(t, expected, nodes)
+
+	pa := &v1.PipelineActivity{}
+	err := pipelines.SetStageGraph(pa, nodes)
+	require.NoError(t, err, "failed to set stage graph")
+
+	actual, err := pipelines.GetStageGraph(pa)
+	require.NoError(t, err, "failed to get stage graph")
+	assert.Equal(t, expected, actual)
+}
@@ -0,0 +1,106 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// PipelineRunLabel the label Tekton adds to a TaskRun for the name of the PipelineRun which created it
+const PipelineRunLabel = "tekton.dev/pipelineRun"
+
+// TaskRunLoader loads the TaskRuns of a PipelineRun using a single List call rather than one Get per child reference
+type TaskRunLoader struct {
+	client     tektonversioned.Interface
+	namespace  string
+	apiVersion string
+	taskRuns   map[string]*pipelinev1.TaskRun
+}
+
+// NewTaskRunLoader lists the TaskRuns of the given PipelineRun
+func NewTaskRunLoader(ctx context.Context, tektonclient tektonversioned.Interface, ns string, pr *pipelinev1.PipelineRun) (*TaskRunLoader, error) {
+	l := &TaskRunLoader{
+		client:     tektonclient,
+		namespace:  ns,
+		apiVersion: ServedAPIVersion(tektonclient),
+		taskRuns:   map[string]*pipelinev1.TaskRun{},
+	}
+	// names which are not valid label values (e.g. longer than 63 characters) fall back to loading each TaskRun
+	if len(pr.Status.ChildReferences) == 0 || len(validation.IsValidLabelValue(pr.Name)) > 0 {
+		return l, nil
+	}
+	list, err := ListTaskRuns(ctx, tektonclient, ns, l.apiVersion, metav1.ListOptions{
+		LabelSelector: PipelineRunLabel + "=" + pr.Name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TaskRuns for PipelineRun %s in namespace %s: %w", pr.Name, ns, err)
+	}
+	for i := range list.Items {
+		tr := &list.Items[i]
+		l.taskRuns[tr.Name] = tr
+	}
+	return l, nil
+}
+
+// Get returns the TaskRun of the given name. If it was not returned by the List (e.g. the TaskRun is missing the label)
+// it is loaded individually
+func (l *TaskRunLoader) Get(ctx context.Context, name string) (*pipelinev1.TaskRun, error) {
+	tr := l.taskRuns[name]
+	if tr != nil {
+		return tr, nil
+	}
+	tr, err := GetTaskRun(ctx, l.client, l.namespace, l.apiVersion, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get TaskRun %s in namespace %s: %w", name, l.namespace, err)
+	}
+	l.taskRuns[name] = tr
+	return tr, nil
+}
+
+// StagePodNames returns the names of the pods which ran each stage of the PipelineRun indexed by stage name
+func StagePodNames(ctx context.Context, tektonclient tektonversioned.Interface, ns string, pr *pipelinev1.PipelineRun) (map[string]string, error) {
+	taskRuns, _, err := StageTaskRuns(ctx, tektonclient, ns, pr)
+	if err != nil {
+		return nil, err
+	}
+	answer := map[string]string{}
+	for stageName, tr := range taskRuns {
+		if tr.Status.PodName != "" {
+			answer[stageName] = tr.Status.PodName
+		}
+	}
+	return answer, nil
+}
+
+// StageTaskRuns returns the TaskRuns of the PipelineRun indexed by stage name along with the names of the stages
+// whose TaskRun no longer exists
+func StageTaskRuns(ctx context.Context, tektonclient tektonversioned.Interface, ns string, pr *pipelinev1.PipelineRun) (map[string]*pipelinev1.TaskRun, []string, error) {
+	taskRuns, err := NewTaskRunLoader(ctx, tektonclient, ns, pr)
+	if err != nil {
+		return nil, nil, err
+	}
+	namer := NewChildStageNamer(pr)
+	answer := map[string]*pipelinev1.TaskRun{}
+	var missing []string
+	for i := range pr.Status.ChildReferences {
+		childReference := &pr.Status.ChildReferences[i]
+		if IsCustomRun(childReference) {
+			continue
+		}
+		tr, err := taskRuns.Get(ctx, childReference.Name)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				missing = append(missing, namer.StageName(childReference, nil))
+				continue
+			}
+			return nil, nil, err
+		}
+		answer[namer.StageName(childReference, TaskRunParams(tr))] = tr
+	}
+	return answer, missing, nil
+}
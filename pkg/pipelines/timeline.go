@@ -0,0 +1,196 @@
+package pipelines
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+)
+
+// TimelineStep the start and finish times of a step of a task
+type TimelineStep struct {
+	// Name the name of the step
+	Name string
+
+	// Started when the step started or zero if it has not started yet
+	Started time.Time
+
+	// Completed when the step finished or zero if it has not finished yet
+	Completed time.Time
+}
+
+// TimelineTask the times of a TaskRun or CustomRun of a pipeline
+type TimelineTask struct {
+	// Stage the name of the stage in the PipelineActivity
+	Stage string
+
+	// Task the name of the pipeline task
+	Task string
+
+	// Created when the TaskRun was created
+	Created time.Time
+
+	// Started when the first step started running or zero if the pod has not started yet. The time between Created
+	// and Started is the time spent waiting for the pod to be scheduled
+	Started time.Time
+
+	// Completed when the task finished or zero if it is still running
+	Completed time.Time
+
+	// Steps the steps of the task
+	Steps []TimelineStep
+}
+
+// Timeline the times of the tasks and steps of the PipelineRuns of a build
+type Timeline struct {
+	// Started when the first PipelineRun started
+	Started time.Time
+
+	// Completed when the last PipelineRun completed or zero if any are still running
+	Completed time.Time
+
+	// Tasks the tasks ordered by when they were created
+	Tasks []TimelineTask
+}
+
+// End returns when the timeline completed or now if it is still running
+func (t *Timeline) End(now time.Time) time.Time {
+	if t.Completed.IsZero() {
+		return now
+	}
+	return t.Completed
+}
+
+// QueueEnd returns when the task stopped waiting for its pod to be scheduled
+func (t *TimelineTask) QueueEnd(now time.Time) time.Time {
+	if !t.Started.IsZero() {
+		return t.Started
+	}
+	if !t.Completed.IsZero() {
+		return t.Completed
+	}
+	return now
+}
+
+// End returns when the task completed or now if it is still running
+func (t *TimelineTask) End(now time.Time) time.Time {
+	if t.Completed.IsZero() {
+		return now
+	}
+	return t.Completed
+}
+
+// LoadTimeline loads the TaskRuns and CustomRuns of the PipelineRuns to create the timeline of a build
+func LoadTimeline(ctx context.Context, tektonclient tektonversioned.Interface, ns string, prList []*pipelinev1.PipelineRun) (*Timeline, error) {
+	timeline := &Timeline{}
+	running := false
+	for _, pr := range prList {
+		started := pr.CreationTimestamp.Time
+		if pr.Status.StartTime != nil {
+			started = pr.Status.StartTime.Time
+		}
+		if timeline.Started.IsZero() || (!started.IsZero() && started.Before(timeline.Started)) {
+			timeline.Started = started
+		}
+		if pr.Status.CompletionTime == nil {
+			running = true
+		} else if pr.Status.CompletionTime.After(timeline.Completed) {
+			timeline.Completed = pr.Status.CompletionTime.Time
+		}
+
+		taskRuns, err := NewTaskRunLoader(ctx, tektonclient, ns, pr)
+		if err != nil {
+			return nil, err
+		}
+		namer := NewChildStageNamer(pr)
+		for i := range pr.Status.ChildReferences {
+			childReference := &pr.Status.ChildReferences[i]
+			if IsCustomRun(childReference) {
+				cr, err := taskRuns.GetCustomRun(ctx, childReference.Name)
+				if err != nil {
+					return nil, err
+				}
+				stageName := namer.StageName(childReference, CustomRunParams(cr))
+				timeline.Tasks = append(timeline.Tasks, ToCustomRunTimelineTask(stageName, childReference.PipelineTaskName, cr))
+				continue
+			}
+			tr, err := taskRuns.Get(ctx, childReference.Name)
+			if err != nil {
+				return nil, err
+			}
+			stageName := namer.StageName(childReference, TaskRunParams(tr))
+			timeline.Tasks = append(timeline.Tasks, ToTimelineTask(stageName, childReference.PipelineTaskName, tr))
+		}
+	}
+	if running {
+		timeline.Completed = time.Time{}
+	}
+	sort.SliceStable(timeline.Tasks, func(i, j int) bool {
+		return timeline.Tasks[i].Created.Before(timeline.Tasks[j].Created)
+	})
+	return timeline, nil
+}
+
+// ToTimelineTask returns the times of the TaskRun and its steps using the step states
+func ToTimelineTask(stageName, taskName string, tr *pipelinev1.TaskRun) TimelineTask {
+	task := TimelineTask{
+		Stage:   stageName,
+		Task:    taskName,
+		Created: tr.CreationTimestamp.Time,
+	}
+	if task.Created.IsZero() && tr.Status.StartTime != nil {
+		task.Created = tr.Status.StartTime.Time
+	}
+	if tr.Status.CompletionTime != nil {
+		task.Completed = tr.Status.CompletionTime.Time
+	}
+
+	// the containers of later steps report as running while they wait for the previous step to finish so
+	// lets only trust the running start time of the first step or one following a terminated step
+	previousStepTerminated := true
+	for i := range tr.Status.Steps {
+		state := &tr.Status.Steps[i]
+		step := TimelineStep{
+			Name: state.Name,
+		}
+		if terminated := state.Terminated; terminated != nil {
+			step.Started = terminated.StartedAt.Time
+			step.Completed = terminated.FinishedAt.Time
+			previousStepTerminated = true
+		} else if state.Running != nil {
+			if previousStepTerminated {
+				step.Started = state.Running.StartedAt.Time
+			}
+			previousStepTerminated = false
+		} else {
+			previousStepTerminated = false
+		}
+		if !step.Started.IsZero() && (task.Started.IsZero() || step.Started.Before(task.Started)) {
+			task.Started = step.Started
+		}
+		task.Steps = append(task.Steps, step)
+	}
+	return task
+}
+
+// ToCustomRunTimelineTask returns the times of the CustomRun which has no pod or steps
+func ToCustomRunTimelineTask(stageName, taskName string, cr *pipelinev1beta1.CustomRun) TimelineTask {
+	task := TimelineTask{
+		Stage:   stageName,
+		Task:    taskName,
+		Created: cr.CreationTimestamp.Time,
+	}
+	if cr.Status.StartTime != nil {
+		task.Started = cr.Status.StartTime.Time
+		if task.Created.IsZero() {
+			task.Created = task.Started
+		}
+	}
+	if cr.Status.CompletionTime != nil {
+		task.Completed = cr.Status.CompletionTime.Time
+	}
+	return task
+}
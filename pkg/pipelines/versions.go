@@ -0,0 +1,199 @@
+package pipelines
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonversioned "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	// TektonAPIVersionV1 the v1 API version of Tekton
+	TektonAPIVersionV1 = "tekton.dev/v1"
+
+	// TektonAPIVersionV1beta1 the v1beta1 API version of Tekton used by older Tekton releases
+	TektonAPIVersionV1beta1 = "tekton.dev/v1beta1"
+)
+
+var servedAPIVersions sync.Map
+
+// ServedAPIVersion returns the Tekton API version served for PipelineRuns by the cluster of the client.
+// If the cluster does not serve v1 but serves v1beta1 then v1beta1 is returned; otherwise v1 is assumed.
+// The result is cached for each client
+func ServedAPIVersion(tektonclient tektonversioned.Interface) string {
+	if tektonclient == nil {
+		return TektonAPIVersionV1
+	}
+	if value, ok := servedAPIVersions.Load(tektonclient); ok {
+		return value.(string)
+	}
+	answer := DiscoverAPIVersion(tektonclient.Discovery())
+	servedAPIVersions.Store(tektonclient, answer)
+	return answer
+}
+
+// DiscoverAPIVersion uses discovery to find the Tekton API version served for PipelineRuns
+func DiscoverAPIVersion(client discovery.DiscoveryInterface) string {
+	if client == nil || servesPipelineRuns(client, TektonAPIVersionV1) {
+		return TektonAPIVersionV1
+	}
+	if servesPipelineRuns(client, TektonAPIVersionV1beta1) {
+		return TektonAPIVersionV1beta1
+	}
+	return TektonAPIVersionV1
+}
+
+func servesPipelineRuns(client discovery.DiscoveryInterface, groupVersion string) bool {
+	resources, err := client.ServerResourcesForGroupVersion(groupVersion)
+	if err != nil || resources == nil {
+		return false
+	}
+	for i := range resources.APIResources {
+		if resources.APIResources[i].Name == "pipelineruns" {
+			return true
+		}
+	}
+	return false
+}
+
+// IsV1beta1 returns true if the API version is v1beta1
+func IsV1beta1(apiVersion string) bool {
+	return apiVersion == TektonAPIVersionV1beta1
+}
+
+// ListPipelineRuns lists the PipelineRuns using the given API version converting them to v1
+func ListPipelineRuns(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion string, opts metav1.ListOptions) (*pipelinev1.PipelineRunList, error) {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().PipelineRuns(ns).List(ctx, opts)
+	}
+	list, err := tektonclient.TektonV1beta1().PipelineRuns(ns).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	answer := &pipelinev1.PipelineRunList{
+		ListMeta: list.ListMeta,
+	}
+	for i := range list.Items {
+		pr, err := ToV1PipelineRun(ctx, &list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		answer.Items = append(answer.Items, *pr)
+	}
+	return answer, nil
+}
+
+// ListTaskRuns lists the TaskRuns using the given API version converting them to v1
+func ListTaskRuns(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion string, opts metav1.ListOptions) (*pipelinev1.TaskRunList, error) {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().TaskRuns(ns).List(ctx, opts)
+	}
+	list, err := tektonclient.TektonV1beta1().TaskRuns(ns).List(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	answer := &pipelinev1.TaskRunList{
+		ListMeta: list.ListMeta,
+	}
+	for i := range list.Items {
+		tr, err := ToV1TaskRun(ctx, &list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		answer.Items = append(answer.Items, *tr)
+	}
+	return answer, nil
+}
+
+// GetTaskRun gets the TaskRun using the given API version converting it to v1
+func GetTaskRun(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion, name string) (*pipelinev1.TaskRun, error) {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().TaskRuns(ns).Get(ctx, name, metav1.GetOptions{})
+	}
+	tr, err := tektonclient.TektonV1beta1().TaskRuns(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ToV1TaskRun(ctx, tr)
+}
+
+// DeletePipelineRun deletes the PipelineRun using the given API version
+func DeletePipelineRun(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion, name string) error {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().PipelineRuns(ns).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	return tektonclient.TektonV1beta1().PipelineRuns(ns).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// DeleteTaskRun deletes the TaskRun using the given API version
+func DeleteTaskRun(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion, name string) error {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().TaskRuns(ns).Delete(ctx, name, metav1.DeleteOptions{})
+	}
+	return tektonclient.TektonV1beta1().TaskRuns(ns).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+// GetPipeline gets the Pipeline using the given API version converting it to v1
+func GetPipeline(ctx context.Context, tektonclient tektonversioned.Interface, ns, apiVersion, name string) (*pipelinev1.Pipeline, error) {
+	if !IsV1beta1(apiVersion) {
+		return tektonclient.TektonV1().Pipelines(ns).Get(ctx, name, metav1.GetOptions{})
+	}
+	p, err := tektonclient.TektonV1beta1().Pipelines(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ToV1Pipeline(ctx, p)
+}
+
+// ToV1PipelineRun converts the v1beta1 PipelineRun to v1
+func ToV1PipelineRun(ctx context.Context, from *pipelinev1beta1.PipelineRun) (*pipelinev1.PipelineRun, error) {
+	to := &pipelinev1.PipelineRun{}
+	err := from.ConvertTo(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert PipelineRun %s to %s: %w", from.Name, TektonAPIVersionV1, err)
+	}
+	to.APIVersion = TektonAPIVersionV1
+	to.Kind = "PipelineRun"
+	return to, nil
+}
+
+// ToV1TaskRun converts the v1beta1 TaskRun to v1
+func ToV1TaskRun(ctx context.Context, from *pipelinev1beta1.TaskRun) (*pipelinev1.TaskRun, error) {
+	to := &pipelinev1.TaskRun{}
+	err := from.ConvertTo(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert TaskRun %s to %s: %w", from.Name, TektonAPIVersionV1, err)
+	}
+	to.APIVersion = TektonAPIVersionV1
+	to.Kind = "TaskRun"
+	return to, nil
+}
+
+// ToV1Pipeline converts the v1beta1 Pipeline to v1
+func ToV1Pipeline(ctx context.Context, from *pipelinev1beta1.Pipeline) (*pipelinev1.Pipeline, error) {
+	to := &pipelinev1.Pipeline{}
+	err := from.ConvertTo(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert Pipeline %s to %s: %w", from.Name, TektonAPIVersionV1, err)
+	}
+	to.APIVersion = TektonAPIVersionV1
+	to.Kind = "Pipeline"
+	return to, nil
+}
+
+// ToV1Task converts the v1beta1 Task to v1
+func ToV1Task(ctx context.Context, from *pipelinev1beta1.Task) (*pipelinev1.Task, error) {
+	to := &pipelinev1.Task{}
+	err := from.ConvertTo(ctx, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert Task %s to %s: %w", from.Name, TektonAPIVersionV1, err)
+	}
+	to.APIVersion = TektonAPIVersionV1
+	to.Kind = "Task"
+	return to, nil
+}
@@ -0,0 +1,117 @@
+package pipelines_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"sigs.k8s.io/yaml"
+)
+
+func TestDiscoverAPIVersion(t *testing.T) {
+	testCases := []struct {
+		name     string
+		served   []string
+		expected string
+	}{
+		{name: "v1", served: []string{"tekton.dev/v1", "tekton.dev/v1beta1"}, expected: pipelines.TektonAPIVersionV1},
+		{name: "v1beta1", served: []string{"tekton.dev/v1beta1"}, expected: pipelines.TektonAPIVersionV1beta1},
+		{name: "none", expected: pipelines.TektonAPIVersionV1},
+	}
+	for _, tc := range testCases {
+		client := tektonfake.NewSimpleClientset()
+		fd, ok := client.Discovery().(*fakediscovery.FakeDiscovery)
+		require.True(t, ok)
+		for _, gv := range tc.served {
+			fd.Resources = append(fd.Resources, &metav1.APIResourceList{
+				GroupVersion: gv,
+				APIResources: []metav1.APIResource{{Name: "pipelineruns", Kind: "PipelineRun"}},
+			})
+		}
+		assert.Equal(t, tc.expected, pipelines.DiscoverAPIVersion(fd), "for %s", tc.name)
+	}
+}
+
+func TestListV1beta1PipelineRuns(t *testing.T) {
+	ctx := context.Background()
+	ns := "jx"
+	client := tektonfake.NewSimpleClientset(
+		&pipelinev1beta1.PipelineRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-a-1", Namespace: ns},
+			Spec: pipelinev1beta1.PipelineRunSpec{
+				PipelineSpec: &pipelinev1beta1.PipelineSpec{
+					Tasks: []pipelinev1beta1.PipelineTask{{Name: "build"}},
+				},
+			},
+		},
+		&pipelinev1beta1.TaskRun{
+			ObjectMeta: metav1.ObjectMeta{Name: "repo-a-1-build", Namespace: ns},
+		},
+	)
+
+	prs, err := pipelines.ListPipelineRuns(ctx, client, ns, pipelines.TektonAPIVersionV1beta1, metav1.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, prs.Items, 1)
+	pr := prs.Items[0]
+	assert.Equal(t, pipelines.TektonAPIVersionV1, pr.APIVersion)
+	assert.Equal(t, "repo-a-1", pr.Name)
+	require.NotNil(t, pr.Spec.PipelineSpec)
+	require.Len(t, pr.Spec.PipelineSpec.Tasks, 1)
+	assert.Equal(t, "build", pr.Spec.PipelineSpec.Tasks[0].Name)
+
+	tr, err := pipelines.GetTaskRun(ctx, client, ns, pipelines.TektonAPIVersionV1beta1, "repo-a-1-build")
+	require.NoError(t, err)
+	assert.Equal(t, pipelines.TektonAPIVersionV1, tr.APIVersion)
+	assert.Equal(t, "repo-a-1-build", tr.Name)
+}
+
+func TestConvertV1beta1YAML(t *testing.T) {
+	ctx := context.Background()
+	source := `apiVersion: tekton.dev/v1beta1
+kind: PipelineRun
+metadata:
+  name: release
+spec:
+  timeout: 1h0m0s
+  pipelineSpec:
+    tasks:
+    - name: build
+      taskRef:
+        kind: ClusterTask
+        name: build
+`
+	data, warnings, err := pipelines.ConvertV1beta1YAML(ctx, []byte(source))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"spec.timeout is deprecated: use spec.timeouts.pipeline instead",
+		"spec.pipelineSpec.tasks[0].taskRef refers to a ClusterTask which is deprecated: use the cluster resolver instead",
+	}, warnings)
+
+	pr := &pipelinev1.PipelineRun{}
+	err = yaml.Unmarshal(data, pr)
+	require.NoError(t, err)
+	assert.Equal(t, pipelines.TektonAPIVersionV1, pr.APIVersion)
+	assert.Equal(t, "PipelineRun", pr.Kind)
+	require.NotNil(t, pr.Spec.Timeouts)
+	require.NotNil(t, pr.Spec.Timeouts.Pipeline)
+	assert.Equal(t, "1h0m0s", pr.Spec.Timeouts.Pipeline.Duration.String())
+
+	v1Source := "apiVersion: tekton.dev/v1\nkind: PipelineRun\nmetadata:\n  name: release\n"
+	data, warnings, err = pipelines.ConvertV1beta1YAML(ctx, []byte(v1Source))
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, v1Source, string(data), "v1 resources should be unchanged")
+
+	noKindSource := "spec:\n  pipelineSpec:\n    tasks: []\n"
+	data, warnings, err = pipelines.ConvertV1beta1YAML(ctx, []byte(noKindSource))
+	require.NoError(t, err, "documents without a kind should not fail")
+	assert.Empty(t, warnings)
+	assert.Equal(t, noKindSource, string(data), "documents without a kind should be unchanged")
+}
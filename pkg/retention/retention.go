@@ -0,0 +1,162 @@
+package retention
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+)
+
+const (
+	// ReasonRunning the activity is kept as it has not completed yet
+	ReasonRunning = "running"
+
+	// ReasonLatest the activity is kept as it is one of the latest builds of its branch
+	ReasonLatest = "latest"
+
+	// ReasonRecent the activity is kept as it is younger than the keep duration
+	ReasonRecent = "recent"
+
+	// ReasonLastSuccess the activity is kept as it is the last successful build of its branch
+	ReasonLastSuccess = "last success"
+
+	// ReasonExpired the activity is deleted as it is not kept by any of the policies
+	ReasonExpired = "expired"
+
+	// ReasonClosedPullRequest the activity is deleted as its pull request is closed
+	ReasonClosedPullRequest = "closed pull request"
+
+	// ReasonOrphaned the PipelineRun or TaskRun is deleted as it has no PipelineActivity
+	ReasonOrphaned = "orphaned"
+)
+
+// Policy the retention policy of the PipelineActivity resources of each repository and branch
+type Policy struct {
+	// KeepLast the number of the latest builds of each repository and branch to keep
+	KeepLast int
+
+	// KeepFor the minimum duration to keep a build since it started
+	KeepFor time.Duration
+
+	// KeepLastSuccess always keep the last successful build of each repository and branch
+	KeepLastSuccess bool
+
+	// ClosedPRKeepFor the duration to keep builds of pull requests which are closed instead of KeepLast and KeepFor.
+	// KeepLastSuccess still applies to closed pull requests. Zero disables this policy
+	ClosedPRKeepFor time.Duration
+
+	// IsClosedPullRequest returns true if the pull request of the activity is closed. It is only invoked for
+	// pull request branches when ClosedPRKeepFor is specified
+	IsClosedPullRequest func(pa *v1.PipelineActivity) (bool, error)
+}
+
+// Decision whether to delete an activity and why
+type Decision struct {
+	Activity *v1.PipelineActivity
+	Delete   bool
+	Reason   string
+}
+
+// Select decides which of the activities to delete using the policy
+func Select(activities []v1.PipelineActivity, policy *Policy, now time.Time) ([]Decision, error) {
+	groups := map[string][]*v1.PipelineActivity{}
+	var keys []string
+	for i := range activities {
+		pa := &activities[i]
+		key := GroupKey(pa)
+		if groups[key] == nil {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], pa)
+	}
+	sort.Strings(keys)
+
+	var answer []Decision
+	for _, key := range keys {
+		decisions, err := selectGroup(groups[key], policy, now)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, decisions...)
+	}
+	return answer, nil
+}
+
+func selectGroup(group []*v1.PipelineActivity, policy *Policy, now time.Time) ([]Decision, error) {
+	sort.SliceStable(group, func(i, j int) bool {
+		return newer(group[i], group[j])
+	})
+
+	closed := false
+	if policy.ClosedPRKeepFor > 0 && policy.IsClosedPullRequest != nil && scmclients.IsPullRequest(group[0]) {
+		var err error
+		closed, err = policy.IsClosedPullRequest(group[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	lastSuccess := -1
+	for i, pa := range group {
+		if pa.Spec.Status == v1.ActivityStatusTypeSucceeded {
+			lastSuccess = i
+			break
+		}
+	}
+
+	var answer []Decision
+	for i, pa := range group {
+		d := Decision{Activity: pa}
+		age := now.Sub(startTime(pa))
+		switch {
+		case !pa.Spec.Status.IsTerminated():
+			d.Reason = ReasonRunning
+		case closed && age < policy.ClosedPRKeepFor:
+			d.Reason = ReasonRecent
+		case closed && policy.KeepLastSuccess && i == lastSuccess:
+			d.Reason = ReasonLastSuccess
+		case closed:
+			d.Delete = true
+			d.Reason = ReasonClosedPullRequest
+		case i < policy.KeepLast:
+			d.Reason = ReasonLatest
+		case age < policy.KeepFor:
+			d.Reason = ReasonRecent
+		case policy.KeepLastSuccess && i == lastSuccess:
+			d.Reason = ReasonLastSuccess
+		default:
+			d.Delete = true
+			d.Reason = ReasonExpired
+		}
+		answer = append(answer, d)
+	}
+	return answer, nil
+}
+
+// GroupKey returns the repository and branch of the activity which the policies are applied to
+func GroupKey(pa *v1.PipelineActivity) string {
+	ps := &pa.Spec
+	if ps.GitRepository == "" {
+		return ps.Pipeline
+	}
+	return ps.GitOwner + "/" + ps.GitRepository + "/" + ps.GitBranch
+}
+
+// newer returns true if a is a later build than b using the build number falling back to the start time
+func newer(a, b *v1.PipelineActivity) bool {
+	an, aerr := strconv.Atoi(a.Spec.Build)
+	bn, berr := strconv.Atoi(b.Spec.Build)
+	if aerr == nil && berr == nil && an != bn {
+		return an > bn
+	}
+	return startTime(a).After(startTime(b))
+}
+
+func startTime(pa *v1.PipelineActivity) time.Time {
+	if pa.Spec.StartedTimestamp != nil {
+		return pa.Spec.StartedTimestamp.Time
+	}
+	return pa.CreationTimestamp.Time
+}
@@ -0,0 +1,152 @@
+//go:build unit
+// +build unit
+
+package retention_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/retention"
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelect(t *testing.T) {
+	now := time.Date(2024, 1, 20, 10, 0, 0, 0, time.UTC)
+	newActivity := func(branch string, build int, status v1.ActivityStatusType, daysAgo int) v1.PipelineActivity {
+		started := metav1.NewTime(now.Add(-time.Duration(daysAgo) * 24 * time.Hour))
+		return v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "myorg-cheese-" + branch + "-" + strconv.Itoa(build),
+			},
+			Spec: v1.PipelineActivitySpec{
+				GitOwner:         "myorg",
+				GitRepository:    "cheese",
+				GitBranch:        branch,
+				Build:            strconv.Itoa(build),
+				Status:           status,
+				StartedTimestamp: &started,
+			},
+		}
+	}
+
+	activities := []v1.PipelineActivity{
+		newActivity("main", 1, v1.ActivityStatusTypeSucceeded, 10),
+		newActivity("main", 2, v1.ActivityStatusTypeFailed, 9),
+		newActivity("main", 3, v1.ActivityStatusTypeRunning, 8),
+		newActivity("main", 4, v1.ActivityStatusTypeFailed, 7),
+		newActivity("main", 5, v1.ActivityStatusTypeFailed, 1),
+		newActivity("PR-1", 1, v1.ActivityStatusTypeSucceeded, 3),
+		newActivity("PR-1", 2, v1.ActivityStatusTypeSucceeded, 1),
+		newActivity("PR-2", 1, v1.ActivityStatusTypeSucceeded, 3),
+	}
+	var checked []int
+	policy := &retention.Policy{
+		KeepLast:        1,
+		KeepFor:         2 * 24 * time.Hour,
+		KeepLastSuccess: true,
+		ClosedPRKeepFor: 2 * 24 * time.Hour,
+		IsClosedPullRequest: func(pa *v1.PipelineActivity) (bool, error) {
+			number := scmclients.PullRequestNumber(pa)
+			checked = append(checked, number)
+			return number == 1, nil
+		},
+	}
+
+	decisions, err := retention.Select(activities, policy, now)
+	require.NoError(t, err)
+	require.Len(t, decisions, len(activities))
+
+	reasons := map[string]string{}
+	for _, d := range decisions {
+		reason := d.Reason
+		if d.Delete {
+			reason = "delete " + reason
+		}
+		reasons[d.Activity.Name] = reason
+	}
+	assert.Equal(t, map[string]string{
+		"myorg-cheese-main-1": retention.ReasonLastSuccess,
+		"myorg-cheese-main-2": "delete " + retention.ReasonExpired,
+		"myorg-cheese-main-3": retention.ReasonRunning,
+		"myorg-cheese-main-4": "delete " + retention.ReasonExpired,
+		"myorg-cheese-main-5": retention.ReasonLatest,
+		"myorg-cheese-PR-1-1": "delete " + retention.ReasonClosedPullRequest,
+		"myorg-cheese-PR-1-2": retention.ReasonRecent,
+		"myorg-cheese-PR-2-1": retention.ReasonLatest,
+	}, reasons)
+	assert.ElementsMatch(t, []int{1, 2}, checked, "should check each pull request once")
+
+	policy.KeepLastSuccess = false
+	policy.ClosedPRKeepFor = 0
+	decisions, err = retention.Select(activities, policy, now)
+	require.NoError(t, err)
+	for _, d := range decisions {
+		if d.Activity.Name == "myorg-cheese-main-1" {
+			assert.True(t, d.Delete, "should delete the last success when not kept")
+		}
+		if d.Activity.Name == "myorg-cheese-PR-1-1" {
+			assert.Equal(t, retention.ReasonExpired, d.Reason)
+		}
+	}
+}
+
+func TestSelectClosedPullRequestKeepsLastSuccess(t *testing.T) {
+	now := time.Date(2024, 1, 20, 10, 0, 0, 0, time.UTC)
+	newActivity := func(build int, status v1.ActivityStatusType, daysAgo int) v1.PipelineActivity {
+		started := metav1.NewTime(now.Add(-time.Duration(daysAgo) * 24 * time.Hour))
+		return v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "myorg-cheese-PR-3-" + strconv.Itoa(build),
+			},
+			Spec: v1.PipelineActivitySpec{
+				GitOwner:         "myorg",
+				GitRepository:    "cheese",
+				GitBranch:        "PR-3",
+				Build:            strconv.Itoa(build),
+				Status:           status,
+				StartedTimestamp: &started,
+			},
+		}
+	}
+	activities := []v1.PipelineActivity{
+		newActivity(1, v1.ActivityStatusTypeSucceeded, 6),
+		newActivity(2, v1.ActivityStatusTypeSucceeded, 5),
+		newActivity(3, v1.ActivityStatusTypeFailed, 4),
+	}
+	policy := &retention.Policy{
+		KeepLastSuccess: true,
+		ClosedPRKeepFor: 24 * time.Hour,
+		IsClosedPullRequest: func(_ *v1.PipelineActivity) (bool, error) {
+			return true, nil
+		},
+	}
+
+	decisions, err := retention.Select(activities, policy, now)
+	require.NoError(t, err)
+	reasons := map[string]string{}
+	for _, d := range decisions {
+		reason := d.Reason
+		if d.Delete {
+			reason = "delete " + reason
+		}
+		reasons[d.Activity.Name] = reason
+	}
+	assert.Equal(t, map[string]string{
+		"myorg-cheese-PR-3-1": "delete " + retention.ReasonClosedPullRequest,
+		"myorg-cheese-PR-3-2": retention.ReasonLastSuccess,
+		"myorg-cheese-PR-3-3": "delete " + retention.ReasonClosedPullRequest,
+	}, reasons)
+
+	policy.KeepLastSuccess = false
+	decisions, err = retention.Select(activities, policy, now)
+	require.NoError(t, err)
+	for _, d := range decisions {
+		assert.True(t, d.Delete, "should delete %s when the last success is not kept", d.Activity.Name)
+	}
+}
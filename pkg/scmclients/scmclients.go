@@ -0,0 +1,136 @@
+package scmclients
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/giturl"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/scmhelpers"
+	"github.com/jenkins-x/jx-logging/v3/pkg/log"
+)
+
+// IsPullRequest returns true if the activity is a build of a pull request
+func IsPullRequest(pa *v1.PipelineActivity) bool {
+	return strings.HasPrefix(strings.ToUpper(pa.Spec.GitBranch), "PR-")
+}
+
+// PullRequestNumber returns the pull request number of the branch of the activity or zero if it is not a pull
+// request build
+func PullRequestNumber(pa *v1.PipelineActivity) int {
+	if !IsPullRequest(pa) {
+		return 0
+	}
+	n, err := strconv.Atoi(pa.Spec.GitBranch[3:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// GitServerURL returns the URL of the git server of the activity defaulting to GitHub
+func GitServerURL(pa *v1.PipelineActivity) (string, error) {
+	if pa.Spec.GitURL == "" {
+		return giturl.GitHubURL, nil
+	}
+	gitInfo, err := giturl.ParseGitURL(pa.Spec.GitURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse git URL %s of PipelineActivity %s: %w", pa.Spec.GitURL, pa.Name, err)
+	}
+	return gitInfo.HostURL(), nil
+}
+
+// ScmClient returns the Scm Client for the git server of the activity from the clients cache creating it if required.
+// The cache is not locked so callers must synchronize concurrent access
+func ScmClient(clients map[string]*scm.Client, gitUsername, gitToken string, pa *v1.PipelineActivity) (*scm.Client, error) {
+	gitServerURL, err := GitServerURL(pa)
+	if err != nil {
+		return nil, err
+	}
+	scmClient := clients[gitServerURL]
+	if scmClient != nil {
+		return scmClient, nil
+	}
+	f := scmhelpers.Factory{
+		GitServerURL: gitServerURL,
+		GitUsername:  gitUsername,
+		GitToken:     gitToken,
+		GitKind:      giturl.SaasGitKind(gitServerURL),
+	}
+	scmClient, err = f.Create()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create an ScmClient for %s: %w", gitServerURL, err)
+	}
+	clients[gitServerURL] = scmClient
+	return scmClient, nil
+}
+
+// FindPullRequest returns the pull request of the commit of the activity falling back to the pull request number of
+// its branch. Returns nil if there is no pull request
+func FindPullRequest(ctx context.Context, scmClient *scm.Client, pa *v1.PipelineActivity) (*scm.PullRequest, error) {
+	ps := &pa.Spec
+	fullName := scm.Join(ps.GitOwner, ps.GitRepository)
+	number := PullRequestNumber(pa)
+	if ps.LastCommitSHA != "" {
+		prs, err := FindPullRequestsForCommit(ctx, scmClient, fullName, ps.LastCommitSHA)
+		if err != nil {
+			log.Logger().Debugf("failed to find the pull requests of commit %s so using the branch %s: %s", ps.LastCommitSHA, ps.GitBranch, err.Error())
+		}
+		for _, pr := range prs {
+			if number <= 0 || pr.Number == number {
+				return pr, nil
+			}
+		}
+	}
+	if number <= 0 {
+		return nil, nil
+	}
+	pr, _, err := scmClient.PullRequests.Find(ctx, fullName, number)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find pull request %d of repository %s: %w", number, fullName, err)
+	}
+	return pr, nil
+}
+
+// FindPullRequestsForCommit returns the pull requests of the repository for the commit. The search API is used if the
+// git provider supports it otherwise the open pull requests whose head is the commit are returned
+func FindPullRequestsForCommit(ctx context.Context, scmClient *scm.Client, fullName, sha string) ([]*scm.PullRequest, error) {
+	var answer []*scm.PullRequest
+	issues, _, err := scmClient.Issues.Search(ctx, scm.SearchOptions{
+		Query: fmt.Sprintf("repo:%s is:pr %s", fullName, sha),
+	})
+	if err == nil {
+		for _, issue := range issues {
+			if issue == nil || issue.PullRequest == nil {
+				continue
+			}
+			pr, _, err := scmClient.PullRequests.Find(ctx, fullName, issue.Number)
+			if err != nil {
+				return nil, fmt.Errorf("failed to find pull request %d of repository %s: %w", issue.Number, fullName, err)
+			}
+			if pr != nil {
+				answer = append(answer, pr)
+			}
+		}
+		if len(answer) > 0 {
+			return answer, nil
+		}
+	}
+
+	prs, _, err := scmClient.PullRequests.List(ctx, fullName, &scm.PullRequestListOptions{
+		Open: true,
+		Size: 100,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pull requests of repository %s: %w", fullName, err)
+	}
+	for _, pr := range prs {
+		if pr.Sha == sha || pr.Head.Sha == sha {
+			answer = append(answer, pr)
+		}
+	}
+	return answer, nil
+}
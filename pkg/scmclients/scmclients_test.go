@@ -0,0 +1,72 @@
+//go:build unit
+// +build unit
+
+package scmclients_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullRequestNumber(t *testing.T) {
+	for branch, expected := range map[string]int{
+		"PR-123": 123,
+		"pr-7":   7,
+		"main":   0,
+		"PR-abc": 0,
+	} {
+		pa := &v1.PipelineActivity{Spec: v1.PipelineActivitySpec{GitBranch: branch}}
+		assert.Equal(t, expected, scmclients.PullRequestNumber(pa), "branch %s", branch)
+		assert.Equal(t, expected > 0 || branch == "PR-abc", scmclients.IsPullRequest(pa), "branch %s", branch)
+	}
+}
+
+func TestFindPullRequest(t *testing.T) {
+	ctx := context.Background()
+	scmClient, fakeData := fakescm.NewDefault()
+	repo := scm.Repository{Namespace: "myorg", Name: "cheese", FullName: "myorg/cheese"}
+	fakeData.PullRequests[3] = &scm.PullRequest{
+		Number: 3,
+		Title:  "Some cheese",
+		Head:   scm.PullRequestBranch{Sha: "abc123"},
+		Base:   scm.PullRequestBranch{Repo: repo},
+	}
+	fakeData.PullRequests[4] = &scm.PullRequest{
+		Number: 4,
+		Title:  "Closed cheese",
+		Closed: true,
+		Head:   scm.PullRequestBranch{Sha: "def456"},
+		Base:   scm.PullRequestBranch{Repo: repo},
+	}
+	newActivity := func(branch, sha string) *v1.PipelineActivity {
+		return &v1.PipelineActivity{
+			Spec: v1.PipelineActivitySpec{
+				GitOwner:      "myorg",
+				GitRepository: "cheese",
+				GitBranch:     branch,
+				LastCommitSHA: sha,
+			},
+		}
+	}
+
+	pr, err := scmclients.FindPullRequest(ctx, scmClient, newActivity("some-cheese", "abc123"))
+	require.NoError(t, err)
+	require.NotNil(t, pr, "should find the pull request of the commit")
+	assert.Equal(t, 3, pr.Number)
+
+	pr, err = scmclients.FindPullRequest(ctx, scmClient, newActivity("PR-4", "def456"))
+	require.NoError(t, err)
+	require.NotNil(t, pr, "should fall back to the pull request of the branch")
+	assert.Equal(t, 4, pr.Number)
+
+	pr, err = scmclients.FindPullRequest(ctx, scmClient, newActivity("main", "fff999"))
+	require.NoError(t, err)
+	assert.Nil(t, pr, "should not find a pull request for a commit on main")
+}
@@ -0,0 +1,226 @@
+package scminfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scmclients"
+	"github.com/jenkins-x/go-scm/scm"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/homedir"
+	"github.com/spf13/cobra"
+)
+
+// Details the commit and pull request of the SHA of a build
+type Details struct {
+	SHA              string `json:"sha"`
+	Message          string `json:"message,omitempty"`
+	Author           string `json:"author,omitempty"`
+	PullRequest      int    `json:"pr,omitempty"`
+	PullRequestTitle string `json:"prTitle,omitempty"`
+	PullRequestURL   string `json:"prURL,omitempty"`
+
+	// PullRequestChecked the pull request number of the build that was looked up so that builds of a pull request
+	// the git provider could not find are not looked up again
+	PullRequestChecked int `json:"prChecked,omitempty"`
+}
+
+// Subject returns the first line of the commit message
+func (d *Details) Subject() string {
+	if d == nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(d.Message, "\n", 2)[0])
+}
+
+// Title returns the pull request title if there is one otherwise the subject of the commit message
+func (d *Details) Title() string {
+	if d == nil {
+		return ""
+	}
+	if d.PullRequestTitle != "" {
+		return d.PullRequestTitle
+	}
+	return d.Subject()
+}
+
+// Enricher fetches the commit and pull request details of the SHA of each activity from the git provider caching
+// them on disk so that each SHA is only looked up once
+type Enricher struct {
+	CacheDir    string
+	GitUsername string
+	GitToken    string
+
+	// ScmClients cache of Scm Clients for each git server URL mostly used for testing
+	ScmClients map[string]*scm.Client
+
+	lock    sync.Mutex
+	details map[string]*Details
+}
+
+// AddFlags adds the CLI flags for the git provider
+func (e *Enricher) AddFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&e.CacheDir, "scm-cache-dir", "", "", "The directory used to cache the commit and pull request details. Defaults to ~/.jx/cache/scm")
+	cmd.Flags().StringVarP(&e.GitUsername, "git-username", "", "", "The git username used to find the commits and pull requests. If not specified it's loaded from the git credentials file")
+	cmd.Flags().StringVarP(&e.GitToken, "git-token", "", "", "The git token used to find the commits and pull requests. If not specified it's loaded from the git credentials file")
+}
+
+// Validate defaults the cache directory
+func (e *Enricher) Validate() error {
+	if e.CacheDir == "" {
+		dir, err := homedir.CacheDir("", ".jx")
+		if err != nil {
+			return fmt.Errorf("failed to find the cache dir: %w", err)
+		}
+		e.CacheDir = filepath.Join(dir, "scm")
+	}
+	err := os.MkdirAll(e.CacheDir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return fmt.Errorf("failed to create the cache dir %s: %w", e.CacheDir, err)
+	}
+	if e.ScmClients == nil {
+		e.ScmClients = map[string]*scm.Client{}
+	}
+	return nil
+}
+
+// Details returns the commit and pull request details of the activity or nil if it has no SHA.
+//
+// The pull request is found from the commit falling back to the pull request number of the branch. The cache is
+// not locked while the git provider is called so that slow lookups do not block other builds
+func (e *Enricher) Details(ctx context.Context, pa *v1.PipelineActivity) (*Details, error) {
+	ps := &pa.Spec
+	sha := ps.LastCommitSHA
+	if sha == "" || ps.GitOwner == "" || ps.GitRepository == "" {
+		return nil, nil
+	}
+	number := scmclients.PullRequestNumber(pa)
+
+	cached, err := e.cached(sha)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil && (number <= 0 || cached.PullRequest == number || cached.PullRequestChecked == number) {
+		return cached, nil
+	}
+	scmClient, err := e.scmClient(pa)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Details{SHA: sha}
+	if cached != nil {
+		// lets not modify the cached details which other goroutines may be reading
+		*d = *cached
+	} else {
+		commit, _, err := scmClient.Git.FindCommit(ctx, scm.Join(ps.GitOwner, ps.GitRepository), sha)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find commit %s of repository %s/%s: %w", sha, ps.GitOwner, ps.GitRepository, err)
+		}
+		if commit != nil {
+			d.Message = commit.Message
+			d.Author = commit.Author.Login
+			if d.Author == "" {
+				d.Author = commit.Author.Name
+			}
+		}
+	}
+	pr, err := scmclients.FindPullRequest(ctx, scmClient, pa)
+	if err != nil && !errors.Is(err, scm.ErrNotFound) {
+		return nil, err
+	}
+	if number > 0 {
+		d.PullRequestChecked = number
+	}
+	if pr != nil {
+		d.PullRequest = pr.Number
+		if d.PullRequest == 0 {
+			d.PullRequest = number
+		}
+		d.PullRequestTitle = pr.Title
+		d.PullRequestURL = pr.Link
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	err = e.save(d)
+	if err != nil {
+		return nil, err
+	}
+	e.details[sha] = d
+	return d, nil
+}
+
+// cached returns the details of the SHA from memory or the cache dir or nil if it has not been looked up yet
+func (e *Enricher) cached(sha string) (*Details, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.details == nil {
+		e.details = map[string]*Details{}
+	}
+	d := e.details[sha]
+	if d != nil {
+		return d, nil
+	}
+	d, err := e.load(sha)
+	if err != nil {
+		return nil, err
+	}
+	if d != nil {
+		e.details[sha] = d
+	}
+	return d, nil
+}
+
+// scmClient lazily creates the Scm Client for the git server of the activity
+func (e *Enricher) scmClient(pa *v1.PipelineActivity) (*scm.Client, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if e.ScmClients == nil {
+		e.ScmClients = map[string]*scm.Client{}
+	}
+	return scmclients.ScmClient(e.ScmClients, e.GitUsername, e.GitToken, pa)
+}
+
+func (e *Enricher) load(sha string) (*Details, error) {
+	path := e.cacheFile(sha)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	d := &Details{}
+	err = json.Unmarshal(data, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	return d, nil
+}
+
+func (e *Enricher) save(d *Details) error {
+	path := e.cacheFile(d.SHA)
+	data, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("failed to marshal the details of %s: %w", d.SHA, err)
+	}
+	err = os.WriteFile(path, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return fmt.Errorf("failed to save %s: %w", path, err)
+	}
+	return nil
+}
+
+func (e *Enricher) cacheFile(sha string) string {
+	return filepath.Join(e.CacheDir, filepath.Base(sha)+".json")
+}
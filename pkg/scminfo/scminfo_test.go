@@ -0,0 +1,150 @@
+//go:build unit
+// +build unit
+
+package scminfo_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/scminfo"
+	"github.com/jenkins-x/go-scm/scm"
+	fakescm "github.com/jenkins-x/go-scm/scm/driver/fake"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDetails(t *testing.T) {
+	ctx := context.Background()
+	cacheDir := t.TempDir()
+
+	scmClient, fakeData := fakescm.NewDefault()
+	fakeData.Commits["abc123"] = &scm.Commit{
+		Sha:     "abc123",
+		Message: "fix: the cheese\n\nmore details",
+		Author:  scm.Signature{Name: "James", Login: "jstrachan"},
+	}
+	fakeData.PullRequests[5] = &scm.PullRequest{Number: 5, Title: "Fix the cheese", Link: "https://github.com/myorg/cheese/pull/5"}
+
+	e := &scminfo.Enricher{
+		CacheDir:   cacheDir,
+		ScmClients: map[string]*scm.Client{"https://github.com": scmClient},
+	}
+	require.NoError(t, e.Validate())
+
+	d, err := e.Details(ctx, newActivity("PR-5", "abc123"))
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "abc123", d.SHA)
+	assert.Equal(t, "jstrachan", d.Author)
+	assert.Equal(t, "fix: the cheese", d.Subject())
+	assert.Equal(t, 5, d.PullRequest)
+	assert.Equal(t, "Fix the cheese", d.Title())
+	assert.FileExists(t, filepath.Join(cacheDir, "abc123.json"))
+
+	// a new enricher should load the details from the cache without the git provider
+	delete(fakeData.Commits, "abc123")
+	delete(fakeData.PullRequests, 5)
+	e = &scminfo.Enricher{
+		CacheDir:   cacheDir,
+		ScmClients: map[string]*scm.Client{"https://github.com": scmClient},
+	}
+	d, err = e.Details(ctx, newActivity("PR-5", "abc123"))
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "Fix the cheese", d.PullRequestTitle)
+
+	d, err = e.Details(ctx, newActivity("main", ""))
+	require.NoError(t, err)
+	assert.Nil(t, d, "should have no details without a SHA")
+}
+
+func TestDetailsFindsPullRequestOfCommit(t *testing.T) {
+	ctx := context.Background()
+	scmClient, fakeData := fakescm.NewDefault()
+	fakeData.Commits["def456"] = &scm.Commit{
+		Sha:     "def456",
+		Message: "feat: more cheese",
+		Author:  scm.Signature{Login: "jstrachan"},
+	}
+	fakeData.PullRequests[6] = &scm.PullRequest{
+		Number: 6,
+		Title:  "More cheese",
+		Link:   "https://github.com/myorg/cheese/pull/6",
+		Head:   scm.PullRequestBranch{Ref: "more-cheese", Sha: "def456"},
+		Base:   scm.PullRequestBranch{Ref: "main", Repo: scm.Repository{Namespace: "myorg", Name: "cheese", FullName: "myorg/cheese"}},
+	}
+
+	e := &scminfo.Enricher{
+		CacheDir:   t.TempDir(),
+		ScmClients: map[string]*scm.Client{"https://github.com": scmClient},
+	}
+	require.NoError(t, e.Validate())
+
+	d, err := e.Details(ctx, newActivity("more-cheese", "def456"))
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, 6, d.PullRequest, "should find the pull request from the commit of a branch build")
+	assert.Equal(t, "More cheese", d.Title())
+}
+
+func TestDetailsCachesPullRequestNotFound(t *testing.T) {
+	ctx := context.Background()
+	scmClient, fakeData := fakescm.NewDefault()
+	fakeData.Commits["abc123"] = &scm.Commit{
+		Sha:     "abc123",
+		Message: "fix: the cheese",
+		Author:  scm.Signature{Login: "jstrachan"},
+	}
+	scmClient.PullRequests = &notFoundPullRequestService{PullRequestService: scmClient.PullRequests}
+
+	e := &scminfo.Enricher{
+		CacheDir:   t.TempDir(),
+		ScmClients: map[string]*scm.Client{"https://github.com": scmClient},
+	}
+	require.NoError(t, e.Validate())
+
+	d, err := e.Details(ctx, newActivity("PR-7", "abc123"))
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, 0, d.PullRequest)
+	assert.Equal(t, 7, d.PullRequestChecked)
+
+	// the pull request should not be looked up again
+	scmClient.PullRequests = nil
+	e = &scminfo.Enricher{
+		CacheDir:   e.CacheDir,
+		ScmClients: map[string]*scm.Client{"https://github.com": scmClient},
+	}
+	d, err = e.Details(ctx, newActivity("PR-7", "abc123"))
+	require.NoError(t, err)
+	require.NotNil(t, d)
+	assert.Equal(t, "fix: the cheese", d.Title())
+}
+
+// notFoundPullRequestService returns scm.ErrNotFound like the git providers do for a missing pull request
+type notFoundPullRequestService struct {
+	scm.PullRequestService
+}
+
+func (s *notFoundPullRequestService) Find(context.Context, string, int) (*scm.PullRequest, *scm.Response, error) {
+	return nil, nil, scm.ErrNotFound
+}
+
+func newActivity(branch, sha string) *v1.PipelineActivity {
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "myorg-cheese-" + branch + "-1",
+		},
+		Spec: v1.PipelineActivitySpec{
+			GitOwner:      "myorg",
+			GitRepository: "cheese",
+			GitBranch:     branch,
+			GitURL:        "https://github.com/myorg/cheese.git",
+			LastCommitSHA: sha,
+		},
+	}
+}
@@ -0,0 +1,101 @@
+package sourcerepos
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/naming"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/retry"
+)
+
+// LastBuildNumberAnnotationPrefix used to annotate SourceRepository with the latest build number for a branch
+const LastBuildNumberAnnotationPrefix = "jenkins.io/last-build-number-for-"
+
+// BuildNumberBackoff the backoff used when retrying build number allocations which conflict with concurrent pipelines
+var BuildNumberBackoff = wait.Backoff{
+	Steps:    10,
+	Duration: 10 * time.Millisecond,
+	Factor:   1.5,
+	Jitter:   0.5,
+}
+
+// BuildNumberAnnotation returns the SourceRepository annotation holding the last build number of the given branch
+func BuildNumberAnnotation(branch string) string {
+	// the name part of an annotation key is limited to 63 characters
+	return LastBuildNumberAnnotationPrefix + naming.ToValidNameTruncated(branch, 63-len("last-build-number-for-"))
+}
+
+// NextBuildNumber allocates the next build number for the branch by incrementing the last build number annotation on
+// the SourceRepository. The update relies on the resource version of the SourceRepository so concurrent callers never
+// get the same number; conflicts are retried.
+//
+// The lastBuild is the highest build number known to the caller (e.g. from existing PipelineActivity resources) and is
+// used to seed the annotation so numbers are never reused. Returns 0 if there is no SourceRepository for the repository
+func NextBuildNumber(ctx context.Context, jxClient versioned.Interface, ns, owner, repository, branch string, lastBuild int) (int, error) {
+	sr, err := FindSourceRepositoryWithoutProvider(ctx, jxClient, ns, owner, repository)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find SourceRepository for %s/%s: %w", owner, repository, err)
+	}
+	if sr == nil {
+		return 0, nil
+	}
+
+	key := BuildNumberAnnotation(branch)
+	name := sr.Name
+	repositories := jxClient.JenkinsV1().SourceRepositories(ns)
+	answer := 0
+	err = retry.RetryOnConflict(BuildNumberBackoff, func() error {
+		sr, err := repositories.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		answer, err = nextBuildNumber(sr, key, lastBuild)
+		if err != nil {
+			return err
+		}
+		if sr.Annotations == nil {
+			sr.Annotations = map[string]string{}
+		}
+		sr.Annotations[key] = strconv.Itoa(answer)
+		_, err = repositories.Update(ctx, sr, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to update annotation %s on SourceRepository %s: %w", key, name, err)
+	}
+	return answer, nil
+}
+
+// PeekBuildNumber returns the build number NextBuildNumber would allocate for the branch without updating the
+// SourceRepository so that dry runs use the same numbers. Returns 0 if there is no SourceRepository for the repository
+func PeekBuildNumber(ctx context.Context, jxClient versioned.Interface, ns, owner, repository, branch string, lastBuild int) (int, error) {
+	sr, err := FindSourceRepositoryWithoutProvider(ctx, jxClient, ns, owner, repository)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find SourceRepository for %s/%s: %w", owner, repository, err)
+	}
+	if sr == nil {
+		return 0, nil
+	}
+	return nextBuildNumber(sr, BuildNumberAnnotation(branch), lastBuild)
+}
+
+// nextBuildNumber returns the build number after the highest of the annotation of the SourceRepository and the last build
+func nextBuildNumber(sr *v1.SourceRepository, key string, lastBuild int) (int, error) {
+	last := lastBuild
+	if value := sr.Annotations[key]; value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid build number %q in annotation %s: %w", value, key, err)
+		}
+		if n > last {
+			last = n
+		}
+	}
+	return last + 1, nil
+}
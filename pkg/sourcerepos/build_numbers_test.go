@@ -0,0 +1,129 @@
+//go:build unit
+// +build unit
+
+package sourcerepos_test
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/sourcerepos"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestNextBuildNumber(t *testing.T) {
+	sr := createSourceRepository("myorg-myrepo", "myorg", "myrepo", "https://github.com", false)
+	sr.Annotations = map[string]string{
+		sourcerepos.BuildNumberAnnotation("master"): "7",
+	}
+	jxClient := fake.NewSimpleClientset(&sr)
+	ctx := context.Background()
+
+	build, err := sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "master", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 8, build, "should increment the annotation")
+
+	build, err = sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "master", 20)
+	require.NoError(t, err)
+	assert.Equal(t, 21, build, "should never go below the last known build")
+
+	build, err = sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "PR-123", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, build, "should start a new branch at 1")
+
+	found, err := jxClient.JenkinsV1().SourceRepositories(ns).Get(ctx, sr.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "21", found.Annotations["jenkins.io/last-build-number-for-master"])
+	assert.Equal(t, "1", found.Annotations["jenkins.io/last-build-number-for-pr-123"])
+
+	build, err = sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "unknown", "master", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, build, "should not allocate a build number without a SourceRepository")
+}
+
+func TestPeekBuildNumber(t *testing.T) {
+	sr := createSourceRepository("myorg-myrepo", "myorg", "myrepo", "https://github.com", false)
+	sr.Annotations = map[string]string{
+		sourcerepos.BuildNumberAnnotation("master"): "7",
+	}
+	jxClient := fake.NewSimpleClientset(&sr)
+	ctx := context.Background()
+
+	build, err := sourcerepos.PeekBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "master", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 8, build, "should return the next build number")
+
+	build, err = sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "master", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 8, build, "should not have updated the annotation")
+
+	build, err = sourcerepos.PeekBuildNumber(ctx, jxClient, ns, "myorg", "unknown", "master", 3)
+	require.NoError(t, err)
+	assert.Equal(t, 0, build, "should not return a build number without a SourceRepository")
+}
+
+func TestNextBuildNumberConcurrent(t *testing.T) {
+	sr := createSourceRepository("myorg-myrepo", "myorg", "myrepo", "https://github.com", false)
+	sr.ResourceVersion = "1"
+	jxClient := fake.NewSimpleClientset(&sr)
+	addOptimisticConcurrency(jxClient)
+	ctx := context.Background()
+
+	const count = 10
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	var builds []int
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			build, err := sourcerepos.NextBuildNumber(ctx, jxClient, ns, "myorg", "myrepo", "master", 0)
+			assert.NoError(t, err)
+			lock.Lock()
+			builds = append(builds, build)
+			lock.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	sort.Ints(builds)
+	var expected []int
+	for i := 1; i <= count; i++ {
+		expected = append(expected, i)
+	}
+	assert.Equal(t, expected, builds, "concurrent allocations should get unique build numbers")
+}
+
+// addOptimisticConcurrency makes the fake client reject updates of stale SourceRepository resources like the API server does
+func addOptimisticConcurrency(jxClient *fake.Clientset) {
+	gvr := v1.SchemeGroupVersion.WithResource("sourcerepositories")
+	var lock sync.Mutex
+	jxClient.PrependReactor("update", "sourcerepositories", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		sr := action.(k8stesting.UpdateAction).GetObject().(*v1.SourceRepository).DeepCopy()
+		obj, err := jxClient.Tracker().Get(gvr, sr.Namespace, sr.Name)
+		if err != nil {
+			return true, nil, err
+		}
+		current := obj.(*v1.SourceRepository)
+		if current.ResourceVersion != sr.ResourceVersion {
+			return true, nil, apierrors.NewConflict(gvr.GroupResource(), sr.Name, nil)
+		}
+		rv, _ := strconv.Atoi(current.ResourceVersion)
+		sr.ResourceVersion = strconv.Itoa(rv + 1)
+		err = jxClient.Tracker().Update(gvr, sr, sr.Namespace)
+		return true, sr, err
+	})
+}
@@ -0,0 +1,305 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// GroupByRepo groups the activities by owner and repository
+	GroupByRepo = "repo"
+
+	// GroupByBranch groups the activities by owner, repository and branch
+	GroupByBranch = "branch"
+
+	// GroupByContext groups the activities by their trigger context
+	GroupByContext = "context"
+
+	// GroupByStage groups the stages of the activities by their name
+	GroupByStage = "stage"
+
+	// slowestStageCount the number of slowest stages to report for each group
+	slowestStageCount = 3
+)
+
+// GroupBys the valid ways of grouping activities
+var GroupBys = []string{GroupByRepo, GroupByBranch, GroupByContext, GroupByStage}
+
+// GroupStats the statistics of a group of pipeline runs or stages
+type GroupStats struct {
+	Name          string          `json:"name"`
+	Runs          int             `json:"runs"`
+	Succeeded     int             `json:"succeeded"`
+	Failed        int             `json:"failed"`
+	Aborted       int             `json:"aborted"`
+	Running       int             `json:"running"`
+	SuccessRate   float64         `json:"successRate"`
+	FailureRate   float64         `json:"failureRate"`
+	AbortRate     float64         `json:"abortRate"`
+	DurationP50   Seconds         `json:"durationP50"`
+	DurationP90   Seconds         `json:"durationP90"`
+	DurationP99   Seconds         `json:"durationP99"`
+	QueueP50      Seconds         `json:"queueP50"`
+	QueueP90      Seconds         `json:"queueP90"`
+	SlowestStages []StageDuration `json:"slowestStages,omitempty"`
+	Commits       int             `json:"commits"`
+	FlakyCommits  int             `json:"flakyCommits"`
+	Flakiness     float64         `json:"flakiness"`
+}
+
+// StageDuration the 90th percentile duration of a stage
+type StageDuration struct {
+	Name        string  `json:"name"`
+	DurationP90 Seconds `json:"durationP90"`
+}
+
+// Seconds a duration which is marshalled as a number of seconds
+type Seconds float64
+
+// ToSeconds converts the duration to seconds
+func ToSeconds(d time.Duration) Seconds {
+	return Seconds(d.Seconds())
+}
+
+// String returns the seconds as a duration rounded to the second
+func (s Seconds) String() string {
+	return time.Duration(float64(s) * float64(time.Second)).Round(time.Second).String()
+}
+
+// sample a completed or running pipeline or stage
+type sample struct {
+	group    string
+	pipeline string
+	sha      string
+	status   v1.ActivityStatusType
+	duration *time.Duration
+	queue    *time.Duration
+	stages   map[string]time.Duration
+}
+
+// Compute computes the statistics of the activities grouped by the given field
+func Compute(activities []v1.PipelineActivity, groupBy string) ([]*GroupStats, error) {
+	var samples []*sample
+	for i := range activities {
+		pa := &activities[i]
+		switch groupBy {
+		case GroupByStage:
+			samples = append(samples, stageSamples(pa)...)
+		case GroupByRepo, GroupByBranch, GroupByContext:
+			samples = append(samples, activitySample(pa, groupKey(pa, groupBy)))
+		default:
+			return nil, fmt.Errorf("unknown group by %s: valid values are: %s", groupBy, strings.Join(GroupBys, ", "))
+		}
+	}
+
+	groups := map[string][]*sample{}
+	for _, s := range samples {
+		groups[s.group] = append(groups[s.group], s)
+	}
+	var answer []*GroupStats
+	for name, group := range groups {
+		answer = append(answer, computeGroup(name, group))
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return answer[i].Name < answer[j].Name
+	})
+	return answer, nil
+}
+
+func groupKey(pa *v1.PipelineActivity, groupBy string) string {
+	ps := &pa.Spec
+	switch groupBy {
+	case GroupByRepo:
+		return ps.GitOwner + "/" + ps.GitRepository
+	case GroupByBranch:
+		return ps.GitOwner + "/" + ps.GitRepository + "/" + ps.GitBranch
+	default:
+		return ps.Context
+	}
+}
+
+// pipelineKey returns the key of the pipeline of the activity so that the different pipelines run for a commit
+// are not compared with each other
+func pipelineKey(pa *v1.PipelineActivity) string {
+	ps := &pa.Spec
+	return ps.GitOwner + "/" + ps.GitRepository + "/" + ps.Context
+}
+
+func activitySample(pa *v1.PipelineActivity, group string) *sample {
+	ps := &pa.Spec
+	s := &sample{
+		group:    group,
+		pipeline: pipelineKey(pa),
+		sha:      ps.LastCommitSHA,
+		status:   ps.Status,
+		duration: duration(ps.StartedTimestamp, ps.CompletedTimestamp, ps.Status),
+		stages:   map[string]time.Duration{},
+	}
+
+	// the queue time is how long the activity waited before the first step of its pods started
+	var firstStep *time.Time
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil {
+			continue
+		}
+		d := duration(stage.StartedTimestamp, stage.CompletedTimestamp, stage.Status)
+		if d != nil {
+			s.stages[stage.Name] = *d
+		}
+		for j := range stage.Steps {
+			started := stage.Steps[j].StartedTimestamp
+			if started != nil && (firstStep == nil || started.Time.Before(*firstStep)) {
+				t := started.Time
+				firstStep = &t
+			}
+		}
+	}
+	if firstStep != nil && ps.StartedTimestamp != nil {
+		queue := firstStep.Sub(ps.StartedTimestamp.Time)
+		if queue < 0 {
+			queue = 0
+		}
+		s.queue = &queue
+	}
+	return s
+}
+
+func stageSamples(pa *v1.PipelineActivity) []*sample {
+	ps := &pa.Spec
+	var answer []*sample
+	for i := range ps.Steps {
+		stage := ps.Steps[i].Stage
+		if stage == nil || stage.Status == v1.ActivityStatusTypeNotExecuted || stage.Status == v1.ActivityStatusTypePending {
+			continue
+		}
+		answer = append(answer, &sample{
+			group:    stage.Name,
+			pipeline: pipelineKey(pa),
+			sha:      ps.LastCommitSHA,
+			status:   stage.Status,
+			duration: duration(stage.StartedTimestamp, stage.CompletedTimestamp, stage.Status),
+		})
+	}
+	return answer
+}
+
+// duration returns the duration of a completed activity or stage
+func duration(started, completed *metav1.Time, status v1.ActivityStatusType) *time.Duration {
+	if started == nil || completed == nil || !status.IsTerminated() {
+		return nil
+	}
+	d := completed.Sub(started.Time)
+	return &d
+}
+
+func computeGroup(name string, samples []*sample) *GroupStats {
+	g := &GroupStats{
+		Name: name,
+		Runs: len(samples),
+	}
+	var durations, queues []time.Duration
+	stageDurations := map[string][]time.Duration{}
+	commits := map[string]map[string]bool{}
+	for _, s := range samples {
+		outcome := ""
+		switch {
+		case s.status == v1.ActivityStatusTypeSucceeded:
+			g.Succeeded++
+			outcome = "passed"
+		case s.status == v1.ActivityStatusTypeAborted || s.status == v1.ActivityStatusTypeCancelled:
+			g.Aborted++
+		case s.status.IsTerminated():
+			g.Failed++
+			outcome = "failed"
+		default:
+			g.Running++
+		}
+		if s.duration != nil {
+			durations = append(durations, *s.duration)
+		}
+		if s.queue != nil {
+			queues = append(queues, *s.queue)
+		}
+		for stage, d := range s.stages {
+			stageDurations[stage] = append(stageDurations[stage], d)
+		}
+		if s.sha != "" && outcome != "" {
+			key := s.sha + "/" + s.pipeline
+			if commits[key] == nil {
+				commits[key] = map[string]bool{}
+			}
+			commits[key][outcome] = true
+		}
+	}
+
+	completed := g.Succeeded + g.Failed + g.Aborted
+	g.SuccessRate = rate(g.Succeeded, completed)
+	g.FailureRate = rate(g.Failed, completed)
+	g.AbortRate = rate(g.Aborted, completed)
+	g.DurationP50 = ToSeconds(Percentile(durations, 50))
+	g.DurationP90 = ToSeconds(Percentile(durations, 90))
+	g.DurationP99 = ToSeconds(Percentile(durations, 99))
+	g.QueueP50 = ToSeconds(Percentile(queues, 50))
+	g.QueueP90 = ToSeconds(Percentile(queues, 90))
+
+	for stage, values := range stageDurations {
+		g.SlowestStages = append(g.SlowestStages, StageDuration{
+			Name:        stage,
+			DurationP90: ToSeconds(Percentile(values, 90)),
+		})
+	}
+	sort.Slice(g.SlowestStages, func(i, j int) bool {
+		s1 := g.SlowestStages[i]
+		s2 := g.SlowestStages[j]
+		if s1.DurationP90 != s2.DurationP90 {
+			return s1.DurationP90 > s2.DurationP90
+		}
+		return s1.Name < s2.Name
+	})
+	if len(g.SlowestStages) > slowestStageCount {
+		g.SlowestStages = g.SlowestStages[:slowestStageCount]
+	}
+
+	// a commit is flaky if the same pipeline both failed and succeeded for it
+	g.Commits = len(commits)
+	for _, statuses := range commits {
+		if len(statuses) > 1 {
+			g.FlakyCommits++
+		}
+	}
+	g.Flakiness = rate(g.FlakyCommits, g.Commits)
+	return g
+}
+
+// Percentile returns the nearest rank percentile of the durations
+func Percentile(durations []time.Duration, percentile float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i] < sorted[j]
+	})
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+func rate(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(count)/float64(total)*10000) / 10000
+}
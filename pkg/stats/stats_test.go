@@ -0,0 +1,145 @@
+package stats_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/stats"
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var start = time.Date(2026, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+func TestComputeByRepo(t *testing.T) {
+	activities := []v1.PipelineActivity{
+		newActivity("repo-a", "sha1", v1.ActivityStatusTypeFailed, 10*time.Minute, 30*time.Second),
+		newActivity("repo-a", "sha1", v1.ActivityStatusTypeSucceeded, 4*time.Minute, 10*time.Second),
+		newActivity("repo-a", "sha2", v1.ActivityStatusTypeSucceeded, 5*time.Minute, 20*time.Second),
+		newActivity("repo-a", "sha3", v1.ActivityStatusTypeAborted, time.Minute, 0),
+		newActivity("repo-b", "sha4", v1.ActivityStatusTypeRunning, 0, 0),
+	}
+	results, err := stats.Compute(activities, stats.GroupByRepo)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	a := results[0]
+	assert.Equal(t, "myorg/repo-a", a.Name)
+	assert.Equal(t, 4, a.Runs)
+	assert.Equal(t, 2, a.Succeeded)
+	assert.Equal(t, 1, a.Failed)
+	assert.Equal(t, 1, a.Aborted)
+	assert.Equal(t, 0.5, a.SuccessRate)
+	assert.Equal(t, 0.25, a.FailureRate)
+	assert.Equal(t, 0.25, a.AbortRate)
+	assert.Equal(t, "4m0s", a.DurationP50.String())
+	assert.Equal(t, "10m0s", a.DurationP90.String())
+	assert.Equal(t, "10m0s", a.DurationP99.String())
+	assert.Equal(t, "10s", a.QueueP50.String())
+	assert.Equal(t, 2, a.Commits)
+	assert.Equal(t, 1, a.FlakyCommits, "sha1 both failed and passed")
+	assert.Equal(t, 0.5, a.Flakiness)
+	require.Len(t, a.SlowestStages, 2)
+	assert.Equal(t, "test", a.SlowestStages[0].Name)
+	assert.Equal(t, "build", a.SlowestStages[1].Name)
+
+	b := results[1]
+	assert.Equal(t, "myorg/repo-b", b.Name)
+	assert.Equal(t, 1, b.Runs)
+	assert.Equal(t, 1, b.Running)
+	assert.Equal(t, 0.0, b.SuccessRate)
+	assert.Equal(t, stats.Seconds(0), b.DurationP50)
+}
+
+func TestComputeByStage(t *testing.T) {
+	activities := []v1.PipelineActivity{
+		newActivity("repo-a", "sha1", v1.ActivityStatusTypeSucceeded, 4*time.Minute, 0),
+		newActivity("repo-b", "sha2", v1.ActivityStatusTypeSucceeded, 6*time.Minute, 0),
+	}
+	results, err := stats.Compute(activities, stats.GroupByStage)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "build", results[0].Name)
+	assert.Equal(t, 2, results[0].Runs)
+	assert.Equal(t, 1.0, results[0].SuccessRate)
+	assert.Equal(t, "test", results[1].Name)
+
+	_, err = stats.Compute(activities, "cheese")
+	require.Error(t, err)
+}
+
+func TestComputeFlakinessPerContext(t *testing.T) {
+	withContext := func(pa v1.PipelineActivity, context string) v1.PipelineActivity {
+		pa.Spec.Context = context
+		return pa
+	}
+	activities := []v1.PipelineActivity{
+		withContext(newActivity("repo-a", "sha1", v1.ActivityStatusTypeFailed, 4*time.Minute, 0), "lint"),
+		withContext(newActivity("repo-a", "sha1", v1.ActivityStatusTypeSucceeded, 4*time.Minute, 0), "pr-build"),
+	}
+	results, err := stats.Compute(activities, stats.GroupByRepo)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	a := results[0]
+	assert.Equal(t, 2, a.Commits, "each context of the commit is a separate pipeline")
+	assert.Equal(t, 0, a.FlakyCommits, "different contexts of the same commit are not flaky")
+	assert.Equal(t, 0.0, a.Flakiness)
+}
+
+func TestPercentile(t *testing.T) {
+	var durations []time.Duration
+	for i := 1; i <= 10; i++ {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+	assert.Equal(t, 5*time.Second, stats.Percentile(durations, 50))
+	assert.Equal(t, 9*time.Second, stats.Percentile(durations, 90))
+	assert.Equal(t, 10*time.Second, stats.Percentile(durations, 99))
+	assert.Equal(t, time.Duration(0), stats.Percentile(nil, 50))
+}
+
+// newActivity creates an activity with a build stage taking a third of the duration and a test stage taking the rest
+func newActivity(repo, sha string, status v1.ActivityStatusType, duration, queue time.Duration) v1.PipelineActivity {
+	started := metav1.NewTime(start)
+	firstStep := metav1.NewTime(start.Add(queue))
+	buildEnd := metav1.NewTime(firstStep.Add((duration - queue) / 3))
+	completed := metav1.NewTime(start.Add(duration))
+	stage := func(name string, started, completed *metav1.Time) v1.PipelineActivityStep {
+		return v1.PipelineActivityStep{
+			Kind: v1.ActivityStepKindTypeStage,
+			Stage: &v1.StageActivityStep{
+				CoreActivityStep: v1.CoreActivityStep{
+					Name:               name,
+					Status:             status,
+					StartedTimestamp:   started,
+					CompletedTimestamp: completed,
+				},
+				Steps: []v1.CoreActivityStep{
+					{
+						Name:             "step",
+						StartedTimestamp: started,
+					},
+				},
+			},
+		}
+	}
+	pa := v1.PipelineActivity{
+		Spec: v1.PipelineActivitySpec{
+			GitOwner:         "myorg",
+			GitRepository:    repo,
+			GitBranch:        "main",
+			LastCommitSHA:    sha,
+			Status:           status,
+			StartedTimestamp: &started,
+		},
+	}
+	if status.IsTerminated() {
+		pa.Spec.CompletedTimestamp = &completed
+		pa.Spec.Steps = []v1.PipelineActivityStep{
+			stage("build", &firstStep, &buildEnd),
+			stage("test", &buildEnd, &completed),
+		}
+	}
+	return pa
+}
@@ -0,0 +1,65 @@
+package tektonlog
+
+import (
+	"context"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	"github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListFilteredPipelineActivities lists the PipelineActivities of the namespace which match the owner, repository and
+// branch labels of the filter along with those missing the labels so that they can be filtered using Matches
+func ListFilteredPipelineActivities(ctx context.Context, jxClient versioned.Interface, ns string, filter *BuildPodInfoFilter) ([]v1.PipelineActivity, error) {
+	return ListPipelineActivities(ctx, jxClient, ns, filter.labels(), 0)
+}
+
+// ListPipelineActivities lists the PipelineActivities of the namespace a page at a time which have all the label
+// values along with those missing one of the labels so that the caller can filter them on their spec instead.
+// Blank values and values which are not valid label values are not used to select the activities
+func ListPipelineActivities(ctx context.Context, jxClient versioned.Interface, ns string, labelValues map[string]string, pageSize int64) ([]v1.PipelineActivity, error) {
+	set := toLabelSet(labelValues)
+	answer, err := listPipelineActivities(ctx, jxClient, ns, toLabelSelector(set), pageSize)
+	if err != nil {
+		return answer, err
+	}
+	names := map[string]bool{}
+	for i := range answer {
+		names[answer[i].Name] = true
+	}
+	for _, selector := range toMissingLabelSelectors(set) {
+		list, err := listPipelineActivities(ctx, jxClient, ns, selector, pageSize)
+		if err != nil {
+			return answer, err
+		}
+		for i := range list {
+			if !names[list[i].Name] {
+				names[list[i].Name] = true
+				answer = append(answer, list[i])
+			}
+		}
+	}
+	return answer, nil
+}
+
+func listPipelineActivities(ctx context.Context, jxClient versioned.Interface, ns, selector string, pageSize int64) ([]v1.PipelineActivity, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	var answer []v1.PipelineActivity
+	opts := metav1.ListOptions{
+		LabelSelector: selector,
+		Limit:         pageSize,
+	}
+	for {
+		list, err := jxClient.JenkinsV1().PipelineActivities(ns).List(ctx, opts)
+		if err != nil {
+			return answer, err
+		}
+		answer = append(answer, list.Items...)
+		opts.Continue = list.Continue
+		if opts.Continue == "" {
+			return answer, nil
+		}
+	}
+}
@@ -1,12 +1,13 @@
 package tektonlog
 
 import (
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/sourcerepos"
 	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 )
 
 const (
 	// LastBuildNumberAnnotationPrefix used to annotate SourceRepository with the latest build number for a branch
-	LastBuildNumberAnnotationPrefix = "jenkins.io/last-build-number-for-"
+	LastBuildNumberAnnotationPrefix = sourcerepos.LastBuildNumberAnnotationPrefix
 
 	// LabelOwner is the label added to Tekton CRDs for the owner of the repository being built.
 	LabelOwner = v1.LabelOwner
@@ -23,6 +24,21 @@ const (
 	// LabelContext is the label added to Tekton CRDs for the context being built.
 	LabelContext = "context"
 
+	// LabelLighthouseOwner is the label lighthouse adds to PipelineRuns for the owner of the repository being built.
+	LabelLighthouseOwner = "lighthouse.jenkins-x.io/refs.org"
+
+	// LabelLighthouseRepo is the label lighthouse adds to PipelineRuns for the repository being built.
+	LabelLighthouseRepo = "lighthouse.jenkins-x.io/refs.repo"
+
+	// LabelLighthouseBranch is the label lighthouse adds to PipelineRuns for the branch being built.
+	LabelLighthouseBranch = "lighthouse.jenkins-x.io/branch"
+
+	// LabelLighthouseContext is the label lighthouse adds to PipelineRuns for the context being built.
+	LabelLighthouseContext = "lighthouse.jenkins-x.io/context"
+
+	// DefaultPageSize the default number of resources to load per List call
+	DefaultPageSize = 500
+
 	// LabelType is the label added to Tekton CRDs for the type of pipeline.
 	LabelType = "jenkins.io/pipelineType"
 
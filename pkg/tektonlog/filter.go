@@ -3,7 +3,13 @@ package tektonlog
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
 
 	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/giturl"
@@ -57,6 +63,123 @@ func (o *BuildPodInfoFilter) Matches(pa *v1.PipelineActivity) bool {
 	return true
 }
 
+// MatchesWindow returns true if the PipelineActivity matches the filter, its name or pipeline contains the Filter
+// text and it started within the window before now. A zero window matches activities started at any time
+func (o *BuildPodInfoFilter) MatchesWindow(pa *v1.PipelineActivity, window time.Duration, now time.Time) bool {
+	return o.Matches(pa) && o.MatchesText(pa.Name, pa.Spec.Pipeline) && StartedWithin(pa.Spec.StartedTimestamp, window, now)
+}
+
+// MatchesText returns true if there is no Filter text or one of the values contains it
+func (o *BuildPodInfoFilter) MatchesText(values ...string) bool {
+	if o == nil || o.Filter == "" {
+		return true
+	}
+	for _, v := range values {
+		if strings.Contains(v, o.Filter) {
+			return true
+		}
+	}
+	return false
+}
+
+// StartedWithin returns true if the start time is within the window before now. A zero window matches any start time
+func StartedWithin(started *metav1.Time, window time.Duration, now time.Time) bool {
+	if window <= 0 {
+		return true
+	}
+	return started != nil && !started.Time.Before(now.Add(-window))
+}
+
+// NeedsTaskRuns returns true if the filter uses the pod name or status of the activity which are only known
+// once the TaskRuns of its PipelineRuns have been loaded
+func (o *BuildPodInfoFilter) NeedsTaskRuns() bool {
+	return o != nil && (o.Pod != "" || o.Pending)
+}
+
+// WithoutTaskRuns returns a copy of the filter without the fields which need the TaskRuns to be loaded so that
+// the candidate activities can be found before loading them
+func (o *BuildPodInfoFilter) WithoutTaskRuns() *BuildPodInfoFilter {
+	if o == nil {
+		return nil
+	}
+	answer := *o
+	answer.Pod = ""
+	answer.Pending = false
+	return &answer
+}
+
+// LabelSelector returns the label selector for the owner, repository and branch of the filter so that the
+// filtering can be done on the server. Values which are not valid label values are left to Matches
+func (o *BuildPodInfoFilter) LabelSelector() string {
+	return toLabelSelector(o.labels())
+}
+
+// MissingLabelSelectors returns the label selectors for the resources which do not have one of the labels used
+// by LabelSelector so that they can be filtered using Matches instead
+func (o *BuildPodInfoFilter) MissingLabelSelectors() []string {
+	return toMissingLabelSelectors(o.labels())
+}
+
+// PipelineRunLabelSelector returns the label selector for PipelineRuns which also includes the context
+func (o *BuildPodInfoFilter) PipelineRunLabelSelector() string {
+	return toLabelSelector(o.pipelineRunLabels())
+}
+
+// PipelineRunMissingLabelSelectors returns the label selectors for the PipelineRuns which do not have one of the
+// labels used by PipelineRunLabelSelector
+func (o *BuildPodInfoFilter) PipelineRunMissingLabelSelectors() []string {
+	return toMissingLabelSelectors(o.pipelineRunLabels())
+}
+
+func (o *BuildPodInfoFilter) labels() labels.Set {
+	if o == nil {
+		return nil
+	}
+	return toLabelSet(map[string]string{
+		LabelLighthouseOwner:  o.Owner,
+		LabelLighthouseRepo:   o.Repository,
+		LabelLighthouseBranch: o.Branch,
+	})
+}
+
+func (o *BuildPodInfoFilter) pipelineRunLabels() labels.Set {
+	if o == nil {
+		return nil
+	}
+	return toLabelSet(map[string]string{
+		LabelLighthouseOwner:   o.Owner,
+		LabelLighthouseRepo:    o.Repository,
+		LabelLighthouseBranch:  o.Branch,
+		LabelLighthouseContext: o.Context,
+	})
+}
+
+func toLabelSet(m map[string]string) labels.Set {
+	set := labels.Set{}
+	for k, v := range m {
+		if v != "" && len(validation.IsValidLabelValue(v)) == 0 {
+			set[k] = v
+		}
+	}
+	return set
+}
+
+func toLabelSelector(set labels.Set) string {
+	if len(set) == 0 {
+		return ""
+	}
+	return labels.SelectorFromSet(set).String()
+}
+
+func toMissingLabelSelectors(set labels.Set) []string {
+	var answer []string
+	for k := range set {
+		answer = append(answer, "!"+k)
+	}
+	sort.Strings(answer)
+	return answer
+}
+
 // AddFlags adds the CLI flags for filtering
 func (o *BuildPodInfoFilter) AddFlags(cmd *cobra.Command) {
 	cmd.Flags().BoolVarP(&o.Pending, "pending", "p", false, "Only include pipeline pods which are currently pending to choose from if no build name is supplied")
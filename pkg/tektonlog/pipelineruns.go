@@ -0,0 +1,65 @@
+package tektonlog
+
+import (
+	"context"
+
+	"github.com/jenkins-x-plugins/jx-pipeline/pkg/pipelines"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ListFilteredPipelineRuns lists the PipelineRuns of the namespace which match the owner, repository, branch and
+// context labels of the filter along with those missing the labels so that they can be filtered on their spec instead
+func ListFilteredPipelineRuns(ctx context.Context, tektonClient tektonclient.Interface, ns, apiVersion string, filter *BuildPodInfoFilter) ([]pipelinev1.PipelineRun, error) {
+	return ListPipelineRuns(ctx, tektonClient, ns, apiVersion, filter.pipelineRunLabels(), 0)
+}
+
+// ListPipelineRuns lists the PipelineRuns of the namespace a page at a time using the given API version which have
+// all the label values along with those missing one of the labels so that the caller can filter them instead
+func ListPipelineRuns(ctx context.Context, tektonClient tektonclient.Interface, ns, apiVersion string, labelValues map[string]string, pageSize int64) ([]pipelinev1.PipelineRun, error) {
+	set := toLabelSet(labelValues)
+	answer, err := listPipelineRuns(ctx, tektonClient, ns, apiVersion, toLabelSelector(set), pageSize)
+	if err != nil {
+		return answer, err
+	}
+	names := map[string]bool{}
+	for i := range answer {
+		names[answer[i].Name] = true
+	}
+	for _, selector := range toMissingLabelSelectors(set) {
+		list, err := listPipelineRuns(ctx, tektonClient, ns, apiVersion, selector, pageSize)
+		if err != nil {
+			return answer, err
+		}
+		for i := range list {
+			if !names[list[i].Name] {
+				names[list[i].Name] = true
+				answer = append(answer, list[i])
+			}
+		}
+	}
+	return answer, nil
+}
+
+func listPipelineRuns(ctx context.Context, tektonClient tektonclient.Interface, ns, apiVersion, selector string, pageSize int64) ([]pipelinev1.PipelineRun, error) {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	var answer []pipelinev1.PipelineRun
+	opts := metav1.ListOptions{
+		LabelSelector: selector,
+		Limit:         pageSize,
+	}
+	for {
+		list, err := pipelines.ListPipelineRuns(ctx, tektonClient, ns, apiVersion, opts)
+		if err != nil {
+			return answer, err
+		}
+		answer = append(answer, list.Items...)
+		opts.Continue = list.Continue
+		if opts.Continue == "" {
+			return answer, nil
+		}
+	}
+}
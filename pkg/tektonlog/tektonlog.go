@@ -20,7 +20,6 @@ import (
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube/pods"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/termcolor"
 	"github.com/jenkins-x/jx-logging/v3/pkg/log"
-	"github.com/jenkins-x/lighthouse/pkg/clients"
 	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
 	tektonclient "github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
 	corev1 "k8s.io/api/core/v1"
@@ -43,6 +42,8 @@ type TektonLogger struct {
 	BytesLimit         int64
 	FailIfPodFails     bool
 	StorageReadTimeout time.Duration
+	PageSize           int64
+	APIVersion         string
 	LogsRetrieverFunc  retrieverFunc
 	err                error
 }
@@ -64,6 +65,8 @@ type LogLine struct {
 }
 
 func (t *TektonLogger) GetLogsForActivity(ctx context.Context, out io.Writer, pa *v1.PipelineActivity, name string, prList []*pipelinev1.PipelineRun) error {
+	t.ResolvePipelineActivity(pa, prList)
+
 	if pa.Spec.BuildLogsURL != "" && pa.Spec.Status != v1.ActivityStatusTypeRunning {
 		for line := range t.StreamPipelinePersistentLogs(pa.Spec.BuildLogsURL) {
 			fmt.Fprintln(out, line.Line)
@@ -80,26 +83,34 @@ func (t *TektonLogger) GetLogsForActivity(ctx context.Context, out io.Writer, pa
 	return t.Err()
 }
 
-// GetTektonPipelinesWithActivePipelineActivity returns list of all PipelineActivities with corresponding Tekton PipelineRuns ordered by the PipelineRun creation timestamp and a map to obtain its reference once a name has been selected
+// GetTektonPipelinesWithActivePipelineActivity returns list of all PipelineActivities with corresponding Tekton PipelineRuns ordered by the PipelineRun creation timestamp and a map to obtain its reference once a name has been selected.
+//
+// The owner, repository, branch and context of the filter are used as label selectors with the resources which do not
+// have those labels being filtered on the client. The PipelineActivities are not updated from the TaskRuns of their
+// PipelineRuns unless the filter uses the pod or pending status, in which case only the candidate activities are
+// resolved; otherwise use ResolvePipelineActivity once a name has been selected
 func (t *TektonLogger) GetTektonPipelinesWithActivePipelineActivity(ctx context.Context, filter *BuildPodInfoFilter) ([]string, map[string]*v1.PipelineActivity, map[string][]*pipelinev1.PipelineRun, error) {
-	paList, err := t.JXClient.JenkinsV1().PipelineActivities(t.Namespace).List(ctx, metav1.ListOptions{})
+	paList, err := t.listFilteredPipelineActivities(ctx, filter)
 	if err != nil && !apierrors.IsNotFound(err) {
 		return nil, nil, nil, fmt.Errorf("there was a problem getting the PipelineActivities: %w", err)
 	}
 
 	paNameMap := make(map[string]*v1.PipelineActivity)
-	for i := range paList.Items {
-		p := &paList.Items[i]
+	for i := range paList {
+		p := &paList[i]
 		paNameMap[p.Name] = p
 	}
 
-	tektonPRs, _ := t.TektonClient.TektonV1().PipelineRuns(t.Namespace).List(ctx, metav1.ListOptions{})
-	log.Logger().Debugf("found %d PipelineRuns in namespace %s", len(tektonPRs.Items), t.Namespace)
+	tektonPRs, err := t.listFilteredPipelineRuns(ctx, filter)
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Logger().Warnf("failed to list PipelineRuns in namespace %s: %v", t.Namespace, err)
+	}
+	log.Logger().Debugf("found %d PipelineRuns in namespace %s", len(tektonPRs), t.Namespace)
 
 	prMap := make(map[string][]*pipelinev1.PipelineRun)
-	for i := range tektonPRs.Items {
-		p := &tektonPRs.Items[i]
-		paName := pipelines.ToPipelineActivityName(p, paList.Items)
+	for i := range tektonPRs {
+		p := &tektonPRs[i]
+		paName := pipelines.ToPipelineActivityName(p, paList)
 		if paName == "" {
 			continue
 		}
@@ -107,12 +118,13 @@ func (t *TektonLogger) GetTektonPipelinesWithActivePipelineActivity(ctx context.
 		if pa == nil {
 			pa = &v1.PipelineActivity{}
 			pa.Name = paName
+			pa.CreationTimestamp = p.CreationTimestamp
+			pipelines.UpdatePipelineActivityMetadata(p, pa)
+			if pa.Spec.Status == v1.ActivityStatusTypeNone {
+				pa.Spec.Status = pipelines.ToPipelineRunStatus(p)
+			}
 			paNameMap[paName] = pa
 		}
-		err = pipelines.ToPipelineActivity(t.TektonClient, p, pa, false)
-		if err != nil {
-			log.Logger().Warnf("failed to get PipelineActivity: %v", err)
-		}
 
 		fullBuildName := createPipelineActivityName(pa)
 		prMap[fullBuildName] = append(prMap[fullBuildName], p)
@@ -132,12 +144,24 @@ func (t *TektonLogger) GetTektonPipelinesWithActivePipelineActivity(ctx context.
 		paMap[createPipelineActivityName(p)] = p
 	}
 
+	// the pod name and status are only known once the TaskRuns have been loaded so lets only resolve the candidates
+	candidateFilter := filter
+	if filter.NeedsTaskRuns() {
+		candidateFilter = filter.WithoutTaskRuns()
+	}
+
 	var names []string
 	for _, pa := range sortedPA {
-		if !filter.Matches(pa) {
+		if !candidateFilter.Matches(pa) {
 			continue
 		}
 		paName := createPipelineActivityName(pa)
+		if filter.NeedsTaskRuns() {
+			t.ResolvePipelineActivity(pa, prMap[paName])
+			if !filter.Matches(pa) {
+				continue
+			}
+		}
 		if _, exists := prMap[paName]; exists {
 			hasNonPendingPR := false
 			for _, pr := range prMap[paName] {
@@ -156,6 +180,44 @@ func (t *TektonLogger) GetTektonPipelinesWithActivePipelineActivity(ctx context.
 	return names, paMap, prMap, nil
 }
 
+// ResolvePipelineActivity updates the PipelineActivity with the latest status of the stages of its PipelineRuns.
+// This loads the TaskRuns of the PipelineRuns so should only be used for the activities the user has selected
+func (t *TektonLogger) ResolvePipelineActivity(pa *v1.PipelineActivity, prList []*pipelinev1.PipelineRun) {
+	for _, pr := range prList {
+		err := pipelines.ToPipelineActivity(t.TektonClient, pr, pa, false)
+		if err != nil {
+			log.Logger().Warnf("failed to get PipelineActivity: %v", err)
+		}
+	}
+}
+
+// listFilteredPipelineActivities lists the PipelineActivities matching the label selector of the filter along with
+// those which do not have the labels so that they can be filtered using Matches
+func (t *TektonLogger) listFilteredPipelineActivities(ctx context.Context, filter *BuildPodInfoFilter) ([]v1.PipelineActivity, error) {
+	return ListPipelineActivities(ctx, t.JXClient, t.Namespace, filter.labels(), t.pageSize())
+}
+
+// listFilteredPipelineRuns lists the PipelineRuns matching the label selector of the filter along with those which
+// do not have the labels
+func (t *TektonLogger) listFilteredPipelineRuns(ctx context.Context, filter *BuildPodInfoFilter) ([]pipelinev1.PipelineRun, error) {
+	return ListPipelineRuns(ctx, t.TektonClient, t.Namespace, t.apiVersion(), filter.pipelineRunLabels(), t.pageSize())
+}
+
+// apiVersion returns the Tekton API version to read resources with, using discovery if it has not been specified
+func (t *TektonLogger) apiVersion() string {
+	if t.APIVersion == "" {
+		t.APIVersion = pipelines.ServedAPIVersion(t.TektonClient)
+	}
+	return t.APIVersion
+}
+
+func (t *TektonLogger) pageSize() int64 {
+	if t.PageSize > 0 {
+		return t.PageSize
+	}
+	return DefaultPageSize
+}
+
 // GetPipelineActivityForPipelineRun returns the PipelineActivity for the PipelineRun if it can be found
 func GetPipelineActivityForPipelineRun(ctx context.Context, activityInterface typev1.PipelineActivityInterface, pr *pipelinev1.PipelineRun) (*v1.PipelineActivity, error) {
 	resources, err := activityInterface.List(ctx, metav1.ListOptions{})
@@ -220,6 +282,8 @@ type stageTime struct {
 	skipped   bool
 	podExists bool
 	completed bool
+	customRun bool
+	status    v1.ActivityStatusType
 }
 
 func (t *TektonLogger) getRunningBuildLogs(ctx context.Context, pa *v1.PipelineActivity, pipelineRuns []*pipelinev1.PipelineRun, buildName string, out chan<- LogLine) error {
@@ -240,7 +304,15 @@ func (t *TektonLogger) getRunningBuildLogs(ctx context.Context, pa *v1.PipelineA
 			if completedStages[stageName] {
 				continue
 			}
-			if stage.podExists {
+			if stage.customRun {
+				// a CustomRun has no pod so lets just report its status once it completes
+				if stage.completed {
+					completedStages[stageName] = true
+					out <- LogLine{
+						Line: fmt.Sprintf("\nShowing status for build %v stage %s which is a CustomRun without logs: %s", info(buildName), info(stageName), stage.status),
+					}
+				}
+			} else if stage.podExists {
 				log.Logger().Infof("logging pod: %s for task %s", info(podName), stageName)
 
 				pod, err := t.KubeClient.CoreV1().Pods(t.Namespace).Get(ctx, podName, metav1.GetOptions{})
@@ -261,7 +333,7 @@ func (t *TektonLogger) getRunningBuildLogs(ctx context.Context, pa *v1.PipelineA
 
 				err = pods.WaitForPodNameToBeComplete(t.KubeClient, t.Namespace, podName, 1*time.Second)
 				if err == nil {
-					completedStages[podName] = true
+					completedStages[stageName] = true
 				}
 
 			} else if stage.skipped || stage.completed {
@@ -291,34 +363,36 @@ func (t *TektonLogger) getRunningBuildLogs(ctx context.Context, pa *v1.PipelineA
 func (t *TektonLogger) collectStages(ctx context.Context, pipelineRuns []*pipelinev1.PipelineRun) ([]stageTime, error) {
 	var stageTimes []stageTime
 	for _, pr := range pipelineRuns {
-		if pr.Status.PipelineSpec != nil {
-			for k := range pr.Status.PipelineSpec.Tasks {
-				taskStatus := pr.Status.PipelineSpec.Tasks[k]
-				podTime, err := findExecutedOrSkippedStagesStage(t.Namespace, taskStatus.Name, pr)
-				if err != nil {
-					return nil, fmt.Errorf("failed to get stage %s: %w", taskStatus.Name, err)
-				}
-				stageTimes = append(stageTimes, podTime)
-			}
-		} else if pr.Spec.PipelineRef != nil && pr.Spec.PipelineRef.Name != "" {
+		taskRuns, err := pipelines.NewTaskRunLoader(ctx, t.TektonClient, t.Namespace, pr)
+		if err != nil {
+			return nil, err
+		}
+		ps := pr.Status.PipelineSpec
+		if ps == nil && pr.Spec.PipelineRef != nil && pr.Spec.PipelineRef.Name != "" {
 			// if the tasks definition is not available in the PipelineRun, let's retrieve it from the Pipeline itself
-			pipeline, err := t.TektonClient.TektonV1().Pipelines(t.Namespace).Get(ctx, pr.Spec.PipelineRef.Name, metav1.GetOptions{})
+			pipeline, err := pipelines.GetPipeline(ctx, t.TektonClient, t.Namespace, t.apiVersion(), pr.Spec.PipelineRef.Name)
 			if err != nil {
 				return nil, err
 			}
-			for k := range pipeline.Spec.Tasks {
-				task := pipeline.Spec.Tasks[k]
-				podTime, err := findExecutedOrSkippedStagesStage(t.Namespace, task.Name, pr)
+			ps = &pipeline.Spec
+		}
+		if ps == nil {
+			log.Logger().Warningf("Could not retrieve tasks for PipelineRun %s", pr.Name)
+			continue
+		}
+		namer := pipelines.NewChildStageNamer(pr)
+		for _, tasks := range [][]pipelinev1.PipelineTask{ps.Tasks, ps.Finally} {
+			for k := range tasks {
+				task := &tasks[k]
+				podTimes, err := findExecutedOrSkippedStages(ctx, taskRuns, namer, task.Name, pr)
 				if err != nil {
 					return nil, fmt.Errorf("failed to get stage %s: %w", task.Name, err)
 				}
-				stageTimes = append(stageTimes, podTime)
+				stageTimes = append(stageTimes, podTimes...)
 			}
-		} else {
-			log.Logger().Warningf("Could not retrieve tasks for PipelineRun %s", pr.Name)
 		}
 	}
-	sort.Slice(stageTimes, func(i, j int) bool {
+	sort.SliceStable(stageTimes, func(i, j int) bool {
 		t1 := stageTimes[i].startTime
 		t2 := stageTimes[j].startTime
 		if t1 == nil && t2 == nil {
@@ -336,36 +410,58 @@ func (t *TektonLogger) collectStages(ctx context.Context, pipelineRuns []*pipeli
 	return stageTimes, nil
 }
 
-func findExecutedOrSkippedStagesStage(namespace, taskName string, pr *pipelinev1.PipelineRun) (stageTime, error) {
-	tektonClient, _, _, _, err := clients.GetAPIClients()
-	if err != nil {
-		return stageTime{}, err
-	}
-	for _, childReference := range pr.Status.ChildReferences {
-		if taskName == childReference.PipelineTaskName {
-			taskrun, err := tektonClient.TektonV1().TaskRuns(namespace).Get(context.TODO(), childReference.Name, metav1.GetOptions{})
+// findExecutedOrSkippedStages returns a stage for each TaskRun or CustomRun of the pipeline task so that every
+// instance of a matrix fan-out is logged
+func findExecutedOrSkippedStages(ctx context.Context, taskRuns *pipelines.TaskRunLoader, namer *pipelines.ChildStageNamer, taskName string, pr *pipelinev1.PipelineRun) ([]stageTime, error) {
+	var answer []stageTime
+	for i := range pr.Status.ChildReferences {
+		childReference := &pr.Status.ChildReferences[i]
+		if taskName != childReference.PipelineTaskName {
+			continue
+		}
+		if pipelines.IsCustomRun(childReference) {
+			customRun, err := taskRuns.GetCustomRun(ctx, childReference.Name)
 			if err != nil {
-				return stageTime{}, fmt.Errorf("failed to get TaskRun %s in namespace %s: %w", childReference.Name, namespace, err)
+				return nil, err
 			}
-			return stageTime{
-				podName:   taskrun.Status.PodName,
-				startTime: taskrun.Status.StartTime,
-				task:      taskName,
-				podExists: taskrun.Status.PodName != "",
-				completed: taskrun.Status.CompletionTime != nil,
-			}, nil
+			answer = append(answer, stageTime{
+				startTime: customRun.Status.StartTime,
+				task:      namer.StageName(childReference, pipelines.CustomRunParams(customRun)),
+				completed: customRun.Status.CompletionTime != nil,
+				customRun: true,
+				status:    pipelines.ToCustomRunStatus(customRun),
+			})
+			continue
 		}
+		taskrun, err := taskRuns.Get(ctx, childReference.Name)
+		if err != nil {
+			return nil, err
+		}
+		answer = append(answer, stageTime{
+			podName:   taskrun.Status.PodName,
+			startTime: taskrun.Status.StartTime,
+			task:      namer.StageName(childReference, pipelines.TaskRunParams(taskrun)),
+			podExists: taskrun.Status.PodName != "",
+			completed: taskrun.Status.CompletionTime != nil,
+		})
+	}
+	if len(answer) > 0 {
+		return answer, nil
 	}
 	for _, taskStatus := range pr.Status.SkippedTasks {
 		if taskName == taskStatus.Name {
-			return stageTime{
-				skipped: true,
-				task:    taskName,
+			return []stageTime{
+				{
+					skipped: true,
+					task:    taskName,
+				},
 			}, nil
 		}
 	}
-	return stageTime{
-		task: taskName,
+	return []stageTime{
+		{
+			task: taskName,
+		},
 	}, nil
 }
 
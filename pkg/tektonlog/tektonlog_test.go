@@ -0,0 +1,374 @@
+package tektonlog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "github.com/jenkins-x/jx-api/v4/pkg/apis/jenkins.io/v1"
+	jxfake "github.com/jenkins-x/jx-api/v4/pkg/client/clientset/versioned/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pipelinev1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1"
+	pipelinev1beta1 "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	tektonfake "github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"knative.dev/pkg/apis"
+)
+
+func TestBuildPodInfoFilterLabelSelector(t *testing.T) {
+	filter := &BuildPodInfoFilter{
+		Owner:      "myorg",
+		Repository: "myrepo",
+		Branch:     "PR-123",
+		Context:    "pr-build",
+	}
+	assert.Equal(t, "lighthouse.jenkins-x.io/branch=PR-123,lighthouse.jenkins-x.io/refs.org=myorg,lighthouse.jenkins-x.io/refs.repo=myrepo", filter.LabelSelector())
+	assert.Equal(t, "lighthouse.jenkins-x.io/branch=PR-123,lighthouse.jenkins-x.io/context=pr-build,lighthouse.jenkins-x.io/refs.org=myorg,lighthouse.jenkins-x.io/refs.repo=myrepo", filter.PipelineRunLabelSelector())
+
+	filter = &BuildPodInfoFilter{Branch: "feature/cheese"}
+	assert.Equal(t, "", filter.LabelSelector(), "invalid label values should be filtered on the client")
+
+	var nilFilter *BuildPodInfoFilter
+	assert.Equal(t, "", nilFilter.LabelSelector())
+}
+
+func TestBuildPodInfoFilterMatchesWindow(t *testing.T) {
+	now := time.Date(2026, time.March, 8, 10, 0, 0, 0, time.UTC)
+	started := metav1.NewTime(now.Add(-2 * time.Hour))
+	pa := &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "myorg-myrepo-main-1",
+		},
+		Spec: v1.PipelineActivitySpec{
+			Pipeline:         "myorg/myrepo/main",
+			GitOwner:         "myorg",
+			GitRepository:    "myrepo",
+			GitBranch:        "main",
+			StartedTimestamp: &started,
+		},
+	}
+
+	var nilFilter *BuildPodInfoFilter
+	assert.True(t, nilFilter.MatchesWindow(pa, 0, now))
+
+	filter := &BuildPodInfoFilter{Repository: "myrepo", Filter: "myorg/myrepo"}
+	assert.True(t, filter.MatchesWindow(pa, 0, now), "should match the pipeline")
+	assert.True(t, filter.MatchesWindow(pa, 3*time.Hour, now), "should match within the window")
+	assert.False(t, filter.MatchesWindow(pa, time.Hour, now), "should not match outside of the window")
+
+	filter = &BuildPodInfoFilter{Filter: "cheese"}
+	assert.False(t, filter.MatchesWindow(pa, 0, now), "should not match the filter text")
+
+	filter = &BuildPodInfoFilter{Repository: "cheese"}
+	assert.False(t, filter.MatchesWindow(pa, 0, now), "should not match the repository")
+
+	assert.False(t, StartedWithin(nil, time.Hour, now), "should not match without a start time")
+	assert.True(t, StartedWithin(nil, 0, now), "should match without a window")
+}
+
+func TestListPipelineActivitiesWithoutLabels(t *testing.T) {
+	ns := "jx"
+	newActivity := func(name, repo string, labels map[string]string) *v1.PipelineActivity {
+		return &v1.PipelineActivity{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    labels,
+			},
+			Spec: v1.PipelineActivitySpec{
+				GitOwner:      "myorg",
+				GitRepository: repo,
+			},
+		}
+	}
+	jxClient := jxfake.NewSimpleClientset(
+		newActivity("myorg-myrepo-main-1", "myrepo", map[string]string{LabelLighthouseRepo: "myrepo"}),
+		newActivity("myorg-myrepo-main-2", "myrepo", nil),
+		newActivity("myorg-other-main-1", "other", map[string]string{LabelLighthouseRepo: "other"}),
+	)
+
+	list, err := ListFilteredPipelineActivities(context.Background(), jxClient, ns, &BuildPodInfoFilter{Repository: "myrepo"})
+	require.NoError(t, err)
+
+	var names []string
+	for i := range list {
+		names = append(names, list[i].Name)
+	}
+	assert.ElementsMatch(t, []string{"myorg-myrepo-main-1", "myorg-myrepo-main-2"}, names, "should include the activities without the label")
+}
+
+func TestGetTektonPipelinesWithActivePipelineActivityIsLazy(t *testing.T) {
+	ctx := context.Background()
+	jxClient := jxfake.NewSimpleClientset(
+		newActivity("myorg-repo-a-master-1", "myorg", "repo-a", "master", "1"),
+		newActivity("myorg-repo-b-master-1", "myorg", "repo-b", "master", "1"),
+	)
+	tektonClient := tektonfake.NewSimpleClientset(
+		newPipelineRun("repo-a-1", "myorg", "repo-a", "master", "1", "repo-a-1-build"),
+		newPipelineRun("repo-a-2", "myorg", "repo-a", "master", "2", "repo-a-2-build"),
+		newPipelineRun("repo-b-1", "myorg", "repo-b", "master", "1", "repo-b-1-build"),
+		newTaskRun("repo-a-1-build", "repo-a-1"),
+		newTaskRun("repo-a-2-build", "repo-a-2"),
+		newTaskRun("repo-b-1-build", "repo-b-1"),
+	)
+	tektonClient.ClearActions()
+	jxClient.ClearActions()
+
+	logger := &TektonLogger{
+		JXClient:     jxClient,
+		TektonClient: tektonClient,
+		Namespace:    ns,
+		PageSize:     10,
+	}
+	names, paMap, prMap, err := logger.GetTektonPipelinesWithActivePipelineActivity(ctx, &BuildPodInfoFilter{Repository: "repo-a"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"myorg/repo-a/master #1", "myorg/repo-a/master #2"}, names)
+
+	selectors := []string{"lighthouse.jenkins-x.io/refs.repo=repo-a", "!lighthouse.jenkins-x.io/refs.repo"}
+	for _, action := range jxClient.Actions() {
+		list, ok := action.(k8stesting.ListAction)
+		require.True(t, ok, "unexpected action %#v", action)
+		assert.Contains(t, selectors, list.GetListRestrictions().Labels.String())
+	}
+	for _, action := range tektonClient.Actions() {
+		if action.GetResource().Resource == "resource" {
+			// discovery of the served Tekton API version
+			continue
+		}
+		assert.Equal(t, "pipelineruns", action.GetResource().Resource, "should not load TaskRuns until a build is selected")
+		list, ok := action.(k8stesting.ListAction)
+		require.True(t, ok, "unexpected action %#v", action)
+		assert.Contains(t, selectors, list.GetListRestrictions().Labels.String())
+	}
+
+	pa := paMap["myorg/repo-a/master #2"]
+	require.NotNil(t, pa, "should have created an activity for the PipelineRun without one")
+	assert.Equal(t, v1.ActivityStatusTypeRunning, pa.Spec.Status)
+	assert.Empty(t, pa.Spec.Steps)
+
+	tektonClient.ClearActions()
+	logger.ResolvePipelineActivity(pa, prMap["myorg/repo-a/master #2"])
+
+	actions := tektonClient.Actions()
+	require.Len(t, actions, 1, "should load the TaskRuns with a single List")
+	assert.Equal(t, "list", actions[0].GetVerb())
+	assert.Equal(t, "taskruns", actions[0].GetResource().Resource)
+	assert.Equal(t, "tekton.dev/pipelineRun=repo-a-2", actions[0].(k8stesting.ListAction).GetListRestrictions().Labels.String())
+	assert.Equal(t, "repo-a-2-build-pod", pa.Labels["podName"])
+	require.Len(t, pa.Spec.Steps, 1)
+	assert.Equal(t, "build", pa.Spec.Steps[0].Stage.Name)
+}
+
+func TestGetTektonPipelinesWithActivePipelineActivityWithoutLabels(t *testing.T) {
+	ctx := context.Background()
+	unlabelled := newActivity("myorg-repo-a-master-3", "myorg", "repo-a", "master", "3")
+	unlabelled.Labels = nil
+	unlabelled.Spec.Status = v1.ActivityStatusTypeSucceeded
+	completed := metav1.Now()
+	unlabelled.Spec.CompletedTimestamp = &completed
+	other := newActivity("myorg-repo-b-master-1", "myorg", "repo-b", "master", "1")
+	other.Labels = nil
+	other.Spec.CompletedTimestamp = &completed
+
+	jxClient := jxfake.NewSimpleClientset(
+		newActivity("myorg-repo-a-master-1", "myorg", "repo-a", "master", "1"),
+		unlabelled,
+		other,
+	)
+	tektonClient := tektonfake.NewSimpleClientset(
+		newPipelineRun("repo-a-1", "myorg", "repo-a", "master", "1", "repo-a-1-build"),
+		newTaskRun("repo-a-1-build", "repo-a-1"),
+	)
+	logger := &TektonLogger{
+		JXClient:     jxClient,
+		TektonClient: tektonClient,
+		Namespace:    ns,
+	}
+	names, _, _, err := logger.GetTektonPipelinesWithActivePipelineActivity(ctx, &BuildPodInfoFilter{Repository: "repo-a"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"myorg/repo-a/master #1", "myorg/repo-a/master #3"}, names, "should filter the activities without labels on the client")
+}
+
+func TestGetTektonPipelinesWithActivePipelineActivityFiltersPodAndPending(t *testing.T) {
+	ctx := context.Background()
+	jxClient := jxfake.NewSimpleClientset(
+		newActivity("myorg-repo-a-master-1", "myorg", "repo-a", "master", "1"),
+		newActivity("myorg-repo-a-master-2", "myorg", "repo-a", "master", "2"),
+	)
+	tektonClient := tektonfake.NewSimpleClientset(
+		newPipelineRun("repo-a-1", "myorg", "repo-a", "master", "1", "repo-a-1-build"),
+		newPipelineRun("repo-a-2", "myorg", "repo-a", "master", "2", "repo-a-2-build"),
+		newTaskRun("repo-a-1-build", "repo-a-1"),
+		newTaskRun("repo-a-2-build", "repo-a-2"),
+	)
+	logger := &TektonLogger{
+		JXClient:     jxClient,
+		TektonClient: tektonClient,
+		Namespace:    ns,
+	}
+	names, paMap, _, err := logger.GetTektonPipelinesWithActivePipelineActivity(ctx, &BuildPodInfoFilter{Pod: "repo-a-2-build-pod"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"myorg/repo-a/master #2"}, names)
+	assert.Equal(t, "repo-a-2-build-pod", paMap["myorg/repo-a/master #2"].Labels["podName"])
+
+	names, _, _, err = logger.GetTektonPipelinesWithActivePipelineActivity(ctx, &BuildPodInfoFilter{Pending: true})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"myorg/repo-a/master #1", "myorg/repo-a/master #2"}, names, "running builds are not terminated")
+}
+
+func TestCollectStagesIncludesFinallyMatrixAndCustomRuns(t *testing.T) {
+	ctx := context.Background()
+	pr := newPipelineRun("repo-a-1", "myorg", "repo-a", "master", "1", "repo-a-1-build-0")
+	pr.Status.PipelineSpec = &pipelinev1.PipelineSpec{
+		Tasks: []pipelinev1.PipelineTask{
+			{
+				Name: "build",
+				Matrix: &pipelinev1.Matrix{
+					Params: pipelinev1.Params{
+						{Name: "arch", Value: *pipelinev1.NewStructuredValues("amd64", "arm64")},
+					},
+				},
+			},
+			{Name: "approve", RunAfter: []string{"build"}},
+		},
+		Finally: []pipelinev1.PipelineTask{
+			{Name: "notify"},
+		},
+	}
+	pr.Status.ChildReferences = []pipelinev1.ChildStatusReference{
+		{Name: "repo-a-1-build-0", PipelineTaskName: "build"},
+		{Name: "repo-a-1-build-1", PipelineTaskName: "build"},
+		{
+			TypeMeta:         runtime.TypeMeta{APIVersion: "tekton.dev/v1beta1", Kind: "CustomRun"},
+			Name:             "repo-a-1-approve",
+			PipelineTaskName: "approve",
+		},
+		{Name: "repo-a-1-notify", PipelineTaskName: "notify"},
+	}
+
+	withArch := func(tr *pipelinev1.TaskRun, arch string) *pipelinev1.TaskRun {
+		tr.Spec.Params = pipelinev1.Params{
+			{Name: "arch", Value: *pipelinev1.NewStructuredValues(arch)},
+			{Name: "version", Value: *pipelinev1.NewStructuredValues("1.0.0")},
+		}
+		return tr
+	}
+	now := metav1.Now()
+	customRun := &pipelinev1beta1.CustomRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "repo-a-1-approve",
+			Namespace: ns,
+		},
+	}
+	customRun.Status.StartTime = &now
+	customRun.Status.CompletionTime = &now
+	customRun.Status.SetCondition(&apis.Condition{
+		Type:   apis.ConditionSucceeded,
+		Status: "True",
+	})
+
+	tektonClient := tektonfake.NewSimpleClientset(
+		pr,
+		withArch(newTaskRun("repo-a-1-build-0", "repo-a-1"), "amd64"),
+		withArch(newTaskRun("repo-a-1-build-1", "repo-a-1"), "arm64"),
+		newTaskRun("repo-a-1-notify", "repo-a-1"),
+		customRun,
+	)
+	logger := &TektonLogger{
+		TektonClient: tektonClient,
+		Namespace:    ns,
+	}
+	stages, err := logger.collectStages(ctx, []*pipelinev1.PipelineRun{pr})
+	require.NoError(t, err)
+
+	var names []string
+	for _, stage := range stages {
+		names = append(names, stage.task)
+		if stage.task == "approve" {
+			assert.True(t, stage.customRun, "should be a CustomRun")
+			assert.False(t, stage.podExists, "a CustomRun has no pod")
+			assert.True(t, stage.completed)
+			assert.Equal(t, v1.ActivityStatusTypeSucceeded, stage.status)
+		}
+	}
+	assert.ElementsMatch(t, []string{"build [arch=amd64]", "build [arch=arm64]", "approve", "notify"}, names)
+}
+
+func newActivity(name, owner, repo, branch, build string) *v1.PipelineActivity {
+	return &v1.PipelineActivity{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				LabelLighthouseOwner:  owner,
+				LabelLighthouseRepo:   repo,
+				LabelLighthouseBranch: branch,
+			},
+		},
+		Spec: v1.PipelineActivitySpec{
+			GitOwner:      owner,
+			GitRepository: repo,
+			GitBranch:     branch,
+			Build:         build,
+			Status:        v1.ActivityStatusTypeRunning,
+		},
+	}
+}
+
+func newPipelineRun(name, owner, repo, branch, build, taskRunName string) *pipelinev1.PipelineRun {
+	pr := &pipelinev1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				LabelLighthouseOwner:  owner,
+				LabelLighthouseRepo:   repo,
+				LabelLighthouseBranch: branch,
+				"build":               build,
+			},
+		},
+		Status: pipelinev1.PipelineRunStatus{
+			PipelineRunStatusFields: pipelinev1.PipelineRunStatusFields{
+				ChildReferences: []pipelinev1.ChildStatusReference{
+					{
+						Name:             taskRunName,
+						PipelineTaskName: "build",
+					},
+				},
+			},
+		},
+	}
+	pr.Status.SetCondition(&apis.Condition{
+		Type:   apis.ConditionSucceeded,
+		Status: "Unknown",
+		Reason: "Running",
+	})
+	return pr
+}
+
+func newTaskRun(name, prName string) *pipelinev1.TaskRun {
+	now := metav1.Now()
+	return &pipelinev1.TaskRun{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ns,
+			Labels: map[string]string{
+				"tekton.dev/pipelineRun": prName,
+			},
+		},
+		Status: pipelinev1.TaskRunStatus{
+			TaskRunStatusFields: pipelinev1.TaskRunStatusFields{
+				PodName:   name + "-pod",
+				StartTime: &now,
+				Steps: []pipelinev1.StepState{
+					{
+						Name: "make",
+					},
+				},
+			},
+		},
+	}
+}